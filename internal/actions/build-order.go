@@ -1,11 +1,19 @@
 package actions
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"roborok/internal/buildorder"
 	"roborok/internal/common"
+	"roborok/internal/logging"
+	"roborok/internal/metrics"
+	"roborok/internal/planner"
 	"roborok/internal/state"
 	"roborok/internal/utils"
 	"roborok/internal/vision"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -121,37 +129,38 @@ func isMultipleTypeBuilding(buildingType string) bool {
 
 // UpdateMainBuildingPosition updates the position of a main building if not already set
 func UpdateMainBuildingPosition(buildingType string, x, y int, instanceState *state.InstanceState) {
+	fields := logging.Fields{"task": "update_main_building_position", "building": buildingType}
 	switch buildingType {
 	case "farm":
 		// Only set if not already set (X and Y are both zero)
 		if instanceState.BuildingPositions.Farm.X == 0 && instanceState.BuildingPositions.Farm.Y == 0 {
 			instanceState.BuildingPositions.Farm.X = x
 			instanceState.BuildingPositions.Farm.Y = y
-			log.Printf("Set main farm position to (%d, %d)", x, y)
+			logging.Emit(logging.Info, fields, "Set main farm position to (%d, %d)", x, y)
 		}
 	case "quarry":
 		if instanceState.BuildingPositions.Quarry.X == 0 && instanceState.BuildingPositions.Quarry.Y == 0 {
 			instanceState.BuildingPositions.Quarry.X = x
 			instanceState.BuildingPositions.Quarry.Y = y
-			log.Printf("Set main quarry position to (%d, %d)", x, y)
+			logging.Emit(logging.Info, fields, "Set main quarry position to (%d, %d)", x, y)
 		}
 	case "lumber_mill":
 		if instanceState.BuildingPositions.LumberMill.X == 0 && instanceState.BuildingPositions.LumberMill.Y == 0 {
 			instanceState.BuildingPositions.LumberMill.X = x
 			instanceState.BuildingPositions.LumberMill.Y = y
-			log.Printf("Set main lumber mill position to (%d, %d)", x, y)
+			logging.Emit(logging.Info, fields, "Set main lumber mill position to (%d, %d)", x, y)
 		}
 	case "goldmine":
 		if instanceState.BuildingPositions.Goldmine.X == 0 && instanceState.BuildingPositions.Goldmine.Y == 0 {
 			instanceState.BuildingPositions.Goldmine.X = x
 			instanceState.BuildingPositions.Goldmine.Y = y
-			log.Printf("Set main goldmine position to (%d, %d)", x, y)
+			logging.Emit(logging.Info, fields, "Set main goldmine position to (%d, %d)", x, y)
 		}
 	case "hospital":
 		if instanceState.BuildingPositions.Hospital.X == 0 && instanceState.BuildingPositions.Hospital.Y == 0 {
 			instanceState.BuildingPositions.Hospital.X = x
 			instanceState.BuildingPositions.Hospital.Y = y
-			log.Printf("Set main hospital position to (%d, %d)", x, y)
+			logging.Emit(logging.Info, fields, "Set main hospital position to (%d, %d)", x, y)
 		}
 	}
 }
@@ -187,9 +196,11 @@ func ProcessBuildOrder(
 	config common.TaskConfig,
 	instanceState *state.InstanceState,
 ) bool {
+	fields := logging.Fields{"device_id": deviceID, "task": "process_build_order"}
+
 	// Skip if not in city view
 	if gameView != "city" {
-		log.Println("Not in city view, can't process build tasks")
+		logging.Emit(logging.Info, fields, "Not in city view, can't process build tasks")
 		return false
 	}
 
@@ -198,14 +209,14 @@ func ProcessBuildOrder(
 	for _, det := range detections {
 		if det.Class == "builders_hut" && det.Confidence > common.MinConfidence {
 			builderAvailable = true
-			log.Printf("Found idle builder at (%.1f, %.1f) with confidence %.2f",
+			logging.Emit(logging.Info, fields, "Found idle builder at (%.1f, %.1f) with confidence %.2f",
 				det.X, det.Y, det.Confidence)
 			break
 		}
 	}
 
 	if !builderAvailable {
-		log.Println("No builder available, skipping build tasks")
+		logging.Emit(logging.Info, fields, "No builder available, skipping build tasks")
 		return false
 	}
 
@@ -226,15 +237,32 @@ func ProcessBuildOrder(
 		}
 	}
 
+	// Refresh the economy snapshot processBuildOrderWithPlan's economy-aware
+	// scoring reads from, opportunistically, the same way the position
+	// updates above piggyback on whatever this tick already detected.
+	if econ, ok := vision.ExtractEconomy(detections); ok {
+		instanceState.GameState.Economy = econ
+	}
+
+	// A configured goals file takes precedence over a hand-authored build
+	// plan, which in turn replaces the flat UpcomingTasks walk below
+	// entirely; see runBuildOrderGoals and processBuildOrderWithPlan.
+	if goalsPath := effectiveGoalsPath(deviceID); goalsPath != "" {
+		return runBuildOrderGoals(deviceID, gameView, detections, adbPath, config, instanceState, goalsPath)
+	}
+	if planPath := effectiveBuildPlanPath(deviceID); planPath != "" {
+		return processBuildOrderWithPlan(deviceID, gameView, detections, adbPath, config, instanceState, planPath)
+	}
+
 	// Initialize build order if it's empty
 	if len(instanceState.BuildOrder.UpcomingTasks) == 0 {
-		log.Println("Initializing build order tasks")
+		logging.Emit(logging.Info, fields, "Initializing build order tasks")
 		instanceState.BuildOrder.UpcomingTasks = DefineDefaultBuildOrder()
 
 		// Log the initialized task list
-		log.Println("Build order initialized with the following tasks:")
+		logging.Emit(logging.Info, fields, "Build order initialized with the following tasks:")
 		for i, task := range instanceState.BuildOrder.UpcomingTasks {
-			log.Printf("  %d. %s %s", i+1, task.Type, task.Building)
+			logging.Emit(logging.Debug, fields, "  %d. %s %s", i+1, task.Type, task.Building)
 		}
 	}
 
@@ -245,26 +273,39 @@ func ProcessBuildOrder(
 			completedCount++
 		}
 	}
-	log.Printf("Build order status: %d/%d tasks completed",
+	logging.Emit(logging.Info, fields, "Build order status: %d/%d tasks completed",
 		completedCount, len(instanceState.BuildOrder.UpcomingTasks))
 
 	// Loop through tasks until we find ONLY the first non-completed task
 	for i := 0; i < len(instanceState.BuildOrder.UpcomingTasks); i++ {
 		currentTask := &instanceState.BuildOrder.UpcomingTasks[i]
 
-		// Skip completed tasks
-		if currentTask.Completed {
+		// Skip completed or permanently-skipped tasks
+		if currentTask.Completed || currentTask.Skipped {
+			continue
+		}
+
+		if allowed, reason := config.ActionFilter.Allowed(currentTask.Building, planner.DeriveCategory(currentTask.Building)); !allowed {
+			logging.Emit(logging.Info, fields, "Skipping task %s %s: %s", currentTask.Type, currentTask.Building, reason)
 			continue
 		}
 
-		log.Printf("Attempting task %d/%d: %s %s (attempt %d)",
+		logging.Emit(logging.Info, fields, "Attempting task %d/%d: %s %s (attempt %d)",
 			i+1, len(instanceState.BuildOrder.UpcomingTasks),
 			currentTask.Type, currentTask.Building, currentTask.Attempts+1)
 
-		// Check if this task has a cooldown and respect it
-		if !currentTask.LastAttempt.IsZero() && time.Since(currentTask.LastAttempt) < (30*time.Second) {
-			timeRemaining := 30*time.Second - time.Since(currentTask.LastAttempt)
-			log.Printf("Task '%s %s' is on cooldown for %.1f more seconds",
+		// A build_new task mid-BuildFSM (Step already set) is waiting on its
+		// next expected detection, not on the usual inter-attempt cooldown -
+		// skip the cooldown gate so it can advance on the very next tick.
+		inFlight := currentTask.Type == "build_new" && currentTask.Step != ""
+
+		// Check if this task has a cooldown and respect it - Backoff grows
+		// with ConsecutiveFailures (see backoffForFailure) instead of
+		// always being the same flat baseBackoff.
+		cooldown := taskBackoff(currentTask.Backoff)
+		if !inFlight && !currentTask.LastAttempt.IsZero() && time.Since(currentTask.LastAttempt) < cooldown {
+			timeRemaining := cooldown - time.Since(currentTask.LastAttempt)
+			logging.Emit(logging.Info, fields, "Task '%s %s' is on cooldown for %.1f more seconds",
 				currentTask.Type, currentTask.Building, timeRemaining.Seconds())
 			return false
 		}
@@ -272,7 +313,18 @@ func ProcessBuildOrder(
 		success := false
 		switch currentTask.Type {
 		case "build_new":
-			success = BuildNewBuilding(deviceID, gameView, detections, adbPath, currentTask, instanceState)
+			switch BuildNewBuilding(deviceID, gameView, detections, adbPath, currentTask, instanceState) {
+			case BuildDone:
+				success = true
+			case BuildInProgress:
+				// Still walking the BuildFSM; this tick isn't an attempt in
+				// its own right, so don't touch Attempts/LastAttempt below -
+				// just let the next tick continue from currentTask.Step.
+				instanceState.BuildOrder.LastAttemptTime = time.Now()
+				return false
+			case BuildFailed:
+				success = false
+			}
 		case "upgrade":
 			success = UpgradeBuilding(deviceID, gameView, detections, adbPath, currentTask, instanceState)
 		}
@@ -287,329 +339,763 @@ func ProcessBuildOrder(
 		if success {
 			// Mark as completed and add to completed tasks list
 			currentTask.Completed = true
+			resetFailurePolicy(currentTask)
 
 			completedTask := *currentTask
 			instanceState.BuildOrder.CompletedTasks = append(
 				instanceState.BuildOrder.CompletedTasks, completedTask)
 
-			log.Printf("Build task completed: %s %s", currentTask.Type, currentTask.Building)
+			metrics.Default.IncBuildTaskAttempts(currentTask.Building, "success")
+			logging.Emit(logging.Info, fields, "Build task completed: %s %s", currentTask.Type, currentTask.Building)
 
 			return true
 		} else {
-			log.Printf("Build task failed (attempt %d): %s %s",
-				currentTask.Attempts, currentTask.Type, currentTask.Building)
+			applyFailurePolicy(deviceID, adbPath, currentTask)
+			metrics.Default.IncBuildTaskAttempts(currentTask.Building, "failure")
+			logging.Emit(logging.Warning, fields, "Build task failed (attempt %d, %d consecutive): %s %s",
+				currentTask.Attempts, currentTask.ConsecutiveFailures, currentTask.Type, currentTask.Building)
 			return false // Return false after one failure
 		}
 	}
 
-	log.Println("No available tasks (all completed)")
+	logging.Emit(logging.Info, fields, "No available tasks (all completed)")
 	return false
 }
 
-// BuildNewBuilding handles building a new structure
-func BuildNewBuilding(
-	deviceID string,
-	gameView string,
-	detections []common.Detection,
-	adbPath string,
-	task *state.BuildTask,
-	instanceState *state.InstanceState,
-) bool {
-	log.Printf("Starting new building: %s", task.Building)
+// effectiveBuildPlanPath returns the planner.Plan path to use for deviceID:
+// its InstanceConfig override if set, else GlobalConfig.BuildPlanPath.
+// Mirrors manager.Manager.effectiveTaskSpecPath's override precedence for
+// the same reason - one emulator following a different build plan than the
+// rest of the fleet.
+func effectiveBuildPlanPath(deviceID string) string {
+	cfg := utils.GetConfig()
+	if instCfg, ok := cfg.Instances[deviceID]; ok && instCfg.BuildPlanPath != "" {
+		return instCfg.BuildPlanPath
+	}
+	return cfg.Global.BuildPlanPath
+}
 
-	// Log all the available detections for debugging
-	log.Printf("Available detections for building (%d total):", len(detections))
-	for i, det := range detections {
-		if det.Confidence > common.MinConfidence {
-			log.Printf("  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
-				i+1, det.Class, det.Confidence, det.X, det.Y, det.Width, det.Height)
-		}
+// cachedPlan pairs a loaded planner.Plan with the mtime it was loaded at.
+type cachedPlan struct {
+	plan    *planner.Plan
+	modTime time.Time
+}
+
+// buildPlans caches each loaded planner.Plan by path, since Load does
+// topological validation work we don't want to repeat on every
+// process_build_order tick. loadBuildPlan reloads a path whenever its
+// mtime advances, so editing the plan file applies on the next tick without
+// a restart - the same mtime-polling tradeoff internal/taskspec.Watch
+// documents instead of a filesystem-event library this tree doesn't vendor,
+// just checked inline here instead of from a background goroutine, since
+// process_build_order already runs once a tick on its own.
+var buildPlans = make(map[string]*cachedPlan)
+
+// loadBuildPlan returns the cached Plan for planPath, reloading it first if
+// the file's mtime has advanced since it was last loaded.
+func loadBuildPlan(planPath string) (*planner.Plan, error) {
+	info, err := os.Stat(planPath)
+	if err != nil {
+		return nil, err
 	}
 
-	// First, click the "build new" button
-	buildNewButton := vision.FindDetectionByClass(detections, "build_available", common.MinConfidence)
-	if buildNewButton == nil {
-		log.Println("No build button found, checking for build_new_button instead")
-		buildNewButton = vision.FindDetectionByClass(detections, "build_new_button", common.MinConfidence)
+	if cached, ok := buildPlans[planPath]; ok && !info.ModTime().After(cached.modTime) {
+		return cached.plan, nil
+	}
 
-		if buildNewButton == nil {
-			log.Println("No build buttons found at all, returning")
-			return false
-		}
+	plan, err := planner.Load(planPath)
+	if err != nil {
+		return nil, err
 	}
 
-	// Click the found button
-	log.Printf("Found build button at (%.1f, %.1f), clicking...", buildNewButton.X, buildNewButton.Y)
-	if err := utils.TapScreen(deviceID, adbPath, int(buildNewButton.X), int(buildNewButton.Y)); err != nil {
-		log.Printf("Error tapping build button: %v", err)
-		return false
+	logging.Emit(logging.Info, logging.Fields{"task": "load_build_plan"}, "Loaded build plan %s (%d tasks)", planPath, len(plan.Tasks))
+	buildPlans[planPath] = &cachedPlan{plan: plan, modTime: info.ModTime()}
+	return plan, nil
+}
+
+// effectiveGoalsPath returns the buildorder.Goal list path to use for
+// deviceID, mirroring effectiveBuildPlanPath's override precedence.
+func effectiveGoalsPath(deviceID string) string {
+	cfg := utils.GetConfig()
+	if instCfg, ok := cfg.Instances[deviceID]; ok && instCfg.GoalsPath != "" {
+		return instCfg.GoalsPath
 	}
+	return cfg.Global.GoalsPath
+}
 
-	// Wait for building menu to appear
-	log.Println("Waiting for building menu to appear...")
-	time.Sleep(1 * time.Second)
+// cachedGoalPlan pairs a buildorder.Compile result with the goals file
+// mtime it was compiled from, the buildPlans/loadBuildPlan caching pattern
+// applied to goals instead of a hand-authored plan file.
+type cachedGoalPlan struct {
+	goals   []buildorder.Goal
+	plan    *planner.Plan
+	modTime time.Time
+}
 
-	// Parse the detect class to check for category prefix (economic: or military:)
-	detectionParams := strings.Split(task.DetectClass, ":")
-	var category, buildingClass string
+var goalPlans = make(map[string]*cachedGoalPlan)
 
-	if len(detectionParams) > 1 {
-		// Format is "category:building_class"
-		category = strings.TrimSpace(detectionParams[0])
-		buildingClass = strings.TrimSpace(detectionParams[1])
-		log.Printf("Using category '%s' for building class '%s'", category, buildingClass)
-	} else {
-		// No category specified, use the whole string as the building class
-		buildingClass = strings.TrimSpace(task.DetectClass)
-		log.Printf("No category specified in %s, returning..", buildingClass)
-		return false
+// loadGoalPlan reads and compiles the buildorder.Goal list at goalsPath,
+// reloading and recompiling it whenever the file's mtime has advanced since
+// it was last loaded - the same reload-on-edit behavior loadBuildPlan gives
+// a hand-authored plan file.
+func loadGoalPlan(goalsPath string) ([]buildorder.Goal, *planner.Plan, error) {
+	info, err := os.Stat(goalsPath)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Take new screenshot and detect building options
-	log.Println("Taking new screenshot to detect building options...")
-	buildMenuDetections, err := vision.CaptureAndDetect(deviceID, adbPath)
+	if cached, ok := goalPlans[goalsPath]; ok && !info.ModTime().After(cached.modTime) {
+		return cached.goals, cached.plan, nil
+	}
+
+	data, err := os.ReadFile(goalsPath)
 	if err != nil {
-		log.Printf("Error getting detections for building menu: %v", err)
-		resetView(deviceID, adbPath)
+		return nil, nil, err
+	}
+
+	var raw struct {
+		Goals []buildorder.Goal `json:"goals"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("error parsing goals file %s: %w", goalsPath, err)
+	}
+
+	plan, err := buildorder.Compile(raw.Goals)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error compiling goals file %s: %w", goalsPath, err)
+	}
+
+	logging.Emit(logging.Info, logging.Fields{"task": "load_goal_plan"}, "Loaded goals %s (%d goals, %d synthesized tasks)", goalsPath, len(raw.Goals), len(plan.Tasks))
+	goalPlans[goalsPath] = &cachedGoalPlan{goals: raw.Goals, plan: plan, modTime: info.ModTime()}
+	return raw.Goals, plan, nil
+}
+
+// runBuildOrderGoals is RunBuildOrderTask's adapter for GlobalConfig.GoalsPath:
+// it compiles the configured goals into a planner.Plan, tracks each goal's
+// first-seen time for Deadline purposes, and drives the same
+// plan-based scheduling processBuildOrderWithPlan uses for a hand-authored
+// plan file.
+func runBuildOrderGoals(
+	deviceID string,
+	gameView string,
+	detections []common.Detection,
+	adbPath string,
+	config common.TaskConfig,
+	instanceState *state.InstanceState,
+	goalsPath string,
+) bool {
+	fields := logging.Fields{"device_id": deviceID, "task": "run_build_order_goals"}
+	goals, plan, err := loadGoalPlan(goalsPath)
+	if err != nil {
+		logging.Emit(logging.Error, fields, "Error loading goals %s: %v", goalsPath, err)
 		return false
 	}
 
-	// Log the building menu detections
-	log.Printf("Building menu detections (%d total):", len(buildMenuDetections))
-	for i, det := range buildMenuDetections {
-		if det.Confidence > common.MinConfidence {
-			log.Printf("  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
-				i+1, det.Class, det.Confidence, det.X, det.Y, det.Width, det.Height)
+	if instanceState.GoalsStartedAt == nil {
+		instanceState.GoalsStartedAt = make(map[string]time.Time)
+	}
+	buildorder.Track(goals, instanceState.GoalsStartedAt, time.Now())
+
+	report := buildorder.Summarize(buildorder.Evaluate(goals, plan, instanceState, instanceState.GoalsStartedAt))
+	for building, result := range report.Results {
+		if result.Status == buildorder.StatusFailed || result.Status == buildorder.StatusStalled {
+			logging.Emit(logging.Warning, fields, "Goal %q: %s (%s)", building, result.Status, result.Reason)
 		}
 	}
+	if report.Done {
+		logging.Emit(logging.Info, fields, "All build goals have reached a terminal state (completed or failed)")
+		return false
+	}
 
-	var categoryButton *common.Detection
+	return processBuildOrderWithResolvedPlan(deviceID, gameView, detections, adbPath, config, instanceState, plan)
+}
 
-	switch strings.ToLower(category) {
-	case "economic":
-		categoryButton = vision.FindDetectionByClass(buildMenuDetections, "build_economic", common.MinConfidence)
-		log.Println("Looking for economic buildings tab")
-	case "military":
-		categoryButton = vision.FindDetectionByClass(buildMenuDetections, "build_military", common.MinConfidence)
-		log.Println("Looking for military buildings tab")
-	default:
-		log.Printf("Unknown build interface category: %s", category)
-		resetView(deviceID, adbPath)
+// processBuildOrderWithPlan is ProcessBuildOrder's task-selection logic when
+// a planner.Plan is configured: it asks the plan for the next eligible task
+// instead of walking instanceState.BuildOrder.UpcomingTasks in declaration
+// order, then dispatches to the same BuildNewBuilding/UpgradeBuilding this
+// package already uses. Task selection is economy-aware (see
+// planner.Plan.NextWithEconomy) whenever config.EconomyWeights is set;
+// otherwise it falls back to plain Priority-ordering via plan.Next.
+func processBuildOrderWithPlan(
+	deviceID string,
+	gameView string,
+	detections []common.Detection,
+	adbPath string,
+	config common.TaskConfig,
+	instanceState *state.InstanceState,
+	planPath string,
+) bool {
+	plan, err := loadBuildPlan(planPath)
+	if err != nil {
+		logging.Emit(logging.Error, logging.Fields{"device_id": deviceID, "task": "process_build_order_with_plan"}, "Error loading build plan %s: %v", planPath, err)
 		return false
 	}
 
-	if categoryButton != nil {
-		log.Printf("Clicking on %s buildings tab at (%.1f, %.1f)",
-			category, categoryButton.X, categoryButton.Y)
-		if err := utils.TapScreen(deviceID, adbPath, int(categoryButton.X), int(categoryButton.Y)); err != nil {
-			log.Printf("Error tapping %s tab: %v", category, err)
-			resetView(deviceID, adbPath)
+	return processBuildOrderWithResolvedPlan(deviceID, gameView, detections, adbPath, config, instanceState, plan)
+}
+
+// processBuildOrderWithResolvedPlan is processBuildOrderWithPlan's task
+// selection/dispatch logic, factored out so runBuildOrderGoals can drive
+// the same plan-based scheduling against a *planner.Plan it compiled
+// in-memory (see buildorder.Compile) instead of one loadBuildPlan read from
+// a file.
+func processBuildOrderWithResolvedPlan(
+	deviceID string,
+	gameView string,
+	detections []common.Detection,
+	adbPath string,
+	config common.TaskConfig,
+	instanceState *state.InstanceState,
+	plan *planner.Plan,
+) bool {
+	fields := logging.Fields{"device_id": deviceID, "task": "process_build_order"}
+	planner.MigrateLegacyBuildOrder(instanceState, plan)
+
+	// Ask the plan for its best candidate, skipping (and logging) anything
+	// config.ActionFilter rejects rather than stopping at the first one -
+	// e.g. an "econ only" filter shouldn't stall forever on a filtered-out
+	// military task that outranks every economic one on Priority.
+	excluded := make(map[string]bool)
+	var task *planner.PlanTask
+	for {
+		if config.EconomyWeights != (common.EconomyWeights{}) {
+			task = plan.NextWithEconomy(instanceState, config.EconomyWeights, excluded)
+		} else {
+			task = plan.Next(instanceState, excluded)
+		}
+		if task == nil {
+			logging.Emit(logging.Info, fields, "No available plan tasks (all completed, blocked, unaffordable, or filtered)")
 			return false
 		}
+		if allowed, reason := config.ActionFilter.Allowed(task.Building, task.Category); !allowed {
+			logging.Emit(logging.Info, fields, "Skipping plan task %s (%s %s): %s", task.ID, task.Type, task.Building, reason)
+			excluded[task.ID] = true
+			continue
+		}
+		break
+	}
 
-		// Wait for tab to activate
-		time.Sleep(1 * time.Second)
+	progress := instanceState.BuildPlanProgress[task.ID]
+	if instanceState.BuildPlanProgress == nil {
+		instanceState.BuildPlanProgress = make(map[string]state.BuildPlanTaskProgress)
+	}
 
-		// Get fresh detections after switching tabs
-		log.Println("Getting fresh detections after switching tabs...")
-		buildMenuDetections, err = vision.CaptureAndDetect(deviceID, adbPath)
-		if err != nil {
-			log.Printf("Error getting detections after switching to %s tab: %v", category, err)
-			resetView(deviceID, adbPath)
+	// A build_new task mid-BuildFSM (Step already set) is waiting on its
+	// next expected detection, not on the usual inter-attempt cooldown -
+	// skip the cooldown gate so it can advance on the very next tick.
+	inFlight := task.Type == "build_new" && progress.Step != ""
+
+	// Backoff grows with ConsecutiveFailures (see backoffForFailure)
+	// instead of always being the same flat baseBackoff.
+	cooldown := taskBackoff(progress.Backoff)
+	if !inFlight && !progress.LastAttempt.IsZero() && time.Since(progress.LastAttempt) < cooldown {
+		timeRemaining := cooldown - time.Since(progress.LastAttempt)
+		logging.Emit(logging.Info, fields, "Plan task '%s %s' is on cooldown for %.1f more seconds",
+			task.Type, task.Building, timeRemaining.Seconds())
+		return false
+	}
+
+	// BuildNewBuilding parses a "economic:"/"military:" category prefix off
+	// DetectClass to pick the right in-game tab (see its detectionParams
+	// split below); a plan task that didn't spell the prefix out itself
+	// gets one from its (possibly auto-derived) Category instead.
+	detectClass := task.DetectClass
+	if task.Type == "build_new" && task.Category != "" && !strings.Contains(detectClass, ":") {
+		detectClass = task.Category + ":" + detectClass
+	}
+	legacyTask := &state.BuildTask{
+		Type:                task.Type,
+		Building:            task.Building,
+		DetectClass:         detectClass,
+		Step:                progress.Step,
+		StepEnteredAt:       progress.StepEnteredAt,
+		Backoff:             progress.Backoff,
+		ConsecutiveFailures: progress.ConsecutiveFailures,
+		FailureReason:       progress.FailureReason,
+		Skipped:             progress.Skipped,
+	}
+
+	success := false
+	switch task.Type {
+	case "build_new":
+		switch BuildNewBuilding(deviceID, gameView, detections, adbPath, legacyTask, instanceState) {
+		case BuildDone:
+			success = true
+		case BuildInProgress:
+			// Still walking the BuildFSM; not an attempt in its own
+			// right, so leave Attempts/LastAttempt untouched - just
+			// persist where to resume next tick.
+			progress.Step = legacyTask.Step
+			progress.StepEnteredAt = legacyTask.StepEnteredAt
+			instanceState.BuildPlanProgress[task.ID] = progress
 			return false
+		case BuildFailed:
+			success = false
 		}
+	case "upgrade":
+		success = UpgradeBuilding(deviceID, gameView, detections, adbPath, legacyTask, instanceState)
+	}
 
-		// Log the updated building menu detections
-		log.Printf("Updated building menu detections after tab switch (%d total):", len(buildMenuDetections))
-		for i, det := range buildMenuDetections {
-			if det.Confidence > common.MinConfidence {
-				log.Printf("  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
-					i+1, det.Class, det.Confidence, det.X, det.Y, det.Width, det.Height)
-			}
-		}
+	progress.Step = legacyTask.Step
+	progress.StepEnteredAt = legacyTask.StepEnteredAt
+	progress.Attempts++
+	progress.LastAttempt = time.Now()
+
+	if success {
+		progress.Completed = true
+		resetFailurePolicy(legacyTask)
+		progress.Backoff = legacyTask.Backoff
+		progress.ConsecutiveFailures = legacyTask.ConsecutiveFailures
+		progress.FailureReason = legacyTask.FailureReason
+		metrics.Default.IncBuildTaskAttempts(task.Building, "success")
+		logging.Emit(logging.Info, fields, "Build plan task completed: %s (%s %s)", task.ID, task.Type, task.Building)
 	} else {
-		log.Printf("Could not find %s tab button", category)
-		resetView(deviceID, adbPath)
-		return false
+		applyFailurePolicy(deviceID, adbPath, legacyTask)
+		progress.Backoff = legacyTask.Backoff
+		progress.ConsecutiveFailures = legacyTask.ConsecutiveFailures
+		progress.FailureReason = legacyTask.FailureReason
+		progress.Skipped = legacyTask.Skipped
+		metrics.Default.IncBuildTaskAttempts(task.Building, "failure")
+		logging.Emit(logging.Warning, fields, "Build plan task failed (attempt %d, %d consecutive): %s (%s %s)",
+			progress.Attempts, progress.ConsecutiveFailures, task.ID, task.Type, task.Building)
 	}
+	instanceState.BuildPlanProgress[task.ID] = progress
 
-	// Look for the specific building type option
-	buildingButton := vision.FindDetectionByClass(buildMenuDetections, buildingClass, common.MinConfidence)
-	if buildingButton == nil {
-		log.Printf("Building option for '%s' not found, checking for alternative format...", buildingClass)
+	return success
+}
 
-		// Try with "build_" prefix
-		buildingButtonAlt := vision.FindDetectionByClass(buildMenuDetections, "build_"+buildingClass, common.MinConfidence)
-		if buildingButtonAlt != nil {
-			buildingButton = buildingButtonAlt
-			log.Printf("Found alternative format 'build_%s'", buildingClass)
-		} else {
-			log.Printf("Building option for '%s' not found with any format", buildingClass)
-			resetView(deviceID, adbPath)
-			return false
-		}
+// BuildStepResult is BuildNewBuilding's per-tick outcome: whether the
+// BuildFSM is still walking toward a result (BuildInProgress, call again
+// next tick with that tick's detections) or has reached one
+// (BuildDone/BuildFailed).
+type BuildStepResult int
+
+const (
+	BuildFailed BuildStepResult = iota
+	BuildInProgress
+	BuildDone
+)
+
+// BuildFSM step names, persisted as BuildTask.Step/BuildPlanTaskProgress.Step
+// so a crash or restart mid-build resumes from the right UI screen instead
+// of starting the whole sequence over. A successful attempt walks them in
+// this order, with StepHandleAllianceHelp and StepDone always reached once
+// StepConfirmLocation succeeds; SelectCategory, SelectBuilding and
+// ConfirmLocation drop back to the Wait step before them when their target
+// has vanished from this tick's detections:
+//
+//	ClickBuildButton -> WaitMenu -> SelectCategory -> WaitTab ->
+//	SelectBuilding -> WaitPlacement -> ConfirmLocation ->
+//	HandleAllianceHelp -> Done
+//
+// StepFailed isn't itself persisted - a failure resets Step back to "" (so
+// the next attempt starts over at StepClickBuildButton) rather than parking
+// on StepFailed - it exists only to name the terminal failure outcome
+// alongside StepDone in logging and doc comments.
+const (
+	StepClickBuildButton   = "click_build_button"
+	StepWaitMenu           = "wait_menu"
+	StepSelectCategory     = "select_category"
+	StepWaitTab            = "wait_tab"
+	StepSelectBuilding     = "select_building"
+	StepWaitPlacement      = "wait_placement"
+	StepConfirmLocation    = "confirm_location"
+	StepHandleAllianceHelp = "handle_alliance_help"
+	StepDone               = "done"
+	StepFailed             = "failed"
+)
+
+// buildStepTimeout bounds how long a "Wait" state below will keep returning
+// BuildInProgress without seeing its expected detection before giving up,
+// resetting the view, and reporting BuildFailed.
+const buildStepTimeout = 15 * time.Second
+
+// FailureReason classifies why a build attempt failed, stored as
+// BuildTask.FailureReason/BuildPlanTaskProgress.FailureReason so
+// applyFailurePolicy can react to *why* a task keeps failing instead of
+// applying the same flat cooldown to everything. NoResources and
+// BuildersBusy are transient - they're expected to clear on their own as
+// the city's economy or builders free up. MenuNotFound and ButtonNotFound
+// are structural - the detector never found UI it should always be able to
+// find - and are what applyFailurePolicy counts toward a restart.
+const (
+	FailureReasonNone           = ""
+	FailureReasonNoResources    = "no_resources"
+	FailureReasonBuildersBusy   = "builders_busy"
+	FailureReasonMenuNotFound   = "menu_not_found"
+	FailureReasonButtonNotFound = "button_not_found"
+)
+
+// baseBackoff/maxBackoff bound backoffForFailure's 30s*2^ConsecutiveFailures
+// growth. structuralFailureThreshold is how many consecutive
+// FailureReasonMenuNotFound/FailureReasonButtonNotFound failures
+// applyFailurePolicy tolerates before escalating to a full app restart and
+// giving up on the task for this run.
+const (
+	baseBackoff                = 30 * time.Second
+	maxBackoff                 = 30 * time.Minute
+	structuralFailureThreshold = 5
+)
+
+// backoffForFailure returns the cooldown to wait before retrying a task
+// that has now failed consecutiveFailures times in a row:
+// baseBackoff*2^consecutiveFailures, capped at maxBackoff.
+func backoffForFailure(consecutiveFailures int) time.Duration {
+	backoff := baseBackoff
+	for i := 0; i < consecutiveFailures && backoff < maxBackoff; i++ {
+		backoff *= 2
 	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
 
-	// Click on the building option
-	log.Printf("Clicking on %s building at (%.1f, %.1f)", buildingClass, buildingButton.X, buildingButton.Y)
-	if err := utils.TapScreen(deviceID, adbPath, int(buildingButton.X), int(buildingButton.Y)); err != nil {
-		log.Printf("Error tapping building option: %v", err)
+// isStructuralFailure reports whether reason reflects the detector never
+// finding UI it expects to always find, as opposed to a transient,
+// self-clearing condition like a busy builder or low resources.
+func isStructuralFailure(reason string) bool {
+	return reason == FailureReasonMenuNotFound || reason == FailureReasonButtonNotFound
+}
+
+// applyFailurePolicy updates task's backoff bookkeeping after a failed
+// attempt, and - once it's racked up structuralFailureThreshold consecutive
+// structural failures - resets the view, restarts the app via the existing
+// device orchestration, and marks task Skipped so a single broken
+// detection can't stall the rest of the build order forever.
+func applyFailurePolicy(deviceID, adbPath string, task *state.BuildTask) {
+	task.ConsecutiveFailures++
+	task.Backoff = backoffForFailure(task.ConsecutiveFailures)
+
+	if isStructuralFailure(task.FailureReason) && task.ConsecutiveFailures >= structuralFailureThreshold {
+		fields := logging.Fields{"device_id": deviceID, "building": task.Building, "task": "apply_failure_policy"}
+		logging.Emit(logging.Warning, fields, "%d consecutive %s failures building %s, restarting app",
+			task.ConsecutiveFailures, task.FailureReason, task.Building)
 		resetView(deviceID, adbPath)
-		return false
+		if err := utils.RestartApp(deviceID, adbPath); err != nil {
+			logging.Emit(logging.Error, fields, "Error restarting app: %v", err)
+		}
+		task.Skipped = true
 	}
+}
 
-	// Wait for placement mode
-	log.Println("Waiting for placement mode...")
-	time.Sleep(1 * time.Second)
+// resetFailurePolicy clears a task's failure bookkeeping after a
+// successful attempt.
+func resetFailurePolicy(task *state.BuildTask) {
+	task.ConsecutiveFailures = 0
+	task.Backoff = 0
+	task.FailureReason = FailureReasonNone
+}
 
-	// Look for confirm button
-	log.Println("Taking screenshot to find confirm button...")
-	confirmDetections, err := vision.CaptureAndDetect(deviceID, adbPath)
-	if err != nil {
-		log.Printf("Error getting detections for confirm button: %v", err)
-		resetView(deviceID, adbPath)
-		return false
+// taskBackoff returns task's current cooldown: its own Backoff once a
+// failure has set one, else baseBackoff.
+func taskBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return baseBackoff
 	}
+	return backoff
+}
 
-	// Log the confirm screen detections
-	log.Printf("Confirm screen detections (%d total):", len(confirmDetections))
-	for i, det := range confirmDetections {
-		if det.Confidence > common.MinConfidence {
-			log.Printf("  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
-				i+1, det.Class, det.Confidence, det.X, det.Y, det.Width, det.Height)
-		}
+// enterBuildStep moves task onto step, stamping StepEnteredAt so the next
+// Wait state's timeout check measures from here.
+func enterBuildStep(task *state.BuildTask, step string) BuildStepResult {
+	task.Step = step
+	task.StepEnteredAt = time.Now()
+	return BuildInProgress
+}
+
+// failBuildStep resets task back to its initial (un-started) step and
+// returns the view to a known state, so the next attempt at this task
+// starts clean from StepClickBuildButton rather than wherever it failed.
+// failureReason (one of the FailureReason* constants) records why, for
+// applyFailurePolicy's backoff/escalation decision.
+func failBuildStep(deviceID, adbPath string, task *state.BuildTask, failureReason, detail string) BuildStepResult {
+	logging.Emit(logging.Warning, logging.Fields{"device_id": deviceID, "building": task.Building, "task": "build_new"}, "Build step failed for %s (%s): %s", task.Building, failureReason, detail)
+	resetView(deviceID, adbPath)
+	task.Step = ""
+	task.StepEnteredAt = time.Time{}
+	task.FailureReason = failureReason
+	return BuildFailed
+}
+
+// buildCategoryAndClass splits a "category:building_class" DetectClass (see
+// processBuildOrderWithPlan) into its category and building-class parts.
+func buildCategoryAndClass(detectClass string) (category, buildingClass string, ok bool) {
+	parts := strings.Split(detectClass, ":")
+	if len(parts) < 2 {
+		return "", strings.TrimSpace(detectClass), false
 	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), true
+}
 
-	// First check if both builders are busy
-	buildersBusy := vision.FindDetectionByClass(confirmDetections, "builders_hut", common.MinConfidence)
-	if buildersBusy != nil {
-		log.Printf("Both builders are busy, cannot build new %s at this time", task.Building)
+// BuildNewBuilding advances task's BuildFSM by exactly one step using only
+// the detections passed in for this tick - no internal
+// vision.CaptureAndDetect/time.Sleep calls - so the caller's per-instance
+// loop regains control between every tap instead of blocking for the whole
+// several-second build-new sequence. Call it again on the next tick
+// (whatever detections that tick's capture produced) while it returns
+// BuildInProgress; task.Step (and the mirror on
+// state.BuildPlanTaskProgress, for the build-plan call path) records where
+// to resume after a crash or restart.
+func BuildNewBuilding(
+	deviceID string,
+	gameView string,
+	detections []common.Detection,
+	adbPath string,
+	task *state.BuildTask,
+	instanceState *state.InstanceState,
+) BuildStepResult {
+	fields := logging.Fields{"device_id": deviceID, "building": task.Building, "task": "build_new"}
+	step := task.Step
+	if step == "" {
+		step = StepClickBuildButton
+	}
 
-		// Look for exit_dialog_button to gracefully exit
-		exitDialogButton := vision.FindDetectionByClass(confirmDetections, "exit_dialog_button", common.MinConfidence)
-		if exitDialogButton != nil {
-			log.Printf("Found exit_dialog_button at (%.1f, %.1f), clicking to exit builders busy dialog...",
-				exitDialogButton.X, exitDialogButton.Y)
-			if err := utils.TapScreen(deviceID, adbPath, int(exitDialogButton.X), int(exitDialogButton.Y)); err != nil {
-				log.Printf("Error clicking on exit dialog button: %v", err)
-			}
+	switch step {
+	case StepClickBuildButton:
+		buildNewButton := vision.FindDetectionByClass(detections, "build_available", common.MinConfidence)
+		if buildNewButton == nil {
+			buildNewButton = vision.FindDetectionByClass(detections, "build_new_button", common.MinConfidence)
+		}
+		if buildNewButton == nil {
+			return failBuildStep(deviceID, adbPath, task, FailureReasonButtonNotFound, "no build button found")
 		}
 
-		resetView(deviceID, adbPath)
-		return false
-	}
+		logging.Emit(logging.Info, fields, "Found build button at (%.1f, %.1f), clicking...", buildNewButton.X, buildNewButton.Y)
+		if err := utils.TapScreen(deviceID, adbPath, int(buildNewButton.X), int(buildNewButton.Y)); err != nil {
+			return failBuildStep(deviceID, adbPath, task, FailureReasonButtonNotFound, fmt.Sprintf("error tapping build button: %v", err))
+		}
+		return enterBuildStep(task, StepWaitMenu)
 
-	confirmButton := vision.FindDetectionByClass(confirmDetections, "accept_build_location", common.MinConfidence)
-	if confirmButton == nil {
-		log.Println("Accept build location button not found, checking for confirm_button instead")
-		confirmButton = vision.FindDetectionByClass(confirmDetections, "confirm_button", common.MinConfidence)
+	case StepWaitMenu:
+		category, _, hasCategory := buildCategoryAndClass(task.DetectClass)
+		if !hasCategory {
+			return failBuildStep(deviceID, adbPath, task, FailureReasonMenuNotFound, fmt.Sprintf("no category specified in %s", task.DetectClass))
+		}
 
-		if confirmButton == nil {
-			log.Println("No confirmation buttons found, failing build operation")
-			resetView(deviceID, adbPath)
-			return false
-		} else {
-			// Click confirm button
-			log.Printf("Found confirm_button at (%.1f, %.1f), clicking...", confirmButton.X, confirmButton.Y)
-			if err := utils.TapScreen(deviceID, adbPath, int(confirmButton.X), int(confirmButton.Y)); err != nil {
-				log.Printf("Error tapping confirm button: %v", err)
-				resetView(deviceID, adbPath)
-				return false
+		var categoryClass string
+		switch strings.ToLower(category) {
+		case "economic":
+			categoryClass = "build_economic"
+		case "military":
+			categoryClass = "build_military"
+		default:
+			return failBuildStep(deviceID, adbPath, task, FailureReasonMenuNotFound, fmt.Sprintf("unknown build interface category: %s", category))
+		}
+
+		if vision.FindDetectionByClass(detections, categoryClass, common.MinConfidence) == nil {
+			if time.Since(task.StepEnteredAt) > buildStepTimeout {
+				return failBuildStep(deviceID, adbPath, task, FailureReasonMenuNotFound, "building menu never appeared")
 			}
+			return BuildInProgress
 		}
-	} else {
-		log.Printf("Found accept_build_location at (%.1f, %.1f), clicking...", confirmButton.X, confirmButton.Y)
-		if err := utils.TapScreen(deviceID, adbPath, int(confirmButton.X), int(confirmButton.Y)); err != nil {
-			log.Printf("Error tapping confirm button: %v", err)
-			resetView(deviceID, adbPath)
-			return false
+		return enterBuildStep(task, StepSelectCategory)
+
+	case StepSelectCategory:
+		category, _, _ := buildCategoryAndClass(task.DetectClass)
+		var categoryClass string
+		switch strings.ToLower(category) {
+		case "economic":
+			categoryClass = "build_economic"
+		case "military":
+			categoryClass = "build_military"
 		}
-	}
 
-	// Wait for confirmation
-	log.Println("Waiting for confirmation dialog...")
-	time.Sleep(1 * time.Second)
+		categoryButton := vision.FindDetectionByClass(detections, categoryClass, common.MinConfidence)
+		if categoryButton == nil {
+			// The menu detection WaitMenu saw has since scrolled off; go
+			// back and wait for it again rather than failing outright.
+			return enterBuildStep(task, StepWaitMenu)
+		}
 
-	// Check for alliance help request if available
-	log.Println("Taking screenshot to check for alliance help request...")
-	helpDetections, err := vision.CaptureAndDetect(deviceID, adbPath)
-	if err != nil {
-		log.Printf("Error getting detections for alliance help: %v", err)
-	} else {
-		// Log the help screen detections
-		log.Printf("Help screen detections (%d total):", len(helpDetections))
-		for i, det := range helpDetections {
-			if det.Confidence > common.MinConfidence {
-				log.Printf("  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
-					i+1, det.Class, det.Confidence, det.X, det.Y, det.Width, det.Height)
+		logging.Emit(logging.Info, fields, "Clicking on %s buildings tab at (%.1f, %.1f)", category, categoryButton.X, categoryButton.Y)
+		if err := utils.TapScreen(deviceID, adbPath, int(categoryButton.X), int(categoryButton.Y)); err != nil {
+			return failBuildStep(deviceID, adbPath, task, FailureReasonMenuNotFound, fmt.Sprintf("error tapping %s tab: %v", category, err))
+		}
+		return enterBuildStep(task, StepWaitTab)
+
+	case StepWaitTab:
+		_, buildingClass, _ := buildCategoryAndClass(task.DetectClass)
+		if vision.FindDetectionByClass(detections, buildingClass, common.MinConfidence) == nil &&
+			vision.FindDetectionByClass(detections, "build_"+buildingClass, common.MinConfidence) == nil {
+			if time.Since(task.StepEnteredAt) > buildStepTimeout {
+				return failBuildStep(deviceID, adbPath, task, FailureReasonButtonNotFound, fmt.Sprintf("building option for '%s' not found with any format", buildingClass))
 			}
+			return BuildInProgress
 		}
+		return enterBuildStep(task, StepSelectBuilding)
 
-		helpButton := vision.FindDetectionByClass(helpDetections, "alliance_help_button", common.MinConfidence)
-		if helpButton != nil {
-			log.Printf("Clicking on alliance help request button at (%.1f, %.1f)...", helpButton.X, helpButton.Y)
-			if err := utils.TapScreen(deviceID, adbPath, int(helpButton.X), int(helpButton.Y)); err != nil {
-				log.Printf("Error tapping help button: %v", err)
-			} else {
-				log.Println("Successfully clicked alliance help button")
-				time.Sleep(500 * time.Millisecond)
+	case StepSelectBuilding:
+		_, buildingClass, _ := buildCategoryAndClass(task.DetectClass)
+		buildingButton := vision.FindDetectionByClass(detections, buildingClass, common.MinConfidence)
+		if buildingButton == nil {
+			buildingButton = vision.FindDetectionByClass(detections, "build_"+buildingClass, common.MinConfidence)
+		}
+		if buildingButton == nil {
+			return enterBuildStep(task, StepWaitTab)
+		}
+
+		logging.Emit(logging.Info, fields, "Clicking on %s building at (%.1f, %.1f)", buildingClass, buildingButton.X, buildingButton.Y)
+		if err := utils.TapScreen(deviceID, adbPath, int(buildingButton.X), int(buildingButton.Y)); err != nil {
+			return failBuildStep(deviceID, adbPath, task, FailureReasonButtonNotFound, fmt.Sprintf("error tapping building option: %v", err))
+		}
+		return enterBuildStep(task, StepWaitPlacement)
+
+	case StepWaitPlacement:
+		// Both builders busy is a terminal failure, not something to wait
+		// out - there's no placement screen coming.
+		if vision.FindDetectionByClass(detections, "builders_hut", common.MinConfidence) != nil {
+			if exitDialogButton := vision.FindDetectionByClass(detections, "exit_dialog_button", common.MinConfidence); exitDialogButton != nil {
+				logging.Emit(logging.Info, fields, "Both builders busy, clicking exit_dialog_button at (%.1f, %.1f)", exitDialogButton.X, exitDialogButton.Y)
+				if err := utils.TapScreen(deviceID, adbPath, int(exitDialogButton.X), int(exitDialogButton.Y)); err != nil {
+					logging.Emit(logging.Error, fields, "Error clicking on exit dialog button: %v", err)
+				}
 			}
-		} else {
-			log.Println("No alliance help button found")
+			return failBuildStep(deviceID, adbPath, task, FailureReasonBuildersBusy, "both builders busy")
 		}
-	}
 
-	// Get the current number of buildings of this type (for tracking purposes)
-	var hasExistingBuilding bool
-	switch task.Building {
-	case "farm":
-		hasExistingBuilding = instanceState.BuildingPositions.Farm.X != 0 || instanceState.BuildingPositions.Farm.Y != 0
-	case "quarry":
-		hasExistingBuilding = instanceState.BuildingPositions.Quarry.X != 0 || instanceState.BuildingPositions.Quarry.Y != 0
-	case "lumber_mill":
-		hasExistingBuilding = instanceState.BuildingPositions.LumberMill.X != 0 || instanceState.BuildingPositions.LumberMill.Y != 0
-	case "goldmine":
-		hasExistingBuilding = instanceState.BuildingPositions.Goldmine.X != 0 || instanceState.BuildingPositions.Goldmine.Y != 0
-	case "hospital":
-		hasExistingBuilding = instanceState.BuildingPositions.Hospital.X != 0 || instanceState.BuildingPositions.Hospital.Y != 0
-	}
+		// Insufficient resources is also terminal here, not something to
+		// wait out - the placement dialog won't let us confirm until the
+		// player goes and gets more of whatever's short.
+		if vision.FindDetectionByClass(detections, "insufficient_resources", common.MinConfidence) != nil {
+			if exitDialogButton := vision.FindDetectionByClass(detections, "exit_dialog_button", common.MinConfidence); exitDialogButton != nil {
+				logging.Emit(logging.Info, fields, "Insufficient resources, clicking exit_dialog_button at (%.1f, %.1f)", exitDialogButton.X, exitDialogButton.Y)
+				if err := utils.TapScreen(deviceID, adbPath, int(exitDialogButton.X), int(exitDialogButton.Y)); err != nil {
+					logging.Emit(logging.Error, fields, "Error clicking on exit dialog button: %v", err)
+				}
+			}
+			return failBuildStep(deviceID, adbPath, task, FailureReasonNoResources, "insufficient resources")
+		}
 
-	if hasExistingBuilding {
-		log.Printf("Already tracking a main %s building", task.Building)
-	} else {
-		log.Printf("No existing %s tracked yet", task.Building)
-	}
+		if vision.FindDetectionByClass(detections, "accept_build_location", common.MinConfidence) == nil &&
+			vision.FindDetectionByClass(detections, "confirm_button", common.MinConfidence) == nil {
+			if time.Since(task.StepEnteredAt) > buildStepTimeout {
+				return failBuildStep(deviceID, adbPath, task, FailureReasonButtonNotFound, "no confirmation buttons found")
+			}
+			return BuildInProgress
+		}
+		return enterBuildStep(task, StepConfirmLocation)
 
-	// Take another screenshot to try to detect the new building
-	time.Sleep(1 * time.Second) // Wait for UI to update after building placement
+	case StepConfirmLocation:
+		confirmButton := vision.FindDetectionByClass(detections, "accept_build_location", common.MinConfidence)
+		if confirmButton == nil {
+			confirmButton = vision.FindDetectionByClass(detections, "confirm_button", common.MinConfidence)
+		}
+		if confirmButton == nil {
+			return enterBuildStep(task, StepWaitPlacement)
+		}
 
-	log.Println("Taking screenshot to detect newly placed building...")
-	newDetections, err := vision.CaptureAndDetect(deviceID, adbPath)
-	if err != nil {
-		log.Printf("Error getting detections for new building: %v", err)
-	} else {
-		// Log the new building detections
-		log.Printf("New building detections (%d total):", len(newDetections))
-		for i, det := range newDetections {
-			if det.Confidence > common.MinConfidence {
-				log.Printf("  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
-					i+1, det.Class, det.Confidence, det.X, det.Y, det.Width, det.Height)
+		logging.Emit(logging.Info, fields, "Clicking confirm button at (%.1f, %.1f)", confirmButton.X, confirmButton.Y)
+		if err := utils.TapScreen(deviceID, adbPath, int(confirmButton.X), int(confirmButton.Y)); err != nil {
+			return failBuildStep(deviceID, adbPath, task, FailureReasonButtonNotFound, fmt.Sprintf("error tapping confirm button: %v", err))
+		}
+		return enterBuildStep(task, StepHandleAllianceHelp)
+
+	case StepHandleAllianceHelp:
+		// Best-effort and non-blocking: tap it if this tick's detections
+		// happen to catch it, but don't wait around for it to appear -
+		// most builds never trigger an alliance help prompt at all.
+		if helpButton := vision.FindDetectionByClass(detections, "alliance_help_button", common.MinConfidence); helpButton != nil {
+			logging.Emit(logging.Info, fields, "Clicking alliance help request button at (%.1f, %.1f)", helpButton.X, helpButton.Y)
+			if err := utils.TapScreen(deviceID, adbPath, int(helpButton.X), int(helpButton.Y)); err != nil {
+				logging.Emit(logging.Error, fields, "Error tapping alliance help button: %v", err)
 			}
 		}
+		return enterBuildStep(task, StepDone)
 
-		// Update building positions with the new detections
-		for _, det := range newDetections {
+	case StepDone:
+		for _, det := range detections {
 			if det.Class == task.Building && isMultipleTypeBuilding(task.Building) {
 				UpdateMainBuildingPosition(task.Building, int(det.X), int(det.Y), instanceState)
-				log.Printf("Updated position for %s to (%d, %d)", task.Building, int(det.X), int(det.Y))
+				logging.Emit(logging.Info, fields, "Updated position for %s to (%d, %d)", task.Building, int(det.X), int(det.Y))
 			}
 		}
+
+		logging.Emit(logging.Info, fields, "Build new operation complete, resetting view...")
+		resetView(deviceID, adbPath)
+		task.Step = ""
+		task.StepEnteredAt = time.Time{}
+		return BuildDone
+
+	default:
+		return failBuildStep(deviceID, adbPath, task, FailureReasonButtonNotFound, fmt.Sprintf("unknown build step %q", step))
 	}
+}
 
-	log.Println("Build new operation complete, resetting view...")
-	// Reset view to ensure we're back in a known state
-	resetView(deviceID, adbPath)
-	return true
+// preflightUpgradeCheck reads the upgrade dialog's cost text via OCR and,
+// if the cost can be parsed, checks it against instanceState's cached
+// resources before UpgradeBuilding ever taps confirm - catching
+// insufficient resources up front instead of waiting to discover them from
+// confirmDetections afterward. A successfully parsed cost is stored in
+// instanceState.UpgradeCosts either way; nothing reads that map back, so
+// every call reads the cost off the screen again. It reports ok
+// (proceed) whenever the screenshot, OCR read, or parse don't pan out,
+// since there's nothing to gate on without a cost - in this tree that's
+// every call, as vision.ReadRegion has no real OCR backend yet.
+func preflightUpgradeCheck(deviceID, adbPath string, task *state.BuildTask, instanceState *state.InstanceState) (bool, string) {
+	screenshot, err := vision.CaptureScreenshot(deviceID, adbPath)
+	if err != nil {
+		return true, ""
+	}
+
+	costText, ok := vision.ReadRegion(screenshot, "upgrade_cost")
+	if !ok {
+		return true, ""
+	}
+
+	cost, ok := parseUpgradeCost(costText)
+	if !ok {
+		return true, ""
+	}
+
+	if instanceState.UpgradeCosts == nil {
+		instanceState.UpgradeCosts = make(map[string]state.UpgradeCost)
+	}
+	instanceState.UpgradeCosts[task.Building] = cost
+
+	resources := instanceState.GameState.Resources
+	if cost.Food > resources.Food || cost.Wood > resources.Wood ||
+		cost.Stone > resources.Stone || cost.Gold > resources.Gold {
+		return false, "cached resources are below the dialog's parsed cost"
+	}
+	return true, ""
+}
+
+// parseUpgradeCost turns OCR'd cost text (expected to read roughly like
+// "Food 1,200  Wood 800  Stone 0  Gold 0") into a state.UpgradeCost, using
+// vision.FuzzyEqual on each whitespace-separated label so OCR noise (a
+// misread "Fo0d" or "G0ld") still matches the resource it names. Reports
+// false if no label in costText fuzzy-matches a known resource name.
+func parseUpgradeCost(costText string) (state.UpgradeCost, bool) {
+	labels := map[string]*int{}
+	var cost state.UpgradeCost
+	labels["food"] = &cost.Food
+	labels["wood"] = &cost.Wood
+	labels["stone"] = &cost.Stone
+	labels["gold"] = &cost.Gold
+
+	fields := strings.Fields(costText)
+	found := false
+	for i := 0; i < len(fields)-1; i++ {
+		for label, dest := range labels {
+			if !vision.FuzzyEqual(fields[i], label, 1) {
+				continue
+			}
+			amount := strings.ReplaceAll(fields[i+1], ",", "")
+			n, err := strconv.Atoi(amount)
+			if err != nil {
+				continue
+			}
+			*dest = n
+			found = true
+		}
+	}
+
+	if !found {
+		return state.UpgradeCost{}, false
+	}
+	return cost, true
 }
 
 // UpgradeBuilding handles upgrading an existing building
@@ -621,13 +1107,14 @@ func UpgradeBuilding(
 	task *state.BuildTask,
 	instanceState *state.InstanceState,
 ) bool {
-	log.Printf("Attempting to upgrade %s", task.Building)
+	fields := logging.Fields{"device_id": deviceID, "building": task.Building, "task": "upgrade_building"}
+	logging.Emit(logging.Info, fields, "Attempting to upgrade %s", task.Building)
 
 	// Log all the available detections for debugging
-	log.Printf("Available detections for upgrading (%d total):", len(detections))
+	logging.Emit(logging.Debug, fields, "Available detections for upgrading (%d total):", len(detections))
 	for i, det := range detections {
 		if det.Confidence > common.MinConfidence {
-			log.Printf("  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
+			logging.Emit(logging.Debug, fields, "  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
 				i+1, det.Class, det.Confidence, det.X, det.Y, det.Width, det.Height)
 		}
 	}
@@ -640,7 +1127,7 @@ func UpgradeBuilding(
 		mainX, mainY, hasMainPosition := GetMainBuildingPosition(task.Building, instanceState)
 		if hasMainPosition {
 			// Use the stored position for the main building
-			log.Printf("Using stored position (%d, %d) for main %s", mainX, mainY, task.Building)
+			logging.Emit(logging.Info, fields, "Using stored position (%d, %d) for main %s", mainX, mainY, task.Building)
 			clickX = mainX
 			clickY = mainY
 			useStoredPosition = true
@@ -653,63 +1140,63 @@ func UpgradeBuilding(
 		detectClasses := strings.Split(task.DetectClass, ",")
 		var building *common.Detection
 
-		log.Printf("Looking for building with classes: %s", task.DetectClass)
+		logging.Emit(logging.Info, fields, "Looking for building with classes: %s", task.DetectClass)
 
 		// Try each detection class
 		for _, class := range detectClasses {
 			class = strings.TrimSpace(class)
-			log.Printf("Checking for class: '%s'", class)
+			logging.Emit(logging.Debug, fields, "Checking for class: '%s'", class)
 			building = vision.FindDetectionByClass(detections, class, common.MinConfidence)
 			if building != nil {
-				log.Printf("Found building with class '%s'", class)
+				logging.Emit(logging.Info, fields, "Found building with class '%s'", class)
 				break // Found it with one of the classes
 			}
 		}
 
 		// If building not found, cannot proceed
 		if building == nil {
-			log.Printf("%s not found in detections with any of the specified classes", task.Building)
+			logging.Emit(logging.Warning, fields, "%s not found in detections with any of the specified classes", task.Building)
 			return false
 		}
 
 		clickX = int(building.X)
 		clickY = int(building.Y)
-		log.Printf("Found %s at position (%d, %d)", task.Building, clickX, clickY)
+		logging.Emit(logging.Info, fields, "Found %s at position (%d, %d)", task.Building, clickX, clickY)
 
 		// If this is a building that can have multiples, store the position
 		if isMultipleTypeBuilding(task.Building) {
 			UpdateMainBuildingPosition(task.Building, clickX, clickY, instanceState)
-			log.Printf("Updated position for multiple-type building %s to (%d, %d)",
+			logging.Emit(logging.Info, fields, "Updated position for multiple-type building %s to (%d, %d)",
 				task.Building, clickX, clickY)
 		}
 	}
 
 	// Click on the building
-	log.Printf("Clicking on %s at (%d, %d)", task.Building, clickX, clickY)
+	logging.Emit(logging.Info, fields, "Clicking on %s at (%d, %d)", task.Building, clickX, clickY)
 	if err := utils.TapScreen(deviceID, adbPath, clickX, clickY); err != nil {
-		log.Printf("Error clicking on %s: %v", task.Building, err)
+		logging.Emit(logging.Error, fields, "Error clicking on %s: %v", task.Building, err)
 		resetView(deviceID, adbPath)
 		return false
 	}
 
-	// Wait for menu to appear
-	log.Println("Waiting for building menu to appear...")
-	time.Sleep(1 * time.Second)
-
-	// Take another screenshot and get detections to find the upgrade button
-	log.Println("Taking screenshot to find upgrade button...")
-	upgradeDetections, err := vision.CaptureAndDetect(deviceID, adbPath)
+	// Wait for the building menu to appear: either a recognized upgrade
+	// button shows up, or the screen just stops changing (an unrecognized
+	// button name - the fallback search below still gets a chance at it).
+	logging.Emit(logging.Info, fields, "Waiting for building menu to appear...")
+	upgradeDetections, err := vision.WaitForState(deviceID, adbPath,
+		vision.Or(vision.HasAnyOf("upgrade_button", "upgrade_available", "upgrade_building", "building_upgrade"), vision.Stable(3)),
+		5*time.Second, 300*time.Millisecond)
 	if err != nil {
-		log.Printf("Error getting detections for upgrade button: %v", err)
+		logging.Emit(logging.Error, fields, "Error waiting for upgrade button: %v", err)
 		resetView(deviceID, adbPath)
 		return false
 	}
 
 	// Log the upgrade menu detections
-	log.Printf("Upgrade menu detections (%d total):", len(upgradeDetections))
+	logging.Emit(logging.Debug, fields, "Upgrade menu detections (%d total):", len(upgradeDetections))
 	for i, det := range upgradeDetections {
 		if det.Confidence > common.MinConfidence {
-			log.Printf("  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
+			logging.Emit(logging.Debug, fields, "  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
 				i+1, det.Class, det.Confidence, det.X, det.Y, det.Width, det.Height)
 		}
 	}
@@ -719,67 +1206,78 @@ func UpgradeBuilding(
 
 	// If upgrade button not found, try alternative names or reset view and exit
 	if upgradeButton == nil {
-		log.Println("Upgrade button not found, checking for alternative button names")
+		logging.Emit(logging.Info, fields, "Upgrade button not found, checking for alternative button names")
 
 		// Try alternatives like "upgrade_available" etc.
 		alternativeNames := []string{"upgrade_available", "upgrade_building", "building_upgrade"}
 		for _, altName := range alternativeNames {
 			upgradeButton = vision.FindDetectionByClass(upgradeDetections, altName, common.MinConfidence)
 			if upgradeButton != nil {
-				log.Printf("Found alternative upgrade button: %s", altName)
+				logging.Emit(logging.Info, fields, "Found alternative upgrade button: %s", altName)
 				break
 			}
 		}
 
 		if upgradeButton == nil {
-			log.Printf("No upgrade button found for %s with any name, resetting view", task.Building)
+			logging.Emit(logging.Warning, fields, "No upgrade button found for %s with any name, resetting view", task.Building)
 			resetView(deviceID, adbPath)
 			return false
 		}
 	}
 
 	// Click on upgrade button
-	log.Printf("Clicking on upgrade button at (%.1f, %.1f)...", upgradeButton.X, upgradeButton.Y)
+	logging.Emit(logging.Info, fields, "Clicking on upgrade button at (%.1f, %.1f)...", upgradeButton.X, upgradeButton.Y)
 	if err := utils.TapScreen(deviceID, adbPath, int(upgradeButton.X), int(upgradeButton.Y)); err != nil {
-		log.Printf("Error clicking on upgrade button: %v", err)
+		logging.Emit(logging.Error, fields, "Error clicking on upgrade button: %v", err)
 		resetView(deviceID, adbPath)
 		return false
 	}
 
-	// Wait for upgrade dialog to appear
-	log.Println("Waiting for upgrade dialog to appear...")
-	time.Sleep(800 * time.Millisecond)
-
-	// Take another screenshot to find the confirmation button
-	log.Println("Taking screenshot to find confirmation button...")
-	confirmDetections, err := vision.CaptureAndDetect(deviceID, adbPath)
+	// Wait for the upgrade confirmation dialog to appear: any of its known
+	// outcome buttons, or a stable frame if none of them show up.
+	logging.Emit(logging.Info, fields, "Waiting for upgrade dialog to appear...")
+	confirmDetections, err := vision.WaitForState(deviceID, adbPath,
+		vision.Or(vision.HasAnyOf("upgrade_available_button", "confirm_button", "builders_hut_busy", "upgrade_not_available"), vision.Stable(3)),
+		5*time.Second, 300*time.Millisecond)
 	if err != nil {
-		log.Printf("Error getting detections for confirm button: %v", err)
+		logging.Emit(logging.Error, fields, "Error waiting for confirm dialog: %v", err)
 		resetView(deviceID, adbPath)
 		return false
 	}
 
 	// Log the confirm dialog detections
-	log.Printf("Confirm dialog detections (%d total):", len(confirmDetections))
+	logging.Emit(logging.Debug, fields, "Confirm dialog detections (%d total):", len(confirmDetections))
 	for i, det := range confirmDetections {
 		if det.Confidence > common.MinConfidence {
-			log.Printf("  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
+			logging.Emit(logging.Debug, fields, "  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
 				i+1, det.Class, det.Confidence, det.X, det.Y, det.Width, det.Height)
 		}
 	}
 
+	// Pre-flight check: try to read the dialog's cost fields via OCR and
+	// compare them against cached resources before ever tapping confirm,
+	// instead of only discovering insufficient resources reactively from
+	// confirmDetections below. This is a no-op (always proceeds) until
+	// vision.ReadRegion has a real OCR backend - see its doc comment - but
+	// UpgradeBuilding is wired to use it the moment it does.
+	if ok, reason := preflightUpgradeCheck(deviceID, adbPath, task, instanceState); !ok {
+		logging.Emit(logging.Info, fields, "Skipping confirm tap for %s: %s", task.Building, reason)
+		resetView(deviceID, adbPath)
+		return false
+	}
+
 	// First check if both builders are busy
 	buildersBusy := vision.FindDetectionByClass(confirmDetections, "builders_hut_busy", common.MinConfidence)
 	if buildersBusy != nil {
-		log.Printf("Both builders are busy, cannot upgrade %s at this time", task.Building)
+		logging.Emit(logging.Warning, fields, "Both builders are busy, cannot upgrade %s at this time", task.Building)
 
 		// Look for exit_dialog_button to gracefully exit
 		exitDialogButton := vision.FindDetectionByClass(confirmDetections, "exit_dialog_button", common.MinConfidence)
 		if exitDialogButton != nil {
-			log.Printf("Found exit_dialog_button at (%.1f, %.1f), clicking to exit builders busy dialog...",
+			logging.Emit(logging.Info, fields, "Found exit_dialog_button at (%.1f, %.1f), clicking to exit builders busy dialog...",
 				exitDialogButton.X, exitDialogButton.Y)
 			if err := utils.TapScreen(deviceID, adbPath, int(exitDialogButton.X), int(exitDialogButton.Y)); err != nil {
-				log.Printf("Error clicking on exit dialog button: %v", err)
+				logging.Emit(logging.Error, fields, "Error clicking on exit dialog button: %v", err)
 			}
 		}
 
@@ -791,21 +1289,21 @@ func UpgradeBuilding(
 	requirementsNotMet := vision.FindDetectionByClass(confirmDetections, "upgrade_not_available", common.MinConfidence)
 
 	if requirementsNotMet != nil {
-		log.Printf("Requirements not met for upgrading %s - detected 'upgrade_not_available'", task.Building)
+		logging.Emit(logging.Warning, fields, "Requirements not met for upgrading %s - detected 'upgrade_not_available'", task.Building)
 
-		log.Println("Looking for exit_dialog_button to dismiss requirements message")
+		logging.Emit(logging.Info, fields, "Looking for exit_dialog_button to dismiss requirements message")
 		exitDialogButton := vision.FindDetectionByClass(confirmDetections, "exit_dialog_button", common.MinConfidence)
 
 		if exitDialogButton != nil {
-			log.Printf("Found exit_dialog_button at (%.1f, %.1f), clicking...",
+			logging.Emit(logging.Info, fields, "Found exit_dialog_button at (%.1f, %.1f), clicking...",
 				exitDialogButton.X, exitDialogButton.Y)
 			if err := utils.TapScreen(deviceID, adbPath, int(exitDialogButton.X), int(exitDialogButton.Y)); err != nil {
-				log.Printf("Error clicking on exit dialog button: %v", err)
+				logging.Emit(logging.Error, fields, "Error clicking on exit dialog button: %v", err)
 				resetView(deviceID, adbPath)
 				return false
 			}
 		} else {
-			log.Println("Could not find exit_dialog_button, trying to reset view")
+			logging.Emit(logging.Warning, fields, "Could not find exit_dialog_button, trying to reset view")
 			resetView(deviceID, adbPath)
 			return false
 		}
@@ -814,40 +1312,39 @@ func UpgradeBuilding(
 	// Look for upgrade_available_button or confirm_button
 	confirmButton := vision.FindDetectionByClass(confirmDetections, "upgrade_available_button", common.MinConfidence)
 	if confirmButton == nil {
-		log.Println("upgrade_available_button not found, checking for confirm_button")
+		logging.Emit(logging.Info, fields, "upgrade_available_button not found, checking for confirm_button")
 		confirmButton = vision.FindDetectionByClass(confirmDetections, "confirm_button", common.MinConfidence)
 	}
 
 	// If confirmation button found, click it
 	if confirmButton != nil {
-		log.Printf("Found confirm button at (%.1f, %.1f), clicking...", confirmButton.X, confirmButton.Y)
+		logging.Emit(logging.Info, fields, "Found confirm button at (%.1f, %.1f), clicking...", confirmButton.X, confirmButton.Y)
 		if err := utils.TapScreen(deviceID, adbPath, int(confirmButton.X), int(confirmButton.Y)); err != nil {
-			log.Printf("Error clicking on confirm button: %v", err)
+			logging.Emit(logging.Error, fields, "Error clicking on confirm button: %v", err)
 			resetView(deviceID, adbPath)
 			return false
 		}
 	} else {
-		log.Println("No confirm button found, failing upgrade operation")
+		logging.Emit(logging.Warning, fields, "No confirm button found, failing upgrade operation")
 		resetView(deviceID, adbPath)
 		return false
 	}
 
-	// Wait for processing
-	log.Println("Waiting for processing...")
-	time.Sleep(1 * time.Second)
-
-	// Take one more screenshot to check for alliance help request
-	log.Println("Taking screenshot to check for alliance help button...")
-	helpDetections, err := vision.CaptureAndDetect(deviceID, adbPath)
+	// Wait for processing to settle: either an alliance help request pops
+	// up, or the screen simply stops changing once the upgrade starts.
+	logging.Emit(logging.Info, fields, "Waiting for processing...")
+	helpDetections, err := vision.WaitForState(deviceID, adbPath,
+		vision.Or(vision.HasClass("alliance_help_button"), vision.Stable(3)),
+		5*time.Second, 300*time.Millisecond)
 	if err != nil {
-		log.Printf("Error getting detections for help button: %v", err)
+		logging.Emit(logging.Error, fields, "Error waiting for help button: %v", err)
 		// Continue anyway as the upgrade should have started
 	} else {
 		// Log the help screen detections
-		log.Printf("Help request detections (%d total):", len(helpDetections))
+		logging.Emit(logging.Debug, fields, "Help request detections (%d total):", len(helpDetections))
 		for i, det := range helpDetections {
 			if det.Confidence > common.MinConfidence {
-				log.Printf("  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
+				logging.Emit(logging.Debug, fields, "  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
 					i+1, det.Class, det.Confidence, det.X, det.Y, det.Width, det.Height)
 			}
 		}
@@ -857,22 +1354,22 @@ func UpgradeBuilding(
 
 		// If help button found, click it
 		if helpButton != nil {
-			log.Printf("Clicking on alliance help request button at (%.1f, %.1f)...", helpButton.X, helpButton.Y)
+			logging.Emit(logging.Info, fields, "Clicking on alliance help request button at (%.1f, %.1f)...", helpButton.X, helpButton.Y)
 			if err := utils.TapScreen(deviceID, adbPath, int(helpButton.X), int(helpButton.Y)); err != nil {
-				log.Printf("Error tapping help button: %v", err)
+				logging.Emit(logging.Error, fields, "Error tapping help button: %v", err)
 			} else {
-				log.Println("Successfully clicked alliance help button")
+				logging.Emit(logging.Info, fields, "Successfully clicked alliance help button")
 				time.Sleep(500 * time.Millisecond)
 			}
 		} else {
-			log.Println("No alliance help button found")
+			logging.Emit(logging.Info, fields, "No alliance help button found")
 		}
 	}
 
-	log.Printf("%s upgrade initiated successfully", task.Building)
+	logging.Emit(logging.Info, fields, "%s upgrade initiated successfully", task.Building)
 
 	// Reset view to ensure we're back in a known state
-	log.Println("Upgrade operation complete, resetting view...")
+	logging.Emit(logging.Info, fields, "Upgrade operation complete, resetting view...")
 	resetView(deviceID, adbPath)
 
 	return true
@@ -881,12 +1378,13 @@ func UpgradeBuilding(
 // Helper function to reset the view by clicking in the home button area
 // Helper function to reset the view by determining the current state and taking appropriate action
 func resetView(deviceID, adbPath string) {
-	log.Println("Resetting view to return to normal city view...")
+	fields := logging.Fields{"device_id": deviceID, "task": "reset_view"}
+	logging.Emit(logging.Info, fields, "Resetting view to return to normal city view...")
 
 	// Take a screenshot to detect current state
 	screenshot, err := vision.CaptureScreenshot(deviceID, adbPath)
 	if err != nil {
-		log.Printf("Error capturing screenshot for view reset: %v", err)
+		logging.Emit(logging.Error, fields, "Error capturing screenshot for view reset: %v", err)
 		// Fallback to default reset approach if we can't detect the state
 		defaultReset(deviceID, adbPath)
 		return
@@ -899,7 +1397,7 @@ func resetView(deviceID, adbPath string) {
 		utils.GetRoboflowGameplayModel(),
 	)
 	if err != nil {
-		log.Printf("Error analyzing game state for view reset: %v", err)
+		logging.Emit(logging.Error, fields, "Error analyzing game state for view reset: %v", err)
 		// Fallback to default reset approach if we can't analyze
 		defaultReset(deviceID, adbPath)
 		return
@@ -915,29 +1413,39 @@ func resetView(deviceID, adbPath string) {
 	}
 
 	if inBuild {
-		log.Println("Detected we're in build menu, using escape key to exit...")
-		// Use Android back button (escape key) for build menu
+		logging.Emit(logging.Info, fields, "Detected we're in build menu, using escape key to exit...")
+		// Use Android back button (escape key) for build menu, waiting for
+		// "in_build" to actually go away rather than a fixed delay.
 		utils.PressKey(deviceID, adbPath, "4") // Android back button keycode
-		time.Sleep(800 * time.Millisecond)
+		if _, err := vision.WaitForState(deviceID, adbPath, vision.Or(vision.LostClass("in_build"), vision.Stable(3)), 3*time.Second, 300*time.Millisecond); err != nil {
+			logging.Emit(logging.Warning, fields, "View reset: %v", err)
+		}
 
 		// Press again just to be sure
 		utils.PressKey(deviceID, adbPath, "4")
-		time.Sleep(800 * time.Millisecond)
+		if _, err := vision.WaitForState(deviceID, adbPath, vision.Stable(3), 3*time.Second, 300*time.Millisecond); err != nil {
+			logging.Emit(logging.Warning, fields, "View reset: %v", err)
+		}
 	} else {
-		// For normal city/field view, use the home button approach
-		log.Println("Using home button approach for normal view reset")
+		// For normal city/field view, use the home button approach, waiting
+		// for the screen to settle instead of a fixed delay after each tap.
+		logging.Emit(logging.Info, fields, "Using home button approach for normal view reset")
 		utils.TapScreen(deviceID, adbPath, 31, 450) // Home button location
-		time.Sleep(800 * time.Millisecond)
+		if _, err := vision.WaitForState(deviceID, adbPath, vision.Stable(3), 2*time.Second, 300*time.Millisecond); err != nil {
+			logging.Emit(logging.Warning, fields, "View reset: %v", err)
+		}
 		utils.TapScreen(deviceID, adbPath, 31, 450) // Second click just to be sure
-		time.Sleep(800 * time.Millisecond)
+		if _, err := vision.WaitForState(deviceID, adbPath, vision.Stable(3), 2*time.Second, 300*time.Millisecond); err != nil {
+			logging.Emit(logging.Warning, fields, "View reset: %v", err)
+		}
 	}
 
-	log.Println("View reset sequence completed")
+	logging.Emit(logging.Info, fields, "View reset sequence completed")
 }
 
 // Default reset method as fallback
 func defaultReset(deviceID, adbPath string) {
-	log.Println("Using default reset approach (home button + escape key)")
+	logging.Emit(logging.Info, logging.Fields{"device_id": deviceID, "task": "reset_view"}, "Using default reset approach (home button + escape key)")
 	// Try home button first
 	utils.TapScreen(deviceID, adbPath, 31, 450)
 	time.Sleep(800 * time.Millisecond)
@@ -949,6 +1457,7 @@ func defaultReset(deviceID, adbPath string) {
 
 // RunBuildOrderTask is the handler function to be called from the task system
 func RunBuildOrderTask(
+	ctx context.Context,
 	deviceID string,
 	gameView string,
 	detections []common.Detection,
@@ -956,5 +1465,14 @@ func RunBuildOrderTask(
 	config common.TaskConfig,
 	instanceState *state.InstanceState,
 ) bool {
+	logging.FromContext(ctx).Printf("Running build order task")
+	// ctx isn't threaded any deeper than this - ProcessBuildOrder's
+	// internal navigate/tap/confirm/verify steps log through logging.Emit
+	// with their own Fields, so they don't carry the fields attached to ctx
+	// (see manager.newBuildOrderRunner).
 	return ProcessBuildOrder(deviceID, gameView, detections, adbPath, config, instanceState)
 }
+
+func init() {
+	Register("process_build_order", RunBuildOrderTask)
+}
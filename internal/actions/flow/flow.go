@@ -0,0 +1,371 @@
+// Package flow is a small, data-driven replacement for the hand-written
+// capture->detect->tap->sleep sequences scattered through internal/actions
+// (RecruitSecondBuilder was the original offender: four copy-pasted blocks
+// differing only in which detection classes they looked for and how long
+// they slept afterward). A Flow is an ordered list of Steps; Run drives
+// each one - capture, log what it saw, find a tap target by trying
+// PrimaryClass then FallbackClasses, tap it, wait PostDelay - so a new UI
+// sequence is a data literal instead of a new hand-written function.
+//
+// Run is driven through a device.Device rather than raw deviceID/adbPath
+// strings, so a Flow can be exercised against a device.FakeDevice.
+//
+// This intentionally doesn't reach into internal/actions/build-order.go's
+// BuildNewBuilding/UpgradeBuilding: those are larger, handle several
+// category/tab sub-cases the four-step recruit flow never had, and are
+// exercised in production today, so rewriting them is left for a separate,
+// dedicated pass rather than bundled in here.
+package flow
+
+import (
+	"log"
+	"time"
+
+	"roborok/internal/common"
+	"roborok/internal/device"
+	"roborok/internal/vision"
+)
+
+// OnFailure describes what Run does once a Step's target can't be found
+// (or tapping it fails) after all of its Retries are exhausted.
+type OnFailure int
+
+const (
+	// Abort stops the Flow and Run returns false. The caller is
+	// responsible for whatever cleanup it did before calling Run.
+	Abort OnFailure = iota
+	// ResetView calls the Flow's configured Reset func (if any) before
+	// stopping and returning false, e.g. to back out of a half-open menu.
+	ResetView
+)
+
+// Point is a fixed screen coordinate.
+type Point struct{ X, Y int }
+
+// Step is one capture/tap in a Flow.
+type Step struct {
+	// Name identifies the step in log output.
+	Name string
+
+	// PrimaryClass is the detection class Run looks for first.
+	PrimaryClass string
+	// FallbackClasses are tried, in order, if PrimaryClass isn't found -
+	// e.g. a generic "confirm_button"/"button" the UI sometimes shows
+	// instead of a named one.
+	FallbackClasses []string
+	// MinY restricts FallbackClasses matches to detections below this Y
+	// coordinate, the same heuristic the original recruit flow used to
+	// avoid matching an unrelated button near the top of the screen.
+	// Ignored for PrimaryClass. Zero means no restriction.
+	MinY float64
+	// MinConfidence overrides common.MinConfidence for this step's
+	// matches. Zero uses common.MinConfidence.
+	MinConfidence float64
+
+	// DefaultTap, if set, is tapped when neither PrimaryClass nor any
+	// FallbackClass matched, instead of treating the step as failed -
+	// e.g. tapping the center of the screen to dismiss an unidentified
+	// dialog.
+	DefaultTap *Point
+
+	// Retries is how many additional capture/detect attempts Run makes,
+	// each preceded by retryDelay, if no target is found (and no
+	// DefaultTap is configured) on the first attempt.
+	Retries int
+
+	// SuccessClass, if present among this step's detections, is logged as
+	// confirmation that the previous step's action took effect (e.g. a
+	// "...hire_success" banner). Within Run it doesn't affect control flow;
+	// Resume treats its presence on the current screen as proof that an
+	// interrupted step's own tap landed, and continues from the step after.
+	SuccessClass string
+
+	// ExpectNext, if set, switches this step from a single blind tap to
+	// device.TapAndConfirm: every detection matching PrimaryClass or
+	// FallbackClasses (subject to MinY) is ranked by confidence and tried
+	// in turn until ExpectNext shows up in a post-tap capture, with
+	// DismissClasses tapped away between attempts. This is for steps where
+	// a transient overlay (tutorial bubble, resource popup) covering the
+	// right candidate shouldn't be treated the same as the target being
+	// genuinely absent.
+	ExpectNext string
+	// DismissClasses are tapped away between TapAndConfirm attempts. Only
+	// meaningful when ExpectNext is set.
+	DismissClasses []string
+
+	// PostDelay is how long Run sleeps after a successful tap, before
+	// capturing for the next step.
+	PostDelay time.Duration
+
+	// OnFailure is what Run does if this step never finds a target (and
+	// has no DefaultTap) or its tap errors.
+	OnFailure OnFailure
+}
+
+// retryDelay is how long Run waits between a Step's failed attempts.
+const retryDelay = 2 * time.Second
+
+// Flow is a named, ordered sequence of Steps. A Flow value is immutable
+// once built and is shared across every instance that runs it (see
+// RecruitSecondBuilder's package-level recruitSecondBuilderFlow), so nothing
+// instance-specific - like a Journal - lives on it; those are passed into
+// Run/Resume per call instead.
+type Flow struct {
+	Name  string
+	Steps []Step
+}
+
+// ResetFunc backs an OnFailure of ResetView.
+type ResetFunc func(d device.Device)
+
+// Run executes f against d from its first step. initialDetections, if
+// non-nil, is used for that first step instead of taking a fresh capture,
+// since a caller that just ran its own detection pass this tick shouldn't
+// pay for a second one. journal, if non-nil, records each step's
+// progress so a crash mid-flow can be resumed with Resume instead of
+// blindly restarting from the first step; pass nil to opt out. Run returns
+// true once every step completes.
+func (f *Flow) Run(d device.Device, initialDetections []common.Detection, reset ResetFunc, journal *Journal) bool {
+	// Starting over: any journal left from a previous, crash-interrupted
+	// attempt should already have been handled by Resume before Run is
+	// called again, so drop it rather than let entries accumulate forever
+	// across retries that never reach success.
+	journal.Clear()
+	return f.runFrom(d, 0, initialDetections, reset, journal)
+}
+
+// runFrom executes f's steps starting at startIndex, e.g. to resume a flow
+// a previous run got partway through before crashing.
+func (f *Flow) runFrom(d device.Device, startIndex int, initialDetections []common.Detection, reset ResetFunc, journal *Journal) bool {
+	detections := initialDetections
+
+	for i := startIndex; i < len(f.Steps); i++ {
+		step := f.Steps[i]
+
+		if i > startIndex || detections == nil {
+			var err error
+			detections, err = f.captureAndLog(d, step.Name)
+			if err != nil {
+				return f.fail(d, step, reset, "error capturing detections: %v", err)
+			}
+		}
+
+		journal.recordStart(f.Name, step.Name)
+
+		if step.ExpectNext != "" {
+			candidates := candidatesFor(detections, step)
+			if len(candidates) == 0 {
+				if step.DefaultTap == nil {
+					return f.fail(d, step, reset, "no matching detection found")
+				}
+				log.Printf("flow %s: step %q: no match, tapping default point (%d, %d)", f.Name, step.Name, step.DefaultTap.X, step.DefaultTap.Y)
+				if err := d.Tap(step.DefaultTap.X, step.DefaultTap.Y); err != nil {
+					return f.fail(d, step, reset, "tap error: %v", err)
+				}
+			} else {
+				next, ok := device.TapAndConfirm(d, candidates, step.ExpectNext, device.TapAndConfirmOptions{
+					DismissClasses: step.DismissClasses,
+					MinConfidence:  minConfidence(step),
+				})
+				detections = next
+				if !ok {
+					return f.fail(d, step, reset, "never saw expected class %q after trying %d candidate(s)", step.ExpectNext, len(candidates))
+				}
+				log.Printf("flow %s: step %q: confirmed %q", f.Name, step.Name, step.ExpectNext)
+			}
+
+			journal.recordDone(f.Name, step.Name)
+			if step.PostDelay > 0 {
+				d.Sleep(step.PostDelay)
+			}
+			continue
+		}
+
+		det := findTarget(detections, step)
+		for attempt := 0; det == nil && step.DefaultTap == nil && attempt < step.Retries; attempt++ {
+			d.Sleep(retryDelay)
+			var err error
+			detections, err = f.captureAndLog(d, step.Name)
+			if err != nil {
+				return f.fail(d, step, reset, "error capturing detections: %v", err)
+			}
+			det = findTarget(detections, step)
+		}
+
+		if step.SuccessClass != "" {
+			if vision.FindDetectionByClass(detections, step.SuccessClass, minConfidence(step)) != nil {
+				log.Printf("flow %s: step %q: saw success class %q", f.Name, step.Name, step.SuccessClass)
+			}
+		}
+
+		var tapX, tapY int
+		switch {
+		case det != nil:
+			tapX, tapY = int(det.X), int(det.Y)
+			log.Printf("flow %s: step %q: tapping %s at (%d, %d)", f.Name, step.Name, det.Class, tapX, tapY)
+		case step.DefaultTap != nil:
+			tapX, tapY = step.DefaultTap.X, step.DefaultTap.Y
+			log.Printf("flow %s: step %q: no match, tapping default point (%d, %d)", f.Name, step.Name, tapX, tapY)
+		default:
+			return f.fail(d, step, reset, "no matching detection found")
+		}
+
+		if err := d.Tap(tapX, tapY); err != nil {
+			return f.fail(d, step, reset, "tap error: %v", err)
+		}
+
+		journal.recordDone(f.Name, step.Name)
+		if step.PostDelay > 0 {
+			d.Sleep(step.PostDelay)
+		}
+	}
+
+	journal.Clear()
+	return true
+}
+
+func (f *Flow) captureAndLog(d device.Device, stepName string) ([]common.Detection, error) {
+	detections, err := d.Detect()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("flow %s: step %q: %d detection(s)", f.Name, stepName, len(detections))
+	for i, det := range detections {
+		if det.Confidence > common.MinConfidence {
+			log.Printf("  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
+				i+1, det.Class, det.Confidence, det.X, det.Y, det.Width, det.Height)
+		}
+	}
+
+	return detections, nil
+}
+
+func (f *Flow) fail(d device.Device, step Step, reset ResetFunc, format string, args ...interface{}) bool {
+	log.Printf("flow %s: step %q: "+format, append([]interface{}{f.Name, step.Name}, args...)...)
+
+	if step.OnFailure == ResetView && reset != nil {
+		reset(d)
+	}
+	return false
+}
+
+func minConfidence(step Step) float64 {
+	if step.MinConfidence > 0 {
+		return step.MinConfidence
+	}
+	return common.MinConfidence
+}
+
+// candidatesFor returns every detection matching step's PrimaryClass or
+// FallbackClasses (the latter subject to MinY), for ranking by
+// device.TapAndConfirm.
+func candidatesFor(detections []common.Detection, step Step) []common.Detection {
+	minConf := minConfidence(step)
+	var candidates []common.Detection
+
+	for _, det := range detections {
+		if det.Class == step.PrimaryClass && det.Confidence > minConf {
+			candidates = append(candidates, det)
+			continue
+		}
+		if step.MinY > 0 && det.Y <= step.MinY {
+			continue
+		}
+		for _, class := range step.FallbackClasses {
+			if det.Class == class && det.Confidence > minConf {
+				candidates = append(candidates, det)
+				break
+			}
+		}
+	}
+
+	return candidates
+}
+
+func findTarget(detections []common.Detection, step Step) *common.Detection {
+	minConf := minConfidence(step)
+
+	if det := vision.FindDetectionByClass(detections, step.PrimaryClass, minConf); det != nil {
+		return det
+	}
+
+	for _, det := range detections {
+		if step.MinY > 0 && det.Y <= step.MinY {
+			continue
+		}
+		for _, class := range step.FallbackClasses {
+			if det.Class == class && det.Confidence > minConf {
+				d := det
+				return &d
+			}
+		}
+	}
+
+	return nil
+}
+
+// Resume checks instanceID's journal for a flow interrupted by a crash or
+// restart and, if one is found, either continues it from the following step
+// (when the interrupted step's SuccessClass is already satisfied by the
+// current screen, meaning its tap landed before the process died) or rolls
+// the view back with reset and abandons it (when it isn't, meaning the tap
+// either never happened or didn't take effect). flows looks up a Flow by
+// the Name the journal recorded it under. Returns true if a flow was found
+// and successfully resumed to completion, false if there was nothing to
+// resume or the resumed flow didn't finish.
+func Resume(d device.Device, instanceID string, flows map[string]*Flow, reset ResetFunc) bool {
+	j := NewJournal(instanceID)
+	entry, err := j.LastEntry()
+	if err != nil {
+		log.Printf("flow: error reading journal for instance %s: %v", instanceID, err)
+		return false
+	}
+	if entry == nil {
+		return false
+	}
+
+	f, ok := flows[entry.Flow]
+	if !ok {
+		log.Printf("flow: journal for instance %s references unknown flow %q, discarding", instanceID, entry.Flow)
+		j.Clear()
+		return false
+	}
+
+	stepIndex := -1
+	for i, step := range f.Steps {
+		if step.Name == entry.Step {
+			stepIndex = i
+			break
+		}
+	}
+	if stepIndex == -1 {
+		log.Printf("flow %s: journal references unknown step %q, discarding", f.Name, entry.Step)
+		j.Clear()
+		return false
+	}
+
+	if entry.Phase == "done" {
+		log.Printf("flow %s: resuming after completed step %q", f.Name, entry.Step)
+		return f.runFrom(d, stepIndex+1, nil, reset, j)
+	}
+
+	step := f.Steps[stepIndex]
+	detections, err := d.Detect()
+	if err != nil {
+		log.Printf("flow %s: error capturing detections to resume: %v", f.Name, err)
+		return false
+	}
+
+	if step.SuccessClass != "" && vision.FindDetectionByClass(detections, step.SuccessClass, minConfidence(step)) != nil {
+		log.Printf("flow %s: step %q's tap landed before the crash, resuming at the next step", f.Name, step.Name)
+		return f.runFrom(d, stepIndex+1, nil, reset, j)
+	}
+
+	log.Printf("flow %s: step %q was interrupted and its result can't be confirmed, resetting view and abandoning the flow", f.Name, step.Name)
+	if reset != nil {
+		reset(d)
+	}
+	j.Clear()
+	return false
+}
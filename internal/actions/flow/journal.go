@@ -0,0 +1,116 @@
+package flow
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// JournalDir is where per-instance journal files are written. Var rather
+// than a literal so an alternate deployment can redirect it, mirroring
+// utils.Config's other path settings.
+var JournalDir = "."
+
+// JournalEntry is one append-only record of a Flow step's progress, written
+// before ("start") and after ("done") its tap, so a process killed mid-flow
+// can tell on restart whether the in-game action it was about to take (or
+// just took) actually landed.
+type JournalEntry struct {
+	Flow      string    `json:"flow"`
+	Step      string    `json:"step"`
+	Phase     string    `json:"phase"` // "start" or "done"
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Journal is an append-only, newline-delimited-JSON record of Flow step
+// progress for one instance. A nil *Journal is valid and a no-op, so a Flow
+// without one behaves exactly as before.
+type Journal struct {
+	path string
+}
+
+// NewJournal returns a Journal for instanceID, stored at
+// JournalDir/flow-journal-<instanceID>.jsonl.
+func NewJournal(instanceID string) *Journal {
+	return &Journal{path: filepath.Join(JournalDir, fmt.Sprintf("flow-journal-%s.jsonl", instanceID))}
+}
+
+func (j *Journal) recordStart(flowName, stepName string) {
+	j.append(JournalEntry{Flow: flowName, Step: stepName, Phase: "start", Timestamp: time.Now()})
+}
+
+func (j *Journal) recordDone(flowName, stepName string) {
+	j.append(JournalEntry{Flow: flowName, Step: stepName, Phase: "done", Timestamp: time.Now()})
+}
+
+func (j *Journal) append(entry JournalEntry) {
+	if j == nil {
+		return
+	}
+
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("flow journal: error opening %s: %v", j.path, err)
+		return
+	}
+	defer f.Close()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("flow journal: error encoding entry: %v", err)
+		return
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Printf("flow journal: error writing to %s: %v", j.path, err)
+	}
+}
+
+// LastEntry returns the final entry in the journal, or nil if the journal
+// doesn't exist or is empty.
+func (j *Journal) LastEntry() (*JournalEntry, error) {
+	if j == nil {
+		return nil, nil
+	}
+	f, err := os.Open(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var last *JournalEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("flow journal: malformed entry in %s: %w", j.path, err)
+		}
+		last = &entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return last, nil
+}
+
+// Clear removes the journal file, e.g. once its Flow completes (or is
+// abandoned as unrecoverable).
+func (j *Journal) Clear() {
+	if j == nil {
+		return
+	}
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("flow journal: error clearing %s: %v", j.path, err)
+	}
+}
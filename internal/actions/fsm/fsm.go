@@ -0,0 +1,239 @@
+// Package fsm is a small, data-driven state machine for detection-driven UI
+// automation. internal/actions/tutorial.go used to pick its next action via
+// two hand-written "check this before anything else" blocks at the top of
+// determineTutorialState (e.g. TutorialUpgradeCompleteClicked pre-empting
+// normal detection), plus its own ad-hoc stuck-state counter and random
+// unstick tap. Those priority rules and that bookkeeping now live here as
+// data - a State's Priority and Guard, and knobs on Machine - so a new
+// detection-driven UI loop registers states instead of reimplementing the
+// loop.
+//
+// This is deliberately not internal/actions/flow: Flow drives a fixed,
+// ordered sequence of steps one at a time, and is a poor fit for a screen
+// that can jump between several unrelated states in any order. Machine
+// instead re-evaluates every registered State's Guard on each Tick and lets
+// the highest-priority match win, which is what tutorial.go (and, in time,
+// other detection-driven loops built on top of the same vision pipeline)
+// actually need.
+package fsm
+
+import (
+	"math/rand"
+	"roborok/internal/common"
+	"roborok/internal/logging"
+	"roborok/internal/utils"
+	"sort"
+)
+
+// Context is passed to every Guard, Action, OnEnter, and OnExit call for a
+// single Tick. Vars carries whatever handler-local state needs to persist
+// across ticks (e.g. a scroll-attempt count, or a flag a caller wants to
+// track outside of Machine itself) - callers own its keys.
+type Context struct {
+	DeviceID   string
+	ADBPath    string
+	Detections []common.Detection
+	// Screenshot is the raw image the current Tick's Detections were
+	// computed from, for a Guard/Action that needs pixel data Detections
+	// alone doesn't carry (e.g. vision.EstimateOrientation). Nil for a
+	// caller that only has Detections to offer.
+	Screenshot []byte
+	Vars       map[string]interface{}
+}
+
+// State is one node in a Machine: Guard decides whether State currently
+// applies (independent of whatever state Machine was in on the previous
+// Tick), Action performs whatever tapping/swiping the state calls for, and
+// OnEnter/OnExit fire once on the transition into/out of State.
+type State struct {
+	// Name identifies the state in logs and Machine.Current.
+	Name string
+
+	// Priority breaks ties when more than one registered State's Guard
+	// matches on the same Tick; the highest Priority wins. Give a state
+	// that must pre-empt normal detection (e.g. "we already clicked
+	// upgrade_complete, only look for the final arrow now") a higher
+	// Priority than the states it should pre-empt, instead of checking it
+	// first in a hand-written conditional.
+	Priority int
+
+	// Guard reports whether State applies to ctx's current Detections.
+	// Called on every Tick regardless of Machine's current state.
+	Guard func(ctx *Context) bool
+
+	// OnEnter, if set, runs once when Machine transitions into State (not
+	// on every Tick State remains current).
+	OnEnter func(ctx *Context)
+
+	// Action performs State's work for this Tick. next, if non-empty,
+	// forces Machine's state for the following Tick without
+	// re-evaluating Guards - useful for a deterministic follow-up step;
+	// returning "" lets Guards decide as usual. handled reports whether
+	// Action actually did something, which Machine uses the same way the
+	// old handleTutorialState's bool return did: to tell repeated misses
+	// apart from steady progress for stuck-state bookkeeping.
+	Action func(ctx *Context) (next string, handled bool)
+
+	// OnExit, if set, runs once when Machine transitions away from State.
+	OnExit func(ctx *Context)
+}
+
+// Transition is Machine's read-only view of one registered State's
+// priority-ordered entry condition, exposed for logging/debugging.
+// AddState derives it from the State itself rather than taking a separate
+// literal, since a State's Guard is the only transition condition this
+// engine has.
+type Transition struct {
+	To       string
+	Priority int
+}
+
+// defaultMaxStuckTicks mirrors RunTutorialAutomation's original
+// maxStuckIterations.
+const defaultMaxStuckTicks = 20
+
+// Machine runs a priority-ordered set of States against a stream of Ticks.
+// It owns the stuck-state bookkeeping RunTutorialAutomation used to do by
+// hand: MaxStuckTicks and Unstick are knobs instead of a magic constant and
+// a copy-pasted random tap.
+type Machine struct {
+	// MaxStuckTicks is how many consecutive Ticks Machine will stay in the
+	// same state with Action reporting handled=false before it calls
+	// Unstick. Zero means defaultMaxStuckTicks.
+	MaxStuckTicks int
+
+	// Unstick runs once Machine has been stuck for MaxStuckTicks; it
+	// defaults to a random tap inside the 200-400 screen range, matching
+	// RunTutorialAutomation's original unstick behavior.
+	Unstick func(ctx *Context)
+
+	states []*State // kept sorted by Priority descending, ties broken by registration order
+
+	current    string
+	stuckCount int
+	override   string // next's value from the current state's last Action, consumed by the following Tick
+}
+
+// NewMachine returns an empty Machine with the default unstick behavior.
+// Call AddState to register states before the first Tick.
+func NewMachine() *Machine {
+	return &Machine{Unstick: defaultUnstick}
+}
+
+// AddState registers s with m. States are evaluated highest Priority first;
+// among equal priorities, whichever was added first is evaluated first.
+func (m *Machine) AddState(s *State) {
+	m.states = append(m.states, s)
+	sort.SliceStable(m.states, func(i, j int) bool {
+		return m.states[i].Priority > m.states[j].Priority
+	})
+}
+
+// Transitions returns every registered State's name and Priority, highest
+// first - e.g. to confirm in a test or log line that a new State was
+// actually registered above the one it's meant to pre-empt.
+func (m *Machine) Transitions() []Transition {
+	out := make([]Transition, len(m.states))
+	for i, st := range m.states {
+		out[i] = Transition{To: st.Name, Priority: st.Priority}
+	}
+	return out
+}
+
+// Current returns the name of the state Machine is currently in, or "" if
+// no registered State's Guard has matched yet.
+func (m *Machine) Current() string {
+	return m.current
+}
+
+// Tick evaluates every registered State's Guard against ctx (unless the
+// previous Tick's Action forced a specific next state), transitions Machine
+// if the winning state differs from the current one, runs its Action, and
+// updates the stuck-state counter - calling Unstick once MaxStuckTicks is
+// exceeded. It returns the state Machine landed on ("" if no Guard
+// matched) and whether that state's Action reported handled.
+func (m *Machine) Tick(ctx *Context) (stateName string, handled bool) {
+	next := m.override
+	m.override = ""
+	if next == "" {
+		next = m.evaluate(ctx)
+	}
+
+	if next != m.current {
+		m.transitionTo(ctx, next)
+	}
+
+	if m.current == "" {
+		return "", false
+	}
+
+	st := m.stateByName(m.current)
+	if st == nil || st.Action == nil {
+		return m.current, false
+	}
+
+	nextOverride, handled := st.Action(ctx)
+	m.override = nextOverride
+
+	if handled {
+		m.stuckCount = 0
+	} else {
+		m.stuckCount++
+		if m.stuckCount > m.maxStuckTicks() {
+			logging.Emit(logging.Warning, logging.Fields{"device_id": ctx.DeviceID, "task": "fsm"},
+				"stuck in state %q for %d ticks, unsticking", m.current, m.stuckCount)
+			if m.Unstick != nil {
+				m.Unstick(ctx)
+			}
+			m.stuckCount = 0
+		}
+	}
+
+	return m.current, handled
+}
+
+func (m *Machine) transitionTo(ctx *Context, next string) {
+	if cur := m.stateByName(m.current); cur != nil && cur.OnExit != nil {
+		cur.OnExit(ctx)
+	}
+	m.current = next
+	m.stuckCount = 0
+	if st := m.stateByName(m.current); st != nil && st.OnEnter != nil {
+		st.OnEnter(ctx)
+	}
+}
+
+func (m *Machine) evaluate(ctx *Context) string {
+	for _, st := range m.states {
+		if st.Guard != nil && st.Guard(ctx) {
+			return st.Name
+		}
+	}
+	return ""
+}
+
+func (m *Machine) stateByName(name string) *State {
+	for _, st := range m.states {
+		if st.Name == name {
+			return st
+		}
+	}
+	return nil
+}
+
+func (m *Machine) maxStuckTicks() int {
+	if m.MaxStuckTicks > 0 {
+		return m.MaxStuckTicks
+	}
+	return defaultMaxStuckTicks
+}
+
+// defaultUnstick taps a random point in the 200-400 screen range, the same
+// blind dismissal RunTutorialAutomation used when it detected it was stuck.
+func defaultUnstick(ctx *Context) {
+	x := 200 + rand.Intn(200)
+	y := 200 + rand.Intn(200)
+	if err := utils.TapScreen(ctx.DeviceID, ctx.ADBPath, x, y); err != nil {
+		logging.Emit(logging.Error, logging.Fields{"device_id": ctx.DeviceID, "task": "fsm"}, "unstick tap failed: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package actions
+
+import (
+	"fmt"
+	"os"
+	"roborok/internal/common"
+	"roborok/internal/uilocator"
+	"roborok/internal/utils"
+	"sync"
+	"time"
+)
+
+// cachedLocatorTable pairs a loaded uilocator.Table with the mtime it was
+// loaded at, mirroring build-order.go's loadBuildPlan caching so an
+// override file is only re-read once it actually changes.
+type cachedLocatorTable struct {
+	table   uilocator.Table
+	modTime time.Time
+}
+
+// locatorOverrides caches each uilocator.Table loaded from
+// GlobalConfig.LocatorsPath, keyed by path. Guarded by locatorOverridesMu
+// since, unlike build-order.go's per-tick buildPlans map, locator
+// resolution runs from every instance's gameplay loop concurrently.
+var (
+	locatorOverridesMu sync.Mutex
+	locatorOverrides   = make(map[string]*cachedLocatorTable)
+)
+
+// loadLocatorOverrides returns the cached uilocator.Table for path,
+// reloading it first if the file's mtime has advanced since it was last
+// loaded.
+func loadLocatorOverrides(path string) (uilocator.Table, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	locatorOverridesMu.Lock()
+	defer locatorOverridesMu.Unlock()
+
+	if cached, ok := locatorOverrides[path]; ok && !info.ModTime().After(cached.modTime) {
+		return cached.table, nil
+	}
+
+	table, err := uilocator.LoadTable(path)
+	if err != nil {
+		return nil, err
+	}
+
+	locatorOverrides[path] = &cachedLocatorTable{table: table, modTime: info.ModTime()}
+	return table, nil
+}
+
+// resolveHandlerLocator looks up name in base - a handler's built-in
+// uilocator.Table, e.g. vip.go's vipLocators - overridden by
+// GlobalConfig.LocatorsPath when set. A broken or unreadable override file
+// is ignored rather than propagated, so a handler degrades to its
+// built-in table instead of breaking on a config typo.
+func resolveHandlerLocator(deviceID, adbPath string, base uilocator.Table, name string, detections []common.Detection) (int, int, error) {
+	loc, ok := base[name]
+	if !ok {
+		return 0, 0, fmt.Errorf("locator %q not defined", name)
+	}
+
+	if path := utils.GetConfig().Global.LocatorsPath; path != "" {
+		if overrides, err := loadLocatorOverrides(path); err == nil {
+			if override, ok := overrides[name]; ok {
+				loc = override
+			}
+		}
+	}
+
+	return uilocator.Resolve(deviceID, adbPath, loc, detections)
+}
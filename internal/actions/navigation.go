@@ -1,8 +1,8 @@
 package actions
 
 import (
-	"log"
 	"roborok/internal/common"
+	"roborok/internal/logging"
 	"roborok/internal/state"
 	"roborok/internal/utils"
 	"time"
@@ -17,12 +17,14 @@ func NavigateToCity(
 	config common.TaskConfig,
 	instanceState *state.InstanceState,
 ) bool {
+	fields := logging.Fields{"device_id": deviceID, "task": "navigate_to_city"}
+
 	// If already in city view, nothing to do
 	if gameView == "city" {
 		return true
 	}
 
-	log.Printf("Navigating to city view from %s view", gameView)
+	logging.Emit(logging.Info, fields, "Navigating to city view from %s view", gameView)
 
 	// Look for return to city button
 	var returnButton *common.Detection
@@ -35,13 +37,13 @@ func NavigateToCity(
 
 	// If return button not found, cannot navigate to city
 	if returnButton == nil {
-		log.Println("Return to city button not found")
+		logging.Emit(logging.Warning, fields, "Return to city button not found")
 		return false
 	}
 
 	// Click on return button
 	if err := utils.TapScreen(deviceID, adbPath, int(returnButton.X), int(returnButton.Y)); err != nil {
-		log.Printf("Error tapping on return button: %v", err)
+		logging.Emit(logging.Error, fields, "Error tapping on return button: %v", err)
 		return false
 	}
 
@@ -60,12 +62,14 @@ func NavigateToMap(
 	config common.TaskConfig,
 	instanceState *state.InstanceState,
 ) bool {
+	fields := logging.Fields{"device_id": deviceID, "task": "navigate_to_map"}
+
 	// If already in map view, nothing to do
 	if gameView == "map" || gameView == "field" {
 		return true
 	}
 
-	log.Printf("Navigating to map view from %s view", gameView)
+	logging.Emit(logging.Info, fields, "Navigating to map view from %s view", gameView)
 
 	// Look for map button in the UI
 	var mapButton *common.Detection
@@ -78,22 +82,22 @@ func NavigateToMap(
 
 	// If map button not found, cannot navigate to map
 	if mapButton == nil {
-		log.Println("Map button not found")
+		logging.Emit(logging.Warning, fields, "Map button not found")
 
 		// Try clicking at the expected location of the map button (lower left)
 		if err := utils.TapScreen(deviceID, adbPath, 50, 800); err != nil {
-			log.Printf("Error tapping approximate map button location: %v", err)
+			logging.Emit(logging.Error, fields, "Error tapping approximate map button location: %v", err)
 			return false
 		}
 
-		log.Println("Tried clicking approximate map button location")
+		logging.Emit(logging.Info, fields, "Tried clicking approximate map button location")
 		time.Sleep(2 * time.Second)
 		return true
 	}
 
 	// Click on map button
 	if err := utils.TapScreen(deviceID, adbPath, int(mapButton.X), int(mapButton.Y)); err != nil {
-		log.Printf("Error tapping on map button: %v", err)
+		logging.Emit(logging.Error, fields, "Error tapping on map button: %v", err)
 		return false
 	}
 
@@ -112,19 +116,21 @@ func ReturnToCity(
 	config common.TaskConfig,
 	instanceState *state.InstanceState,
 ) bool {
+	fields := logging.Fields{"device_id": deviceID, "task": "return_to_city"}
+
 	// Only execute if we're not already in the city
 	if gameView == "city" {
 		return false
 	}
 
-	log.Printf("Executing periodic return to city from %s view", gameView)
+	logging.Emit(logging.Info, fields, "Executing periodic return to city from %s view", gameView)
 
 	// Use the shared navigation function
 	if NavigateToCity(deviceID, gameView, detections, adbPath, config, instanceState) {
-		log.Println("Successfully returned to city")
+		logging.Emit(logging.Info, fields, "Successfully returned to city")
 		return true
 	}
 
-	log.Println("Failed to return to city")
+	logging.Emit(logging.Warning, fields, "Failed to return to city")
 	return false
 }
@@ -1,14 +1,17 @@
 package actions
 
 import (
-	"log"
+	"context"
 	"roborok/internal/common"
+	"roborok/internal/logging"
+	"roborok/internal/metrics"
 	"roborok/internal/state"
 	"roborok/internal/utils"
 )
 
 // CollectQuests attempts to collect available quests directly from the sidebar
 func CollectQuests(
+	ctx context.Context,
 	deviceID string,
 	gameView string,
 	detections []common.Detection,
@@ -16,7 +19,8 @@ func CollectQuests(
 	config common.TaskConfig,
 	instanceState *state.InstanceState,
 ) bool {
-	log.Printf("Checking for claimable quests on device %s", deviceID)
+	logger := logging.FromContext(ctx)
+	logger.Printf("Checking for claimable quests on device %s", deviceID)
 
 	// Track if we claimed anything
 	claimedAny := false
@@ -24,27 +28,33 @@ func CollectQuests(
 	// Look for claimable quests in the detections
 	for _, det := range detections {
 		if det.Class == "main_quest_claimable" && det.Confidence > common.MinConfidence {
-			log.Println("Main quest reward available, clicking to claim...")
+			logger.Printf("Main quest reward available, clicking to claim...")
 			if err := utils.TapScreen(deviceID, adbPath, int(det.X), int(det.Y)); err != nil {
-				log.Printf("Error clicking on main quest: %v", err)
+				logger.Printf("Error clicking on main quest: %v", err)
 			} else {
 				claimedAny = true
+				metrics.Default.IncQuestsClaimed(instanceState.ID, "main")
 			}
 		} else if det.Class == "quests_claimable" && det.Confidence > common.MinConfidence && !config.ClaimOnlyMainQuest {
-			log.Println("Regular quest reward available, clicking the top one to claim it...")
+			logger.Printf("Regular quest reward available, clicking the top one to claim it...")
 			if err := utils.TapScreen(deviceID, adbPath, int(det.X), int(det.Y+78)); err != nil {
-				log.Printf("Error clicking on regular quest: %v", err)
+				logger.Printf("Error clicking on regular quest: %v", err)
 			} else {
 				claimedAny = true
+				metrics.Default.IncQuestsClaimed(instanceState.ID, "regular")
 			}
 		}
 	}
 
 	if !claimedAny {
-		log.Println("No claimable quests detected")
+		logger.Printf("No claimable quests detected")
 		return false
 	}
 
-	log.Println("Quest claims completed")
+	logger.Printf("Quest claims completed")
 	return true
 }
+
+func init() {
+	Register("collect_quests", CollectQuests)
+}
@@ -0,0 +1,25 @@
+package actions
+
+import "roborok/internal/common"
+
+// registry maps a task name to the handler that implements it, so
+// internal/taskspec can build a Manager's task list from a loaded Spec
+// without a big name-to-function switch. Handlers register themselves via
+// init() in their own file.
+var registry = make(map[string]common.HandlerFunc)
+
+// Register associates name with handler. Called from init() in the file
+// defining handler; panics on a duplicate name since that can only be a
+// programming error, not something a misconfigured spec file could trigger.
+func Register(name string, handler common.HandlerFunc) {
+	if _, exists := registry[name]; exists {
+		panic("actions: handler already registered for " + name)
+	}
+	registry[name] = handler
+}
+
+// Lookup returns the handler registered for name, if any.
+func Lookup(name string) (common.HandlerFunc, bool) {
+	handler, ok := registry[name]
+	return handler, ok
+}
@@ -1,16 +1,22 @@
 package actions
 
 import (
-	"log"
+	"context"
 	"roborok/internal/common"
+	"roborok/internal/logging"
 	"roborok/internal/state"
 	"roborok/internal/utils"
 	"roborok/internal/vision"
 	"time"
 )
 
+func init() {
+	Register("manage_scouts", ManageScouts)
+}
+
 // ManageScouts handles scout management including expedition to fog
 func ManageScouts(
+	ctx context.Context,
 	deviceID string,
 	gameView string,
 	detections []common.Detection,
@@ -18,13 +24,14 @@ func ManageScouts(
 	config common.TaskConfig,
 	instanceState *state.InstanceState,
 ) bool {
-	log.Printf("Managing scouts on device %s", deviceID)
+	fields := logging.Fields{"device_id": deviceID, "task": "manage_scouts"}
+	logging.Emit(logging.Info, fields, "Managing scouts on device %s", deviceID)
 
 	// If we're in city view, we need to go to the map view
 	if gameView == "city" {
 		// Use the standard navigation function instead of the local navigateToMap
 		if !NavigateToMap(deviceID, gameView, detections, adbPath, config, instanceState) {
-			log.Println("Failed to navigate to map view")
+			logging.Emit(logging.Warning, fields, "Failed to navigate to map view")
 			return false
 		}
 
@@ -35,12 +42,12 @@ func ManageScouts(
 	// Check if scout is idle
 	isScoutIdle, err := IsScoutIdle(deviceID, gameView, detections, adbPath)
 	if err != nil {
-		log.Printf("Failed to check if scout is idle: %v", err)
+		logging.Emit(logging.Error, fields, "Failed to check if scout is idle: %v", err)
 		return false
 	}
 
 	if !isScoutIdle {
-		log.Println("Scout is not idle, skipping management")
+		logging.Emit(logging.Info, fields, "Scout is not idle, skipping management")
 		return false
 	}
 
@@ -65,7 +72,53 @@ func IsScoutIdle(
 	return true, nil
 }
 
-// SendScoutToFog sends a scout to explore fog
+// defaultScoutBlacklistTTL is how long SendScoutToFog remembers an
+// unreachable fog destination when TaskConfig.ScoutBlacklistTTLSeconds
+// isn't set, so the map re-opens over time instead of the blacklist
+// growing forever.
+const defaultScoutBlacklistTTL = 6 * time.Hour
+
+// scoutBlacklistTTL returns config's configured blacklist expiry, or
+// defaultScoutBlacklistTTL when unset.
+func scoutBlacklistTTL(config common.TaskConfig) time.Duration {
+	if config.ScoutBlacklistTTLSeconds <= 0 {
+		return defaultScoutBlacklistTTL
+	}
+	return time.Duration(config.ScoutBlacklistTTLSeconds) * time.Second
+}
+
+// pruneExpiredScoutBlacklist drops blacklist entries older than ttl.
+func pruneExpiredScoutBlacklist(scoutState *state.ScoutState, ttl time.Duration) {
+	if len(scoutState.Blacklist) == 0 {
+		return
+	}
+	fresh := scoutState.Blacklist[:0]
+	for _, entry := range scoutState.Blacklist {
+		if time.Since(entry.BlacklistedAt) < ttl {
+			fresh = append(fresh, entry)
+		}
+	}
+	scoutState.Blacklist = fresh
+}
+
+// isScoutBlacklisted reports whether (x, y) matches any still-live
+// blacklist entry.
+func isScoutBlacklisted(blacklist []state.ScoutBlacklistEntry, x, y int) bool {
+	for _, entry := range blacklist {
+		if entry.X == x && entry.Y == y {
+			return true
+		}
+	}
+	return false
+}
+
+// SendScoutToFog sends a scout to explore fog. If March fails with an
+// "unable_to_reach"/"path_blocked" UI error, it backs out and blacklists
+// the selected destination (see state.ScoutState.Blacklist) instead of
+// giving up outright - the next tick's ManageScouts call tries again, and
+// if the client highlights the same destination a second time,
+// SendScoutToFog skips confirming it rather than repeating the same
+// failed march.
 func SendScoutToFog(
 	deviceID string,
 	gameView string,
@@ -74,10 +127,12 @@ func SendScoutToFog(
 	config common.TaskConfig,
 	instanceState *state.InstanceState,
 ) bool {
-	log.Println("Sending scout to explore fog")
+	fields := logging.Fields{"device_id": deviceID, "task": "send_scout_to_fog"}
+	logging.Emit(logging.Info, fields, "Sending scout to explore fog")
 
 	// Reference the scout state from the instance state
 	scoutState := &instanceState.ScoutState
+	pruneExpiredScoutBlacklist(scoutState, scoutBlacklistTTL(config))
 
 	// Look for the scout camp or scout button
 	var scoutButton *common.Detection
@@ -90,13 +145,13 @@ func SendScoutToFog(
 
 	// If scout button not found, we can't proceed
 	if scoutButton == nil {
-		log.Println("Scout camp/button not found")
+		logging.Emit(logging.Warning, fields, "Scout camp/button not found")
 		return false
 	}
 
 	// Click on scout camp/button
-	if err := utils.TapScreen(deviceID, adbPath, int(scoutButton.X), int(scoutButton.Y)); err != nil {
-		log.Printf("Failed to tap on scout camp/button: %v", err)
+	if err := utils.HumanizedTap(deviceID, adbPath, int(scoutButton.X), int(scoutButton.Y), utils.DefaultTapOptions()); err != nil {
+		logging.Emit(logging.Error, fields, "Failed to tap on scout camp/button: %v", err)
 		return false
 	}
 
@@ -104,10 +159,10 @@ func SendScoutToFog(
 	time.Sleep(1 * time.Second)
 
 	// Take new screenshot and use CaptureAndDetect
-	log.Println("Taking screenshot to find explore button")
+	logging.Emit(logging.Info, fields, "Taking screenshot to find explore button")
 	exploreDetections, err := vision.CaptureAndDetect(deviceID, adbPath)
 	if err != nil {
-		log.Printf("Failed to get detections for explore button: %v", err)
+		logging.Emit(logging.Error, fields, "Failed to get detections for explore button: %v", err)
 		return false
 	}
 
@@ -116,15 +171,29 @@ func SendScoutToFog(
 
 	// If explore button not found, close the interface and return
 	if exploreButton == nil {
-		log.Println("Explore button not found")
+		logging.Emit(logging.Warning, fields, "Explore button not found")
 		// Try to close the interface
-		utils.TapScreen(deviceID, adbPath, 10, 10)
+		utils.HumanizedTap(deviceID, adbPath, 10, 10, utils.DefaultTapOptions())
 		return false
 	}
 
+	// If the client highlights a specific destination tile before
+	// exploring, skip it when it's still blacklisted from a previous
+	// failed march rather than confirming the same unreachable target
+	// again.
+	var targetX, targetY int
+	if fogTarget := vision.FindDetectionByClass(exploreDetections, "fog_target_selected", common.MinConfidence); fogTarget != nil {
+		targetX, targetY = int(fogTarget.X), int(fogTarget.Y)
+		if isScoutBlacklisted(scoutState.Blacklist, targetX, targetY) {
+			logging.Emit(logging.Info, fields, "Fog target (%d, %d) is blacklisted, backing out to retry next tick", targetX, targetY)
+			utils.HumanizedTap(deviceID, adbPath, 10, 10, utils.DefaultTapOptions())
+			return false
+		}
+	}
+
 	// Click on explore button
-	if err := utils.TapScreen(deviceID, adbPath, int(exploreButton.X), int(exploreButton.Y)); err != nil {
-		log.Printf("Failed to tap on explore button: %v", err)
+	if err := utils.HumanizedTap(deviceID, adbPath, int(exploreButton.X), int(exploreButton.Y), utils.DefaultTapOptions()); err != nil {
+		logging.Emit(logging.Error, fields, "Failed to tap on explore button: %v", err)
 		return false
 	}
 
@@ -132,10 +201,10 @@ func SendScoutToFog(
 	time.Sleep(1 * time.Second)
 
 	// Take new screenshot to find march button
-	log.Println("Taking screenshot to find march button")
+	logging.Emit(logging.Info, fields, "Taking screenshot to find march button")
 	marchDetections, err := vision.CaptureAndDetect(deviceID, adbPath)
 	if err != nil {
-		log.Printf("Failed to get detections for march button: %v", err)
+		logging.Emit(logging.Error, fields, "Failed to get detections for march button: %v", err)
 		return false
 	}
 
@@ -144,19 +213,39 @@ func SendScoutToFog(
 
 	// If march button not found, close the dialog and return
 	if marchButton == nil {
-		log.Println("March button not found")
+		logging.Emit(logging.Warning, fields, "March button not found")
 		// Try to close the dialog
-		utils.TapScreen(deviceID, adbPath, 10, 10)
+		utils.HumanizedTap(deviceID, adbPath, 10, 10, utils.DefaultTapOptions())
 		return false
 	}
 
 	// Click on march button
-	if err := utils.TapScreen(deviceID, adbPath, int(marchButton.X), int(marchButton.Y)); err != nil {
-		log.Printf("Failed to tap on march button: %v", err)
+	if err := utils.HumanizedTap(deviceID, adbPath, int(marchButton.X), int(marchButton.Y), utils.DefaultTapOptions()); err != nil {
+		logging.Emit(logging.Error, fields, "Failed to tap on march button: %v", err)
+		return false
+	}
+
+	// Wait for the march to either start or reject
+	time.Sleep(1 * time.Second)
+
+	// Check for an unreachable-destination error, borrowing the same
+	// unable-to-reach handling combat bots use against obstructed targets.
+	resultDetections, err := vision.CaptureAndDetect(deviceID, adbPath)
+	if err != nil {
+		logging.Emit(logging.Error, fields, "Failed to get detections for march result: %v", err)
+	} else if failure := vision.FindDetectionByClasses(resultDetections, []string{"unable_to_reach", "path_blocked"}, common.MinConfidence); failure != nil {
+		logging.Emit(logging.Warning, fields, "March failed (%s); blacklisting target (%d, %d) and backing out", failure.Class, targetX, targetY)
+		scoutState.Blacklist = append(scoutState.Blacklist, state.ScoutBlacklistEntry{
+			X:             targetX,
+			Y:             targetY,
+			BlacklistedAt: time.Now(),
+			Reason:        failure.Class,
+		})
+		utils.HumanizedTap(deviceID, adbPath, 10, 10, utils.DefaultTapOptions())
 		return false
 	}
 
-	log.Println("Scout sent to explore fog successfully")
+	logging.Emit(logging.Info, fields, "Scout sent to explore fog successfully")
 
 	// Update scout state
 	scoutState.IsMoving = true
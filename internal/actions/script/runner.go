@@ -0,0 +1,223 @@
+package script
+
+import (
+	"log"
+	"roborok/internal/common"
+	"roborok/internal/vision"
+	"strings"
+	"time"
+)
+
+// defaultMaxLoopIterations bounds a Step.Loop when LoopSpec.MaxIterations
+// isn't set, so a While condition that never goes false can't spin a
+// flow forever.
+const defaultMaxLoopIterations = 20
+
+// Env wires a Runner to a specific device: how to get fresh detections,
+// how to tap, and how to resolve a named template to a coordinate.
+// Callers in internal/actions build one from the same deviceID/adbPath
+// every other action function already takes, so Flow steps stay free of
+// device-level plumbing.
+type Env struct {
+	// Detect returns a fresh detection pass, e.g. vision.CaptureAndDetect
+	// for the Step's device.
+	Detect func() ([]common.Detection, error)
+
+	// Tap performs a humanized tap at (x, y), e.g. utils.HumanizedTap
+	// bound to the Step's deviceID/adbPath.
+	Tap func(x, y int) error
+
+	// ResolveTapTarget resolves templateName to a coordinate, falling
+	// back to (fallbackX, fallbackY) - actions.resolveTapTarget bound to
+	// the Step's deviceID/adbPath. May be left nil, in which case a
+	// {"template": ...} Tap always uses its fallback coordinate.
+	ResolveTapTarget func(templateName string, fallbackX, fallbackY int) (int, int)
+}
+
+// Runner interprets Flows against an Env. Library holds named sub-flows
+// a Step.OnError can refer to, analogous to composable recovery
+// sequences shared across flows instead of copy-pasted into each one.
+type Runner struct {
+	Env     Env
+	Library map[string]Flow
+}
+
+// NewRunner builds a Runner. library may be nil if no flow uses OnError.
+func NewRunner(env Env, library map[string]Flow) *Runner {
+	return &Runner{Env: env, Library: library}
+}
+
+// Run interprets flow from a fresh detection pass, returning true if
+// every step completed and false if a Find/Tap step failed along the
+// way - the same true/false contract every HandlerFunc in this package
+// already returns.
+func (r *Runner) Run(flow Flow) bool {
+	detections, err := r.Env.Detect()
+	if err != nil {
+		log.Printf("script: %s: initial detect failed: %v", flow.Name, err)
+		return false
+	}
+	_, ok := r.runSteps(flow.Steps, detections)
+	return ok
+}
+
+func (r *Runner) runSteps(steps []Step, detections []common.Detection) ([]common.Detection, bool) {
+	for _, step := range steps {
+		var found *common.Detection
+		if len(step.Find) > 0 {
+			found = vision.FindDetectionByClasses(detections, step.Find, common.MinConfidence)
+			if found == nil {
+				r.runOnError(step.OnError, detections)
+				return detections, false
+			}
+		}
+
+		if !evalCondition(step.When, found) {
+			continue
+		}
+
+		if step.Tap != nil {
+			x, y, ok := r.resolveTap(step.Tap, found)
+			if !ok {
+				log.Printf("script: tap step has no resolvable target")
+				r.runOnError(step.OnError, detections)
+				return detections, false
+			}
+			if err := r.Env.Tap(x, y); err != nil {
+				log.Printf("script: tap at (%d, %d) failed: %v", x, y, err)
+				if step.BestEffort {
+					continue
+				}
+				r.runOnError(step.OnError, detections)
+				return detections, false
+			}
+		}
+
+		if step.Wait != "" {
+			d, err := time.ParseDuration(step.Wait)
+			if err != nil {
+				log.Printf("script: invalid wait duration %q: %v", step.Wait, err)
+			} else {
+				time.Sleep(d)
+			}
+
+			fresh, err := r.Env.Detect()
+			if err != nil {
+				log.Printf("script: re-detect after wait failed: %v", err)
+			} else {
+				detections = fresh
+			}
+		}
+
+		switch {
+		case step.Loop != nil:
+			var ok bool
+			detections, ok = r.runLoop(step, detections, found)
+			if !ok {
+				return detections, false
+			}
+		case len(step.Steps) > 0:
+			var ok bool
+			detections, ok = r.runSteps(step.Steps, detections)
+			if !ok {
+				return detections, false
+			}
+		}
+	}
+	return detections, true
+}
+
+func (r *Runner) runLoop(step Step, detections []common.Detection, found *common.Detection) ([]common.Detection, bool) {
+	max := step.Loop.MaxIterations
+	if max <= 0 {
+		max = defaultMaxLoopIterations
+	}
+
+	for i := 0; i < max; i++ {
+		if !evalCondition(step.Loop.While, found) {
+			break
+		}
+
+		var ok bool
+		detections, ok = r.runSteps(step.Loop.Steps, detections)
+		if !ok {
+			return detections, false
+		}
+
+		if len(step.Find) > 0 {
+			found = vision.FindDetectionByClasses(detections, step.Find, common.MinConfidence)
+		}
+	}
+	return detections, true
+}
+
+func (r *Runner) runOnError(name string, detections []common.Detection) {
+	if name == "" {
+		return
+	}
+	flow, ok := r.Library[name]
+	if !ok {
+		log.Printf("script: on_error sub-flow %q not found in library", name)
+		return
+	}
+	r.runSteps(flow.Steps, detections)
+}
+
+func (r *Runner) resolveTap(spec *TapSpec, found *common.Detection) (int, int, bool) {
+	if spec.Detection {
+		if found == nil {
+			return 0, 0, false
+		}
+		return int(found.X), int(found.Y), true
+	}
+
+	if spec.Template != "" && r.Env.ResolveTapTarget != nil {
+		x, y := r.Env.ResolveTapTarget(spec.Template, spec.FallbackX, spec.FallbackY)
+		return x, y, true
+	}
+
+	return spec.FallbackX, spec.FallbackY, true
+}
+
+// evalCondition evaluates the small `detection.class == "x"` /
+// `detection.class != "x"` language When and Loop.While support. An
+// empty expr always holds. Anything else logs and evaluates false, so an
+// unsupported condition fails closed rather than silently running steps
+// it was meant to guard.
+func evalCondition(expr string, det *common.Detection) bool {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return true
+	}
+
+	op := "=="
+	idx := strings.Index(expr, "==")
+	if idx < 0 {
+		idx = strings.Index(expr, "!=")
+		op = "!="
+	}
+	if idx < 0 {
+		log.Printf("script: unsupported condition %q, treating as false", expr)
+		return false
+	}
+
+	lhs := strings.TrimSpace(expr[:idx])
+	rhs := strings.Trim(strings.TrimSpace(expr[idx+len(op):]), `"`)
+
+	var actual string
+	switch lhs {
+	case "detection.class":
+		if det != nil {
+			actual = det.Class
+		}
+	default:
+		log.Printf("script: unsupported condition left-hand side %q, treating as false", lhs)
+		return false
+	}
+
+	match := actual == rhs
+	if op == "!=" {
+		match = !match
+	}
+	return match
+}
@@ -0,0 +1,139 @@
+// Package script defines a declarative step sequence for gameplay flows
+// that would otherwise be near-identical imperative tap/wait Go functions
+// (TrainInfantry and TrainArchers being the motivating case - same shape,
+// different building and unit template names). A Flow is a small tree of
+// Steps: find a detection, tap it (or a named template/fallback
+// coordinate), wait, loop, branch on a condition, or fall back to a named
+// recovery sub-flow on error. internal/actions/script.Runner interprets a
+// Flow against live detections; see runner.go.
+//
+// Flows are JSON, not YAML: the repo has no go.mod and doesn't vendor a
+// YAML library, so a hand-rolled YAML parser would be the only option,
+// and that's a worse bet than the stdlib encoding/json this package
+// actually uses. A Flow authored as JSON is still just data a non-Go
+// contributor can edit to add a building, which is the part of the
+// original ask that matters.
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Flow is a named, ordered sequence of Steps.
+type Flow struct {
+	Name  string `json:"name"`
+	Steps []Step `json:"steps"`
+}
+
+// Step is one unit of a Flow. A Step can combine a Find guard, a Tap
+// action, a Wait, a When-guarded or Loop-repeated nested Steps, and an
+// OnError recovery sub-flow - whichever fields are set apply, in the
+// order Find, When, Tap, Wait, Loop/Steps.
+type Step struct {
+	// Find requires at least one of these detection classes to be present
+	// (above common.MinConfidence) before the rest of the step runs; the
+	// matched detection becomes available to Tap: "detection" and to When
+	// for the remainder of this step. Accepts a single string or a list in
+	// JSON (see stringList).
+	Find stringList `json:"find,omitempty"`
+
+	// Tap performs a humanized tap. Either "detection" (tap the Step's
+	// Find match) or an object naming a template with a hardcoded
+	// fallback coordinate, e.g. {"template": "train_button", "fallback_x":
+	// 450, "fallback_y": 300}.
+	Tap *TapSpec `json:"tap,omitempty"`
+
+	// Wait pauses for a duration (time.ParseDuration syntax, e.g. "1s",
+	// "500ms") before re-detecting, since a wait almost always precedes a
+	// new screen in these flows.
+	Wait string `json:"wait,omitempty"`
+
+	// When guards Steps with a condition evaluated against this step's
+	// Find match, e.g. `detection.class == "resource_full"`. Steps only
+	// run if When is empty or evaluates true.
+	When  string `json:"when,omitempty"`
+	Steps []Step `json:"steps,omitempty"`
+
+	// Loop re-runs Steps while Loop.While evaluates true against this
+	// step's Find match, re-finding it after each pass, up to
+	// Loop.MaxIterations times.
+	Loop *LoopSpec `json:"loop,omitempty"`
+
+	// OnError names a sub-flow in the Runner's Library to run (for its
+	// side effects, e.g. closing menus) when Find isn't satisfied or Tap
+	// fails - a composable substitute for the same three or four recovery
+	// taps copy-pasted at the end of every flow.
+	OnError string `json:"on_error,omitempty"`
+
+	// BestEffort marks a Tap whose failure shouldn't stop the flow or run
+	// OnError - just log and move on. Matches the original hand-written
+	// flows' habit of still trying a trailing "close whatever's open" tap
+	// even when there's nothing to confirm it worked.
+	BestEffort bool `json:"best_effort,omitempty"`
+}
+
+// LoopSpec bounds a Step.Loop: Steps repeats while While holds, capped at
+// MaxIterations (defaultMaxLoopIterations if unset) so a flow can't spin
+// forever against a detection that never changes.
+type LoopSpec struct {
+	While         string `json:"while"`
+	Steps         []Step `json:"steps"`
+	MaxIterations int    `json:"max_iterations,omitempty"`
+}
+
+// TapSpec names a Step's tap target: either the step's Find match
+// ({"tap": "detection"}) or a template/fallback coordinate pair
+// ({"tap": {"template": "...", "fallback_x": 0, "fallback_y": 0}}).
+type TapSpec struct {
+	Detection bool
+	Template  string
+	FallbackX int
+	FallbackY int
+}
+
+// UnmarshalJSON accepts either the literal string "detection" or a
+// {template, fallback_x, fallback_y} object.
+func (t *TapSpec) UnmarshalJSON(data []byte) error {
+	var asString string
+	if err := json.Unmarshal(data, &asString); err == nil {
+		if asString != "detection" {
+			return fmt.Errorf("script: tap string must be %q, got %q", "detection", asString)
+		}
+		t.Detection = true
+		return nil
+	}
+
+	var asObject struct {
+		Template  string `json:"template"`
+		FallbackX int    `json:"fallback_x"`
+		FallbackY int    `json:"fallback_y"`
+	}
+	if err := json.Unmarshal(data, &asObject); err != nil {
+		return fmt.Errorf("script: invalid tap spec: %w", err)
+	}
+	t.Template = asObject.Template
+	t.FallbackX = asObject.FallbackX
+	t.FallbackY = asObject.FallbackY
+	return nil
+}
+
+// stringList decodes from either a single JSON string or a JSON array of
+// strings, so a Step's "find" can name one class or several alternatives
+// without the author needing to remember which form to use.
+type stringList []string
+
+func (s *stringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = stringList{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("script: invalid find list: %w", err)
+	}
+	*s = many
+	return nil
+}
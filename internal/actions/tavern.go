@@ -1,15 +1,27 @@
 package actions
 
 import (
-	"log"
+	"context"
 	"roborok/internal/common"
+	"roborok/internal/logging"
 	"roborok/internal/state"
 	"roborok/internal/utils"
 	"time"
 )
 
-// CollectTavernChests attempts to collect free chests from the tavern
+func init() {
+	Register("collect_tavern_chests", CollectTavernChests)
+}
+
+// CollectTavernChests attempts to collect free chests from the tavern.
+//
+// Also not yet ported to the script engine (see script.Flow and
+// TrainInfantry): it writes to instanceState.TavernState.LastSilverChestTime
+// partway through, which the engine has no hook for since Env only knows
+// about detect/tap/resolve, not instance state. Worth adding once a
+// second flow needs it rather than building that hook for one caller.
 func CollectTavernChests(
+	ctx context.Context,
 	deviceID string,
 	gameView string,
 	detections []common.Detection,
@@ -17,11 +29,12 @@ func CollectTavernChests(
 	config common.TaskConfig,
 	instanceState *state.InstanceState,
 ) bool {
-	log.Printf("Attempting to collect tavern chests on device %s", deviceID)
+	fields := logging.Fields{"device_id": deviceID, "task": "collect_tavern_chests"}
+	logging.Emit(logging.Info, fields, "Attempting to collect tavern chests on device %s", deviceID)
 
 	// We need to be in city view
 	if gameView != "city" {
-		log.Println("Not in city view, cannot collect tavern chests")
+		logging.Emit(logging.Info, fields, "Not in city view, cannot collect tavern chests")
 		return false
 	}
 
@@ -37,53 +50,60 @@ func CollectTavernChests(
 
 	// If tavern not found or not clickable, nothing to do
 	if tavern == nil {
-		log.Println("Tavern not found or not clickable in detections")
+		logging.Emit(logging.Warning, fields, "Tavern not found or not clickable in detections")
 		return false
 	}
 
 	// Click on tavern
-	if err := utils.TapScreen(deviceID, adbPath, int(tavern.X), int(tavern.Y)); err != nil {
-		log.Printf("Failed to tap on tavern: %v", err)
+	if err := utils.HumanizedTap(deviceID, adbPath, int(tavern.X), int(tavern.Y), utils.DefaultTapOptions()); err != nil {
+		logging.Emit(logging.Error, fields, "Failed to tap on tavern: %v", err)
 		return false
 	}
 
 	// Wait for tavern interface to load
 	time.Sleep(1 * time.Second)
 
-	// Click where chest claim buttons would be
+	// Click where chest claim buttons would be, preferring a template
+	// match over the hardcoded fallback position when TemplatesDir is
+	// configured.
 	// Silver chest is typically in the middle-left
-	if err := utils.TapScreen(deviceID, adbPath, 150, 300); err != nil {
-		log.Printf("Failed to tap on silver chest claim: %v", err)
+	silverX, silverY := resolveTapTarget(deviceID, adbPath, "tavern_silver_chest_claim", 150, 300)
+	if err := utils.HumanizedTap(deviceID, adbPath, silverX, silverY, utils.DefaultTapOptions()); err != nil {
+		logging.Emit(logging.Error, fields, "Failed to tap on silver chest claim: %v", err)
 	} else {
-		log.Println("Tapped on potential silver chest location")
+		logging.Emit(logging.Info, fields, "Tapped on potential silver chest location")
 		// Wait for chest animation
 		time.Sleep(1 * time.Second)
 
 		// Click to dismiss rewards
-		utils.TapScreen(deviceID, adbPath, 300, 400) // Center of screen
+		dismissX, dismissY := resolveTapTarget(deviceID, adbPath, "dismiss_reward", 300, 400)
+		utils.HumanizedTap(deviceID, adbPath, dismissX, dismissY, utils.DefaultTapOptions())
 		time.Sleep(1 * time.Second)
 
 		instanceState.TavernState.LastSilverChestTime = time.Now()
 	}
 
 	// Gold chest is typically in the middle-right
-	if err := utils.TapScreen(deviceID, adbPath, 450, 300); err != nil {
-		log.Printf("Failed to tap on gold chest claim: %v", err)
+	goldX, goldY := resolveTapTarget(deviceID, adbPath, "tavern_gold_chest_claim", 450, 300)
+	if err := utils.HumanizedTap(deviceID, adbPath, goldX, goldY, utils.DefaultTapOptions()); err != nil {
+		logging.Emit(logging.Error, fields, "Failed to tap on gold chest claim: %v", err)
 	} else {
-		log.Println("Tapped on potential gold chest location")
+		logging.Emit(logging.Info, fields, "Tapped on potential gold chest location")
 		// Wait for chest animation
 		time.Sleep(1 * time.Second)
 
 		// Click to dismiss rewards
-		utils.TapScreen(deviceID, adbPath, 300, 400) // Center of screen
+		dismissX, dismissY := resolveTapTarget(deviceID, adbPath, "dismiss_reward", 300, 400)
+		utils.HumanizedTap(deviceID, adbPath, dismissX, dismissY, utils.DefaultTapOptions())
 		time.Sleep(1 * time.Second)
 	}
 
 	// Close tavern interface (typically top-right corner)
-	if err := utils.TapScreen(deviceID, adbPath, 550, 50); err != nil {
-		log.Printf("Failed to close tavern interface: %v", err)
+	closeX, closeY := resolveTapTarget(deviceID, adbPath, "close_x", 550, 50)
+	if err := utils.HumanizedTap(deviceID, adbPath, closeX, closeY, utils.DefaultTapOptions()); err != nil {
+		logging.Emit(logging.Error, fields, "Failed to close tavern interface: %v", err)
 	}
 
-	log.Println("Tavern chest collection completed")
+	logging.Emit(logging.Info, fields, "Tavern chest collection completed")
 	return true
 }
@@ -0,0 +1,79 @@
+package actions
+
+import (
+	"image"
+	"roborok/internal/logging"
+	"roborok/internal/utils"
+	"roborok/internal/vision"
+	"roborok/internal/vision/templates"
+)
+
+// tapTargetSearchMargin bounds resolveTapTarget's template search to a
+// region around the caller's fallback coordinate instead of the full
+// screenshot. templates.LocateTemplate is a brute-force NCC scan over every
+// scene position, each costing a full template-sized inner loop - run
+// against an uncropped ~1080x2400 screenshot that's seconds of synchronous
+// work per tap, stalling the instance and starving the shared ADB/vision
+// scheduler other instances depend on. fallbackX/fallbackY is already
+// expected to be close to the button's real position (it's only off by
+// however much a device's resolution or a minor UI shift moved it), so a
+// margin around it covers the same UI-shift tolerance at a fraction of the
+// cost - the same crop-before-match approach vision.EstimateOrientation
+// uses against a detection's bounding box. The margin must stay comfortably
+// bigger than any template's own dimensions, or LocateTemplate's match loop
+// never runs a single iteration against the cropped region and the template
+// silently never matches; every template bundled so far is well under
+// 300x300px.
+const tapTargetSearchMargin = 150
+
+// resolveTapTarget looks up templateName in GlobalConfig.TemplatesDir
+// against a fresh screenshot of deviceID, returning its matched coordinate
+// when the match clears templates.MatchThreshold. Otherwise it returns
+// fallbackX/fallbackY unchanged, so every caller keeps working exactly as
+// it did before template matching existed - whether because TemplatesDir
+// isn't configured, templateName has no reference PNG yet, or the match
+// just didn't clear the threshold on this screen.
+func resolveTapTarget(deviceID, adbPath, templateName string, fallbackX, fallbackY int) (int, int) {
+	dir := utils.GetConfig().Global.TemplatesDir
+	if dir == "" {
+		return fallbackX, fallbackY
+	}
+
+	fields := logging.Fields{"device_id": deviceID, "task": "resolve_tap_target"}
+
+	screenshot, err := vision.CaptureScreenshot(deviceID, adbPath)
+	if err != nil {
+		logging.Emit(logging.Error, fields, "resolveTapTarget: error capturing screenshot for %s: %v", templateName, err)
+		return fallbackX, fallbackY
+	}
+
+	// CropDetection clamps this against the decoded image's own bounds, so
+	// an out-of-range or negative edge here is harmless - only the clamped
+	// Min corner matters below, to translate the match back into full-frame
+	// coordinates.
+	searchRect := image.Rect(
+		fallbackX-tapTargetSearchMargin, fallbackY-tapTargetSearchMargin,
+		fallbackX+tapTargetSearchMargin, fallbackY+tapTargetSearchMargin,
+	)
+	if searchRect.Min.X < 0 {
+		searchRect.Min.X = 0
+	}
+	if searchRect.Min.Y < 0 {
+		searchRect.Min.Y = 0
+	}
+
+	region, err := vision.CropDetection(screenshot, searchRect)
+	if err != nil {
+		logging.Emit(logging.Error, fields, "resolveTapTarget: error cropping search region for %s: %v", templateName, err)
+		return fallbackX, fallbackY
+	}
+
+	x, y, confidence, ok := templates.LocateTemplate(region, dir, templateName)
+	if !ok {
+		return fallbackX, fallbackY
+	}
+	x, y = x+searchRect.Min.X, y+searchRect.Min.Y
+
+	logging.Emit(logging.Debug, fields, "Resolved %s via template match at (%d, %d), confidence %.2f", templateName, x, y, confidence)
+	return x, y
+}
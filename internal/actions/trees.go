@@ -1,16 +1,15 @@
 package actions
 
 import (
-	"fmt"
-	"log"
-	"os"
 	"roborok/internal/common"
+	"roborok/internal/logging"
 	"roborok/internal/state"
 	"roborok/internal/utils"
 	"time"
 )
 
-// TreeCoordinates defines locations of trees in the city
+// TreeCoordinates defines locations of trees in the city, captured at
+// referenceScreenWidth x referenceScreenHeight (see ScaleCoordinate).
 var TreeCoordinates = []struct {
 	X, Y int
 }{
@@ -35,7 +34,8 @@ var TreeCoordinates = []struct {
 	{176, 354},
 }
 
-// HarvestCoordinates defines where to click for the harvest button
+// HarvestCoordinates defines where to click for the harvest button, captured
+// at the same resolution as TreeCoordinates.
 var HarvestCoordinates = []struct {
 	X, Y int
 }{
@@ -60,20 +60,47 @@ var HarvestCoordinates = []struct {
 	{203, 406},
 }
 
-// Global state tracking
-var (
-	treeIndex        int  // Current tree index being processed
-	clearingComplete bool // Whether all trees have been cleared
-	viewResetDone    bool // Whether the view reset has been completed
+// referenceScreenWidth and referenceScreenHeight are the screen resolution
+// TreeCoordinates/HarvestCoordinates were recorded against. ScaleCoordinate
+// scales them onto whatever resolution the device actually reports, so a
+// profile running on a differently-sized emulator doesn't tap into empty
+// space.
+const (
+	referenceScreenWidth  = 640
+	referenceScreenHeight = 480
 )
 
+// ScaleCoordinate maps (x, y), captured at referenceScreenWidth x
+// referenceScreenHeight, onto a device reporting actualWidth x actualHeight.
+// actualWidth/actualHeight <= 0 (resolution unknown, e.g. GetScreenResolution
+// failed) returns (x, y) unchanged rather than dividing by zero.
+func ScaleCoordinate(x, y, actualWidth, actualHeight int) (int, int) {
+	if actualWidth <= 0 || actualHeight <= 0 {
+		return x, y
+	}
+	scaledX := x * actualWidth / referenceScreenWidth
+	scaledY := y * actualHeight / referenceScreenHeight
+	return scaledX, scaledY
+}
+
 // HomeButtonCoordinates for resetting view
 const (
 	HomeButtonX = 31
 	HomeButtonY = 450
 )
 
-// ClearTrees attempts to clear trees in the city using hardcoded coordinates
+// ClearTrees attempts to clear trees in the city using hardcoded coordinates.
+//
+// Unlike TrainInfantry/TrainArchers (see script.Flow), this one isn't ported
+// to the script engine: its behavior is driven by instanceState.TreeState
+// (TreeIndex, ClearingComplete, ViewResetDone) advancing across calls, not a
+// fixed step sequence per call, and per-tree coordinates deliberately bypass
+// template resolution (see the comment above the TreeCoordinates lookup
+// below) - there's
+// no single Flow that captures "tap whichever of 19 specific trees is next".
+// A script.Loop over a single generic "clear one tree" flow could express
+// the repetition, but not the cross-call index/viewReset bookkeeping; left
+// as future work rather than forcing a fit.
 func ClearTrees(
 	deviceID string,
 	gameView string,
@@ -82,21 +109,32 @@ func ClearTrees(
 	config common.TaskConfig,
 	instanceState *state.InstanceState,
 ) bool {
+	fields := logging.Fields{"device_id": deviceID, "task": "clear_trees"}
+	treeState := &instanceState.TreeState
+
 	// Skip if tree clearing was already completed
-	if clearingComplete {
-		log.Println("Tree clearing already completed, moving to next task")
+	if treeState.ClearingComplete {
+		logging.Emit(logging.Info, fields, "Tree clearing already completed, moving to next task")
 		return false
 	}
 
-	log.Printf("Tree harvesting with pre-set coordinates for device %s", deviceID)
+	logging.Emit(logging.Info, fields, "Tree harvesting with pre-set coordinates for device %s", deviceID)
+
+	actualWidth, actualHeight := 0, 0
+	if w, h, err := utils.GetScreenResolution(deviceID, adbPath); err != nil {
+		logging.Emit(logging.Warning, fields, "Could not determine screen resolution, using unscaled coordinates: %v", err)
+	} else {
+		actualWidth, actualHeight = w, h
+	}
 
 	// Handle view reset between sets of trees
-	if treeIndex == 13 && !viewResetDone {
-		log.Println("Resetting view to get to next set of trees...")
+	if treeState.TreeIndex == 13 && !treeState.ViewResetDone {
+		logging.Emit(logging.Info, fields, "Resetting view to get to next set of trees...")
 
 		// First tap on home button
-		if err := utils.TapScreen(deviceID, adbPath, HomeButtonX, HomeButtonY); err != nil {
-			log.Printf("Error tapping home button (first tap): %v", err)
+		homeX, homeY := resolveTapTarget(deviceID, adbPath, "home_button", HomeButtonX, HomeButtonY)
+		if err := utils.HumanizedTap(deviceID, adbPath, homeX, homeY, utils.DefaultTapOptions()); err != nil {
+			logging.Emit(logging.Error, fields, "Error tapping home button (first tap): %v", err)
 			return false
 		}
 
@@ -104,28 +142,30 @@ func ClearTrees(
 		time.Sleep(500 * time.Millisecond)
 
 		// Second tap on home button
-		if err := utils.TapScreen(deviceID, adbPath, HomeButtonX, HomeButtonY); err != nil {
-			log.Printf("Error tapping home button (second tap): %v", err)
+		homeX, homeY = resolveTapTarget(deviceID, adbPath, "home_button", HomeButtonX, HomeButtonY)
+		if err := utils.HumanizedTap(deviceID, adbPath, homeX, homeY, utils.DefaultTapOptions()); err != nil {
+			logging.Emit(logging.Error, fields, "Error tapping home button (second tap): %v", err)
 			return false
 		}
 
 		// Wait for view to reset
 		time.Sleep(1000 * time.Millisecond)
-		log.Println("View reset completed, ready for next trees")
+		logging.Emit(logging.Info, fields, "View reset completed, ready for next trees")
 
 		// Mark view reset as done to avoid looping
-		viewResetDone = true
+		treeState.ViewResetDone = true
 
 		return false // Return to get a fresh game state
 	}
 
 	// If we've gone through all trees, perform final reset and mark as complete
-	if treeIndex >= len(TreeCoordinates) {
-		log.Println("All tree coordinates have been processed, performing final view reset...")
+	if treeState.TreeIndex >= len(TreeCoordinates) {
+		logging.Emit(logging.Info, fields, "All tree coordinates have been processed, performing final view reset...")
 
 		// First tap on home button
-		if err := utils.TapScreen(deviceID, adbPath, HomeButtonX, HomeButtonY); err != nil {
-			log.Printf("Error tapping home button for final reset (first tap): %v", err)
+		homeX, homeY := resolveTapTarget(deviceID, adbPath, "home_button", HomeButtonX, HomeButtonY)
+		if err := utils.HumanizedTap(deviceID, adbPath, homeX, homeY, utils.DefaultTapOptions()); err != nil {
+			logging.Emit(logging.Error, fields, "Error tapping home button for final reset (first tap): %v", err)
 			// Continue even if there's an error
 		}
 
@@ -133,72 +173,73 @@ func ClearTrees(
 		time.Sleep(500 * time.Millisecond)
 
 		// Second tap on home button
-		if err := utils.TapScreen(deviceID, adbPath, HomeButtonX, HomeButtonY); err != nil {
-			log.Printf("Error tapping home button for final reset (second tap): %v", err)
+		homeX, homeY = resolveTapTarget(deviceID, adbPath, "home_button", HomeButtonX, HomeButtonY)
+		if err := utils.HumanizedTap(deviceID, adbPath, homeX, homeY, utils.DefaultTapOptions()); err != nil {
+			logging.Emit(logging.Error, fields, "Error tapping home button for final reset (second tap): %v", err)
 			// Continue even if there's an error
 		}
 
 		// Wait for view to reset
 		time.Sleep(1000 * time.Millisecond)
-		log.Println("Final view reset completed")
+		logging.Emit(logging.Info, fields, "Final view reset completed")
 
 		// Mark as complete
-		clearingComplete = true
-
-		// Record completion in a file
-		f, err := os.OpenFile("tree_clearing_complete.txt", os.O_CREATE|os.O_WRONLY, 0644)
-		if err == nil {
-			defer f.Close()
-			f.WriteString(fmt.Sprintf("Tree clearing completed at %s\n", time.Now().Format(time.RFC3339)))
-		}
+		treeState.ClearingComplete = true
 
 		return false
 	}
 
-	// Get current tree coordinates
-	tree := TreeCoordinates[treeIndex]
-	log.Printf("Processing tree %d/%d at position (%d, %d)",
-		treeIndex+1, len(TreeCoordinates), tree.X, tree.Y)
+	// TreeCoordinates/HarvestCoordinates aren't routed through
+	// resolveTapTarget: each index is a distinct tree at a distinct
+	// position, so a single "tree" template would just match whichever
+	// tree on screen happens to correlate best, not specifically the one
+	// at TreeIndex. Template matching only helps for a UI element that's
+	// the same image wherever it appears, like the home button above.
+	tree := TreeCoordinates[treeState.TreeIndex]
+	treeX, treeY := ScaleCoordinate(tree.X, tree.Y, actualWidth, actualHeight)
+	logging.Emit(logging.Info, fields, "Processing tree %d/%d at position (%d, %d)",
+		treeState.TreeIndex+1, len(TreeCoordinates), treeX, treeY)
 
 	// Click on the tree
-	if err := utils.TapScreen(deviceID, adbPath, tree.X, tree.Y); err != nil {
-		log.Printf("Error clicking tree at (%d, %d): %v", tree.X, tree.Y, err)
-		treeIndex++ // Move to next tree even if this one failed
+	if err := utils.HumanizedTap(deviceID, adbPath, treeX, treeY, utils.DefaultTapOptions()); err != nil {
+		logging.Emit(logging.Error, fields, "Error clicking tree at (%d, %d): %v", treeX, treeY, err)
+		treeState.TreeIndex++ // Move to next tree even if this one failed
 		return false
 	}
 
 	// Get corresponding harvest coordinates
-	harvest := HarvestCoordinates[treeIndex]
-	log.Printf("Clicking harvest at (%d, %d)", harvest.X, harvest.Y)
+	harvest := HarvestCoordinates[treeState.TreeIndex]
+	harvestX, harvestY := ScaleCoordinate(harvest.X, harvest.Y, actualWidth, actualHeight)
+	logging.Emit(logging.Info, fields, "Clicking harvest at (%d, %d)", harvestX, harvestY)
 
 	// Wait briefly for harvest button to appear
 	time.Sleep(500 * time.Millisecond)
 
 	// Click the harvest button
-	if err := utils.TapScreen(deviceID, adbPath, harvest.X, harvest.Y); err != nil {
-		log.Printf("Error clicking harvest at (%d, %d): %v", harvest.X, harvest.Y, err)
-		treeIndex++ // Move to next tree even if harvest failed
+	if err := utils.HumanizedTap(deviceID, adbPath, harvestX, harvestY, utils.DefaultTapOptions()); err != nil {
+		logging.Emit(logging.Error, fields, "Error clicking harvest at (%d, %d): %v", harvestX, harvestY, err)
+		treeState.TreeIndex++ // Move to next tree even if harvest failed
 		return false
 	}
 
 	// Log success
-	log.Printf("Successfully harvested tree %d/%d", treeIndex+1, len(TreeCoordinates))
+	logging.Emit(logging.Info, fields, "Successfully harvested tree %d/%d", treeState.TreeIndex+1, len(TreeCoordinates))
 
 	// Increment tree index for next run
-	treeIndex++
+	treeState.TreeIndex++
 
 	return true
 }
 
-// ResetTreeClearing resets the tree clearing state
-// This can be called if you want to restart the process
-func ResetTreeClearing() {
-	treeIndex = 0
-	clearingComplete = false
-	viewResetDone = false
-	log.Println("Tree clearing state has been reset")
+// ResetTreeClearing resets the tree clearing state for instanceState.
+// This can be called if you want to restart the process.
+func ResetTreeClearing(instanceState *state.InstanceState) {
+	instanceState.TreeState = state.TreeState{}
+	logging.Emit(logging.Info, logging.Fields{"task": "reset_tree_clearing"}, "Tree clearing state has been reset")
 }
 
-func IsTreeClearingComplete() bool {
-	return clearingComplete
+// IsTreeClearingComplete reports whether instanceState has finished clearing
+// all of TreeCoordinates.
+func IsTreeClearingComplete(instanceState *state.InstanceState) bool {
+	return instanceState.TreeState.ClearingComplete
 }
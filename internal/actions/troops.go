@@ -1,15 +1,102 @@
 package actions
 
 import (
-	"log"
+	"context"
+	"math/rand"
+	"roborok/internal/actions/script"
 	"roborok/internal/common"
+	"roborok/internal/logging"
 	"roborok/internal/state"
 	"roborok/internal/utils"
-	"time"
+	"roborok/internal/vision"
 )
 
+func init() {
+	Register("train_infantry", TrainInfantry)
+	Register("train_archers", TrainArchers)
+}
+
+// trainingRatioRoll reports whether a training task should proceed this
+// tick given TaskConfig.TrainingRatio - the share of ticks a
+// profile.Profile wants this unit type to get when multiple training
+// tasks are enabled for the same instance. Unset or out-of-range (the
+// default) always proceeds, so this only rations attempts when a profile
+// deliberately asks for it.
+func trainingRatioRoll(ratio float64) bool {
+	if ratio <= 0 || ratio >= 1 {
+		return true
+	}
+	return rand.Float64() < ratio
+}
+
+// trainingLibrary holds the recovery sub-flow trainingFlow's OnError
+// steps fall back to: close whatever menu is left open so the next
+// tick's detections aren't stuck behind it.
+var trainingLibrary = map[string]script.Flow{
+	"close_menus": {
+		Name: "close_menus",
+		Steps: []script.Step{
+			{Tap: &script.TapSpec{Template: "help_button", FallbackX: 320, FallbackY: 350}, BestEffort: true},
+			{Tap: &script.TapSpec{Template: "close_x", FallbackX: 50, FallbackY: 50}, BestEffort: true},
+		},
+	},
+}
+
+// trainingEnv builds a script.Env bound to deviceID/adbPath: the same
+// detect/tap/resolve plumbing every action function in this package
+// already does by hand, wired once for trainingFlow's Runner.
+func trainingEnv(deviceID, adbPath string) script.Env {
+	return script.Env{
+		Detect: func() ([]common.Detection, error) { return vision.CaptureAndDetect(deviceID, adbPath) },
+		Tap: func(x, y int) error {
+			return utils.HumanizedTap(deviceID, adbPath, x, y, utils.DefaultTapOptions())
+		},
+		ResolveTapTarget: func(templateName string, fallbackX, fallbackY int) (int, int) {
+			return resolveTapTarget(deviceID, adbPath, templateName, fallbackX, fallbackY)
+		},
+	}
+}
+
+// trainingFlow is TrainInfantry and TrainArchers's shared shape: open an
+// idle training building, pick a unit, train max, then best-effort close
+// whatever popup is left. Adding a new training building (siege
+// workshop, stable) is a new call to this function with that building's
+// detection classes and unit-select template, not a new copy of the
+// whole tap/sleep sequence.
+func trainingFlow(buildingClasses []string, unitSelectTemplate string, unitFallbackX, unitFallbackY int) script.Flow {
+	return script.Flow{
+		Name: "train_" + unitSelectTemplate,
+		Steps: []script.Step{
+			{
+				Find:    buildingClasses,
+				Tap:     &script.TapSpec{Detection: true},
+				Wait:    "1s",
+				OnError: "close_menus",
+			},
+			{
+				Tap:     &script.TapSpec{Template: "train_button", FallbackX: 450, FallbackY: 300},
+				Wait:    "1s",
+				OnError: "close_menus",
+			},
+			{
+				Tap:     &script.TapSpec{Template: unitSelectTemplate, FallbackX: unitFallbackX, FallbackY: unitFallbackY},
+				Wait:    "500ms",
+				OnError: "close_menus",
+			},
+			{
+				Tap:     &script.TapSpec{Template: "train_max", FallbackX: 450, FallbackY: 450},
+				Wait:    "1s",
+				OnError: "close_menus",
+			},
+			{Tap: &script.TapSpec{Template: "help_button", FallbackX: 320, FallbackY: 350}, BestEffort: true},
+			{Tap: &script.TapSpec{Template: "close_x", FallbackX: 50, FallbackY: 50}, BestEffort: true},
+		},
+	}
+}
+
 // TrainInfantry attempts to train infantry in the barracks
 func TrainInfantry(
+	ctx context.Context,
 	deviceID string,
 	gameView string,
 	detections []common.Detection,
@@ -17,83 +104,32 @@ func TrainInfantry(
 	config common.TaskConfig,
 	instanceState *state.InstanceState,
 ) bool {
-	log.Printf("Attempting to train infantry on device %s", deviceID)
+	logger := logging.FromContext(ctx)
+	logger.Printf("Attempting to train infantry on device %s", deviceID)
 
-	// We need to be in city view
 	if gameView != "city" {
-		log.Println("Not in city view, cannot train infantry")
+		logger.Printf("Not in city view, cannot train infantry")
 		return false
 	}
 
-	// Find the barracks building
-	var barracks *common.Detection
-	for _, det := range detections {
-		if (det.Class == "barracks_idle" || det.Class == "barracks_upgradeable_idle") &&
-			det.Confidence > common.MinConfidence {
-			barracks = &det
-			break
-		}
-	}
-
-	// If barracks not found or not idle, cannot proceed
-	if barracks == nil {
-		log.Println("Barracks not found or not idle in detections")
-		return false
-	}
-
-	// Click on barracks
-	if err := utils.TapScreen(deviceID, adbPath, int(barracks.X), int(barracks.Y)); err != nil {
-		log.Printf("Failed to tap on barracks: %v", err)
+	if !trainingRatioRoll(config.TrainingRatio) {
+		logger.Printf("Skipping infantry training this tick (training_ratio)")
 		return false
 	}
 
-	// Wait for menu to appear
-	time.Sleep(1 * time.Second)
-
-	// Click where train button would be (typically center-right)
-	if err := utils.TapScreen(deviceID, adbPath, 450, 300); err != nil {
-		log.Printf("Failed to tap on train button: %v", err)
-		return false
-	}
-
-	// Wait for troop selection screen
-	time.Sleep(1 * time.Second)
-
-	// Select infantry (typically leftmost option)
-	if err := utils.TapScreen(deviceID, adbPath, 150, 300); err != nil {
-		log.Printf("Failed to tap on infantry selection: %v", err)
-		return false
-	}
-
-	// Wait for selection
-	time.Sleep(500 * time.Millisecond)
-
-	// Click train max button (typically bottom-right)
-	if err := utils.TapScreen(deviceID, adbPath, 450, 450); err != nil {
-		log.Printf("Failed to tap on train max button: %v", err)
+	flow := trainingFlow([]string{"barracks_idle", "barracks_upgradeable_idle"}, "infantry_select", 150, 300)
+	runner := script.NewRunner(trainingEnv(deviceID, adbPath), trainingLibrary)
+	if !runner.Run(flow) {
 		return false
 	}
 
-	log.Println("Infantry training initiated")
-
-	// Wait for confirmation
-	time.Sleep(1 * time.Second)
-
-	// Click help button if available (typically center)
-	if err := utils.TapScreen(deviceID, adbPath, 320, 350); err != nil {
-		log.Printf("Failed to tap on help button: %v", err)
-	}
-
-	// Close menus by clicking top-left corner
-	if err := utils.TapScreen(deviceID, adbPath, 50, 50); err != nil {
-		log.Printf("Failed to close menus: %v", err)
-	}
-
+	logger.Printf("Infantry training initiated")
 	return true
 }
 
 // TrainArchers attempts to train archers in the archery range
 func TrainArchers(
+	ctx context.Context,
 	deviceID string,
 	gameView string,
 	detections []common.Detection,
@@ -101,78 +137,26 @@ func TrainArchers(
 	config common.TaskConfig,
 	instanceState *state.InstanceState,
 ) bool {
-	log.Printf("Attempting to train archers on device %s", deviceID)
+	logger := logging.FromContext(ctx)
+	logger.Printf("Attempting to train archers on device %s", deviceID)
 
-	// We need to be in city view
 	if gameView != "city" {
-		log.Println("Not in city view, cannot train archers")
-		return false
-	}
-
-	// Find the archery range building
-	var archeryRange *common.Detection
-	for _, det := range detections {
-		if (det.Class == "archery_range_idle" || det.Class == "archery_range_upgradeable_idle") &&
-			det.Confidence > common.MinConfidence {
-			archeryRange = &det
-			break
-		}
-	}
-
-	// If archery range not found or not idle, cannot proceed
-	if archeryRange == nil {
-		log.Println("Archery range not found or not idle in detections")
+		logger.Printf("Not in city view, cannot train archers")
 		return false
 	}
 
-	// Click on archery range
-	if err := utils.TapScreen(deviceID, adbPath, int(archeryRange.X), int(archeryRange.Y)); err != nil {
-		log.Printf("Failed to tap on archery range: %v", err)
+	if !trainingRatioRoll(config.TrainingRatio) {
+		logger.Printf("Skipping archer training this tick (training_ratio)")
 		return false
 	}
 
-	// Wait for menu to appear
-	time.Sleep(1 * time.Second)
-
-	// Click where train button would be (typically center-right)
-	if err := utils.TapScreen(deviceID, adbPath, 450, 300); err != nil {
-		log.Printf("Failed to tap on train button: %v", err)
+	flow := trainingFlow([]string{"archery_range_idle", "archery_range_upgradeable_idle"}, "archer_select", 150, 300)
+	runner := script.NewRunner(trainingEnv(deviceID, adbPath), trainingLibrary)
+	if !runner.Run(flow) {
 		return false
 	}
 
-	// Wait for troop selection screen
-	time.Sleep(1 * time.Second)
-
-	// Select archers (typically leftmost option)
-	if err := utils.TapScreen(deviceID, adbPath, 150, 300); err != nil {
-		log.Printf("Failed to tap on archer selection: %v", err)
-		return false
-	}
-
-	// Wait for selection
-	time.Sleep(500 * time.Millisecond)
-
-	// Click train max button (typically bottom-right)
-	if err := utils.TapScreen(deviceID, adbPath, 450, 450); err != nil {
-		log.Printf("Failed to tap on train max button: %v", err)
-		return false
-	}
-
-	log.Println("Archer training initiated")
-
-	// Wait for confirmation
-	time.Sleep(1 * time.Second)
-
-	// Click help button if available (typically center)
-	if err := utils.TapScreen(deviceID, adbPath, 320, 350); err != nil {
-		log.Printf("Failed to tap on help button: %v", err)
-	}
-
-	// Close menus by clicking top-left corner
-	if err := utils.TapScreen(deviceID, adbPath, 50, 50); err != nil {
-		log.Printf("Failed to close menus: %v", err)
-	}
-
+	logger.Printf("Archer training initiated")
 	return true
 }
 
@@ -192,7 +176,7 @@ func TrainTroops(
 	if gameView != "city" {
 
 		if !NavigateToCity(deviceID, gameView, detections, adbPath, config, instanceState) {
-			log.Println("Failed to navigate to city view")
+			logging.Emit(logging.Warning, logging.Fields{"device_id": deviceID, "task": "train_troops"}, "Failed to navigate to city view")
 			return false
 		}
 
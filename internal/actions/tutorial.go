@@ -1,9 +1,12 @@
 package actions
 
 import (
-	"log"
+	"math"
 	"math/rand"
+	"roborok/internal/actions/fsm"
 	"roborok/internal/common"
+	"roborok/internal/logging"
+	"roborok/internal/replay"
 	"roborok/internal/state"
 	"roborok/internal/utils"
 	"roborok/internal/vision"
@@ -11,10 +14,69 @@ import (
 	"time"
 )
 
-var civilizationScrollAttempts = 0
+// Context vars threaded through tutorialMachine, a fresh *fsm.Machine built
+// per RunTutorialAutomation call. Anything that needs to persist across
+// Ticks - the two completion flags that live on state.InstanceState, the
+// chosen civilization, and the civilization-carousel scroll count - travels
+// through fsm.Context.Vars instead of being captured in a closure or
+// package-level variable. (The old civilizationScrollAttempts package
+// variable this replaces was actually shared across every instance's
+// tutorial loop; keeping the count in Vars instead makes it per-call again.)
+const (
+	varUpgradeCompleteClicked = "tutorial_upgrade_complete_clicked"
+	varFinalArrowClicked      = "tutorial_final_arrow_clicked"
+	varPreferredCivilization  = "preferred_civilization"
+	varCivScrollAttempts      = "civilization_scroll_attempts"
+
+	// varArrowLastDX/DY and varArrowRepeatCount let handleArrowOnlyAction
+	// notice it inferred the same direction as last Tick, so repeated
+	// arrow-only states don't all tap the exact same spot - see its own
+	// doc comment.
+	varArrowLastDX      = "tutorial_arrow_last_dx"
+	varArrowLastDY      = "tutorial_arrow_last_dy"
+	varArrowRepeatCount = "tutorial_arrow_repeat_count"
+)
+
+func ctxBool(ctx *fsm.Context, key string) bool {
+	v, _ := ctx.Vars[key].(bool)
+	return v
+}
+
+func ctxString(ctx *fsm.Context, key string) string {
+	v, _ := ctx.Vars[key].(string)
+	return v
+}
+
+func ctxInt(ctx *fsm.Context, key string) int {
+	v, _ := ctx.Vars[key].(int)
+	return v
+}
+
+func ctxFloat(ctx *fsm.Context, key string) float64 {
+	v, _ := ctx.Vars[key].(float64)
+	return v
+}
+
+func hasClass(detections []common.Detection, class string) bool {
+	return detectionByClass(detections, class) != nil
+}
+
+// detectionByClass finds class in detections via vision.MatchSpec, the
+// same Classes/Require/MinConfidence matching WaitFor itself uses - so a
+// state's Guard/Action doesn't need its own "for _, detection := range
+// detections" loop. It doesn't call vision.WaitFor/WaitForGone: those poll
+// the device, and every state here already shares one capture per
+// RunTutorialAutomation Tick.
+func detectionByClass(detections []common.Detection, class string) *common.Detection {
+	return vision.MatchSpec(detections, vision.WaitSpec{Classes: []string{class}})
+}
 
 // IsTutorialComplete checks if the tutorial has been completed
 // It simply checks if we've completed both required steps in the sequence
+// IsTutorialComplete only ever inspects instanceState's own flags, not the
+// screen, so there's nothing here for vision.WaitFor to wait on - deviceID
+// and adbPath stay unused, kept for call-site compatibility with
+// manager.go.
 func IsTutorialComplete(deviceID, adbPath string, instanceState *state.InstanceState) (bool, error) {
 	// If we've already marked tutorial as completed, don't re-check
 	if instanceState.TutorialCompleted {
@@ -33,7 +95,14 @@ func IsTutorialComplete(deviceID, adbPath string, instanceState *state.InstanceS
 	return false, nil
 }
 
-// RunTutorialAutomation runs the tutorial automation with state tracking
+// RunTutorialAutomation runs the tutorial automation with state tracking.
+// screenshotter and detector default to live ADB capture and a dedicated
+// Roboflow tutorial-model detector when nil, which is what every call site
+// wants in production; a test or offline repro passes a *replay.Player
+// (which implements both) to drive the same FSM from a recorded session
+// instead of a real device, per internal/replay's own doc comment on why
+// this reuses vision.Screenshotter/vision.Detector rather than a new
+// interface.
 func RunTutorialAutomation(
 	deviceID string,
 	roboflowAPIKey string,
@@ -41,9 +110,12 @@ func RunTutorialAutomation(
 	adbPath string,
 	preferredCivilization string,
 	instanceState *state.InstanceState,
+	screenshotter vision.Screenshotter,
+	detector vision.Detector,
 ) bool {
-	log.Printf("Starting tutorial automation for device %s", deviceID)
-	log.Printf("Using civilization: %s", preferredCivilization)
+	fields := logging.Fields{"device_id": deviceID, "task": "tutorial_automation"}
+	logging.Emit(logging.Info, fields, "Starting tutorial automation for device %s", deviceID)
+	logging.Emit(logging.Info, fields, "Using civilization: %s", preferredCivilization)
 
 	// Use the provided API key or fall back to default
 	if roboflowAPIKey == "" {
@@ -65,20 +137,28 @@ func RunTutorialAutomation(
 		}
 	}
 
+	if screenshotter == nil {
+		screenshotter = vision.DefaultScreenshotter
+	}
+	if detector == nil {
+		detector = &vision.RoboflowDetector{APIKey: roboflowAPIKey, ModelID: roboflowModelID}
+	}
+
 	// Initialize random seed
 	rand.Seed(time.Now().UnixNano())
 
 	// Tutorial timeout (10 minutes should be more than enough for the tutorial)
 	tutorialTimeout := time.Now().Add(10 * time.Minute)
 
-	// Counters for tracking progress and detecting stuck states
 	iterationCount := 0
-	stuckIterationCount := 0
-	lastState := StateUnknown
-	stuckStateCount := 0
+	civScrollAttempts := 0
+	arrowLastDX, arrowLastDY := 0.0, 0.0
+	arrowRepeatCount := 0
 
-	// If we're in the same state for too many iterations, we might be stuck
-	const maxStuckIterations = 20
+	// Built per call, not shared: manager.go runs one RunTutorialAutomation
+	// goroutine per instance, and Machine's current/stuck-count bookkeeping
+	// isn't safe for concurrent use by more than one device at a time.
+	tutorialMachine := buildTutorialMachine()
 
 	// Main tutorial automation loop - run until timeout or completion
 	for time.Now().Before(tutorialTimeout) {
@@ -88,351 +168,192 @@ func RunTutorialAutomation(
 		if iterationCount%50 == 0 {
 			isComplete, err := IsTutorialComplete(deviceID, adbPath, instanceState)
 			if err != nil {
-				log.Printf("Error checking tutorial completion: %v", err)
+				logging.Emit(logging.Error, fields, "Error checking tutorial completion: %v", err)
 			} else if isComplete {
-				log.Println("Tutorial completed!")
+				logging.Emit(logging.Info, fields, "Tutorial completed!")
 				return true
 			}
 		}
 
 		// Capture screenshot
-		screenshot, err := vision.CaptureScreenshot(deviceID, adbPath)
+		screenshot, err := screenshotter.Capture(deviceID, adbPath)
 		if err != nil {
-			log.Printf("Error capturing screenshot: %v", err)
+			logging.Emit(logging.Error, fields, "Error capturing screenshot: %v", err)
 			time.Sleep(500 * time.Millisecond)
 			continue
 		}
 
-		// Send to Roboflow for analysis
-		resp, err := vision.SendToRoboflow(screenshot, roboflowAPIKey, roboflowModelID)
+		gameView, detections, err := detector.Analyze(screenshot)
 		if err != nil {
-			log.Printf("Error sending to Roboflow: %v", err)
+			logging.Emit(logging.Error, fields, "Error analyzing screenshot: %v", err)
 			time.Sleep(500 * time.Millisecond)
 			continue
 		}
-
-		// Convert to common.Detection format
-		var detections []common.Detection
-		for _, pred := range resp.Predictions {
-			detections = append(detections, common.Detection{
-				Class:      pred.Class,
-				X:          pred.X,
-				Y:          pred.Y,
-				Width:      pred.Width,
-				Height:     pred.Height,
-				Confidence: pred.Confidence,
-			})
-		}
+		replay.Default.RecordFrame(deviceID, screenshot, gameView, detections, instanceState)
 
 		// Log occasional detection information
 		if len(detections) > 0 {
-			log.Printf("Detected %d objects:", len(detections))
+			logging.Emit(logging.Debug, fields, "Detected %d objects:", len(detections))
 			for i, det := range detections {
-				log.Printf("  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
+				logging.Emit(logging.Debug, fields, "  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
 					i+1, det.Class, det.Confidence, det.X, det.Y, det.Width, det.Height)
 			}
 		}
 
-		// Determine the tutorial state
-		tutorialState := determineTutorialState(detections, preferredCivilization, instanceState)
-
-		// Check if we're stuck in the same state
-		if tutorialState == lastState {
-			stuckStateCount++
-		} else {
-			stuckStateCount = 0
-			lastState = tutorialState
-		}
-
-		// If we're stuck in the same state for too long, try a random tap
-		if stuckStateCount > maxStuckIterations {
-			log.Printf("Stuck in state %s for %d iterations, trying to unstick...",
-				tutorialState, stuckStateCount)
-
-			// Try a random tap in the center area
-			centerX := 200 + rand.Intn(200) // 200-400
-			centerY := 200 + rand.Intn(200) // 200-400
-			utils.TapScreen(deviceID, adbPath, centerX, centerY)
-
-			// Reset stuck counter
-			stuckStateCount = 0
-			time.Sleep(1 * time.Second)
-			continue
-		}
-
-		if tutorialState != StateUnknown {
-			log.Printf("Tutorial state: %s", tutorialState)
-		}
-
-		// Handle the current state
-		actionTaken := handleTutorialState(
-			deviceID,
-			adbPath,
-			detections,
-			tutorialState,
-			preferredCivilization,
-			instanceState,
-		)
-
-		if !actionTaken {
-			stuckIterationCount++
-
-			// If no action was taken for many iterations, try a different approach
-			if stuckIterationCount > 30 {
-				log.Println("No action taken for many iterations, checking for tutorial completion")
-
-				// Check if tutorial is actually complete
-				isComplete, _ := IsTutorialComplete(deviceID, adbPath, instanceState)
-				if isComplete {
-					log.Println("Tutorial was already completed!")
-					return true
-				}
-
-				// Try tapping center of screen to dismiss any dialogs
-				utils.TapScreen(deviceID, adbPath, 240, 400)
-				stuckIterationCount = 0
-				time.Sleep(1 * time.Second)
-			} else {
-				// Only sleep if no action was taken
-				time.Sleep(500 * time.Millisecond)
-			}
-		} else {
-			// Reset stuck counter when action is taken
-			stuckIterationCount = 0
+		ctx := &fsm.Context{
+			DeviceID:   deviceID,
+			ADBPath:    adbPath,
+			Detections: detections,
+			Screenshot: screenshot,
+			Vars: map[string]interface{}{
+				varUpgradeCompleteClicked: instanceState.TutorialUpgradeCompleteClicked,
+				varFinalArrowClicked:      instanceState.TutorialFinalArrowClicked,
+				varPreferredCivilization:  preferredCivilization,
+				varCivScrollAttempts:      civScrollAttempts,
+				varArrowLastDX:            arrowLastDX,
+				varArrowLastDY:            arrowLastDY,
+				varArrowRepeatCount:       arrowRepeatCount,
+			},
+		}
+
+		// tutorialMachine owns the priority ordering ("upgrade_complete
+		// clicked? only look for the final arrow now" used to be a
+		// conditional at the top of determineTutorialState, now it's just
+		// the FinalArrow state's Priority) as well as the stuck-state
+		// counter and unstick tap that used to live in this loop.
+		stateName, handled := tutorialMachine.Tick(ctx)
+
+		instanceState.TutorialUpgradeCompleteClicked = ctxBool(ctx, varUpgradeCompleteClicked)
+		instanceState.TutorialFinalArrowClicked = ctxBool(ctx, varFinalArrowClicked)
+		civScrollAttempts = ctxInt(ctx, varCivScrollAttempts)
+		arrowLastDX = ctxFloat(ctx, varArrowLastDX)
+		arrowLastDY = ctxFloat(ctx, varArrowLastDY)
+		arrowRepeatCount = ctxInt(ctx, varArrowRepeatCount)
+
+		if stateName != "" {
+			logging.Emit(logging.Info, fields, "Tutorial state: %s", stateName)
+		}
+
+		if !handled {
+			time.Sleep(500 * time.Millisecond)
 		}
 
 		// Check if we've completed both necessary steps in the sequence
 		if instanceState.TutorialUpgradeCompleteClicked &&
 			instanceState.TutorialFinalArrowClicked {
-			log.Println("Detected complete tutorial sequence (upgrade complete + final arrow)!")
+			logging.Emit(logging.Info, fields, "Detected complete tutorial sequence (upgrade complete + final arrow)!")
 			instanceState.TutorialCompleted = true
 			return true
 		}
 	}
 
-	log.Println("Tutorial automation timed out")
+	logging.Emit(logging.Warning, fields, "Tutorial automation timed out")
 	return false
 }
 
-// TutorialState represents the current state of the tutorial
-type TutorialState string
-
-const (
-	StateUnknown            TutorialState = "unknown"
-	StateSkipButton         TutorialState = "skip_button"
-	StateCounselorText      TutorialState = "counselor_text"
-	StateCivilizationSelect TutorialState = "civilization_select"
-	StateConfirmButton      TutorialState = "confirm_button"
-	StateArrowAndTarget     TutorialState = "arrow_and_target"
-	StateArrowOnly          TutorialState = "arrow_only"
-	StateUpgradeComplete    TutorialState = "upgrade_complete"
-	StateFinalArrow         TutorialState = "final_arrow"
-)
-
-// determineTutorialState analyzes detections to determine the current state
-// with awareness of our position in the tutorial completion sequence
-func determineTutorialState(
-	detections []common.Detection,
-	preferredCivilization string,
-	instanceState *state.InstanceState,
-) TutorialState {
-	// If we've already clicked upgrade_complete but not the final arrow,
-	// prioritize looking for ANY click_arrow + click_target combination
-	if instanceState.TutorialUpgradeCompleteClicked && !instanceState.TutorialFinalArrowClicked {
-		// Look for any arrow and target combination
-		hasArrow := false
-		hasTarget := false
-
-		for _, detection := range detections {
-			if detection.Class == "click_arrow" && detection.Confidence > common.MinConfidence {
-				hasArrow = true
-			}
-			if detection.Class == "click_target" && detection.Confidence > common.MinConfidence {
-				hasTarget = true
-			}
-		}
-
-		if hasArrow && hasTarget {
-			return StateFinalArrow
-		}
-	}
-
-	// If we haven't yet clicked upgrade_complete, prioritize finding it
-	if !instanceState.TutorialUpgradeCompleteClicked {
-		for _, detection := range detections {
-			if detection.Class == "upgrade_complete" && detection.Confidence > common.MinConfidence {
-				return StateUpgradeComplete
-			}
-		}
-	}
+// buildTutorialMachine registers the tutorial's states in priority order.
+// FinalArrow and UpgradeComplete carry the highest Priority because they
+// encode the "we're partway through the upgrade_complete -> final_arrow
+// completion sequence" pre-emption determineTutorialState used to check
+// before anything else; the rest keep the same relative order the old
+// function's sequential checks did. Called once per RunTutorialAutomation
+// call - see its call site's comment for why this isn't a shared package
+// variable.
+func buildTutorialMachine() *fsm.Machine {
+	m := fsm.NewMachine()
+	m.AddState(&fsm.State{Name: "FinalArrow", Priority: 100, Guard: finalArrowGuard, Action: handleFinalArrowAction})
+	m.AddState(&fsm.State{Name: "UpgradeComplete", Priority: 90, Guard: upgradeCompleteGuard, Action: handleUpgradeCompleteAction})
+	m.AddState(&fsm.State{Name: "SkipButton", Priority: 50, Guard: classGuard("skip button"), Action: handleSkipButtonAction})
+	m.AddState(&fsm.State{Name: "CounselorText", Priority: 45, Guard: classGuard("counselor text bubble"), Action: handleCounselorTextAction})
+	m.AddState(&fsm.State{Name: "CivSelect", Priority: 40, Guard: civSelectGuard, Action: handleCivilizationSelectionAction})
+	m.AddState(&fsm.State{Name: "ConfirmButton", Priority: 35, Guard: classGuard("confirm_button"), Action: handleConfirmButtonAction})
+	m.AddState(&fsm.State{Name: "ArrowAndTarget", Priority: 30, Guard: arrowAndTargetGuard, Action: handleArrowAndTargetAction})
+	m.AddState(&fsm.State{Name: "ArrowOnly", Priority: 25, Guard: classGuard("click_arrow"), Action: handleArrowOnlyAction})
+	return m
+}
 
-	// Standard tutorial state detection follows below
+func finalArrowGuard(ctx *fsm.Context) bool {
+	return ctxBool(ctx, varUpgradeCompleteClicked) && !ctxBool(ctx, varFinalArrowClicked) &&
+		hasClass(ctx.Detections, "click_arrow") && hasClass(ctx.Detections, "click_target")
+}
 
-	// Check for skip button
-	for _, detection := range detections {
-		if detection.Class == "skip button" && detection.Confidence > common.MinConfidence {
-			return StateSkipButton
-		}
-	}
+func upgradeCompleteGuard(ctx *fsm.Context) bool {
+	return !ctxBool(ctx, varUpgradeCompleteClicked) && hasClass(ctx.Detections, "upgrade_complete")
+}
 
-	// Check for counselor text
-	for _, detection := range detections {
-		if detection.Class == "counselor text bubble" && detection.Confidence > common.MinConfidence {
-			return StateCounselorText
-		}
-	}
+func classGuard(class string) func(*fsm.Context) bool {
+	return func(ctx *fsm.Context) bool { return hasClass(ctx.Detections, class) }
+}
 
-	// Check for civilization selection
-	// Look for civilizations to determine if we're on that screen
-	civCount := 0
-	for _, detection := range detections {
-		if isCivilization(detection.Class) {
-			civCount++
+func civSelectGuard(ctx *fsm.Context) bool {
+	count := 0
+	for _, d := range ctx.Detections {
+		if isCivilization(d.Class) {
+			count++
 		}
 	}
-
 	// If we see multiple civilizations, we're likely on the selection screen
-	if civCount >= 3 {
-		return StateCivilizationSelect
-	}
-
-	// Check for confirm button
-	for _, detection := range detections {
-		if detection.Class == "confirm_button" && detection.Confidence > common.MinConfidence {
-			return StateConfirmButton
-		}
-	}
-
-	// Check for both arrow and target
-	hasArrow := false
-	hasTarget := false
+	return count >= 3
+}
 
-	for _, detection := range detections {
-		if detection.Class == "click_arrow" && detection.Confidence > common.MinConfidence {
-			hasArrow = true
-		}
-		if detection.Class == "click_target" && detection.Confidence > common.MinConfidence {
-			hasTarget = true
-		}
-	}
+func arrowAndTargetGuard(ctx *fsm.Context) bool {
+	return hasClass(ctx.Detections, "click_arrow") && hasClass(ctx.Detections, "click_target")
+}
 
-	if hasArrow && hasTarget {
-		return StateArrowAndTarget
+func handleSkipButtonAction(ctx *fsm.Context) (string, bool) {
+	fields := logging.Fields{"device_id": ctx.DeviceID, "task": "tutorial_automation"}
+	det := detectionByClass(ctx.Detections, "skip button")
+	if det == nil {
+		return "", false
 	}
-
-	if hasArrow {
-		return StateArrowOnly
+	logging.Emit(logging.Info, fields, "Found skip button - clicking...")
+	if err := utils.TapScreen(ctx.DeviceID, ctx.ADBPath, int(det.X), int(det.Y)); err != nil {
+		logging.Emit(logging.Error, fields, "Failed to tap skip button: %v", err)
+		return "", false
 	}
-
-	return StateUnknown
+	return "", true
 }
 
-// handleTutorialState takes action based on the current state
-// and tracks our progress through the tutorial completion sequence
-func handleTutorialState(
-	deviceID, adbPath string,
-	detections []common.Detection,
-	state TutorialState,
-	preferredCivilization string,
-	instanceState *state.InstanceState,
-) bool {
-	switch state {
-	case StateUpgradeComplete:
-		if handled := handleUpgradeComplete(deviceID, adbPath, detections, instanceState); handled {
-			// Mark that we've clicked on upgrade complete
-			instanceState.TutorialUpgradeCompleteClicked = true
-			log.Println("Marked 'upgrade_complete' as clicked - looking for final arrow next")
-			return true
-		}
-		return false
-
-	case StateFinalArrow:
-		if handled := handleFinalArrow(deviceID, adbPath, detections, instanceState); handled {
-			// Mark that we've clicked on the final arrow
-			instanceState.TutorialFinalArrowClicked = true
-			log.Println("Marked final arrow as clicked - tutorial sequence complete!")
-			instanceState.TutorialCompleted = true
-			return true
-		}
-		return false
-
-	case StateSkipButton:
-		return handleSkipButton(deviceID, adbPath, detections)
-
-	case StateCounselorText:
-		return handleCounselorText(deviceID, adbPath, detections)
-
-	case StateCivilizationSelect:
-		return handleCivilizationSelection(deviceID, adbPath, detections, preferredCivilization)
-
-	case StateConfirmButton:
-		return handleConfirmButton(deviceID, adbPath, detections)
-
-	case StateArrowAndTarget:
-		return handleArrowAndTarget(deviceID, adbPath, detections)
-
-	case StateArrowOnly:
-		return handleArrowOnly(deviceID, adbPath, detections)
-
-	default:
-		// Don't log anything for unknown state to reduce noise
-		return false
+func handleCounselorTextAction(ctx *fsm.Context) (string, bool) {
+	fields := logging.Fields{"device_id": ctx.DeviceID, "task": "tutorial_automation"}
+	det := detectionByClass(ctx.Detections, "counselor text bubble")
+	if det == nil {
+		return "", false
 	}
-}
-
-// Individual handlers for each state
-
-func handleSkipButton(deviceID, adbPath string, detections []common.Detection) bool {
-	for _, detection := range detections {
-		if detection.Class == "skip button" && detection.Confidence > common.MinConfidence {
-			log.Println("Found skip button - clicking...")
-			if err := utils.TapScreen(deviceID, adbPath, int(detection.X), int(detection.Y)); err != nil {
-				log.Printf("Failed to tap skip button: %v", err)
-				return false
-			}
-			return true
-		}
+	logging.Emit(logging.Info, fields, "Found counselor text - clicking...")
+	if err := utils.TapScreen(ctx.DeviceID, ctx.ADBPath, int(det.X), int(det.Y)); err != nil {
+		logging.Emit(logging.Error, fields, "Failed to tap counselor text: %v", err)
+		return "", false
 	}
-	return false
+	return "", true
 }
 
-func handleCounselorText(deviceID, adbPath string, detections []common.Detection) bool {
-	for _, detection := range detections {
-		if detection.Class == "counselor text bubble" && detection.Confidence > common.MinConfidence {
-			log.Println("Found counselor text - clicking...")
-			if err := utils.TapScreen(deviceID, adbPath, int(detection.X), int(detection.Y)); err != nil {
-				log.Printf("Failed to tap counselor text: %v", err)
-				return false
-			}
-			return true
-		}
-	}
-	return false
-}
+// handleCivilizationSelectionAction has no fallback: if preferredCivilization
+// is never found, it keeps scrolling (resetting after maxScrollAttempts to
+// circle through the list again) rather than picking something else.
+func handleCivilizationSelectionAction(ctx *fsm.Context) (string, bool) {
+	fields := logging.Fields{"device_id": ctx.DeviceID, "task": "tutorial_automation"}
+	preferredCivilization := ctxString(ctx, varPreferredCivilization)
 
-// Updated function with no fallback
-func handleCivilizationSelection(deviceID, adbPath string, detections []common.Detection, preferredCivilization string) bool {
-	// Check if a civilization is already selected
-	// Check if our preferred civilization is selected
+	// Check if our preferred civilization is already selected
 	selectedCivClass := strings.ToLower(preferredCivilization) + "_selected"
-	for _, detection := range detections {
+	for _, detection := range ctx.Detections {
 		if strings.ToLower(detection.Class) == selectedCivClass && detection.Confidence > common.MinConfidence {
-			log.Printf("Found %s - preferred civilization selected", detection.Class)
+			logging.Emit(logging.Info, fields, "Found %s - preferred civilization selected", detection.Class)
 
 			// Find and click the confirm button
-			for _, btn := range detections {
-				if btn.Class == "confirm_button" && btn.Confidence > common.MinConfidence {
-					log.Println("Found confirm button - clicking...")
-					if err := utils.TapScreen(deviceID, adbPath, int(btn.X), int(btn.Y)); err != nil {
-						log.Printf("Failed to tap confirm button: %v", err)
-						return false
-					}
-					// Wait for confirmation
-					time.Sleep(1 * time.Second)
-					return true
-				}
+			btn := detectionByClass(ctx.Detections, "confirm_button")
+			if btn == nil {
+				return "", false
+			}
+			logging.Emit(logging.Info, fields, "Found confirm button - clicking...")
+			if err := utils.TapScreen(ctx.DeviceID, ctx.ADBPath, int(btn.X), int(btn.Y)); err != nil {
+				logging.Emit(logging.Error, fields, "Failed to tap confirm button: %v", err)
+				return "", false
 			}
-			return false
+			// Wait for confirmation
+			time.Sleep(1 * time.Second)
+			return "", true
 		}
 	}
 
@@ -440,56 +361,57 @@ func handleCivilizationSelection(deviceID, adbPath string, detections []common.D
 	detectedCivs := 0
 	var civDetections []common.Detection
 
-	for _, detection := range detections {
+	for _, detection := range ctx.Detections {
 		if isCivilization(detection.Class) {
 			detectedCivs++
 			civDetections = append(civDetections, detection)
 		}
 	}
 
-	log.Printf("Counted %d civilizations: ", detectedCivs)
+	logging.Emit(logging.Debug, fields, "Counted %d civilizations: ", detectedCivs)
 	for _, civ := range civDetections {
-		log.Printf("  - %s (confidence: %.2f)", civ.Class, civ.Confidence)
+		logging.Emit(logging.Debug, fields, "  - %s (confidence: %.2f)", civ.Class, civ.Confidence)
 	}
 
 	// Make sure we have enough civilizations visible
 	expectedMinCivs := 6
 	if detectedCivs < expectedMinCivs {
-		log.Printf("Only detected %d civilizations, waiting for better view (expecting at least %d)",
+		logging.Emit(logging.Info, fields, "Only detected %d civilizations, waiting for better view (expecting at least %d)",
 			detectedCivs, expectedMinCivs)
-		return false
+		return "", false
 	}
 
 	// Look for the preferred civilization
 	for _, detection := range civDetections {
 		if strings.ToLower(detection.Class) == strings.ToLower(preferredCivilization) && detection.Confidence > 0.5 {
-			log.Printf("Found %s (confidence: %.2f) - clicking...", preferredCivilization, detection.Confidence)
-			if err := utils.TapScreen(deviceID, adbPath, int(detection.X), int(detection.Y)); err != nil {
-				log.Printf("Failed to tap %s: %v", preferredCivilization, err)
-				return false
+			logging.Emit(logging.Info, fields, "Found %s (confidence: %.2f) - clicking...", preferredCivilization, detection.Confidence)
+			if err := utils.TapScreen(ctx.DeviceID, ctx.ADBPath, int(detection.X), int(detection.Y)); err != nil {
+				logging.Emit(logging.Error, fields, "Failed to tap %s: %v", preferredCivilization, err)
+				return "", false
 			}
 			// Wait for selection to take effect
 			time.Sleep(1 * time.Second)
 			// Reset scroll attempts on success
-			civilizationScrollAttempts = 0
-			return true
+			ctx.Vars[varCivScrollAttempts] = 0
+			return "", true
 		}
 	}
 
 	// If preferred civilization not found, try to scroll right
 	maxScrollAttempts := 5 // Increased from 3 to give more chances to find
+	scrollAttempts := ctxInt(ctx, varCivScrollAttempts)
 
 	// After reaching max scroll attempts, reset and start over
 	// This ensures we can circle through all civilizations
-	if civilizationScrollAttempts >= maxScrollAttempts {
-		log.Printf("Reached maximum scroll attempts (%d), resetting to try again", maxScrollAttempts)
-		civilizationScrollAttempts = 0
+	if scrollAttempts >= maxScrollAttempts {
+		logging.Emit(logging.Info, fields, "Reached maximum scroll attempts (%d), resetting to try again", maxScrollAttempts)
+		ctx.Vars[varCivScrollAttempts] = 0
 		time.Sleep(1 * time.Second)
-		return false
+		return "", false
 	}
 
-	log.Printf("Preferred civilization '%s' not found, scrolling right (attempt %d/%d)",
-		preferredCivilization, civilizationScrollAttempts+1, maxScrollAttempts)
+	logging.Emit(logging.Info, fields, "Preferred civilization '%s' not found, scrolling right (attempt %d/%d)",
+		preferredCivilization, scrollAttempts+1, maxScrollAttempts)
 
 	// Find rightmost and leftmost civilizations
 	var rightmost, leftmost *common.Detection
@@ -513,73 +435,132 @@ func handleCivilizationSelection(deviceID, adbPath string, detections []common.D
 		endX := int(leftmost.X)
 		endY := int(leftmost.Y)
 
-		log.Printf("Swiping from (%d,%d) to (%d,%d)", startX, startY, endX, endY)
-		if err := utils.SwipeScreen(deviceID, adbPath, startX, startY, endX, endY, 300); err != nil {
-			log.Printf("Failed to swipe: %v", err)
-			return false
-		} else {
-			civilizationScrollAttempts++
-			// Wait after scrolling
-			time.Sleep(1 * time.Second)
-			return true
+		logging.Emit(logging.Info, fields, "Swiping from (%d,%d) to (%d,%d)", startX, startY, endX, endY)
+		if err := utils.SwipeScreen(ctx.DeviceID, ctx.ADBPath, startX, startY, endX, endY, 300); err != nil {
+			logging.Emit(logging.Error, fields, "Failed to swipe: %v", err)
+			return "", false
 		}
+		ctx.Vars[varCivScrollAttempts] = scrollAttempts + 1
+		// Wait after scrolling
+		time.Sleep(1 * time.Second)
+		return "", true
 	}
 
-	log.Printf("Could not find suitable points to scroll. Still looking for '%s'...", preferredCivilization)
-	return false
+	logging.Emit(logging.Info, fields, "Could not find suitable points to scroll. Still looking for '%s'...", preferredCivilization)
+	return "", false
 }
 
-func handleConfirmButton(deviceID, adbPath string, detections []common.Detection) bool {
-	for _, detection := range detections {
-		if detection.Class == "confirm_button" && detection.Confidence > common.MinConfidence {
-			log.Println("Found confirm button - clicking...")
-			if err := utils.TapScreen(deviceID, adbPath, int(detection.X), int(detection.Y)); err != nil {
-				log.Printf("Failed to tap confirm button: %v", err)
-				return false
-			}
-			return true
-		}
+func handleConfirmButtonAction(ctx *fsm.Context) (string, bool) {
+	fields := logging.Fields{"device_id": ctx.DeviceID, "task": "tutorial_automation"}
+	det := detectionByClass(ctx.Detections, "confirm_button")
+	if det == nil {
+		return "", false
 	}
-	return false
+	logging.Emit(logging.Info, fields, "Found confirm button - clicking...")
+	if err := utils.TapScreen(ctx.DeviceID, ctx.ADBPath, int(det.X), int(det.Y)); err != nil {
+		logging.Emit(logging.Error, fields, "Failed to tap confirm button: %v", err)
+		return "", false
+	}
+	return "", true
 }
 
-func handleArrowAndTarget(deviceID, adbPath string, detections []common.Detection) bool {
-	var target *common.Detection
-
-	for _, detection := range detections {
-		if detection.Class == "click_target" && detection.Confidence > common.MinConfidence {
-			target = &detection
-			break
-		}
+func handleArrowAndTargetAction(ctx *fsm.Context) (string, bool) {
+	fields := logging.Fields{"device_id": ctx.DeviceID, "task": "tutorial_automation"}
+	target := detectionByClass(ctx.Detections, "click_target")
+	if target == nil {
+		return "", false
 	}
 
-	if target != nil {
-		log.Println("Found arrow and target - clicking target...")
-		if err := utils.TapScreen(deviceID, adbPath, int(target.X), int(target.Y)); err != nil {
-			log.Printf("Failed to tap target: %v", err)
-			return false
-		}
-		return true
+	logging.Emit(logging.Info, fields, "Found arrow and target - clicking target...")
+	if err := utils.TapScreen(ctx.DeviceID, ctx.ADBPath, int(target.X), int(target.Y)); err != nil {
+		logging.Emit(logging.Error, fields, "Failed to tap target: %v", err)
+		return "", false
 	}
-
-	return false
+	return "", true
 }
 
-func handleArrowOnly(deviceID, adbPath string, detections []common.Detection) bool {
-	var arrow *common.Detection
+// defaultArrowTapDistancePx is used when GlobalConfig.ArrowTapDistancePx is
+// unset.
+const defaultArrowTapDistancePx = 100.0
+
+// sameDirectionThreshold bounds how close two unit vectors must be (by
+// Euclidean distance, not angle) to count as "the same direction arrow-only
+// pointed last Tick" - small enough that it won't conflate two of the 4
+// cardinal directions with each other.
+const sameDirectionThreshold = 0.1
+
+// handleArrowOnlyAction estimates the click_arrow detection's pointing
+// direction via vision.EstimateOrientation and taps k pixels past its
+// center in that direction, k from GlobalConfig.ArrowTapDistancePx (see
+// arrowTapDistancePx). If EstimateOrientation can't resolve a direction
+// (GlobalConfig.TemplatesDir unset, or none of the 4 arrow templates match
+// above threshold), it reports unhandled and leaves recovery to Machine's
+// stuck-state unstick tap, same as before this was implemented.
+//
+// Repeatedly inferring the same direction means the last tap didn't move
+// things along, so each consecutive repeat extends k further out instead
+// of tapping the same spot again - mirroring how
+// handleCivilizationSelectionAction's scrollAttempts already varies its
+// swipe instead of repeating the same one blindly.
+func handleArrowOnlyAction(ctx *fsm.Context) (string, bool) {
+	fields := logging.Fields{"device_id": ctx.DeviceID, "task": "tutorial_automation"}
+	det := detectionByClass(ctx.Detections, "click_arrow")
+	if det == nil {
+		return "", false
+	}
+
+	templatesDir := utils.GetConfig().Global.TemplatesDir
+	dx, dy, ok := vision.EstimateOrientation(ctx.Screenshot, *det, templatesDir)
+	if !ok {
+		logging.Emit(logging.Debug, fields, "Could not estimate click_arrow direction")
+		return "", false
+	}
+
+	lastDX, lastDY := ctxFloat(ctx, varArrowLastDX), ctxFloat(ctx, varArrowLastDY)
+	repeatCount := ctxInt(ctx, varArrowRepeatCount)
+	if math.Hypot(dx-lastDX, dy-lastDY) < sameDirectionThreshold {
+		repeatCount++
+	} else {
+		repeatCount = 0
+	}
+	ctx.Vars[varArrowLastDX] = dx
+	ctx.Vars[varArrowLastDY] = dy
+	ctx.Vars[varArrowRepeatCount] = repeatCount
+
+	k := arrowTapDistancePx() * (1 + float64(repeatCount)*0.5)
+	x := int(det.X + k*dx)
+	y := int(det.Y + k*dy)
+	if width, height, err := vision.ImageBounds(ctx.Screenshot); err == nil {
+		x = clampInt(x, 0, width-1)
+		y = clampInt(y, 0, height-1)
+	}
+
+	logging.Emit(logging.Info, fields, "Found click_arrow pointing (%.2f, %.2f) - tapping (%d, %d), %dpx out (repeat %d)",
+		dx, dy, x, y, int(k), repeatCount)
+	if err := utils.TapScreen(ctx.DeviceID, ctx.ADBPath, x, y); err != nil {
+		logging.Emit(logging.Error, fields, "Failed to tap in arrow direction: %v", err)
+		return "", false
+	}
+	return "", true
+}
 
-	for _, detection := range detections {
-		if detection.Class == "click_arrow" && detection.Confidence > common.MinConfidence {
-			arrow = &detection
-			break
-		}
+// arrowTapDistancePx returns GlobalConfig.ArrowTapDistancePx, or
+// defaultArrowTapDistancePx if unset.
+func arrowTapDistancePx() float64 {
+	if k := utils.GetConfig().Global.ArrowTapDistancePx; k > 0 {
+		return k
 	}
+	return defaultArrowTapDistancePx
+}
 
-	if arrow != nil {
-		// could look at arrow direction and attempt a click 100px in that direction..
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
 	}
-
-	return false
+	if v > max {
+		return max
+	}
+	return v
 }
 
 // isCivilization checks if a class name is a civilization
@@ -599,60 +580,64 @@ func isCivilization(className string) bool {
 	return false
 }
 
-// Handler for upgrade complete notification
-func handleUpgradeComplete(deviceID, adbPath string, detections []common.Detection, instanceState *state.InstanceState) bool {
-	for _, detection := range detections {
+// handleUpgradeCompleteAction taps just below the "upgrade_complete"
+// notification's bottom edge, which is what the old handleUpgradeComplete
+// found worked better than tapping the notification itself.
+func handleUpgradeCompleteAction(ctx *fsm.Context) (string, bool) {
+	fields := logging.Fields{"device_id": ctx.DeviceID, "task": "tutorial_automation"}
+	for _, detection := range ctx.Detections {
 		if detection.Class == "upgrade_complete" && detection.Confidence > common.MinConfidence {
-			// Calculate position to click - just outside the bottom edge
-			xPos := int(detection.X)                               // Center horizontally
+			xPos := int(detection.X)                              // Center horizontally
 			yPos := int(detection.Y + (detection.Height / 2) + 20) // 20px below the bottom edge
 
-			log.Printf("Found 'upgrade_complete' notification - clicking just below bottom edge at (%d, %d)", xPos, yPos)
+			logging.Emit(logging.Info, fields, "Found 'upgrade_complete' notification - clicking just below bottom edge at (%d, %d)", xPos, yPos)
 
-			if err := utils.TapScreen(deviceID, adbPath, xPos, yPos); err != nil {
-				log.Printf("Failed to tap upgrade_complete: %v", err)
-				return false
+			if err := utils.TapScreen(ctx.DeviceID, ctx.ADBPath, xPos, yPos); err != nil {
+				logging.Emit(logging.Error, fields, "Failed to tap upgrade_complete: %v", err)
+				return "", false
 			}
 
-			// Mark as clicked
-			instanceState.TutorialUpgradeCompleteClicked = true
-			log.Println("Marked 'upgrade_complete' as clicked - looking for final arrow next")
+			ctx.Vars[varUpgradeCompleteClicked] = true
+			logging.Emit(logging.Info, fields, "Marked 'upgrade_complete' as clicked - looking for final arrow next")
 
 			// Wait for UI to update
 			time.Sleep(1 * time.Second)
-			return true
+			return "", true
 		}
 	}
-	return false
+	return "", false
 }
 
-// Handler for the final arrow after upgrade_complete
-func handleFinalArrow(deviceID, adbPath string, detections []common.Detection, instanceState *state.InstanceState) bool {
-	// Find the best target to click (highest confidence)
+// handleFinalArrowAction clicks the highest-confidence click_target once
+// upgrade_complete has already been clicked, completing the tutorial.
+func handleFinalArrowAction(ctx *fsm.Context) (string, bool) {
+	fields := logging.Fields{"device_id": ctx.DeviceID, "task": "tutorial_automation"}
 	var bestTarget *common.Detection
 	var bestConfidence float64
 
-	// Look through all click_targets
-	for _, detection := range detections {
+	for _, detection := range ctx.Detections {
 		if detection.Class == "click_target" && detection.Confidence > common.MinConfidence {
 			if detection.Confidence > bestConfidence {
-				bestTarget = &detection
+				det := detection
+				bestTarget = &det
 				bestConfidence = detection.Confidence
 			}
 		}
 	}
 
-	// If we found a target, click it
-	if bestTarget != nil {
-		log.Println("Found final arrow/target - clicking to complete tutorial")
-		if err := utils.TapScreen(deviceID, adbPath, int(bestTarget.X), int(bestTarget.Y)); err != nil {
-			log.Printf("Failed to tap final target: %v", err)
-			return false
-		}
-		// Wait for the tutorial to fully complete
-		time.Sleep(1 * time.Second)
-		return true
+	if bestTarget == nil {
+		return "", false
 	}
 
-	return false
+	logging.Emit(logging.Info, fields, "Found final arrow/target - clicking to complete tutorial")
+	if err := utils.TapScreen(ctx.DeviceID, ctx.ADBPath, int(bestTarget.X), int(bestTarget.Y)); err != nil {
+		logging.Emit(logging.Error, fields, "Failed to tap final target: %v", err)
+		return "", false
+	}
+
+	ctx.Vars[varFinalArrowClicked] = true
+	logging.Emit(logging.Info, fields, "Marked final arrow as clicked - tutorial sequence complete!")
+	// Wait for the tutorial to fully complete
+	time.Sleep(1 * time.Second)
+	return "", true
 }
@@ -0,0 +1,125 @@
+package actions
+
+import (
+	"path/filepath"
+	"testing"
+
+	"roborok/internal/common"
+	"roborok/internal/replay"
+	"roborok/internal/state"
+	"roborok/internal/vision"
+)
+
+// noopAdbPath is a stand-in adbPath for tests that drive RunTutorialAutomation
+// far enough to call utils.TapScreen: /usr/bin/true ignores whatever args
+// it's given and always exits 0, which is all TapScreen's exec.Command needs
+// from adb here.
+const noopAdbPath = "/usr/bin/true"
+
+// tutorialFrames is the two-detection-frame sequence that drives
+// RunTutorialAutomation's FSM to TutorialCompleted: an upgrade_complete
+// popup, then the click_arrow/click_target pair handleFinalArrowAction
+// expects once upgrade_complete has already been clicked.
+var tutorialFrames = []struct {
+	gameView   string
+	detections []common.Detection
+}{
+	{
+		gameView: "tutorial",
+		detections: []common.Detection{
+			{Class: "upgrade_complete", X: 360, Y: 900, Width: 200, Height: 60, Confidence: 0.95},
+		},
+	},
+	{
+		gameView: "tutorial",
+		detections: []common.Detection{
+			{Class: "click_arrow", X: 360, Y: 640, Width: 80, Height: 80, Confidence: 0.9},
+			{Class: "click_target", X: 500, Y: 700, Width: 80, Height: 80, Confidence: 0.95},
+		},
+	},
+}
+
+// TestRunTutorialAutomation_FakeDetector drives RunTutorialAutomation with a
+// vision.FakeDetector standing in for a live Roboflow call, proving the
+// canned-detector seam FakeDetector exists for is actually usable by a real
+// caller outside the vision package.
+func TestRunTutorialAutomation_FakeDetector(t *testing.T) {
+	detector := &vision.FakeDetector{}
+	for _, f := range tutorialFrames {
+		detector.Responses = append(detector.Responses, vision.FakeDetectorResponse{
+			GameView:   f.gameView,
+			Detections: f.detections,
+		})
+	}
+	instanceState := &state.InstanceState{ID: "emulator-5554", DeviceID: "emulator-5554"}
+
+	done := RunTutorialAutomation("emulator-5554", "key", "model", noopAdbPath, "Romans",
+		instanceState, fakeScreenshotter{}, detector)
+
+	if !done {
+		t.Fatal("RunTutorialAutomation: want true (tutorial completed), got false")
+	}
+	if !instanceState.TutorialCompleted {
+		t.Error("instanceState.TutorialCompleted: want true, got false")
+	}
+}
+
+// fakeScreenshotter returns a fixed, valid (but otherwise meaningless) PNG
+// for every Capture call - FakeDetector.Analyze ignores the screenshot bytes
+// entirely, so the only requirement here is a non-error Capture.
+type fakeScreenshotter struct{}
+
+func (fakeScreenshotter) Capture(deviceID, adbPath string) ([]byte, error) {
+	return onePixelPNG, nil
+}
+
+// onePixelPNG is a minimal valid 1x1 transparent PNG.
+var onePixelPNG = []byte{
+	0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0x00, 0x00, 0x0d,
+	0x49, 0x48, 0x44, 0x52, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+	0x08, 0x06, 0x00, 0x00, 0x00, 0x1f, 0x15, 0xc4, 0x89, 0x00, 0x00, 0x00,
+	0x0a, 0x49, 0x44, 0x41, 0x54, 0x78, 0x9c, 0x63, 0x00, 0x01, 0x00, 0x00,
+	0x05, 0x00, 0x01, 0x0d, 0x0a, 0x2d, 0xb4, 0x00, 0x00, 0x00, 0x00, 0x49,
+	0x45, 0x4e, 0x44, 0xae, 0x42, 0x60, 0x82,
+}
+
+// TestRunTutorialAutomation_Replay records the same two-frame sequence to a
+// session archive via replay.Recorder, loads it back with replay.NewPlayer,
+// and drives RunTutorialAutomation off the Player the way a recorded-session
+// bug repro would - proving chunk8-3's record/replay path actually reaches
+// TutorialCompleted on a canned session instead of sitting untested.
+func TestRunTutorialAutomation_Replay(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := replay.NewRecorder(dir)
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+	for _, f := range tutorialFrames {
+		rec.RecordFrame("emulator-5554", onePixelPNG, f.gameView, f.detections, &state.InstanceState{})
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Recorder.Close: %v", err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "session_*.tar.gz"))
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("expected exactly one session archive, got %v (err %v)", matches, err)
+	}
+
+	player, err := replay.NewPlayer(matches[0])
+	if err != nil {
+		t.Fatalf("NewPlayer: %v", err)
+	}
+
+	instanceState := &state.InstanceState{ID: "emulator-5554", DeviceID: "emulator-5554"}
+
+	done := RunTutorialAutomation("emulator-5554", "key", "model", noopAdbPath, "Romans",
+		instanceState, player, player)
+
+	if !done {
+		t.Fatal("RunTutorialAutomation: want true (tutorial completed), got false")
+	}
+	if !instanceState.TutorialCompleted {
+		t.Error("instanceState.TutorialCompleted: want true, got false")
+	}
+}
@@ -1,13 +1,76 @@
 package actions
 
 import (
-	"log"
 	"roborok/internal/common"
+	"roborok/internal/logging"
 	"roborok/internal/state"
+	"roborok/internal/uilocator"
 	"roborok/internal/utils"
 	"time"
 )
 
+// vipLogFields are the logging.Fields every CollectVIPRewards log line
+// carries, so an operator watching logging.DefaultBus (e.g. over ctlapi's
+// /events) can filter to this task by device_id or task.
+func vipLogFields(deviceID string) logging.Fields {
+	return logging.Fields{"device_id": deviceID, "task": "collect_vip_rewards"}
+}
+
+// vipLocators are CollectVIPRewards's named tap targets, resolved at
+// runtime by uilocator.Resolve: a live detection class first (none of
+// these exist in the vision model yet, so every tap currently falls
+// through and logs a "locator miss" - that's the point, it's how we'll
+// see these get promoted to real detection classes), then a
+// screen-fraction fallback captured against referenceScreenWidth x
+// referenceScreenHeight (see trees.go), replacing what used to be raw
+// literals like TapScreen(deviceID, adbPath, 320, 200).
+// GlobalConfig.LocatorsPath can override any of these without a code
+// change - see resolveHandlerLocator.
+//
+// Note CollectVIPRewards resolves every locator against the single
+// detections snapshot it was called with, taken before the VIP interface
+// even opened - so until this handler also re-detects after opening the
+// VIP screen, these detection classes can never actually match and every
+// tap runs on the fraction fallback. That's still strictly better than a
+// bare literal (resolution-independent, and visible as locator misses),
+// but real use of the detection path needs that re-detect too.
+var vipLocators = uilocator.Table{
+	"vip_menu_item": {
+		Name:           "vip_menu_item",
+		DetectionClass: "vip_menu_item",
+		FracX:          320.0 / referenceScreenWidth,
+		FracY:          200.0 / referenceScreenHeight,
+	},
+	"vip_points_claim": {
+		Name:           "vip_points_claim",
+		DetectionClass: "vip_points_claim_button",
+		FracX:          150.0 / referenceScreenWidth,
+		FracY:          300.0 / referenceScreenHeight,
+	},
+	"vip_chest_claim": {
+		Name:           "vip_chest_claim",
+		DetectionClass: "vip_chest_claim_button",
+		FracX:          450.0 / referenceScreenWidth,
+		FracY:          300.0 / referenceScreenHeight,
+	},
+	"vip_close": {
+		Name:           "vip_close",
+		DetectionClass: "close_x",
+		FracX:          550.0 / referenceScreenWidth,
+		FracY:          50.0 / referenceScreenHeight,
+	},
+}
+
+// tapVIPLocator resolves name against vipLocators (honoring
+// GlobalConfig.LocatorsPath overrides) and taps it.
+func tapVIPLocator(deviceID, adbPath, name string, detections []common.Detection) error {
+	x, y, err := resolveHandlerLocator(deviceID, adbPath, vipLocators, name, detections)
+	if err != nil {
+		return err
+	}
+	return utils.TapScreen(deviceID, adbPath, x, y)
+}
+
 // CollectVIPRewards attempts to collect VIP rewards
 func CollectVIPRewards(
 	deviceID string,
@@ -17,11 +80,12 @@ func CollectVIPRewards(
 	config common.TaskConfig,
 	instanceState *state.InstanceState,
 ) bool {
-	log.Printf("Attempting to collect VIP rewards on device %s", deviceID)
+	fields := vipLogFields(deviceID)
+	logging.Emit(logging.Info, fields, "Attempting to collect VIP rewards on device %s", deviceID)
 
 	// We need to be in city view
 	if gameView != "city" {
-		log.Println("Not in city view, cannot collect VIP rewards")
+		logging.Emit(logging.Info, fields, "Not in city view, cannot collect VIP rewards")
 		return false
 	}
 
@@ -36,7 +100,7 @@ func CollectVIPRewards(
 
 	// If VIP button not found, try menu
 	if vipButton == nil {
-		log.Println("VIP button not found directly, trying via menu")
+		logging.Emit(logging.Info, fields, "VIP button not found directly, trying via menu")
 
 		// Look for menu button
 		var menuButton *common.Detection
@@ -49,26 +113,26 @@ func CollectVIPRewards(
 
 		// If menu button not found, cannot proceed
 		if menuButton == nil {
-			log.Println("Neither VIP button nor menu button found")
+			logging.Emit(logging.Warning, fields, "Neither VIP button nor menu button found")
 			return false
 		}
 
 		// Click menu button
 		if err := utils.TapScreen(deviceID, adbPath, int(menuButton.X), int(menuButton.Y)); err != nil {
-			log.Printf("Failed to tap on menu button: %v", err)
+			logging.Emit(logging.Error, fields, "Failed to tap on menu button: %v", err)
 			return false
 		}
 
-		// Wait for menu to open, then click where VIP button would be
+		// Wait for menu to open, then click the VIP menu item
 		time.Sleep(1 * time.Second)
-		if err := utils.TapScreen(deviceID, adbPath, 320, 200); err != nil {
-			log.Printf("Failed to tap on VIP menu item: %v", err)
+		if err := tapVIPLocator(deviceID, adbPath, "vip_menu_item", detections); err != nil {
+			logging.Emit(logging.Error, fields, "Failed to tap on VIP menu item: %v", err)
 			return false
 		}
 	} else {
 		// Click on VIP button directly
 		if err := utils.TapScreen(deviceID, adbPath, int(vipButton.X), int(vipButton.Y)); err != nil {
-			log.Printf("Failed to tap on VIP button: %v", err)
+			logging.Emit(logging.Error, fields, "Failed to tap on VIP button: %v", err)
 			return false
 		}
 	}
@@ -76,27 +140,27 @@ func CollectVIPRewards(
 	// Wait for VIP interface to open
 	time.Sleep(1 * time.Second)
 
-	// Click potential VIP points claim button location (left side)
-	if err := utils.TapScreen(deviceID, adbPath, 150, 300); err != nil {
-		log.Printf("Failed to tap on VIP points claim button: %v", err)
+	// Claim VIP points (left side)
+	if err := tapVIPLocator(deviceID, adbPath, "vip_points_claim", detections); err != nil {
+		logging.Emit(logging.Error, fields, "Failed to tap on VIP points claim button: %v", err)
 	} else {
-		log.Println("Tapped on potential VIP points claim location")
+		logging.Emit(logging.Info, fields, "Tapped VIP points claim location")
 		time.Sleep(1 * time.Second)
 	}
 
-	// Click potential VIP chest claim button location (right side)
-	if err := utils.TapScreen(deviceID, adbPath, 450, 300); err != nil {
-		log.Printf("Failed to tap on VIP chest claim button: %v", err)
+	// Claim VIP chest (right side)
+	if err := tapVIPLocator(deviceID, adbPath, "vip_chest_claim", detections); err != nil {
+		logging.Emit(logging.Error, fields, "Failed to tap on VIP chest claim button: %v", err)
 	} else {
-		log.Println("Tapped on potential VIP chest claim location")
+		logging.Emit(logging.Info, fields, "Tapped VIP chest claim location")
 		time.Sleep(1 * time.Second)
 	}
 
-	// Close the interface (typically top-right)
-	if err := utils.TapScreen(deviceID, adbPath, 550, 50); err != nil {
-		log.Printf("Failed to close VIP interface: %v", err)
+	// Close the interface
+	if err := tapVIPLocator(deviceID, adbPath, "vip_close", detections); err != nil {
+		logging.Emit(logging.Error, fields, "Failed to close VIP interface: %v", err)
 	}
 
-	log.Println("VIP rewards collection completed")
+	logging.Emit(logging.Info, fields, "VIP rewards collection completed")
 	return true
 }
@@ -0,0 +1,102 @@
+// Package buildorder turns a small set of declared target states - "city
+// hall level 10", "hospital once city_hall is level 5" - into the
+// dependency-ordered planner.Plan tasks that actually get built, so a
+// caller can say what the city should look like instead of enumerating
+// every intermediate build_new/upgrade task by hand (what
+// actions.DefineDefaultBuildOrder's flat list, and a hand-authored
+// planner.Plan file, both require today). It's the RunUntil-style
+// "declare a stop position, start, wait for it or timeout" pattern applied
+// to build orders instead of test workers.
+//
+// buildorder sits on top of internal/planner rather than duplicating its
+// dependency resolution and progress tracking: Compile only synthesizes a
+// PlanTask list, then hands it to planner.NewPlan, which still does the
+// actual topoSort/Requires validation; Evaluate reads the same
+// instanceState.BuildPlanProgress actions.processBuildOrderWithPlan
+// already maintains instead of keeping its own ledger.
+package buildorder
+
+import (
+	"fmt"
+	"time"
+
+	"roborok/internal/planner"
+)
+
+// Goal declares a target state for one building: reach MinLevel, with
+// Count separate tracked instances of it, gated by optional dependency
+// edges in the same "building>=level" form planner.PlanTask.Requires
+// already uses (e.g. "city_hall>=5" for a hospital).
+type Goal struct {
+	Building string   `json:"building"`
+	Count    int      `json:"count,omitempty"`    // 0 means 1; see Compile for why >1 isn't supported yet
+	MinLevel int      `json:"min_level"`          // target level; <=1 means "nothing to do", see Compile
+	Requires []string `json:"requires,omitempty"` // e.g. "city_hall>=5"
+
+	// Deadline, if non-zero, is how long after Track first sees this
+	// goal it must reach MinLevel before Evaluate reports it Failed
+	// (deadline exceeded) instead of Stalled.
+	Deadline time.Duration `json:"deadline,omitempty"`
+}
+
+// Compile synthesizes an upgrade chain (ResultLevel 2..MinLevel, one
+// "upgrade" PlanTask per level) for each goal and hands the combined list
+// to planner.NewPlan, which performs the actual dependency resolution and
+// validation. Compile only decides what tasks to generate, not how they're
+// ordered against each other.
+//
+// Count above 1 isn't supported: this tree's multi-instance building
+// tracking (see actions.isMultipleTypeBuilding and
+// state.BuildingPositions) only ever remembers one on-screen position per
+// building type, so a second synthesized task for the same building would
+// tap the exact same building the first one already found rather than a
+// distinct new one. Compile rejects Count>1 up front instead of silently
+// generating tasks that would do the wrong thing against a real device;
+// supporting it for real needs per-instance position tracking this tree
+// doesn't have yet.
+//
+// A goal with MinLevel<=1 generates no tasks at all - Compile treats the
+// building as already existing, which holds for every goal this package is
+// meant for (city hall, farms, and the rest of the tutorial's starting
+// buildings are never built_new, only upgraded). Modeling "build a brand
+// new instance from nothing" as a distinct synthesized step would need the
+// same per-instance tracking Count>1 is missing above.
+func Compile(goals []Goal) (*planner.Plan, error) {
+	var tasks []planner.PlanTask
+
+	for _, g := range goals {
+		count := g.Count
+		if count == 0 {
+			count = 1
+		}
+		if count > 1 {
+			return nil, fmt.Errorf("goal for %q requests count=%d, but buildorder.Compile only supports one tracked instance per building today", g.Building, count)
+		}
+
+		if g.MinLevel <= 1 {
+			continue
+		}
+
+		var prevID string
+		for level := 2; level <= g.MinLevel; level++ {
+			id := fmt.Sprintf("%s@%d", g.Building, level)
+			task := planner.PlanTask{
+				ID:          id,
+				Type:        "upgrade",
+				Building:    g.Building,
+				DetectClass: g.Building,
+				ResultLevel: level,
+			}
+			if prevID == "" {
+				// Only the chain's first task carries the goal's own
+				// Requires - planner.NewPlan already chains the rest of
+				// the ladder in ResultLevel order on its own.
+				task.Requires = g.Requires
+			}
+			tasks = append(tasks, task)
+			prevID = id
+		}
+	}
+
+	return planner.NewPlan(tasks)
+}
@@ -0,0 +1,128 @@
+package buildorder
+
+import (
+	"fmt"
+	"time"
+
+	"roborok/internal/planner"
+	"roborok/internal/state"
+)
+
+// Status is one goal's up-to-date progress, reported by Evaluate.
+type Status string
+
+const (
+	StatusCompleted  Status = "completed"   // every synthesized task for the goal is done
+	StatusInProgress Status = "in_progress" // at least one task is still pending, none stalled or failed
+	StatusStalled    Status = "stalled"     // blocked on resources or a busy builder, but still before its deadline
+	StatusFailed     Status = "failed"      // a task was skipped after repeated structural failures, or the deadline passed
+)
+
+// failureReasonNoResources and failureReasonBuildersBusy mirror
+// actions.FailureReasonNoResources/FailureReasonBuildersBusy. They're
+// duplicated as plain strings here, not imported, since actions already
+// imports both planner and buildorder - the same state.BuildTask.FailureReason-is-a-plain-string
+// precedent avoids the reverse import edge.
+const (
+	failureReasonNoResources  = "no_resources"
+	failureReasonBuildersBusy = "builders_busy"
+)
+
+// Result is one goal's Status plus a human-readable reason, returned from
+// Evaluate keyed by Goal.Building.
+type Result struct {
+	Status Status
+	Reason string
+}
+
+// Evaluate reports every goal's current Result by inspecting plan's
+// synthesized tasks against instanceState.BuildPlanProgress - the same
+// per-task progress actions.processBuildOrderWithPlan already maintains
+// when plan is the one driving ProcessBuildOrder, so Evaluate needs no
+// tracking of its own beyond started, which records when each goal was
+// first seen (see Track) purely to judge Deadline.
+func Evaluate(goals []Goal, plan *planner.Plan, instanceState *state.InstanceState, started map[string]time.Time) map[string]Result {
+	results := make(map[string]Result, len(goals))
+
+	for _, g := range goals {
+		if g.MinLevel <= 1 {
+			results[g.Building] = Result{Status: StatusCompleted, Reason: "min_level <= 1 requires no synthesized task"}
+			continue
+		}
+
+		results[g.Building] = evaluateGoal(g, plan.TasksForBuilding(g.Building), instanceState, started[g.Building])
+	}
+
+	return results
+}
+
+func evaluateGoal(g Goal, tasks []*planner.PlanTask, instanceState *state.InstanceState, startedAt time.Time) Result {
+	if len(tasks) == 0 {
+		return Result{Status: StatusFailed, Reason: "goal compiled to no tasks"}
+	}
+
+	allDone := true
+	for _, t := range tasks {
+		progress := instanceState.BuildPlanProgress[t.ID]
+		if progress.Skipped {
+			return Result{Status: StatusFailed, Reason: fmt.Sprintf("task %s was skipped after repeated %s failures", t.ID, progress.FailureReason)}
+		}
+		if !progress.Completed {
+			allDone = false
+		}
+	}
+	if allDone {
+		return Result{Status: StatusCompleted}
+	}
+
+	if !startedAt.IsZero() && g.Deadline > 0 && time.Since(startedAt) > g.Deadline {
+		return Result{Status: StatusFailed, Reason: fmt.Sprintf("deadline of %s exceeded", g.Deadline)}
+	}
+
+	for _, t := range tasks {
+		progress := instanceState.BuildPlanProgress[t.ID]
+		if progress.FailureReason == failureReasonNoResources || progress.FailureReason == failureReasonBuildersBusy {
+			return Result{Status: StatusStalled, Reason: "waiting on " + progress.FailureReason}
+		}
+	}
+
+	return Result{Status: StatusInProgress}
+}
+
+// Track records, in started, the first moment each of goals is seen -
+// instanceState persists nothing about goal start times of its own, so a
+// caller that wants Deadline enforcement across ticks needs to keep started
+// itself (e.g. as a field on whatever holds its *state.InstanceState) and
+// pass it to both Track and Evaluate every tick. Track only ever adds
+// entries; it never updates or removes one, so a goal's deadline is always
+// measured from when it was first seen, not when it was last checked.
+func Track(goals []Goal, started map[string]time.Time, now time.Time) {
+	for _, g := range goals {
+		if _, ok := started[g.Building]; !ok {
+			started[g.Building] = now
+		}
+	}
+}
+
+// Report aggregates Evaluate's per-goal Results, modeled on the
+// all-workers-done-or-timed-out summary a RunUntil-style orchestrator
+// reports once every worker has either reached its stop position or given
+// up: Done is true only once no goal is still StatusInProgress or
+// StatusStalled.
+type Report struct {
+	Results map[string]Result
+	Done    bool
+}
+
+// Summarize wraps Evaluate's result map into a Report, setting Done once
+// every goal has reached a terminal Status (Completed or Failed).
+func Summarize(results map[string]Result) Report {
+	done := true
+	for _, r := range results {
+		if r.Status == StatusInProgress || r.Status == StatusStalled {
+			done = false
+			break
+		}
+	}
+	return Report{Results: results, Done: done}
+}
@@ -1,6 +1,8 @@
 package common
 
 import (
+	"context"
+	"fmt"
 	"roborok/internal/state"
 	"time"
 )
@@ -15,46 +17,214 @@ type Detection struct {
 	Confidence float64
 }
 
+// HandlerFunc implements a Task's behavior. It takes ctx so it can pull a
+// logging.Logger carrying the instance/iteration/task fields that
+// RunGameplayIteration attached; ctx isn't (yet) used for cancellation -
+// handlers still run to completion once started. It's a named type, not
+// an inline func type on Task, so actions.Register can keep a registry of
+// handlers by name for internal/taskspec to look up.
+type HandlerFunc func(ctx context.Context, deviceID, gameView string, detections []Detection, adbPath string, config TaskConfig, instanceState *state.InstanceState) bool
+
 // Task defines a gameplay task with priority and cooldown
 type Task struct {
 	Name         string
 	Priority     int // Higher number = higher priority
 	CooldownSec  int // Minimum seconds between executions
 	LastExecuted time.Time
-	Config       TaskConfig // Custom configuration for the task
-	Handler      func(deviceID, gameView string, detections []Detection, adbPath string, config TaskConfig, instanceState *state.InstanceState) bool
+	Boost        int // One-off addition to Priority for the next scheduling pass, e.g. an operator's "force" command; 0 leaves scoring unaffected
+
+	// Requirement gates whether this task is even attempted this
+	// iteration; the zero value (no Any/All/None classes) is always met.
+	Requirement DetectionRequirement
+	// FieldTask marks a task as runnable while in field/map view, not
+	// just city view.
+	FieldTask bool
+
+	Config  TaskConfig // Custom configuration for the task
+	Handler HandlerFunc
+}
+
+// SchedulerWeights tunes how Manager scores eligible tasks each iteration
+// in its candidate-ranking scheduler. Left unset, DefaultSchedulerWeights
+// applies.
+type SchedulerWeights struct {
+	// StalenessPerMinute adds this much score per minute since a task last
+	// ran, so a long-idle low-priority task eventually surfaces over a
+	// constantly-ready high-priority one.
+	StalenessPerMinute float64 `json:"staleness_per_minute"`
+
+	// RetryPenaltyMultiplier scales process_build_order's score down when
+	// its last attempt failed, so a broken build isn't retried at full
+	// priority every single iteration. No other task's failures are tracked,
+	// so no other task is penalized.
+	RetryPenaltyMultiplier float64 `json:"retry_penalty_multiplier"`
+}
+
+// DefaultSchedulerWeights returns the weights used when GameplayConfig
+// doesn't specify scheduler_weights.
+func DefaultSchedulerWeights() SchedulerWeights {
+	return SchedulerWeights{
+		StalenessPerMinute:     1,
+		RetryPenaltyMultiplier: 0.75,
+	}
+}
+
+// EconomyWeights tunes how processBuildOrderWithPlan scores eligible build
+// plan tasks against each other, on top of their declared PlanTask.Priority,
+// once an instance's GameState.Economy and GameState.Power are tracked. The zero
+// value (every field zero) makes scoring behave exactly like plain
+// Priority-ordering, since none of the bonuses below can trigger - see
+// DefaultEconomyWeights for a starting point that actually turns them on.
+type EconomyWeights struct {
+	// EcoWeight is added to an economic building's task score while any of
+	// its cost resources are running low: reserves under both
+	// income*ReserveIncomeMultiple and capacity*ReserveCapacityFraction.
+	EcoWeight float64 `json:"eco_weight"`
+	// MilitaryWeight is added to a military building's task score while
+	// GameState.Power is under CombatPowerTarget.
+	MilitaryWeight float64 `json:"military_weight"`
+	// ReserveIncomeMultiple and ReserveCapacityFraction set the "running
+	// low" threshold EcoWeight reacts to: reserves below
+	// min(income*ReserveIncomeMultiple, capacity*ReserveCapacityFraction).
+	ReserveIncomeMultiple   float64 `json:"reserve_income_multiple"`
+	ReserveCapacityFraction float64 `json:"reserve_capacity_fraction"`
+	// ReserveFloorFraction defers any task whose cost would leave a
+	// resource's reserves below this fraction of its capacity, regardless
+	// of score, so an expensive upgrade never starves something more
+	// urgent. Zero disables the floor entirely.
+	ReserveFloorFraction float64 `json:"reserve_floor_fraction"`
+	// CombatPowerTarget is what MilitaryWeight compares GameState.Power against.
+	CombatPowerTarget int `json:"combat_power_target"`
+}
+
+// DefaultEconomyWeights returns a mild eco-first starting point: prefer
+// economic buildings once a resource's reserves fall under two hours of
+// income or a quarter of capacity, never let a task drop reserves under 10%
+// of capacity, and leave military preference off (CombatPowerTarget 0)
+// until a caller sets one.
+func DefaultEconomyWeights() EconomyWeights {
+	return EconomyWeights{
+		EcoWeight:               50,
+		MilitaryWeight:          50,
+		ReserveIncomeMultiple:   2,
+		ReserveCapacityFraction: 0.25,
+		ReserveFloorFraction:    0.1,
+	}
+}
+
+// ActionFilter is an allow/forbid list gating which build tasks
+// ProcessBuildOrder, BuildNewBuilding, and UpgradeBuilding will even attempt,
+// modeled on dfhack advfort's build_filter table. A filtered task is skipped,
+// not failed - it's left for a later tick (or a different, unfiltered
+// config) rather than burning an attempt and cooldown on it.
+//
+// Precedence, most to least specific: Allow/AllowCategories always permit a
+// task even if ForbidAll is set or it's in Forbid/ForbidCategories;
+// otherwise Forbid/ForbidCategories deny it; otherwise ForbidAll denies
+// everything not already allowed above; otherwise the task is permitted.
+type ActionFilter struct {
+	// ForbidAll makes every task denied by default, so only what's named in
+	// Allow/AllowCategories can run - e.g. a farm-only account.
+	ForbidAll bool `json:"forbid_all,omitempty"`
+
+	// Allow and AllowCategories name buildings/categories ("economic",
+	// "military") that are always permitted, overriding both ForbidAll and
+	// Forbid/ForbidCategories.
+	Allow           []string `json:"allow,omitempty"`
+	AllowCategories []string `json:"allow_categories,omitempty"`
+
+	// Forbid and ForbidCategories name buildings/categories that are never
+	// permitted, e.g. to gate off expensive upgrades during an event.
+	Forbid           []string `json:"forbid,omitempty"`
+	ForbidCategories []string `json:"forbid_categories,omitempty"`
+}
+
+// Allowed reports whether building (classified under category, e.g. from
+// planner.DeriveCategory) passes the filter, along with a reason when it
+// doesn't - for the caller to log why a task was skipped.
+func (f ActionFilter) Allowed(building, category string) (bool, string) {
+	for _, b := range f.Allow {
+		if b == building {
+			return true, ""
+		}
+	}
+	for _, c := range f.AllowCategories {
+		if c != "" && c == category {
+			return true, ""
+		}
+	}
+
+	for _, b := range f.Forbid {
+		if b == building {
+			return false, fmt.Sprintf("building %q is in action_filter.forbid", building)
+		}
+	}
+	for _, c := range f.ForbidCategories {
+		if c != "" && c == category {
+			return false, fmt.Sprintf("category %q is in action_filter.forbid_categories", category)
+		}
+	}
+
+	if f.ForbidAll {
+		return false, "action_filter.forbid_all is set and this task isn't explicitly allowed"
+	}
+	return true, ""
 }
 
 // TaskConfig contains custom configuration options for tasks
 type TaskConfig struct {
 	// Building related configurations
-	MaxLevelDesired int // Maximum level to upgrade this building to
+	MaxLevelDesired int `json:"max_level_desired"` // Maximum level to upgrade this building to
+
+	// EconomyWeights tunes process_build_order's economy-aware task scoring
+	// when a build plan (utils.GlobalConfig.BuildPlanPath) is configured.
+	// Unset (the zero value) falls back to plain Priority-ordering.
+	EconomyWeights EconomyWeights `json:"economy_weights,omitempty"`
+
+	// ActionFilter gates which build tasks ProcessBuildOrder will even
+	// attempt. The zero value permits everything (no behavior change).
+	ActionFilter ActionFilter `json:"action_filter,omitempty"`
 
 	// Quest related configurations
-	ClaimOnlyMainQuest bool // Only claim main quest line
+	ClaimOnlyMainQuest bool `json:"claim_only_main_quest"` // Only claim main quest line
 
 	// Training related configurations
-	TroopLevelDesired int // Level of troops to train (0 = max available)
+	TroopLevelDesired int `json:"troop_level_desired"` // Level of troops to train (0 = max available)
+
+	// TrainingRatio is the share (0 to 1) of ticks this training task
+	// should actually attempt to train, letting a profile.Profile lean
+	// towards one unit type over another when multiple training tasks are
+	// enabled for the same instance - e.g. an infantry task at 0.7 trains
+	// roughly 7 ticks out of 10, leaving the rest for an archer task
+	// enabled alongside it. 0 (and anything outside (0,1)) always attempts,
+	// so a profile that doesn't set this sees no behavior change.
+	TrainingRatio float64 `json:"training_ratio,omitempty"`
 
 	// Research related configurations
-	ResearchPath []string // Ordered list of technologies to research
+	ResearchPath []string `json:"research_path"` // Ordered list of technologies to research
 
 	// Combat related configurations
-	BarbLevel         int    // Barbarian level to target
-	AllianceName      string // Preferred alliance to join
-	UseRandomAlliance bool   // Join a random alliance if preferred not found
+	BarbLevel         int    `json:"barb_level"`          // Barbarian level to target
+	AllianceName      string `json:"alliance_name"`       // Preferred alliance to join
+	UseRandomAlliance bool   `json:"use_random_alliance"` // Join a random alliance if preferred not found
+
+	// Scouting related configurations
+	// ScoutBlacklistTTLSeconds bounds how long actions.SendScoutToFog
+	// remembers an unreachable fog destination before offering it again.
+	// 0 falls back to a 6 hour default.
+	ScoutBlacklistTTLSeconds int `json:"scout_blacklist_ttl_seconds"`
 }
 
 // DetectionRequirement defines what detection classes are needed for a task
 type DetectionRequirement struct {
 	// RequiresAny represents detection classes where at least one must be present
-	RequiresAny []string
+	RequiresAny []string `json:"requires_any"`
 
 	// RequiresAll represents detection classes where all must be present
-	RequiresAll []string
+	RequiresAll []string `json:"requires_all"`
 
 	// RequiresNone represents detection classes that must NOT be present
-	RequiresNone []string
+	RequiresNone []string `json:"requires_none"`
 }
 
 // IsMet returns true if the requirements are met based on the provided detections
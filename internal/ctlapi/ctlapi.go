@@ -0,0 +1,304 @@
+// Package ctlapi exposes the same controls as main's stdin command
+// interface (pause, resume, status, timed pause, per-instance pause) over
+// HTTP, plus a Prometheus-style /metrics endpoint. It lets an operator
+// running several bots on one workstation control and scrape all of them
+// from a single dashboard instead of attaching to each process's console.
+package ctlapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"roborok/internal/logging"
+	"roborok/internal/manager"
+	"roborok/internal/vision"
+	"roborok/internal/vision/templates"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Server is the HTTP control plane for a single Manager.
+type Server struct {
+	mgr  *manager.Manager
+	addr string
+}
+
+// NewServer creates a control plane server bound to addr (e.g. ":8090").
+func NewServer(mgr *manager.Manager, addr string) *Server {
+	return &Server{mgr: mgr, addr: addr}
+}
+
+// Start runs the HTTP server, blocking until it fails. Call it with `go`
+// from main alongside the stdin command monitor.
+func (s *Server) Start() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pause", s.handlePause)
+	mux.HandleFunc("/resume", s.handleResume)
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/instances/", s.handleInstance)
+	mux.HandleFunc("/templates/capture", s.handleTemplateCapture)
+	mux.HandleFunc("/events", s.handleEvents)
+
+	log.Printf("Control API listening on %s", s.addr)
+	return http.ListenAndServe(s.addr, mux)
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mgr.Pause()
+
+	if secondsParam := r.URL.Query().Get("seconds"); secondsParam != "" {
+		seconds, err := strconv.Atoi(secondsParam)
+		if err != nil || seconds <= 0 {
+			http.Error(w, "invalid seconds parameter", http.StatusBadRequest)
+			return
+		}
+
+		go func() {
+			time.Sleep(time.Duration(seconds) * time.Second)
+			s.mgr.Resume()
+			log.Printf("Automation resumed after timed pause of %d seconds", seconds)
+		}()
+
+		fmt.Fprintf(w, "paused for %d seconds\n", seconds)
+		return
+	}
+
+	fmt.Fprintln(w, "paused")
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mgr.Resume()
+	fmt.Fprintln(w, "resumed")
+}
+
+// instanceStatus mirrors the fields main.printStatus prints to the console.
+type instanceStatus struct {
+	DeviceID              string  `json:"device_id"`
+	LifecyclePhase        string  `json:"lifecycle_phase"`
+	NextActionInSeconds   *int    `json:"next_action_in_seconds,omitempty"`
+	CityHallLevel         int     `json:"city_hall_level"`
+	TutorialCompleted     bool    `json:"tutorial_completed"`
+	StartupTasksCompleted bool    `json:"startup_tasks_completed"`
+	TreeClearingCompleted bool    `json:"tree_clearing_completed"`
+	SecondBuilderAdded    bool    `json:"second_builder_added"`
+	Paused                bool    `json:"paused"`
+	PausedUntil           *string `json:"paused_until,omitempty"`
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	instances := s.mgr.InstancesSnapshot()
+	statuses := make(map[string]instanceStatus, len(instances))
+	for id, instance := range instances {
+		pauseState := instance.PauseState()
+		st := instanceStatus{
+			DeviceID:              instance.DeviceID,
+			LifecyclePhase:        string(instance.FSM.State()),
+			CityHallLevel:         instance.State.CityHallLevel,
+			TutorialCompleted:     instance.State.TutorialCompleted,
+			StartupTasksCompleted: instance.State.StartupTasksCompleted,
+			TreeClearingCompleted: instance.State.TreeClearingCompleted,
+			SecondBuilderAdded:    instance.State.SecondBuilderAdded,
+			Paused:                pauseState.Paused,
+		}
+
+		if until := time.Until(instance.NextActionAt); until > 0 {
+			seconds := int(until.Seconds())
+			st.NextActionInSeconds = &seconds
+		}
+
+		if !pauseState.Until.IsZero() {
+			formatted := pauseState.Until.Format(time.RFC3339)
+			st.PausedUntil = &formatted
+		}
+
+		statuses[id] = st
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"running":   !s.mgr.IsPaused(),
+		"instances": statuses,
+	})
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.mgr.Metrics.WriteProm(w)
+}
+
+// handleInstance handles POST /instances/{id}/pause and /instances/{id}/resume.
+func (s *Server) handleInstance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/instances/")
+	id, action, ok := strings.Cut(path, "/")
+	if !ok || id == "" {
+		http.Error(w, "expected /instances/{id}/pause or /instances/{id}/resume", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	switch action {
+	case "pause":
+		if secondsParam := r.URL.Query().Get("seconds"); secondsParam != "" {
+			seconds, perr := strconv.Atoi(secondsParam)
+			if perr != nil || seconds <= 0 {
+				http.Error(w, "invalid seconds parameter", http.StatusBadRequest)
+				return
+			}
+			err = s.mgr.PauseInstanceFor(id, time.Duration(seconds)*time.Second)
+		} else {
+			err = s.mgr.PauseInstance(id)
+		}
+	case "resume":
+		err = s.mgr.ResumeInstance(id)
+	default:
+		http.Error(w, fmt.Sprintf("unknown instance action: %q", action), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	fmt.Fprintf(w, "%s: %s\n", id, action)
+}
+
+// handleTemplateCapture captures a live screenshot from an instance and
+// crops it into internal/vision/templates's library - the dev-mode
+// counterpart to templates.LocateTemplate, for building up a template PNG by
+// pointing at a running instance instead of hand-authoring one offline.
+// POST /templates/capture?device_id=...&name=...&x=...&y=...&width=...&height=...
+func (s *Server) handleTemplateCapture(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceID := r.URL.Query().Get("device_id")
+	name := r.URL.Query().Get("name")
+	if deviceID == "" || name == "" {
+		http.Error(w, "device_id and name are required", http.StatusBadRequest)
+		return
+	}
+
+	instance, ok := s.mgr.InstanceByID(deviceID)
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown instance %q", deviceID), http.StatusNotFound)
+		return
+	}
+
+	x, xerr := strconv.Atoi(r.URL.Query().Get("x"))
+	y, yerr := strconv.Atoi(r.URL.Query().Get("y"))
+	width, werr := strconv.Atoi(r.URL.Query().Get("width"))
+	height, herr := strconv.Atoi(r.URL.Query().Get("height"))
+	if xerr != nil || yerr != nil || werr != nil || herr != nil || width <= 0 || height <= 0 {
+		http.Error(w, "x, y, width, and height must be valid integers (width/height > 0)", http.StatusBadRequest)
+		return
+	}
+
+	dir := s.mgr.Config.Global.TemplatesDir
+	if dir == "" {
+		http.Error(w, "GlobalConfig.TemplatesDir is not set", http.StatusBadRequest)
+		return
+	}
+
+	screenshot, err := vision.CaptureScreenshot(instance.DeviceID, s.mgr.Config.Gameplay.ADBPath)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error capturing screenshot: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := templates.CaptureTemplate(screenshot, dir, name, x, y, width, height); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintf(w, "captured template %q from %s\n", name, deviceID)
+}
+
+// handleEvents streams logging.DefaultBus as Server-Sent Events, replaying
+// its recent backlog on connect, so a dashboard or CLI can attach to a
+// running instance and watch what every device is doing without tailing
+// logs. Plain SSE over the existing HTTP server rather than gRPC or a
+// WebSocket upgrade: this tree has no go.mod to vendor a gRPC/WebSocket
+// library in, and SSE (one-way, text/event-stream, net/http only) covers
+// the same "watch events as they happen" need with the stdlib alone.
+//
+// GET /events?device_id=...&task=... filters to events whose Source or
+// Fields["task"] match, when given; omit both to see everything.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	deviceFilter := r.URL.Query().Get("device_id")
+	taskFilter := r.URL.Query().Get("task")
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ch, unsubscribe := logging.DefaultBus.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if deviceFilter != "" && e.Source != deviceFilter {
+				continue
+			}
+			if taskFilter != "" {
+				if task, _ := e.Fields["task"].(string); task != taskFilter {
+					continue
+				}
+			}
+
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
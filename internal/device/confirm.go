@@ -0,0 +1,108 @@
+package device
+
+import (
+	"sort"
+	"time"
+
+	"roborok/internal/common"
+	"roborok/internal/vision"
+)
+
+// TapAndConfirmOptions configures TapAndConfirm's retry behavior.
+type TapAndConfirmOptions struct {
+	// DismissClasses are detection classes TapAndConfirm taps away on sight
+	// before giving up on a candidate - help bubbles, "close" X icons,
+	// alliance-help popups, and similar overlays that can cover the real
+	// target without being the reason the tap failed.
+	DismissClasses []string
+	// ConfirmDelay is how long to wait after a tap before re-capturing to
+	// check for ExpectNext. Zero defaults to 2 seconds.
+	ConfirmDelay time.Duration
+	// MaxCandidates bounds how many ranked candidates TapAndConfirm will try
+	// before giving up. Zero defaults to 3.
+	MaxCandidates int
+	// MinConfidence overrides common.MinConfidence when checking ExpectNext.
+	// Zero uses common.MinConfidence.
+	MinConfidence float64
+}
+
+// TapAndConfirm taps the highest-confidence of candidates, waits, and
+// recaptures to check whether expectNext shows up. If it doesn't, the tapped
+// detection is blacklisted for the rest of this call, any detection whose
+// class is in opts.DismissClasses is tapped away, and the next-best
+// remaining candidate is tried - borrowing the "blacklist and try the next
+// candidate" pattern instead of treating a single miss as a hard failure.
+// This exists so a transient overlay (tutorial bubble, resource popup) over
+// one candidate doesn't force a caller all the way back to resetting the
+// whole view.
+//
+// It returns the detections from whichever capture satisfied expectNext, and
+// true. If every candidate (up to opts.MaxCandidates) is exhausted without
+// seeing expectNext, it returns the last capture's detections and false.
+func TapAndConfirm(
+	d Device,
+	candidates []common.Detection,
+	expectNext string,
+	opts TapAndConfirmOptions,
+) ([]common.Detection, bool) {
+	confirmDelay := opts.ConfirmDelay
+	if confirmDelay <= 0 {
+		confirmDelay = 2 * time.Second
+	}
+	maxCandidates := opts.MaxCandidates
+	if maxCandidates <= 0 {
+		maxCandidates = 3
+	}
+	minConfidence := opts.MinConfidence
+	if minConfidence <= 0 {
+		minConfidence = common.MinConfidence
+	}
+
+	ranked := append([]common.Detection(nil), candidates...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Confidence > ranked[j].Confidence
+	})
+
+	var detections []common.Detection
+	blacklisted := make(map[common.Detection]bool)
+
+	for attempts := 0; attempts < maxCandidates; attempts++ {
+		var target *common.Detection
+		for i := range ranked {
+			if blacklisted[ranked[i]] {
+				continue
+			}
+			target = &ranked[i]
+			break
+		}
+		if target == nil {
+			break
+		}
+		blacklisted[*target] = true
+
+		if err := d.Tap(int(target.X), int(target.Y)); err != nil {
+			continue
+		}
+		d.Sleep(confirmDelay)
+
+		var err error
+		detections, err = d.Detect()
+		if err != nil {
+			continue
+		}
+
+		if vision.FindDetectionByClass(detections, expectNext, minConfidence) != nil {
+			return detections, true
+		}
+
+		for _, dismissClass := range opts.DismissClasses {
+			if det := vision.FindDetectionByClass(detections, dismissClass, minConfidence); det != nil {
+				if err := d.Tap(int(det.X), int(det.Y)); err == nil {
+					d.Sleep(1 * time.Second)
+				}
+			}
+		}
+	}
+
+	return detections, false
+}
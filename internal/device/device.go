@@ -0,0 +1,89 @@
+// Package device abstracts the actions this bot takes against a running
+// game instance - tapping, swiping, capturing a screenshot, and running
+// vision detection on it - behind a single Device interface, instead of
+// action code threading deviceID/adbPath strings through and calling
+// utils.TapScreen/vision.CaptureAndDetect directly. ADBDevice is the
+// production implementation, driving a real device over adb the same way
+// the rest of the codebase already does; FakeDevice lets a caller script
+// canned detection frames instead.
+//
+// This pass only migrates RecruitSecondBuilder and the internal/actions/flow
+// package it's built on. internal/actions/build-order.go's
+// BuildNewBuilding/UpgradeBuilding (and the other actions still threading
+// deviceID/adbPath) are left as-is for a separate, dedicated migration:
+// they're larger, exercised in production today, and resetView - which they
+// all share - isn't part of this pass either, so RecruitSecondBuilder's
+// reset still reaches into it via an *ADBDevice type assertion. See
+// actions.RecruitSecondBuilder for that seam.
+package device
+
+import (
+	"math/rand"
+	"time"
+
+	"roborok/internal/common"
+	"roborok/internal/utils"
+	"roborok/internal/vision"
+)
+
+// Device is everything an action needs to drive one game instance.
+type Device interface {
+	// ID identifies the device, for logging.
+	ID() string
+	// Tap taps the screen at (x, y).
+	Tap(x, y int) error
+	// Swipe drags from (x1, y1) to (x2, y2) over durationMS.
+	Swipe(x1, y1, x2, y2, durationMS int) error
+	// Screencap captures the current frame as PNG bytes.
+	Screencap() ([]byte, error)
+	// Detect captures a frame and returns its detections, dismissing any
+	// help bubbles along the way (see vision.CaptureAndDetect).
+	Detect() ([]common.Detection, error)
+	// Sleep pauses for roughly d, jittered so that several instances
+	// driven in lockstep don't tap in lockstep too.
+	Sleep(d time.Duration)
+}
+
+// ADBDevice drives a real device over adb, the same way the rest of the
+// codebase already does.
+type ADBDevice struct {
+	DeviceID string
+	AdbPath  string
+}
+
+// ID implements Device.
+func (d *ADBDevice) ID() string { return d.DeviceID }
+
+// Tap implements Device.
+func (d *ADBDevice) Tap(x, y int) error {
+	return utils.TapScreen(d.DeviceID, d.AdbPath, x, y)
+}
+
+// Swipe implements Device.
+func (d *ADBDevice) Swipe(x1, y1, x2, y2, durationMS int) error {
+	return utils.SwipeScreen(d.DeviceID, d.AdbPath, x1, y1, x2, y2, durationMS)
+}
+
+// Screencap implements Device.
+func (d *ADBDevice) Screencap() ([]byte, error) {
+	return vision.CaptureScreenshot(d.DeviceID, d.AdbPath)
+}
+
+// Detect implements Device.
+func (d *ADBDevice) Detect() ([]common.Detection, error) {
+	return vision.CaptureAndDetect(d.DeviceID, d.AdbPath)
+}
+
+// Sleep implements Device, jittering d by up to +/-10% so parallel instances
+// don't all act at once.
+func (d *ADBDevice) Sleep(base time.Duration) {
+	time.Sleep(jitter(base))
+}
+
+func jitter(base time.Duration) time.Duration {
+	if base <= 0 {
+		return base
+	}
+	splay := base / 10
+	return base + time.Duration(rand.Int63n(2*int64(splay)+1)-int64(splay))
+}
@@ -0,0 +1,66 @@
+package device
+
+import (
+	"time"
+
+	"roborok/internal/common"
+)
+
+// Event is one recorded Tap or Swipe call.
+type Event struct {
+	Type               string // "tap" or "swipe"
+	X, Y               int
+	X2, Y2, DurationMS int // swipe only
+}
+
+// FakeDevice is a scripted Device: each call to Detect returns the next
+// frame in Frames (the last frame repeats once exhausted), and every
+// Tap/Swipe is recorded in Events instead of touching a real device. It
+// exists so actions built on Device can be driven and asserted on without
+// adb or Roboflow.
+type FakeDevice struct {
+	Frames [][]common.Detection
+	Events []Event
+
+	frame int
+}
+
+// NewFakeDevice returns a FakeDevice that serves frames in order from Detect.
+func NewFakeDevice(frames ...[]common.Detection) *FakeDevice {
+	return &FakeDevice{Frames: frames}
+}
+
+// ID implements Device.
+func (d *FakeDevice) ID() string { return "fake" }
+
+// Tap implements Device.
+func (d *FakeDevice) Tap(x, y int) error {
+	d.Events = append(d.Events, Event{Type: "tap", X: x, Y: y})
+	return nil
+}
+
+// Swipe implements Device.
+func (d *FakeDevice) Swipe(x1, y1, x2, y2, durationMS int) error {
+	d.Events = append(d.Events, Event{Type: "swipe", X: x1, Y: y1, X2: x2, Y2: y2, DurationMS: durationMS})
+	return nil
+}
+
+// Screencap implements Device. FakeDevice has no real screenshot bytes to
+// offer, since its detections are scripted rather than vision-derived.
+func (d *FakeDevice) Screencap() ([]byte, error) { return nil, nil }
+
+// Detect implements Device, returning the next scripted frame.
+func (d *FakeDevice) Detect() ([]common.Detection, error) {
+	if len(d.Frames) == 0 {
+		return nil, nil
+	}
+	if d.frame >= len(d.Frames) {
+		return d.Frames[len(d.Frames)-1], nil
+	}
+	frame := d.Frames[d.frame]
+	d.frame++
+	return frame, nil
+}
+
+// Sleep implements Device as a no-op, so a scripted run doesn't actually wait.
+func (d *FakeDevice) Sleep(_ time.Duration) {}
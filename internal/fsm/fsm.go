@@ -0,0 +1,128 @@
+// Package fsm implements a small finite-state machine used to drive the
+// lifecycle of a single bot instance (boot, tutorial, startup tasks, daily
+// loop, etc). It replaces the ad-hoc boolean flags that used to live on
+// state.InstanceState with an auditable, testable transition graph.
+package fsm
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// FSMState identifies a phase in the instance lifecycle.
+type FSMState string
+
+const (
+	StateBoot         FSMState = "boot"
+	StateTutorial     FSMState = "tutorial"
+	StateStartupTasks FSMState = "startup_tasks"
+	StateTreeClearing FSMState = "tree_clearing"
+	StateBuilderQuest FSMState = "builder_quest"
+	StateDailyLoop    FSMState = "daily_loop"
+	StatePaused       FSMState = "paused"
+	StateError        FSMState = "error"
+	StateShutdown     FSMState = "shutdown"
+)
+
+// FSMEvent identifies a user or system input that can trigger a transition.
+type FSMEvent string
+
+const (
+	EventBootComplete      FSMEvent = "boot_complete"
+	EventTutorialDone      FSMEvent = "tutorial_done"
+	EventStartupDone       FSMEvent = "startup_done"
+	EventTreesCleared      FSMEvent = "trees_cleared"
+	EventBuilderAdded      FSMEvent = "builder_added"
+	EventCityHallLeveled   FSMEvent = "city_hall_leveled"
+	EventPauseRequested    FSMEvent = "pause_requested"
+	EventResumeRequested   FSMEvent = "resume_requested"
+	EventCrashDetected     FSMEvent = "crash_detected"
+	EventShutdownRequested FSMEvent = "shutdown_requested"
+)
+
+// FSMHandler runs when an event is operated on in a given state. It should
+// call SetState on the FSM to move to the next state, and may return an
+// error to signal that the transition failed.
+type FSMHandler func(f *FSM) error
+
+// StateChangeFunc is invoked whenever SetState changes the current state,
+// so callers (e.g. the reporter) can emit audit events.
+type StateChangeFunc func(old, new FSMState)
+
+// FSM is a small, lockable state machine. One FSM is owned by each instance.
+type FSM struct {
+	mu       sync.Mutex
+	state    FSMState
+	handlers map[FSMState]map[FSMEvent]FSMHandler
+	onChange StateChangeFunc
+}
+
+// New creates an FSM starting in the given state.
+func New(initial FSMState) *FSM {
+	return &FSM{
+		state:    initial,
+		handlers: make(map[FSMState]map[FSMEvent]FSMHandler),
+	}
+}
+
+// AddHandler registers a handler to run when event occurs while the FSM is
+// in state. Only one handler may be registered per (state, event) pair.
+func (f *FSM) AddHandler(state FSMState, event FSMEvent, handler FSMHandler) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.handlers[state] == nil {
+		f.handlers[state] = make(map[FSMEvent]FSMHandler)
+	}
+	f.handlers[state][event] = handler
+}
+
+// OnStateChange registers a callback invoked after every successful
+// transition.
+func (f *FSM) OnStateChange(fn StateChangeFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onChange = fn
+}
+
+// State returns the current state.
+func (f *FSM) State() FSMState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state
+}
+
+// SetState forces the current state without going through a handler. It is
+// primarily used to restore persisted state on resume.
+func (f *FSM) SetState(state FSMState) {
+	f.mu.Lock()
+	old := f.state
+	f.state = state
+	onChange := f.onChange
+	f.mu.Unlock()
+
+	if onChange != nil && old != state {
+		onChange(old, state)
+	}
+}
+
+// Operate looks up the handler registered for the current state and event,
+// runs it, and returns the resulting state. If no handler is registered the
+// state is left unchanged and an error is returned.
+func (f *FSM) Operate(event FSMEvent) (FSMState, error) {
+	f.mu.Lock()
+	handler, ok := f.handlers[f.state][event]
+	f.mu.Unlock()
+
+	if !ok {
+		return f.State(), fmt.Errorf("no handler registered for state %q event %q", f.state, event)
+	}
+
+	if err := handler(f); err != nil {
+		log.Printf("fsm: handler for state %q event %q failed: %v", f.state, event, err)
+		return f.State(), err
+	}
+
+	return f.State(), nil
+}
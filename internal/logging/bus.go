@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is one published log line, the Bus's unit of fan-out.
+type Event struct {
+	Level     Level
+	Source    string // device/instance/task this line is about, if any - see sourceOf
+	Timestamp time.Time
+	Message   string
+	Fields    Fields
+}
+
+// defaultBacklog is how many recent Events Bus replays to a new subscriber
+// on connect, so an operator attaching mid-run (e.g. over ctlapi's /events)
+// sees what just happened instead of starting from a blank screen.
+const defaultBacklog = 50
+
+// subscriberBuffer is how many Events a slow subscriber can fall behind by
+// before Publish starts dropping its oldest unread Events rather than
+// blocking every other subscriber (or the Logger call emitting them) on it.
+const subscriberBuffer = 256
+
+// Bus fans out Events to any number of subscribers (sinks, or a dashboard
+// attached over ctlapi's /events endpoint). It's safe for concurrent use.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[int]chan Event
+	nextID      int
+	recent      []Event
+	backlog     int
+}
+
+// NewBus creates a Bus that replays up to backlog recent Events to each new
+// subscriber.
+func NewBus(backlog int) *Bus {
+	return &Bus{subscribers: make(map[int]chan Event), backlog: backlog}
+}
+
+// DefaultBus is the process-wide Bus every logging.Logger publishes to.
+// Sinks (StartStderrSink, StartJSONLSink) and ctlapi's /events handler all
+// subscribe to this same Bus, so every sink sees identical events.
+var DefaultBus = NewBus(defaultBacklog)
+
+// Publish fans e out to every current subscriber and records it in the
+// replay backlog. A subscriber whose channel is full has its oldest
+// buffered Event dropped to make room, rather than blocking the publisher.
+func (b *Bus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.recent = append(b.recent, e)
+	if len(b.recent) > b.backlog {
+		b.recent = b.recent[len(b.recent)-b.backlog:]
+	}
+
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+	}
+}
+
+// Subscribe registers a new subscriber, immediately replaying the current
+// backlog into it, and returns the channel to read Events from plus a func
+// to unsubscribe and release it. Callers must call the returned func when
+// done to avoid leaking the channel.
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Sized to fit the full backlog replay below without blocking: a Bus
+	// configured with a backlog bigger than subscriberBuffer would otherwise
+	// deadlock here (and, since Subscribe holds b.mu, every future Publish
+	// with it).
+	chCap := subscriberBuffer
+	if len(b.recent) > chCap {
+		chCap = len(b.recent)
+	}
+	ch := make(chan Event, chCap)
+	for _, e := range b.recent {
+		ch <- e
+	}
+
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = ch
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, id)
+	}
+	return ch, unsubscribe
+}
@@ -0,0 +1,138 @@
+// Package logging provides a small context-carrying structured logger,
+// modeled on docker/swarmkit's log.G(ctx) pattern: as execution descends
+// through layers (instance loop -> gameplay iteration -> task handler),
+// each layer attaches its own Fields to the context with WithFields, and
+// whoever eventually logs via FromContext(ctx) emits all of them together
+// as one JSON line instead of a hand-formatted "[instance] ..." prefix.
+//
+// Every emitted line is also published as an Event on DefaultBus (see
+// bus.go), so StartStderrSink/StartJSONLSink, or an operator dashboard
+// subscribed over ctlapi's /events endpoint, see the exact same messages
+// this package writes to the process log - one event stream feeding
+// multiple sinks instead of a second parallel logging path.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+type ctxKey struct{}
+
+// Fields is a set of structured key/value pairs attached to a log line.
+type Fields map[string]interface{}
+
+// Level is a log line's severity, matching the levels an operator
+// dashboard watching DefaultBus needs to filter on.
+type Level string
+
+const (
+	Debug   Level = "DEBUG"
+	Info    Level = "INFO"
+	Warning Level = "WARNING"
+	Error   Level = "ERROR"
+	// Console marks a line meant for an operator's terminal rather than a
+	// machine-readable log (e.g. the startup banner, command-interface
+	// help text) - it still flows through the same Bus so a dashboard
+	// attached over ctlapi's /events can show it alongside task events.
+	Console Level = "CONSOLE"
+)
+
+// Logger emits JSON log lines carrying a context's accumulated Fields.
+type Logger struct {
+	fields Fields
+}
+
+// WithFields returns a context carrying fields merged on top of whatever
+// Fields ctx already carries, so a nested call can add its own fields (e.g.
+// the current task name) without clobbering what an outer layer already
+// set (e.g. the instance ID).
+func WithFields(ctx context.Context, fields Fields) context.Context {
+	merged := make(Fields, len(fields))
+	if existing, ok := ctx.Value(ctxKey{}).(Fields); ok {
+		for k, v := range existing {
+			merged[k] = v
+		}
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, ctxKey{}, merged)
+}
+
+// FromContext returns the Logger carrying ctx's accumulated fields. It
+// never fails: a context with no fields attached just logs bare messages.
+func FromContext(ctx context.Context) *Logger {
+	fields, _ := ctx.Value(ctxKey{}).(Fields)
+	return &Logger{fields: fields}
+}
+
+// Printf formats msg per format/args and emits it at Info level, alongside
+// the logger's accumulated fields, a timestamp, and the message itself
+// under "msg".
+func (l *Logger) Printf(format string, args ...interface{}) {
+	l.emit(Info, fmt.Sprintf(format, args...))
+}
+
+// Debugf, Warnf, and Errorf are Printf at their respective Level.
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.emit(Debug, fmt.Sprintf(format, args...))
+}
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.emit(Warning, fmt.Sprintf(format, args...))
+}
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.emit(Error, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) emit(level Level, msg string) {
+	now := time.Now()
+
+	line := make(Fields, len(l.fields)+3)
+	for k, v := range l.fields {
+		line[k] = v
+	}
+	line["time"] = now.Format(time.RFC3339)
+	line["level"] = string(level)
+	line["msg"] = msg
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		// Fall back to a plain line rather than dropping the message.
+		log.Printf("%s (logging: failed to marshal fields: %v)", msg, err)
+	} else {
+		log.Println(string(data))
+	}
+
+	DefaultBus.Publish(Event{
+		Level:     level,
+		Source:    sourceOf(l.fields),
+		Timestamp: now,
+		Message:   msg,
+		Fields:    l.fields,
+	})
+}
+
+// sourceOf picks a human-meaningful "where did this come from" label out of
+// fields for Event.Source, preferring the most specific field an operator
+// would filter on.
+func sourceOf(fields Fields) string {
+	for _, key := range []string{"device_id", "instance_id", "task"} {
+		if v, ok := fields[key]; ok {
+			if s, ok := v.(string); ok && s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// Emit publishes msg at level with the given fields without going through a
+// context - for call sites that don't have one to thread (e.g. package-level
+// helpers like vision.SendToRoboflow).
+func Emit(level Level, fields Fields, format string, args ...interface{}) {
+	(&Logger{fields: fields}).emit(level, fmt.Sprintf(format, args...))
+}
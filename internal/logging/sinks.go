@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// levelColor is the ANSI color code StartStderrSink uses for each Level,
+// matching the usual INFO=default/WARNING=yellow/ERROR=red convention.
+var levelColor = map[Level]string{
+	Debug:   "\033[90m", // gray
+	Info:    "\033[0m",  // default
+	Warning: "\033[33m", // yellow
+	Error:   "\033[31m", // red
+	Console: "\033[36m", // cyan
+}
+
+const colorReset = "\033[0m"
+
+// StartStderrSink subscribes to bus and writes each Event to stderr as one
+// colorized line, for an operator watching the terminal directly rather
+// than piping the JSON lines logging.Logger already writes to the process
+// log through a formatter. Call the returned stop func to unsubscribe.
+func StartStderrSink(bus *Bus) (stop func()) {
+	ch, unsubscribe := bus.Subscribe()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					return
+				}
+				color := levelColor[e.Level]
+				source := ""
+				if e.Source != "" {
+					source = "[" + e.Source + "] "
+				}
+				fmt.Fprintf(os.Stderr, "%s%s %s%s%s\n", color, e.Timestamp.Format("15:04:05"), source, e.Message, colorReset)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		// Unsubscribe before signaling done so no further Events arrive on
+		// ch once the goroutine stops reading it, then wait for it to
+		// actually exit before returning.
+		unsubscribe()
+		close(done)
+		<-stopped
+	}
+}
+
+// StartJSONLSink subscribes to bus and appends each Event to path as one
+// JSON object per line, for feeding a saved run into external tooling (or
+// roborok replay-style inspection) independent of the process's regular
+// stdout/stderr log. Call the returned stop func to unsubscribe and close
+// the file.
+func StartJSONLSink(bus *Bus, path string) (stop func(), err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening event log %s: %w", path, err)
+	}
+
+	ch, unsubscribe := bus.Subscribe()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				f.Write(append(data, '\n'))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		// Unsubscribe before signaling done so no further Events arrive on
+		// ch once the goroutine stops reading it, then wait for it to
+		// actually exit before closing the file - otherwise a buffered
+		// Event's write could race the Close below.
+		unsubscribe()
+		close(done)
+		<-stopped
+		f.Close()
+	}, nil
+}
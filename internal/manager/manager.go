@@ -1,38 +1,247 @@
 package manager
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"math/rand"
 	"path/filepath"
 	"roborok/internal/actions"
 	"roborok/internal/common"
+	"roborok/internal/device"
+	"roborok/internal/fsm"
+	"roborok/internal/logging"
+	"roborok/internal/metrics"
+	"roborok/internal/profile"
+	"roborok/internal/replay"
 	"roborok/internal/report"
+	"roborok/internal/scheduler"
 	"roborok/internal/state"
+	"roborok/internal/taskrunner"
+	"roborok/internal/taskspec"
 	"roborok/internal/utils"
 	"roborok/internal/vision"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Manager handles all game instances
 type Manager struct {
-	Config              *utils.Config
-	Instances           map[string]*Instance
+	Config *utils.Config
+
+	// instances and instancesMu guard Manager's instance set: ApplyConfig
+	// writes newly-discovered instances into it on every SIGHUP/WatchConfig
+	// reload, concurrently with ctlapi's HTTP handlers and main.go's status
+	// loops ranging/indexing it from other goroutines. Use InstanceByID,
+	// InstancesSnapshot, or InstanceCount from outside this package; internal
+	// callers take instancesMu directly.
+	instances   map[string]*Instance
+	instancesMu sync.RWMutex
+
 	Reporter            *report.Reporter
+	Metrics             *metrics.Metrics
+	Detector            vision.Detector
+	Screenshotter       vision.Screenshotter
+	Replay              *replay.Recorder     // nil unless GlobalConfig.ReplayDir is set
+	BuildOrderRunner    *taskrunner.Runner   // drives process_build_order through a persisted Change/Task so a crash resumes mid-upgrade
+	Scheduler           *scheduler.Scheduler // arbitrates shared ADB/vision budget across every instance loop
 	StatePath           string
 	paused              bool
 	pauseLock           sync.Mutex
 	noActionCount       map[string]int  // Track consecutive no-action iterations per instance
 	lastBuildSuccessful map[string]bool // Track success by instance ID
+
+	taskSpecs     map[string]*taskspec.Spec // loaded Spec by taskspec path, populated by startTaskSpecWatch
+	taskSpecStops map[string]func()         // stop func for each taskspec.Watch, keyed the same way
+
+	profiles     profile.Set // loaded GlobalConfig.ProfilesPath, populated by startProfilesWatch
+	profilesStop func()      // stop func for the profile.Watch goroutine, nil until started
 }
 
 // Instance represents a game instance
 type Instance struct {
-	ID       string
-	DeviceID string
-	Config   utils.InstanceConfig
-	State    *state.InstanceState
-	Tasks    []common.Task
+	ID           string
+	DeviceID     string
+	Config       utils.InstanceConfig
+	State        *state.InstanceState
+	Tasks        []common.Task
+	FSM          *fsm.FSM
+	NextActionAt time.Time    // when the instance loop will wake up next, for display in printStatus
+	pauseState   atomic.Value // holds PauseState; independent of Manager's global pause flag so reads don't contend with other instances
+}
+
+// PauseState describes whether an instance is individually paused and, for
+// a timed pause, when it's due to automatically resume.
+type PauseState struct {
+	Paused bool
+	Until  time.Time // zero if paused indefinitely (no PauseInstanceFor in effect)
+}
+
+// PauseState returns the instance's current per-instance pause state.
+func (i *Instance) PauseState() PauseState {
+	if v := i.pauseState.Load(); v != nil {
+		return v.(PauseState)
+	}
+	return PauseState{}
+}
+
+// IsPaused reports whether the instance is currently paused, individually.
+func (i *Instance) IsPaused() bool {
+	return i.PauseState().Paused
+}
+
+func (i *Instance) setPauseState(s PauseState) {
+	i.pauseState.Store(s)
+}
+
+// shouldSkipForCooldown reports whether task should be skipped this
+// iteration because it's still within its cooldown window. process_build_order
+// is a standing exception: once a builder is idle and the last attempt
+// succeeded, it's retried immediately regardless of cooldown, since waiting
+// out a fixed interval after a successful build just leaves the builder idle
+// longer than it needs to be. This used to be copy-pasted between the field
+// and city task loops in RunGameplayIteration.
+func (m *Manager) shouldSkipForCooldown(instance *Instance, task *common.Task, detections []common.Detection) bool {
+	if time.Since(task.LastExecuted) >= time.Duration(task.CooldownSec)*time.Second {
+		return false
+	}
+
+	if task.Name != "process_build_order" {
+		return true
+	}
+
+	builderAvailable := false
+	for _, det := range detections {
+		if det.Class == "builders_hut_idle" && det.Confidence > common.MinConfidence {
+			builderAvailable = true
+			break
+		}
+	}
+
+	if builderAvailable && m.lastBuildSuccessful[instance.ID] {
+		log.Printf("[%s] Builder is idle and last build was successful, running build order despite cooldown", instance.ID)
+		return false
+	}
+
+	return true
+}
+
+// highestTaskPriority returns the highest Priority among tasks, or 0 if
+// there are none. It's used as a cheap stand-in for "how important is this
+// instance's work in general" when bidding for screenshot/vision budget,
+// before detections (and thus the actual winning task) are known.
+func highestTaskPriority(tasks []common.Task) int {
+	highest := 0
+	for i := range tasks {
+		if tasks[i].Priority > highest {
+			highest = tasks[i].Priority
+		}
+	}
+	return highest
+}
+
+// candidateScore pairs a task with its computed score for one scheduling
+// pass, so the ranked list can be logged before a winner is picked.
+type candidateScore struct {
+	task  *common.Task
+	score float64
+}
+
+// schedulerWeights returns the configured scheduler weights, or
+// common.DefaultSchedulerWeights if none are set.
+func (m *Manager) schedulerWeights() common.SchedulerWeights {
+	if w := m.Config.Gameplay.SchedulerWeights; w != nil {
+		return *w
+	}
+	return common.DefaultSchedulerWeights()
+}
+
+// scoreTask computes task's score for this iteration: its base Priority and
+// any manual Boost, plus a staleness bonus for how long it's been since it
+// last ran, then, for process_build_order only, a penalty if its last
+// attempt failed.
+func (m *Manager) scoreTask(instance *Instance, task *common.Task, now time.Time) float64 {
+	weights := m.schedulerWeights()
+
+	score := float64(task.Priority + task.Boost)
+	score += weights.StalenessPerMinute * now.Sub(task.LastExecuted).Minutes()
+
+	if task.Name == "process_build_order" && !m.lastBuildSuccessful[instance.ID] {
+		score *= weights.RetryPenaltyMultiplier
+	}
+
+	return score
+}
+
+// rankCandidates returns instance's tasks that clear their cooldown and
+// satisfy eligible, ordered by descending scoreTask score, and logs the
+// ranked list so why a task ran (or didn't) is visible after the fact.
+func (m *Manager) rankCandidates(instance *Instance, detections []common.Detection, eligible func(*common.Task) bool) []*common.Task {
+	now := time.Now()
+
+	var scored []candidateScore
+	for i := range instance.Tasks {
+		task := &instance.Tasks[i]
+		if m.shouldSkipForCooldown(instance, task, detections) {
+			continue
+		}
+		if !eligible(task) {
+			continue
+		}
+		scored = append(scored, candidateScore{task: task, score: m.scoreTask(instance, task, now)})
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].score > scored[j].score
+	})
+
+	if len(scored) > 0 {
+		ranked := make([]string, len(scored))
+		for i, c := range scored {
+			ranked[i] = fmt.Sprintf("%s(%.1f)", c.task.Name, c.score)
+		}
+		log.Printf("[%s] ranked candidates: %s", instance.ID, strings.Join(ranked, ", "))
+	}
+
+	tasks := make([]*common.Task, len(scored))
+	for i, c := range scored {
+		tasks[i] = c.task
+	}
+	return tasks
+}
+
+// BoostTask adds a one-off score boost to the named task on the given
+// instance, so it's likelier to win the next candidate-scoring pass
+// regardless of priority or staleness. It's meant for an operator's manual
+// "run this now" request; the boost is consumed (reset to 0) once the task
+// executes.
+func (m *Manager) BoostTask(id, taskName string, boost int) error {
+	instance, err := m.instanceByID(id)
+	if err != nil {
+		return err
+	}
+
+	for i := range instance.Tasks {
+		if instance.Tasks[i].Name == taskName {
+			instance.Tasks[i].Boost = boost
+			return nil
+		}
+	}
+
+	return fmt.Errorf("instance %s has no task named %q", id, taskName)
+}
+
+// splayFor returns the splay duration to use for an instance, preferring its
+// per-instance override over the global default.
+func splayFor(globalConfig *utils.Config, instance *Instance) time.Duration {
+	splayMS := globalConfig.Global.SplayMS
+	if instance.Config.SplayMS != 0 {
+		splayMS = instance.Config.SplayMS
+	}
+	return time.Duration(splayMS) * time.Millisecond
 }
 
 // Define detection requirements for each task
@@ -87,16 +296,293 @@ var taskRequirements = map[string]common.DetectionRequirement{
 	// They'll be handled based on troop availability in their handlers
 }
 
+// fieldTaskNames are the tasks eligible to run while in field/map view, not
+// just city view.
+var fieldTaskNames = map[string]bool{
+	"manage_scouts":        true,
+	"farm_barbarians":      true,
+	"challenge_barbarians": true,
+	"return_to_city":       true,
+}
+
+// taskRequirementFor looks up a task's detection requirement by name, for
+// populating Task.Requirement in initializeTasks (and from a loaded
+// taskspec.Spec in reloadTaskSpec).
+func taskRequirementFor(name string) common.DetectionRequirement {
+	return taskRequirements[name]
+}
+
+// isFieldTaskName reports whether a task is eligible to run in field/map
+// view, for populating Task.FieldTask in initializeTasks.
+func isFieldTaskName(name string) bool {
+	return fieldTaskNames[name]
+}
+
+// buildOrderParamsKey is the context key used to pass per-call arguments
+// (device ID, current detections, ...) into the process_build_order task
+// handler, since taskrunner.HandlerFunc's signature is fixed but what it
+// needs to act on changes every iteration.
+type buildOrderParamsKey struct{}
+
+// buildOrderParams carries one iteration's worth of working data into the
+// process_build_order task handler via context.WithValue.
+type buildOrderParams struct {
+	deviceID   string
+	gameView   string
+	detections []common.Detection
+	adbPath    string
+	config     common.TaskConfig
+	state      *state.InstanceState
+}
+
+// newBuildOrderRunner builds the taskrunner.Runner used for process_build_order.
+// actions.RunBuildOrderTask is still a single call rather than discrete
+// navigate/tap/confirm/verify tasks, so for now it's wrapped as one task;
+// splitting it further is follow-up work once those steps are broken out of
+// the actions package.
+func newBuildOrderRunner() *taskrunner.Runner {
+	runner := taskrunner.NewRunner()
+	runner.AddHandler("process_build_order", func(ctx context.Context, task *taskrunner.Task) error {
+		params, ok := ctx.Value(buildOrderParamsKey{}).(buildOrderParams)
+		if !ok {
+			return fmt.Errorf("process_build_order: missing params in context")
+		}
+
+		executed := actions.RunBuildOrderTask(
+			ctx,
+			params.deviceID,
+			params.gameView,
+			params.detections,
+			params.adbPath,
+			params.config,
+			params.state,
+		)
+		if !executed {
+			return &taskrunner.Retry{After: time.Second}
+		}
+		return nil
+	})
+	return runner
+}
+
 // NewManager creates a new instance manager
 func NewManager(config *utils.Config, reporter *report.Reporter) *Manager {
-	return &Manager{
+	var recorder *replay.Recorder
+	if config.Global.ReplayDir != "" {
+		var err error
+		recorder, err = replay.NewRecorder(config.Global.ReplayDir)
+		if err != nil {
+			log.Printf("Error starting session recorder: %v", err)
+		}
+	}
+	replay.Default = recorder
+
+	m := &Manager{
 		Config:              config,
-		Instances:           make(map[string]*Instance),
+		instances:           make(map[string]*Instance),
 		Reporter:            reporter,
+		Metrics:             metrics.Default,
+		Detector:            vision.NewDetector(config),
+		Screenshotter:       vision.DefaultScreenshotter,
+		Replay:              recorder,
+		BuildOrderRunner:    newBuildOrderRunner(),
+		Scheduler:           scheduler.NewScheduler(config.Global.VisionCallsPerMinute, config.Global.ADBConcurrency),
 		StatePath:           filepath.Join(".", "instance_states.json"),
 		noActionCount:       make(map[string]int),
 		lastBuildSuccessful: make(map[string]bool),
+		taskSpecs:           make(map[string]*taskspec.Spec),
+		taskSpecStops:       make(map[string]func()),
+	}
+
+	// React to every future utils.ReloadConfig (SIGHUP or utils.WatchConfig)
+	// the same way main's old SIGHUP handler used to call ApplyConfig
+	// directly, now without main needing to know Manager exists.
+	utils.SubscribeConfig(func(old, newConfig *utils.Config) {
+		m.ApplyConfig(newConfig)
+	})
+
+	return m
+}
+
+// taskSpecPollInterval is how often taskspec.Watch re-checks a watched
+// spec file's modification time.
+const taskSpecPollInterval = 5 * time.Second
+
+// effectiveTaskSpecPath returns the taskspec.Spec path to use for instance:
+// its own override if set, else the global default. Empty means
+// initializeTasks' hard-coded task list is used instead.
+func (m *Manager) effectiveTaskSpecPath(instance *Instance) string {
+	if instance.Config.TaskSpecPath != "" {
+		return instance.Config.TaskSpecPath
+	}
+	return m.Config.Global.TaskSpecPath
+}
+
+// tasksFromSpec converts a loaded taskspec.Spec into a Task list, looking
+// up each handler by name in the actions registry and skipping (with a log
+// line) any TaskDef naming a handler that isn't registered there. previous
+// supplies LastExecuted for tasks also present in the new spec, so a
+// hot-reload doesn't reset every task's cooldown.
+func tasksFromSpec(spec *taskspec.Spec, previous []common.Task) []common.Task {
+	lastExecuted := make(map[string]time.Time, len(previous))
+	for _, t := range previous {
+		lastExecuted[t.Name] = t.LastExecuted
 	}
+
+	tasks := make([]common.Task, 0, len(spec.Tasks))
+	for _, def := range spec.Tasks {
+		handler, ok := actions.Lookup(def.Handler)
+		if !ok {
+			log.Printf("taskspec: no handler registered for %q (task %q), skipping", def.Handler, def.Name)
+			continue
+		}
+
+		tasks = append(tasks, common.Task{
+			Name:         def.Name,
+			Priority:     def.Priority,
+			CooldownSec:  def.CooldownSec,
+			LastExecuted: lastExecuted[def.Name],
+			Requirement:  def.Requirement,
+			FieldTask:    def.FieldTask,
+			Config:       def.Config,
+			Handler:      handler,
+		})
+	}
+	return tasks
+}
+
+// reloadTaskSpec caches spec under path and rebuilds the task list of every
+// instance whose effective taskspec path is path. Called once on the
+// initial load from startTaskSpecWatch, then again each time
+// taskspec.Watch notices the file changed on disk.
+func (m *Manager) reloadTaskSpec(path string, spec *taskspec.Spec) {
+	m.taskSpecs[path] = spec
+
+	m.instancesMu.RLock()
+	defer m.instancesMu.RUnlock()
+	for _, instance := range m.instances {
+		if m.effectiveTaskSpecPath(instance) != path {
+			continue
+		}
+		instance.Tasks = tasksFromSpec(spec, instance.Tasks)
+		log.Printf("[%s] Reloaded %d tasks from %s", instance.ID, len(instance.Tasks), path)
+	}
+}
+
+// startTaskSpecWatch loads path, applies it to every matching instance, and
+// begins polling it for further changes, unless it's already being watched.
+// A load error leaves instances on their hard-coded default task list and
+// is logged rather than fatal, since a typo'd path shouldn't stop the bot
+// from starting.
+func (m *Manager) startTaskSpecWatch(path string) {
+	if _, watching := m.taskSpecStops[path]; watching {
+		return
+	}
+
+	spec, err := taskspec.Load(path)
+	if err != nil {
+		log.Printf("taskspec: error loading %s, falling back to hard-coded tasks: %v", path, err)
+		return
+	}
+	m.reloadTaskSpec(path, spec)
+
+	m.taskSpecStops[path] = taskspec.Watch(path, taskSpecPollInterval, func(spec *taskspec.Spec) {
+		m.reloadTaskSpec(path, spec)
+	})
+}
+
+// profilesPollInterval is how often profile.Watch re-checks ProfilesPath's
+// modification time.
+const profilesPollInterval = 5 * time.Second
+
+// startProfilesWatch loads GlobalConfig.ProfilesPath (if set and not
+// already being watched) and begins polling it for further edits. A load
+// error leaves m.profiles empty and is logged rather than fatal - every
+// instance.Config.Profile simply fails to resolve until a later reload
+// fixes it, falling back to its taskspec/hard-coded task list in the
+// meantime (see applyProfile).
+func (m *Manager) startProfilesWatch() {
+	path := m.Config.Global.ProfilesPath
+	if path == "" || m.profilesStop != nil {
+		return
+	}
+
+	set, err := profile.Load(path)
+	if err != nil {
+		log.Printf("profile: error loading %s, instances with a Profile set will fall back to taskspec/hard-coded tasks: %v", path, err)
+		return
+	}
+	m.reloadProfiles(set)
+
+	m.profilesStop = profile.Watch(path, profilesPollInterval, m.reloadProfiles)
+}
+
+// reloadProfiles caches set and rebuilds the task list of every instance
+// whose Config.Profile names a profile present in it. Called once on the
+// initial load from startProfilesWatch, then again each time profile.Watch
+// notices ProfilesPath changed on disk.
+func (m *Manager) reloadProfiles(set profile.Set) {
+	m.profiles = set
+
+	m.instancesMu.RLock()
+	defer m.instancesMu.RUnlock()
+	for _, instance := range m.instances {
+		if instance.Config.Profile == "" {
+			continue
+		}
+		if !m.applyProfile(instance) {
+			continue
+		}
+		log.Printf("[%s] Reloaded profile %q (%d tasks)", instance.ID, instance.Config.Profile, len(instance.Tasks))
+	}
+}
+
+// applyProfile rebuilds instance.Tasks from its Config.Profile, if that
+// name resolves against the loaded profile set, and reports whether it
+// did. A caller should fall back to effectiveTaskSpecPath/the hard-coded
+// default task list when it returns false - e.g. ProfilesPath hasn't
+// loaded yet, or the name was mistyped.
+func (m *Manager) applyProfile(instance *Instance) bool {
+	p, ok := m.profiles[instance.Config.Profile]
+	if !ok {
+		return false
+	}
+	instance.Tasks = tasksFromSpec(p.ToSpec(), instance.Tasks)
+	return true
+}
+
+// runBuildOrderTask drives the process_build_order task through
+// BuildOrderRunner instead of calling actions.RunBuildOrderTask directly, so
+// its Change/Task status is persisted on instance.State. Manager.Pause()
+// doesn't cut a call that is already running short: nothing calls
+// BuildOrderRunner.AbortChange, and actions.RunBuildOrderTask uses ctx only
+// for logging. It returns whether a build action was executed
+// this call, matching the signature every other common.Task.Handler has.
+func (m *Manager) runBuildOrderTask(ctx context.Context, instance *Instance, gameView string, detections []common.Detection, config common.TaskConfig) bool {
+	change := instance.State.ActiveBuildChange
+	if change == nil || change.Status.Ready() {
+		change = taskrunner.NewChange(instance.ID, "process_build_order")
+		change.AddTask("execute", "process_build_order")
+		instance.State.ActiveBuildChange = change
+	}
+
+	ctx = context.WithValue(ctx, buildOrderParamsKey{}, buildOrderParams{
+		deviceID:   instance.DeviceID,
+		gameView:   gameView,
+		detections: detections,
+		adbPath:    m.Config.Gameplay.ADBPath,
+		config:     config,
+		state:      instance.State,
+	})
+
+	retryAfter, err := m.BuildOrderRunner.Run(ctx, change)
+	if err != nil {
+		log.Printf("[%s] process_build_order task error: %v", instance.ID, err)
+	} else if retryAfter > 0 {
+		log.Printf("[%s] process_build_order task backing off for %v", instance.ID, retryAfter)
+	}
+
+	return change.Status == taskrunner.DoneStatus
 }
 
 // LoadInstanceStates loads all instance states from disk
@@ -109,6 +595,12 @@ func (m *Manager) LoadInstanceStates(filepath string) error {
 		return err
 	}
 
+	// Populate m.profiles before initializeTasks runs below, so an
+	// instance whose InstanceConfig.Profile is already set in config.json
+	// resolves it on first load instead of starting on the fallback task
+	// list until the next reload happens to land.
+	m.startProfilesWatch()
+
 	// Initialize instances from config
 	for id, cfg := range m.Config.Instances {
 		// Check if we have existing state
@@ -132,16 +624,22 @@ func (m *Manager) LoadInstanceStates(filepath string) error {
 		instanceState.DeviceID = cfg.DeviceID
 
 		// Create instance
-		m.Instances[id] = &Instance{
+		instance := &Instance{
 			ID:       id,
 			DeviceID: cfg.DeviceID,
 			Config:   cfg,
 			State:    instanceState,
 			Tasks:    []common.Task{},
 		}
+		m.instancesMu.Lock()
+		m.instances[id] = instance
+		m.instancesMu.Unlock()
 
 		// Initialize tasks for this instance
-		m.initializeTasks(m.Instances[id])
+		m.initializeTasks(instance)
+
+		// Build the lifecycle FSM, resuming at the persisted phase
+		m.initializeFSM(instance)
 	}
 
 	// Save immediately to ensure file exists and format is correct
@@ -171,6 +669,8 @@ func (m *Manager) initializeTasks(instance *Instance) {
 			Name:        "process_build_order",
 			Priority:    95, // High priority, just below city hall
 			CooldownSec: 0,  // Check every second if not successful
+			Requirement: taskRequirementFor("process_build_order"),
+			FieldTask:   isFieldTaskName("process_build_order"),
 			Config:      common.TaskConfig{},
 			Handler:     actions.RunBuildOrderTask,
 		},
@@ -178,6 +678,8 @@ func (m *Manager) initializeTasks(instance *Instance) {
 			Name:        "collect_quests",
 			Priority:    90,
 			CooldownSec: 0, // no cooldown if there are more quests to claim
+			Requirement: taskRequirementFor("collect_quests"),
+			FieldTask:   isFieldTaskName("collect_quests"),
 			Config: common.TaskConfig{
 				ClaimOnlyMainQuest: false, // Claim all quests by default
 			},
@@ -193,22 +695,224 @@ func (m *Manager) initializeTasks(instance *Instance) {
 		   },
 		*/
 	}
+
+	// A resolvable Config.Profile overrides everything below it - see
+	// applyProfile. Falls through to taskspec/the hard-coded list above if
+	// Profile is unset or hasn't loaded yet.
+	if instance.Config.Profile != "" && m.applyProfile(instance) {
+		return
+	}
+
+	// A configured taskspec.Spec overrides the hard-coded list above, once
+	// loaded - see reloadTaskSpec/startTaskSpecWatch. An unset path, or a
+	// spec that hasn't loaded yet, leaves instance.Tasks as set above.
+	path := m.effectiveTaskSpecPath(instance)
+	if path == "" {
+		return
+	}
+	if spec, cached := m.taskSpecs[path]; cached {
+		instance.Tasks = tasksFromSpec(spec, instance.Tasks)
+		return
+	}
+	m.startTaskSpecWatch(path)
+}
+
+// initializeFSM builds the lifecycle FSM for an instance, resuming at
+// whatever phase was last persisted, and registers the handlers that drive
+// the simple boot -> tutorial -> startup -> daily loop progression. Each
+// handler just moves to the next state; the actual work still happens in
+// RunInstanceLoop/RunGameplayIteration, which call Operate at the right
+// points.
+func (m *Manager) initializeFSM(instance *Instance) {
+	initial := fsm.FSMState(instance.State.LifecyclePhase)
+	if initial == "" {
+		initial = fsm.StateBoot
+	}
+
+	f := fsm.New(initial)
+
+	f.OnStateChange(func(old, new fsm.FSMState) {
+		log.Printf("[%s] Lifecycle transition: %s -> %s", instance.ID, old, new)
+		instance.State.LifecyclePhase = string(new)
+		m.Reporter.ReportEvent(instance.ID, "lifecycle_transition", map[string]interface{}{
+			"from": string(old),
+			"to":   string(new),
+		})
+	})
+
+	f.AddHandler(fsm.StateBoot, fsm.EventBootComplete, func(f *fsm.FSM) error {
+		if instance.State.TutorialCompleted {
+			f.SetState(fsm.StateStartupTasks)
+		} else {
+			f.SetState(fsm.StateTutorial)
+		}
+		return nil
+	})
+	f.AddHandler(fsm.StateTutorial, fsm.EventTutorialDone, func(f *fsm.FSM) error {
+		f.SetState(fsm.StateStartupTasks)
+		return nil
+	})
+	f.AddHandler(fsm.StateStartupTasks, fsm.EventStartupDone, func(f *fsm.FSM) error {
+		f.SetState(fsm.StateDailyLoop)
+		return nil
+	})
+	f.AddHandler(fsm.StateDailyLoop, fsm.EventPauseRequested, func(f *fsm.FSM) error {
+		f.SetState(fsm.StatePaused)
+		return nil
+	})
+	f.AddHandler(fsm.StatePaused, fsm.EventResumeRequested, func(f *fsm.FSM) error {
+		f.SetState(fsm.StateDailyLoop)
+		return nil
+	})
+	for _, s := range []fsm.FSMState{fsm.StateTutorial, fsm.StateStartupTasks, fsm.StateTreeClearing, fsm.StateBuilderQuest, fsm.StateDailyLoop} {
+		f.AddHandler(s, fsm.EventCrashDetected, func(f *fsm.FSM) error {
+			f.SetState(fsm.StateError)
+			return nil
+		})
+	}
+
+	instance.FSM = f
+}
+
+// ApplyConfig swaps in a freshly reloaded configuration (e.g. from a SIGHUP
+// handler) without restarting any already-running instance loops. Tunables
+// like RefreshIntervalMS and ReportEndpoint take effect immediately because
+// RunInstanceLoop reads m.Config on every iteration; any newly added
+// instances are started here since main only starts loops once at boot.
+func (m *Manager) ApplyConfig(newConfig *utils.Config) {
+	for id, cfg := range newConfig.Instances {
+		m.instancesMu.RLock()
+		_, exists := m.instances[id]
+		m.instancesMu.RUnlock()
+		if exists {
+			continue
+		}
+
+		instanceState := state.NewInstanceState(id, cfg.DeviceID)
+		instance := &Instance{
+			ID:       id,
+			DeviceID: cfg.DeviceID,
+			Config:   cfg,
+			State:    instanceState,
+			Tasks:    []common.Task{},
+		}
+
+		// Lock only brackets the map's own insert: holding it across
+		// initializeTasks below would deadlock, since initializeTasks can
+		// call startTaskSpecWatch -> reloadTaskSpec, which takes
+		// instancesMu.RLock on this same goroutine. The exists-check above
+		// and this insert aren't atomic together, so two concurrent reloads
+		// racing to add the same new id could both pass the check - the
+		// second insert below just overwrites the first harmlessly, but
+		// concurrent ApplyConfig calls aren't expected in practice (see
+		// SubscribeConfig's doc comment: fn runs synchronously on the
+		// goroutine that called ReloadConfig).
+		m.instancesMu.Lock()
+		m.instances[id] = instance
+		m.instancesMu.Unlock()
+
+		log.Printf("[%s] New instance found in reloaded config, starting it", id)
+		m.initializeTasks(instance)
+		m.initializeFSM(instance)
+
+		go m.RunInstanceLoop(id, instance)
+	}
+
+	m.Config = newConfig
+	m.Reporter.Endpoint = newConfig.Global.ReportEndpoint
+	m.Reporter.HMACSecret = newConfig.Global.ReportHMACSecret
+	m.Reporter.MaxQueueSize = newConfig.Global.ReportMaxQueueSize
+	m.Reporter.MinReportInterval = time.Duration(newConfig.Global.ReportRateLimitPerInstanceS) * time.Second
+	m.Detector = vision.NewDetector(newConfig)
+
+	m.Scheduler.Stop()
+	m.Scheduler = scheduler.NewScheduler(newConfig.Global.VisionCallsPerMinute, newConfig.Global.ADBConcurrency)
+
+	for _, stop := range m.taskSpecStops {
+		stop()
+	}
+	m.taskSpecStops = make(map[string]func())
+	m.taskSpecs = make(map[string]*taskspec.Spec)
+	// Snapshot first rather than holding instancesMu.RLock across the loop:
+	// startTaskSpecWatch -> reloadTaskSpec takes its own RLock, and a
+	// recursive RLock on the same goroutine can deadlock against a writer
+	// queued in between the two acquisitions.
+	for _, instance := range m.InstancesSnapshot() {
+		if path := m.effectiveTaskSpecPath(instance); path != "" {
+			m.startTaskSpecWatch(path)
+		}
+	}
+
+	if m.profilesStop != nil {
+		m.profilesStop()
+		m.profilesStop = nil
+	}
+	m.profiles = nil
+	m.startProfilesWatch()
+
+	log.Println("Configuration reloaded and applied")
+}
+
+// ApplyDeviceProfiles overrides each named device's InstanceConfig.Profile
+// and rebuilds its task list from it, ignoring any device ID that doesn't
+// match a loaded instance. It's the entry point for main's
+// --device-profiles flag (profile=deviceID pairs), letting an operator
+// assign profiles at launch without editing config.json, and takes
+// priority over whatever config.json itself set for that instance since
+// it's applied after LoadInstanceStates. A no-op if deviceProfiles is
+// empty, so callers can pass an unparsed/absent flag value unconditionally.
+func (m *Manager) ApplyDeviceProfiles(deviceProfiles map[string]string) {
+	if len(deviceProfiles) == 0 {
+		return
+	}
+
+	m.instancesMu.RLock()
+	byDeviceID := make(map[string]*Instance, len(m.instances))
+	for _, instance := range m.instances {
+		byDeviceID[instance.DeviceID] = instance
+	}
+	m.instancesMu.RUnlock()
+
+	for deviceID, profileName := range deviceProfiles {
+		instance, ok := byDeviceID[deviceID]
+		if !ok {
+			log.Printf("--device-profiles: no instance with device ID %q, ignoring", deviceID)
+			continue
+		}
+		instance.Config.Profile = profileName
+		m.initializeTasks(instance)
+		log.Printf("[%s] CLI assigned profile %q (%d tasks)", instance.ID, profileName, len(instance.Tasks))
+	}
 }
 
 // SaveInstanceStates saves all instance states to disk
 func (m *Manager) SaveInstanceStates() error {
 	// Convert to map of InstanceState
 	states := make(map[string]*state.InstanceState)
-	for id, instance := range m.Instances {
+	m.instancesMu.RLock()
+	for id, instance := range m.instances {
 		states[id] = instance.State
 	}
+	m.instancesMu.RUnlock()
 
 	return state.SaveInstanceStates(m.StatePath, states)
 }
 
 // RunInstanceLoop runs the main loop for a specific instance
 func (m *Manager) RunInstanceLoop(id string, instance *Instance) {
-	log.Printf("[%s] Starting instance loop", id)
+	instanceCtx := logging.WithFields(context.Background(), logging.Fields{"instance": id})
+
+	log.Printf("[%s] Starting instance loop, scan interval is %v with a splay of %v",
+		id, time.Duration(m.Config.Global.RefreshIntervalMS)*time.Millisecond, splayFor(m.Config, instance))
+
+	if _, err := instance.FSM.Operate(fsm.EventBootComplete); err != nil {
+		log.Printf("[%s] fsm: %v", id, err)
+	}
+
+	// Pick up any flow (e.g. recruit_second_builder) left interrupted by a
+	// crash or restart before it could persist its own completion flag.
+	resumeDevice := &device.ADBDevice{DeviceID: instance.DeviceID, AdbPath: m.Config.Gameplay.ADBPath}
+	actions.ResumeFlows(resumeDevice, instance.State)
 
 	// First check if tutorial is completed
 	if !instance.State.TutorialCompleted {
@@ -219,9 +923,9 @@ func (m *Manager) RunInstanceLoop(id string, instance *Instance) {
 	// Main gameplay loop
 	iterationCount := 0
 	for {
-		// Check if automation is paused
+		// Check if automation is paused, globally or just for this instance
 		m.pauseLock.Lock()
-		paused := m.paused
+		paused := m.paused || instance.IsPaused()
 		m.pauseLock.Unlock()
 
 		// Only increment iteration and proceed if not paused
@@ -229,9 +933,11 @@ func (m *Manager) RunInstanceLoop(id string, instance *Instance) {
 			// Log iteration count for debugging
 			iterationCount++
 			log.Printf("[%s] Starting gameplay iteration #%d", id, iterationCount)
+			iterationCtx := logging.WithFields(instanceCtx, logging.Fields{"iteration": iterationCount})
 
 			// Run gameplay iteration
-			m.RunGameplayIteration(instance)
+			m.RunGameplayIteration(iterationCtx, instance)
+			m.Metrics.IncCycles(id)
 
 			// Save state periodically
 			if err := m.SaveInstanceStates(); err != nil {
@@ -243,20 +949,29 @@ func (m *Manager) RunInstanceLoop(id string, instance *Instance) {
 			continue
 		}
 
-		// Calculate delay based on current activity
-		delay := time.Duration(m.Config.Global.RefreshIntervalMS) * time.Millisecond
+		// Calculate delay based on current activity, with a random splay so
+		// that N parallel instances don't all wake up and click at once.
+		// Read fresh from m.Config every iteration so a SIGHUP config reload
+		// takes effect without restarting the loop.
+		baseInterval := time.Duration(m.Config.Global.RefreshIntervalMS) * time.Millisecond
+		splay := splayFor(m.Config, instance)
+		delay := baseInterval
+		if splay > 0 {
+			delay = baseInterval + time.Duration(rand.Int63n(2*int64(splay))-int64(splay))
+		}
+		instance.NextActionAt = time.Now().Add(delay)
 
 		// Check if we're paused before sleeping
 		m.pauseLock.Lock()
-		paused = m.paused
+		paused = m.paused || instance.IsPaused()
 		m.pauseLock.Unlock()
 
 		if paused {
 			log.Printf("[%s] Iteration #%d completed. Automation is paused. Will continue when you type 'r'",
 				id, iterationCount)
 		} else {
-			log.Printf("[%s] Iteration #%d completed. Sleeping %v ms before restarting loop",
-				id, iterationCount, m.Config.Global.RefreshIntervalMS)
+			log.Printf("[%s] Iteration #%d completed. Sleeping %v before restarting loop",
+				id, iterationCount, delay)
 		}
 
 		time.Sleep(delay)
@@ -288,6 +1003,7 @@ func (m *Manager) RunTutorial(instance *Instance) {
 			log.Printf("[%s] Tutorial completed, updating state", instance.ID)
 			instance.State.TutorialCompleted = true
 			instance.State.CityHallLevel = 2 // Tutorial leaves us at CH level 2
+			instance.FSM.Operate(fsm.EventTutorialDone)
 			m.SaveInstanceStates()
 			return
 		}
@@ -303,6 +1019,8 @@ func (m *Manager) RunTutorial(instance *Instance) {
 			m.Config.Gameplay.ADBPath,
 			instance.Config.PreferredCivilization,
 			instance.State, // Pass the state for tracking
+			m.Screenshotter,
+			nil, // tutorial model differs from m.Detector's gameplay model; RunTutorialAutomation builds its own
 		)
 
 		if success {
@@ -310,6 +1028,7 @@ func (m *Manager) RunTutorial(instance *Instance) {
 			log.Printf("[%s] Tutorial completed successfully", instance.ID)
 			instance.State.TutorialCompleted = true
 			instance.State.CityHallLevel = 2
+			instance.FSM.Operate(fsm.EventTutorialDone)
 			m.SaveInstanceStates()
 			return
 		} else {
@@ -342,15 +1061,27 @@ func (m *Manager) RunTutorial(instance *Instance) {
 // Pause pauses all automation
 func (m *Manager) Pause() {
 	m.pauseLock.Lock()
-	defer m.pauseLock.Unlock()
 	m.paused = true
+	m.pauseLock.Unlock()
+
+	m.instancesMu.RLock()
+	defer m.instancesMu.RUnlock()
+	for _, instance := range m.instances {
+		instance.FSM.Operate(fsm.EventPauseRequested)
+	}
 }
 
 // Resume resumes all automation
 func (m *Manager) Resume() {
 	m.pauseLock.Lock()
-	defer m.pauseLock.Unlock()
 	m.paused = false
+	m.pauseLock.Unlock()
+
+	m.instancesMu.RLock()
+	defer m.instancesMu.RUnlock()
+	for _, instance := range m.instances {
+		instance.FSM.Operate(fsm.EventResumeRequested)
+	}
 }
 
 // IsPaused returns the current pause state
@@ -360,8 +1091,98 @@ func (m *Manager) IsPaused() bool {
 	return m.paused
 }
 
+// instanceByID is a small helper shared by the per-instance pause methods.
+func (m *Manager) instanceByID(id string) (*Instance, error) {
+	instance, ok := m.InstanceByID(id)
+	if !ok {
+		return nil, fmt.Errorf("no such instance: %s", id)
+	}
+	return instance, nil
+}
+
+// InstanceByID returns the instance registered under id, for callers outside
+// this package (e.g. ctlapi) that need a single lookup rather than a full
+// InstancesSnapshot. Safe for concurrent use with ApplyConfig's
+// instance-adding reload path.
+func (m *Manager) InstanceByID(id string) (*Instance, bool) {
+	m.instancesMu.RLock()
+	defer m.instancesMu.RUnlock()
+	instance, ok := m.instances[id]
+	return instance, ok
+}
+
+// InstancesSnapshot returns a shallow copy of the current instance set, safe
+// to range over without racing ApplyConfig's instance-adding reload path -
+// the *Instance values themselves aren't copied, only the map.
+func (m *Manager) InstancesSnapshot() map[string]*Instance {
+	m.instancesMu.RLock()
+	defer m.instancesMu.RUnlock()
+	out := make(map[string]*Instance, len(m.instances))
+	for id, instance := range m.instances {
+		out[id] = instance
+	}
+	return out
+}
+
+// InstanceCount returns the number of currently registered instances.
+func (m *Manager) InstanceCount() int {
+	m.instancesMu.RLock()
+	defer m.instancesMu.RUnlock()
+	return len(m.instances)
+}
+
+// PauseInstance pauses a single instance indefinitely, without affecting
+// the others. Use this when one emulator needs manual intervention (a
+// captcha, an event popup) while the rest keep farming. It returns an error
+// if no instance with that ID exists.
+func (m *Manager) PauseInstance(id string) error {
+	instance, err := m.instanceByID(id)
+	if err != nil {
+		return err
+	}
+
+	instance.setPauseState(PauseState{Paused: true})
+	instance.FSM.Operate(fsm.EventPauseRequested)
+	return nil
+}
+
+// ResumeInstance resumes a single instance that was paused with
+// PauseInstance or PauseInstanceFor. It returns an error if no instance
+// with that ID exists.
+func (m *Manager) ResumeInstance(id string) error {
+	instance, err := m.instanceByID(id)
+	if err != nil {
+		return err
+	}
+
+	instance.setPauseState(PauseState{})
+	instance.FSM.Operate(fsm.EventResumeRequested)
+	return nil
+}
+
+// PauseInstanceFor pauses a single instance and automatically resumes it
+// after duration, mirroring the console's "tXX" timed pause but scoped to
+// one instance. If the instance is resumed manually before the timer
+// fires, the timer's own ResumeInstance call is a harmless no-op.
+func (m *Manager) PauseInstanceFor(id string, duration time.Duration) error {
+	instance, err := m.instanceByID(id)
+	if err != nil {
+		return err
+	}
+
+	instance.setPauseState(PauseState{Paused: true, Until: time.Now().Add(duration)})
+	instance.FSM.Operate(fsm.EventPauseRequested)
+
+	go func() {
+		time.Sleep(duration)
+		m.ResumeInstance(id)
+	}()
+
+	return nil
+}
+
 // Modified RunGameplayIteration function to integrate building state tracking and prerequisites
-func (m *Manager) RunGameplayIteration(instance *Instance) {
+func (m *Manager) RunGameplayIteration(ctx context.Context, instance *Instance) {
 	// Check if automation is paused
 	m.pauseLock.Lock()
 	paused := m.paused
@@ -377,9 +1198,10 @@ func (m *Manager) RunGameplayIteration(instance *Instance) {
 
 	// Run one-time startup tasks first (no vision required)
 	if !instance.State.StartupTasksCompleted {
-		if startupComplete := m.runStartupTasks(instance); startupComplete {
+		if startupComplete := m.runStartupTasks(ctx, instance); startupComplete {
 			// All startup tasks are complete, mark it in the state
 			instance.State.StartupTasksCompleted = true
+			instance.FSM.Operate(fsm.EventStartupDone)
 			m.SaveInstanceStates()
 			log.Printf("[%s] All startup tasks completed", instance.ID)
 		} else {
@@ -388,12 +1210,31 @@ func (m *Manager) RunGameplayIteration(instance *Instance) {
 		}
 	}
 
+	// Bid for the shared ADB/vision budget before spending it on this
+	// iteration's screenshot and inference call; see internal/scheduler
+	// for why this is shared across instances rather than per-instance.
+	// Per-task ADB calls during task execution below aren't gated yet.
+	bid := scheduler.Bid{
+		InstanceID: instance.ID,
+		TaskName:   "screenshot",
+		Priority:   float64(highestTaskPriority(instance.Tasks)),
+	}
+
+	releaseADB, err := m.Scheduler.AcquireADB(ctx, bid)
+	if err != nil {
+		log.Printf("[%s] Could not acquire ADB budget: %v", instance.ID, err)
+		return
+	}
+
 	// Take screenshot for analysis
-	screenshot, err := vision.CaptureScreenshot(instance.DeviceID, m.Config.Gameplay.ADBPath)
+	screenshot, err := m.Screenshotter.Capture(instance.DeviceID, m.Config.Gameplay.ADBPath)
+	releaseADB()
 	if err != nil {
 		log.Printf("[%s] Error capturing screenshot: %v", instance.ID, err)
+		m.Metrics.IncErrors(instance.ID)
 		return
 	}
+	m.Metrics.IncScreenshots(instance.ID)
 
 	// Determine if we need to take periodic screenshot for reporting
 	timeSinceLastReport := time.Since(instance.State.LastReportTime)
@@ -411,16 +1252,35 @@ func (m *Manager) RunGameplayIteration(instance *Instance) {
 		}
 	}
 
+	if err := m.Scheduler.AcquireVision(ctx, bid); err != nil {
+		log.Printf("[%s] Could not acquire vision call budget: %v", instance.ID, err)
+		return
+	}
+
 	// Get current game state and view (city or map)
-	gameView, detections, err := vision.AnalyzeGameState(
-		screenshot,
-		m.Config.Global.RoboflowAPIKey,
-		m.Config.Global.RoboflowGameplayModel,
-	)
+	gameView, detections, err := m.Detector.Analyze(screenshot)
 	if err != nil {
 		log.Printf("[%s] Error analyzing game state: %v", instance.ID, err)
+		m.Metrics.IncErrors(instance.ID)
 		return
 	}
+	ctx = logging.WithFields(ctx, logging.Fields{"game_view": gameView})
+	m.Replay.RecordFrame(instance.DeviceID, screenshot, gameView, detections, instance.State)
+
+	for _, det := range detections {
+		m.Metrics.ObserveDetectionConfidence(det.Class, det.Confidence)
+	}
+	// Current city hall level, action points, and resources, for the
+	// roborok_city_hall_level/roborok_action_points/roborok_resources
+	// gauges - sourced from state rather than detections since not every
+	// iteration's view refreshes all of them.
+	m.Metrics.SetCityHallLevel(instance.ID, float64(instance.State.CityHallLevel))
+	m.Metrics.SetActionPoints(instance.ID, float64(instance.State.ActionPoints.Current))
+	m.Metrics.SetResource(instance.ID, "food", float64(instance.State.GameState.Resources.Food))
+	m.Metrics.SetResource(instance.ID, "wood", float64(instance.State.GameState.Resources.Wood))
+	m.Metrics.SetResource(instance.ID, "stone", float64(instance.State.GameState.Resources.Stone))
+	m.Metrics.SetResource(instance.ID, "gold", float64(instance.State.GameState.Resources.Gold))
+	m.Metrics.SetResource(instance.ID, "gems", float64(instance.State.GameState.Resources.Gems))
 
 	for _, det := range detections {
 		if det.Class == "in_build" && det.Confidence > common.MinConfidence {
@@ -448,69 +1308,37 @@ func (m *Manager) RunGameplayIteration(instance *Instance) {
 		log.Printf("[%s] Currently in %s view", instance.ID, gameView)
 		fieldTaskExecuted := false
 
-		// Try field-specific tasks first
-		for i := range instance.Tasks {
-			task := &instance.Tasks[i]
-			requirement, hasRequirement := taskRequirements[task.Name]
-
-			// Skip if task is on cooldown - BUT make exception for build_order when builders are idle
-			if time.Since(task.LastExecuted) < time.Duration(task.CooldownSec)*time.Second {
-				// Check if this is the build order task and a builder is available and last build was successful
-				if task.Name == "process_build_order" {
-					builderAvailable := false
-					for _, det := range detections {
-						if det.Class == "builders_hut_idle" && det.Confidence > common.MinConfidence {
-							builderAvailable = true
-							break
-						}
-					}
-
-					// Only bypass cooldown if last build was successful AND builder is available
-					if builderAvailable && m.lastBuildSuccessful[instance.ID] {
-						log.Printf("[%s] Builder is idle and last build was successful, running build order despite cooldown", instance.ID)
-						// Continue with task execution
-					} else {
-						// No idle builder or last build failed, honor the cooldown
-						continue
-					}
-				} else {
-					// Not a build order task, honor the cooldown
-					continue
-				}
+		// Try field-specific tasks first, highest-scored candidate first
+		fieldEligible := func(task *common.Task) bool {
+			if !task.FieldTask {
+				return false
 			}
+			return task.Requirement.IsMet(detections)
+		}
 
-			// Skip if task requires city view
-			if hasRequirement {
-				// Skip city-specific tasks
-				isFieldTask := false
+		for _, task := range m.rankCandidates(instance, detections, fieldEligible) {
+			taskCtx := logging.WithFields(ctx, logging.Fields{"task": task.Name})
 
-				// Tasks that work in field view:
-				switch task.Name {
-				case "manage_scouts", "farm_barbarians", "challenge_barbarians", "return_to_city":
-					isFieldTask = true
-				}
-
-				if !isFieldTask {
-					continue
-				}
-
-				// Check other requirements
-				if !requirement.IsMet(detections) {
-					continue
-				}
+			// Execute field-appropriate task
+			var executed bool
+			if task.Name == "process_build_order" {
+				executed = m.runBuildOrderTask(taskCtx, instance, gameView, detections, task.Config)
+			} else {
+				executed = task.Handler(
+					taskCtx,
+					instance.DeviceID,
+					gameView,
+					detections,
+					m.Config.Gameplay.ADBPath,
+					task.Config,
+					instance.State, // Pass state for tracking building levels
+				)
 			}
 
-			// Execute field-appropriate task
-			if executed := task.Handler(
-				instance.DeviceID,
-				gameView,
-				detections,
-				m.Config.Gameplay.ADBPath,
-				task.Config,
-				instance.State, // Pass state for tracking building levels
-			); executed {
+			if executed {
 				log.Printf("[%s] Executed field task: %s", instance.ID, task.Name)
 				task.LastExecuted = time.Now()
+				task.Boost = 0
 				fieldTaskExecuted = true
 				return // Return to get fresh state
 			}
@@ -543,56 +1371,35 @@ func (m *Manager) RunGameplayIteration(instance *Instance) {
 	// If we're in city view or couldn't handle field view, proceed with city tasks
 	log.Printf("[%s] Processing city tasks", instance.ID)
 
-	// Execute tasks in priority order
-	for i := range instance.Tasks {
-		task := &instance.Tasks[i]
-
-		// Skip if task is on cooldown - BUT make exception for build_order when builders are idle
-		if time.Since(task.LastExecuted) < time.Duration(task.CooldownSec)*time.Second {
-			// Check if this is the build order task and a builder is available and last build was successful
-			if task.Name == "process_build_order" {
-				builderAvailable := false
-				for _, det := range detections {
-					if det.Class == "builders_hut_idle" && det.Confidence > common.MinConfidence {
-						builderAvailable = true
-						break
-					}
-				}
-
-				// Only bypass cooldown if last build was successful AND builder is available
-				if builderAvailable && m.lastBuildSuccessful[instance.ID] {
-					log.Printf("[%s] Builder is idle and last build was successful, running build order despite cooldown", instance.ID)
-					// Continue with task execution
-				} else {
-					// No idle builder or last build failed, honor the cooldown
-					continue
-				}
-			} else {
-				// Not a build order task, honor the cooldown
-				continue
-			}
-		}
-
-		// Check if detection requirements are met for this task
-		requirement, hasRequirement := taskRequirements[task.Name]
-		if hasRequirement && !requirement.IsMet(detections) {
-			// Skip this task as its detection requirements aren't met
-			continue
-		}
+	// Execute tasks highest-scored candidate first
+	cityEligible := func(task *common.Task) bool {
+		return task.Requirement.IsMet(detections)
+	}
 
+	for _, task := range m.rankCandidates(instance, detections, cityEligible) {
 		log.Printf("[%s] Executing task: %s", instance.ID, task.Name)
+		taskCtx := logging.WithFields(ctx, logging.Fields{"task": task.Name})
 
 		// Execute task with state parameter
-		if executed := task.Handler(
-			instance.DeviceID,
-			gameView,
-			detections,
-			m.Config.Gameplay.ADBPath,
-			task.Config,
-			instance.State, // Pass state for tracking building levels
-		); executed {
+		var executed bool
+		if task.Name == "process_build_order" {
+			executed = m.runBuildOrderTask(taskCtx, instance, gameView, detections, task.Config)
+		} else {
+			executed = task.Handler(
+				taskCtx,
+				instance.DeviceID,
+				gameView,
+				detections,
+				m.Config.Gameplay.ADBPath,
+				task.Config,
+				instance.State, // Pass state for tracking building levels
+			)
+		}
+
+		if executed {
 			log.Printf("[%s] Executed task: %s", instance.ID, task.Name)
 			task.LastExecuted = time.Now()
+			task.Boost = 0
 
 			// Save state immediately after executing a building-related task
 			if task.Name == "process_build_order" {
@@ -614,10 +1421,10 @@ func (m *Manager) RunGameplayIteration(instance *Instance) {
 }
 
 // runStartupTasks handles one-time startup tasks that don't require vision
-func (m *Manager) runStartupTasks(instance *Instance) bool {
+func (m *Manager) runStartupTasks(ctx context.Context, instance *Instance) bool {
 	// Get startup tasks from config
 	startupTasks := m.Config.Gameplay.StartupTasks
-	log.Printf("[%s] Running startup tasks: %v", instance.ID, startupTasks)
+	logging.FromContext(ctx).Printf("Running startup tasks: %v", startupTasks)
 
 	// Create empty config for tasks that don't need specific config
 	emptyConfig := common.TaskConfig{}
@@ -640,7 +1447,7 @@ func (m *Manager) runStartupTasks(instance *Instance) bool {
 					return false
 				}
 
-				if actions.IsTreeClearingComplete() {
+				if actions.IsTreeClearingComplete(instance.State) {
 					instance.State.TreeClearingCompleted = true
 					log.Printf("[%s] Startup task completed: clear_trees", instance.ID)
 				} else {
@@ -657,7 +1464,7 @@ func (m *Manager) runStartupTasks(instance *Instance) bool {
 
 				// Take a fresh screenshot for second builder task
 				log.Printf("[%s] Taking fresh screenshot for second builder task", instance.ID)
-				screenshot, err := vision.CaptureScreenshot(instance.DeviceID, m.Config.Gameplay.ADBPath)
+				screenshot, err := m.Screenshotter.Capture(instance.DeviceID, m.Config.Gameplay.ADBPath)
 				if err != nil {
 					log.Printf("[%s] Error capturing screenshot for second builder: %v", instance.ID, err)
 					return false
@@ -673,15 +1480,12 @@ func (m *Manager) runStartupTasks(instance *Instance) bool {
 
 				// Get current game state and view
 				log.Printf("[%s] Analyzing game state for second builder", instance.ID)
-				gameView, detections, err := vision.AnalyzeGameState(
-					screenshot,
-					m.Config.Global.RoboflowAPIKey,
-					m.Config.Global.RoboflowGameplayModel,
-				)
+				gameView, detections, err := m.Detector.Analyze(screenshot)
 				if err != nil {
 					log.Printf("[%s] Error analyzing game state for second builder: %v", instance.ID, err)
 					return false
 				}
+				m.Replay.RecordFrame(instance.DeviceID, screenshot, gameView, detections, instance.State)
 
 				// Log detailed detection info
 				log.Printf("[%s] Game view detected: '%s' with %d objects for second builder",
@@ -701,11 +1505,11 @@ func (m *Manager) runStartupTasks(instance *Instance) bool {
 				}
 
 				// Use the existing RecruitSecondBuilder function with the fresh detections
+				dev := &device.ADBDevice{DeviceID: instance.DeviceID, AdbPath: m.Config.Gameplay.ADBPath}
 				if executed := actions.RecruitSecondBuilder(
-					instance.DeviceID,
+					dev,
 					gameView,
 					detections,
-					m.Config.Gameplay.ADBPath,
 					emptyConfig,
 					instance.State,
 				); executed {
@@ -713,8 +1517,8 @@ func (m *Manager) runStartupTasks(instance *Instance) bool {
 					return false
 				}
 
-				// Check if task is now complete via global state variable
-				if actions.IsSecondBuilderAdded() {
+				// Check if task is now complete
+				if actions.IsSecondBuilderAdded(instance.State) {
 					instance.State.SecondBuilderAdded = true
 					log.Printf("[%s] Startup task completed: recruit_second_builder", instance.ID)
 				} else {
@@ -0,0 +1,455 @@
+// Package metrics tracks simple counters, gauges, and histograms for
+// gameplay and vision activity, and renders them in Prometheus text
+// exposition format for internal/ctlapi's /metrics endpoint. It
+// intentionally hand-rolls the format rather than depending on a client
+// library, since this repo has no external dependencies.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds (inclusive), in seconds, used for the
+// ADB round-trip, screenshot capture, and Roboflow request histograms. A
+// real call usually completes in well under a second, so the buckets are
+// weighted toward the low end with a long tail for flaky devices/networks.
+var latencyBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// confidenceBuckets are the upper bounds used for the detection-confidence
+// histogram, which ranges over [0, 1] rather than seconds.
+var confidenceBuckets = []float64{0.1, 0.3, 0.5, 0.6, 0.7, 0.8, 0.9, 0.95, 0.99}
+
+type histogram struct {
+	buckets []float64 // upper bounds, inclusive
+	counts  []int64   // parallel to buckets, cumulative
+	sum     float64
+	count   int64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]int64, len(buckets))}
+}
+
+func (h *histogram) observe(value float64) {
+	h.sum += value
+	h.count++
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+}
+
+// Metrics collects per-instance counters, gauges, and histograms for the
+// /metrics endpoint. It is safe for concurrent use.
+type Metrics struct {
+	mu          sync.Mutex
+	cycles      map[string]int64
+	errors      map[string]int64
+	screenshots map[string]int64
+	adbLatency  map[string]*histogram // keyed by device ID
+
+	questsClaimed        map[[2]string]int64      // [instance, quest_type]
+	helpBubblesDismissed map[string]int64         // instance
+	detectionConfidence  map[string]*histogram    // class
+	screenshotCapture    map[string]*histogram    // device
+	roboflowRequest      map[[2]string]*histogram // [model, status]
+	buildTaskAttempts    map[[2]string]int64      // [building, result]
+	actionPoints         map[string]float64       // instance
+	cityHallLevel        map[string]float64       // instance
+	resources            map[[2]string]float64    // [instance, resource_type]
+
+	visionRequests  map[[2]string]int64 // [model, provider]
+	visionCacheHits int64               // process-wide: cachingDetector is per-process, not per-instance
+	visionRetries   map[string]int64    // model
+
+	reportQueueDepth float64 // process-wide: report.Reporter is a singleton, not per-instance
+	reportInFlight   float64
+}
+
+// New creates an empty Metrics collector.
+func New() *Metrics {
+	return &Metrics{
+		cycles:               make(map[string]int64),
+		errors:               make(map[string]int64),
+		screenshots:          make(map[string]int64),
+		adbLatency:           make(map[string]*histogram),
+		questsClaimed:        make(map[[2]string]int64),
+		helpBubblesDismissed: make(map[string]int64),
+		detectionConfidence:  make(map[string]*histogram),
+		screenshotCapture:    make(map[string]*histogram),
+		roboflowRequest:      make(map[[2]string]*histogram),
+		buildTaskAttempts:    make(map[[2]string]int64),
+		actionPoints:         make(map[string]float64),
+		cityHallLevel:        make(map[string]float64),
+		resources:            make(map[[2]string]float64),
+		visionRequests:       make(map[[2]string]int64),
+		visionRetries:        make(map[string]int64),
+	}
+}
+
+// Default is the process-wide collector. internal/utils/adb.go and
+// internal/vision record latency/detection metrics here directly, since
+// those helpers are called from deep inside internal/actions and don't
+// have a Manager reference to thread through; everything else goes through
+// a Manager-owned Metrics instance.
+var Default = New()
+
+// IncCycles records one completed gameplay iteration for instanceID.
+func (m *Metrics) IncCycles(instanceID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cycles[instanceID]++
+}
+
+// IncErrors records one handled error for instanceID.
+func (m *Metrics) IncErrors(instanceID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors[instanceID]++
+}
+
+// IncScreenshots records one screenshot capture for instanceID.
+func (m *Metrics) IncScreenshots(instanceID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.screenshots[instanceID]++
+}
+
+// ObserveADBLatency records how long an ADB round-trip took for deviceID.
+func (m *Metrics) ObserveADBLatency(deviceID string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.adbLatency[deviceID]
+	if !ok {
+		h = newHistogram(latencyBuckets)
+		m.adbLatency[deviceID] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// IncQuestsClaimed records one quest claimed for instanceID, labeled by
+// questType ("main" or "regular").
+func (m *Metrics) IncQuestsClaimed(instanceID, questType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.questsClaimed[[2]string{instanceID, questType}]++
+}
+
+// IncHelpBubblesDismissed records one help/chat bubble dismissed for
+// deviceID. This is keyed by device rather than instance, like
+// ObserveADBLatency, since vision.CaptureAndDetect (the only call site) only
+// has a device ID to work with.
+func (m *Metrics) IncHelpBubblesDismissed(deviceID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.helpBubblesDismissed[deviceID]++
+}
+
+// ObserveDetectionConfidence records one detection's confidence score,
+// keyed by class.
+func (m *Metrics) ObserveDetectionConfidence(class string, confidence float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.detectionConfidence[class]
+	if !ok {
+		h = newHistogram(confidenceBuckets)
+		m.detectionConfidence[class] = h
+	}
+	h.observe(confidence)
+}
+
+// ObserveScreenshotCapture records how long a screenshot capture took for
+// deviceID.
+func (m *Metrics) ObserveScreenshotCapture(deviceID string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.screenshotCapture[deviceID]
+	if !ok {
+		h = newHistogram(latencyBuckets)
+		m.screenshotCapture[deviceID] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// ObserveRoboflowRequest records how long a Roboflow inference call took,
+// labeled by model ID and outcome ("ok" or "error").
+func (m *Metrics) ObserveRoboflowRequest(model, status string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := [2]string{model, status}
+	h, ok := m.roboflowRequest[key]
+	if !ok {
+		h = newHistogram(latencyBuckets)
+		m.roboflowRequest[key] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// IncBuildTaskAttempts records one build-order attempt for building, labeled
+// by result ("success" or "failure").
+func (m *Metrics) IncBuildTaskAttempts(building, result string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buildTaskAttempts[[2]string{building, result}]++
+}
+
+// SetActionPoints records instanceID's current action point count, sourced
+// from its InstanceState.
+func (m *Metrics) SetActionPoints(instanceID string, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.actionPoints[instanceID] = value
+}
+
+// SetCityHallLevel records instanceID's current city hall level, sourced
+// from its InstanceState.
+func (m *Metrics) SetCityHallLevel(instanceID string, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cityHallLevel[instanceID] = value
+}
+
+// SetResource records instanceID's current stock of resourceType, sourced
+// from its InstanceState.
+func (m *Metrics) SetResource(instanceID, resourceType string, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resources[[2]string{instanceID, resourceType}] = value
+}
+
+// IncVisionRequests records one vision.ResilientDetector inference attempt
+// against modelID, labeled by which provider actually served it: "roboflow"
+// (the hosted API answered), "error" (every retry against the hosted API
+// was exhausted), or "fallback" (the circuit breaker was already open, so
+// the request never left for Roboflow at all).
+func (m *Metrics) IncVisionRequests(modelID, provider string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.visionRequests[[2]string{modelID, provider}]++
+}
+
+// IncVisionCacheHits records one vision.cachingDetector lookup served from
+// its perceptual-hash cache instead of reaching the wrapped Detector. Not
+// labeled by model: the cache sits in front of whichever Detector NewDetector
+// built, and doesn't itself know the model ID.
+func (m *Metrics) IncVisionCacheHits() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.visionCacheHits++
+}
+
+// IncVisionRetries records one vision.ResilientDetector retry attempt
+// against modelID, i.e. one additional Roboflow request beyond the first
+// for a single Analyze call.
+func (m *Metrics) IncVisionRetries(modelID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.visionRetries[modelID]++
+}
+
+// SetReportQueueDepth records how many ReportItems report.Reporter currently
+// has queued (pending send or spooled from a prior run).
+func (m *Metrics) SetReportQueueDepth(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reportQueueDepth = float64(n)
+}
+
+// SetReportInFlight records how many report.Reporter send batches are
+// currently in progress.
+func (m *Metrics) SetReportInFlight(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reportInFlight = float64(n)
+}
+
+// WriteProm renders all collected metrics in Prometheus text exposition
+// format.
+func (m *Metrics) WriteProm(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP roborok_cycles_completed_total Gameplay iterations completed per instance")
+	fmt.Fprintln(w, "# TYPE roborok_cycles_completed_total counter")
+	for _, id := range sortedKeys(m.cycles) {
+		fmt.Fprintf(w, "roborok_cycles_completed_total{instance=%q} %d\n", id, m.cycles[id])
+	}
+
+	fmt.Fprintln(w, "# HELP roborok_errors_total Errors encountered per instance")
+	fmt.Fprintln(w, "# TYPE roborok_errors_total counter")
+	for _, id := range sortedKeys(m.errors) {
+		fmt.Fprintf(w, "roborok_errors_total{instance=%q} %d\n", id, m.errors[id])
+	}
+
+	fmt.Fprintln(w, "# HELP roborok_screenshots_total Screenshots captured per instance")
+	fmt.Fprintln(w, "# TYPE roborok_screenshots_total counter")
+	for _, id := range sortedKeys(m.screenshots) {
+		fmt.Fprintf(w, "roborok_screenshots_total{instance=%q} %d\n", id, m.screenshots[id])
+	}
+
+	fmt.Fprintln(w, "# HELP roborok_adb_roundtrip_seconds ADB command round-trip latency per device")
+	fmt.Fprintln(w, "# TYPE roborok_adb_roundtrip_seconds histogram")
+	for _, device := range sortedHistKeys(m.adbLatency) {
+		writeHistogram(w, "roborok_adb_roundtrip_seconds", fmt.Sprintf("device=%q", device), m.adbLatency[device])
+	}
+
+	fmt.Fprintln(w, "# HELP roborok_quests_claimed_total Quests claimed per instance, by quest type")
+	fmt.Fprintln(w, "# TYPE roborok_quests_claimed_total counter")
+	for _, key := range sortedPairKeys2(m.questsClaimed) {
+		fmt.Fprintf(w, "roborok_quests_claimed_total{instance=%q,type=%q} %d\n", key[0], key[1], m.questsClaimed[key])
+	}
+
+	fmt.Fprintln(w, "# HELP roborok_help_bubbles_dismissed_total Help/chat bubbles dismissed per device")
+	fmt.Fprintln(w, "# TYPE roborok_help_bubbles_dismissed_total counter")
+	for _, device := range sortedKeys(m.helpBubblesDismissed) {
+		fmt.Fprintf(w, "roborok_help_bubbles_dismissed_total{device=%q} %d\n", device, m.helpBubblesDismissed[device])
+	}
+
+	fmt.Fprintln(w, "# HELP roborok_detection_confidence Confidence scores of detections, by class")
+	fmt.Fprintln(w, "# TYPE roborok_detection_confidence histogram")
+	for _, class := range sortedHistKeys(m.detectionConfidence) {
+		writeHistogram(w, "roborok_detection_confidence", fmt.Sprintf("class=%q", class), m.detectionConfidence[class])
+	}
+
+	fmt.Fprintln(w, "# HELP roborok_screenshot_capture_seconds Screenshot capture latency per device")
+	fmt.Fprintln(w, "# TYPE roborok_screenshot_capture_seconds histogram")
+	for _, device := range sortedHistKeys(m.screenshotCapture) {
+		writeHistogram(w, "roborok_screenshot_capture_seconds", fmt.Sprintf("device=%q", device), m.screenshotCapture[device])
+	}
+
+	fmt.Fprintln(w, "# HELP roborok_roboflow_request_seconds Roboflow inference request latency, by model and outcome")
+	fmt.Fprintln(w, "# TYPE roborok_roboflow_request_seconds histogram")
+	for _, key := range sortedHistPairKeys(m.roboflowRequest) {
+		writeHistogram(w, "roborok_roboflow_request_seconds", fmt.Sprintf("model=%q,status=%q", key[0], key[1]), m.roboflowRequest[key])
+	}
+
+	fmt.Fprintln(w, "# HELP roborok_build_task_attempts_total Build order task attempts, by building and result")
+	fmt.Fprintln(w, "# TYPE roborok_build_task_attempts_total counter")
+	for _, key := range sortedPairKeys2(m.buildTaskAttempts) {
+		fmt.Fprintf(w, "roborok_build_task_attempts_total{building=%q,result=%q} %d\n", key[0], key[1], m.buildTaskAttempts[key])
+	}
+
+	fmt.Fprintln(w, "# HELP roborok_action_points Current action point count per instance")
+	fmt.Fprintln(w, "# TYPE roborok_action_points gauge")
+	for _, id := range sortedGaugeKeys(m.actionPoints) {
+		fmt.Fprintf(w, "roborok_action_points{instance=%q} %g\n", id, m.actionPoints[id])
+	}
+
+	fmt.Fprintln(w, "# HELP roborok_city_hall_level Current city hall level per instance")
+	fmt.Fprintln(w, "# TYPE roborok_city_hall_level gauge")
+	for _, id := range sortedGaugeKeys(m.cityHallLevel) {
+		fmt.Fprintf(w, "roborok_city_hall_level{instance=%q} %g\n", id, m.cityHallLevel[id])
+	}
+
+	fmt.Fprintln(w, "# HELP roborok_resources Current resource stock per instance, by resource type")
+	fmt.Fprintln(w, "# TYPE roborok_resources gauge")
+	for _, key := range sortedGaugePairKeys(m.resources) {
+		fmt.Fprintf(w, "roborok_resources{instance=%q,type=%q} %g\n", key[0], key[1], m.resources[key])
+	}
+
+	fmt.Fprintln(w, "# HELP roborok_vision_requests_total Vision inference attempts, by model and serving provider (roboflow, error, or fallback)")
+	fmt.Fprintln(w, "# TYPE roborok_vision_requests_total counter")
+	for _, key := range sortedPairKeys2(m.visionRequests) {
+		fmt.Fprintf(w, "roborok_vision_requests_total{model=%q,provider=%q} %d\n", key[0], key[1], m.visionRequests[key])
+	}
+
+	fmt.Fprintln(w, "# HELP roborok_vision_cache_hits_total Vision detections served from the perceptual-hash cache instead of inference")
+	fmt.Fprintln(w, "# TYPE roborok_vision_cache_hits_total counter")
+	fmt.Fprintf(w, "roborok_vision_cache_hits_total %d\n", m.visionCacheHits)
+
+	fmt.Fprintln(w, "# HELP roborok_vision_retries_total Roboflow request retries, by model")
+	fmt.Fprintln(w, "# TYPE roborok_vision_retries_total counter")
+	for _, model := range sortedKeys(m.visionRetries) {
+		fmt.Fprintf(w, "roborok_vision_retries_total{model=%q} %d\n", model, m.visionRetries[model])
+	}
+
+	fmt.Fprintln(w, "# HELP roborok_report_queue_depth ReportItems currently queued by the Reporter")
+	fmt.Fprintln(w, "# TYPE roborok_report_queue_depth gauge")
+	fmt.Fprintf(w, "roborok_report_queue_depth %g\n", m.reportQueueDepth)
+
+	fmt.Fprintln(w, "# HELP roborok_report_in_flight Reporter send batches currently in progress")
+	fmt.Fprintln(w, "# TYPE roborok_report_in_flight gauge")
+	fmt.Fprintf(w, "roborok_report_in_flight %g\n", m.reportInFlight)
+}
+
+// writeHistogram renders one histogram's bucket/sum/count lines for name,
+// with extraLabel (already formatted as `key="value"`) added to every
+// series.
+func writeHistogram(w io.Writer, name, extraLabel string, h *histogram) {
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", name, extraLabel, fmt.Sprintf("%g", bound), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, extraLabel, h.count)
+	fmt.Fprintf(w, "%s_sum{%s} %g\n", name, extraLabel, h.sum)
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, extraLabel, h.count)
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedGaugeKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedHistKeys(m map[string]*histogram) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedPairKeys2 sorts the 2-label keys of a counter map for deterministic
+// exposition output.
+func sortedPairKeys2(m map[[2]string]int64) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sortPairs(keys)
+	return keys
+}
+
+func sortedGaugePairKeys(m map[[2]string]float64) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sortPairs(keys)
+	return keys
+}
+
+func sortedHistPairKeys(m map[[2]string]*histogram) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sortPairs(keys)
+	return keys
+}
+
+func sortPairs(keys [][2]string) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+}
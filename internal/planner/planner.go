@@ -0,0 +1,563 @@
+// Package planner loads a declarative build plan describing the buildings
+// and upgrades an instance should pursue, the order constraints between
+// them, their resource costs, and a priority weight, then picks the next
+// task to attempt against an instance's current state.
+//
+// It's meant to sit alongside, not replace, the hard-coded task list in
+// actions.DefineDefaultBuildOrder: actions.ProcessBuildOrder only consults a
+// Plan when utils.GlobalConfig.BuildPlanPath (or the per-instance override)
+// is set, and falls back to the existing flat-slice walk otherwise.
+//
+// The request that prompted this package described plan files as
+// YAML with prerequisites written like "academy>=3". This tree has no
+// go.mod and vendors no YAML library, so - consistent with how the rest of
+// this backlog has substituted stdlib equivalents for implied third-party
+// dependencies (internal/taskspec does the same for its own YAML ask) -
+// Plan files are JSON here, with Requires entries kept in the same
+// "building>=level" string form so the request's example is still valid
+// plan data, just parsed by this package instead of a YAML decoder.
+//
+// A PlanTask's position in a building's dependency chain is expressed with
+// ResultLevel (the level that building reaches once the task completes)
+// rather than by naming other task IDs directly, since that's how the
+// request phrases prerequisites ("academy>=3", not "after task T7"). Load
+// resolves each requirement to the plan task that first reaches the
+// required level and adds a dependency edge on it, then topologically
+// sorts the whole plan with Kahn's algorithm, which surfaces both cycles
+// and tasks whose requirement can never be satisfied as load errors.
+//
+// MinCityHall, Category, and Optional on PlanTask, and the per-instance
+// BuildPlanPath override and reload-on-edit mentioned above, were added
+// later for a follow-up request asking for richer per-task configuration;
+// see their own doc comments and actions.loadBuildPlan.
+package planner
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"roborok/internal/common"
+	"roborok/internal/state"
+)
+
+// externallyTrackedBuildings are buildings a Plan is allowed to reference in
+// a Requires entry without itself containing any task for them, because
+// their level is tracked elsewhere in InstanceState. City hall is the only
+// one today - InstanceState.CityHallLevel is updated independently of any
+// build task (see actions.RunBuildOrderTask's callers).
+var externallyTrackedBuildings = map[string]bool{
+	"city_hall": true,
+}
+
+// ResourceCost is the resource price of one PlanTask.
+type ResourceCost struct {
+	Food  int `json:"food"`
+	Wood  int `json:"wood"`
+	Stone int `json:"stone"`
+	Gold  int `json:"gold"`
+}
+
+// PlanTask is a single build or upgrade step in a Plan.
+type PlanTask struct {
+	ID          string   `json:"id"`
+	Type        string   `json:"type"`     // "build_new" or "upgrade", matching state.BuildTask.Type
+	Building    string   `json:"building"` // matches a key of actions.DetectionClassesByBuilding
+	DetectClass string   `json:"detect_class"`
+	ResultLevel int      `json:"result_level"` // Building's level once this task completes
+	Requires    []string `json:"requires"`     // e.g. "academy>=3"; see externallyTrackedBuildings for buildings a Plan need not build itself
+	// MinCityHall is shorthand for a Requires entry of "city_hall>=N" - it's
+	// common enough (most of actions.DefineDefaultBuildOrder's comments are
+	// "Requires Lvl N City Hall") that plan authors shouldn't have to spell
+	// out the externally-tracked-building form for it every time. Zero means
+	// no city hall floor beyond whatever Requires itself lists.
+	MinCityHall int `json:"min_city_hall,omitempty"`
+	// Category is "economic" or "military", used to pick the right in-game
+	// tab for a build_new task (see actions.BuildNewBuilding) and to decide
+	// which of common.EconomyWeights' EcoWeight/MilitaryWeight bonuses
+	// NextWithEconomy applies. Load fills this in from Building via
+	// DeriveCategory when left empty, so a plan author only needs to set it
+	// explicitly for a building DeriveCategory doesn't recognize.
+	Category string `json:"category,omitempty"`
+	// Optional tasks are skipped (not blocked on) once they've failed
+	// optionalMaxAttempts times, instead of wedging the plan on a task that
+	// keeps failing - e.g. a cosmetic upgrade the detector has trouble
+	// recognizing on some device resolutions.
+	Optional     bool         `json:"optional,omitempty"`
+	Cost         ResourceCost `json:"cost"`
+	BuildTimeSec int          `json:"build_time_sec"`
+	Priority     int          `json:"priority"` // higher runs first among tasks that are otherwise both eligible
+}
+
+// optionalMaxAttempts is how many failed attempts an Optional task gets
+// before Next/NextWithEconomy stop offering it.
+const optionalMaxAttempts = 3
+
+// DeriveCategory fills in PlanTask.Category when a plan author leaves it
+// empty, using the same building classification NextWithEconomy's scoring
+// already relies on. Exported so actions.ActionFilter can classify a
+// building for its category-scoped allow/forbid lists too.
+func DeriveCategory(building string) string {
+	switch {
+	case militaryBuildings[building]:
+		return "military"
+	case economicBuildings[building]:
+		return "economic"
+	default:
+		return ""
+	}
+}
+
+// Plan is a topologically-validated build plan. Tasks is ordered so that
+// every task appears after everything it depends on.
+type Plan struct {
+	Tasks           []PlanTask
+	tasksByBuilding map[string][]*PlanTask
+}
+
+// Load reads, parses, and validates a Plan from a JSON file shaped like
+// {"tasks": [...]}.
+func Load(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading build plan %s: %w", path, err)
+	}
+
+	var raw struct {
+		Tasks []PlanTask `json:"tasks"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing build plan %s: %w", path, err)
+	}
+
+	plan, err := NewPlan(raw.Tasks)
+	if err != nil {
+		return nil, fmt.Errorf("invalid build plan %s: %w", path, err)
+	}
+	return plan, nil
+}
+
+// NewPlan builds a Plan from an in-memory task list the same way Load does
+// from a file - filling in Category via DeriveCategory where left empty,
+// then topoSort-ing and indexing by building - so a caller that synthesizes
+// PlanTasks itself (e.g. buildorder.Compile, expanding a Goal into its
+// build_new/upgrade chain) gets the same validation and lookup behavior a
+// hand-authored plan file would, without writing one to disk first.
+func NewPlan(tasks []PlanTask) (*Plan, error) {
+	for i := range tasks {
+		if tasks[i].Category == "" {
+			tasks[i].Category = DeriveCategory(tasks[i].Building)
+		}
+	}
+
+	ordered, err := topoSort(tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Tasks: ordered, tasksByBuilding: make(map[string][]*PlanTask)}
+	for i := range plan.Tasks {
+		t := &plan.Tasks[i]
+		plan.tasksByBuilding[t.Building] = append(plan.tasksByBuilding[t.Building], t)
+	}
+	return plan, nil
+}
+
+// topoSort validates tasks (strictly-increasing per-building ResultLevels,
+// resolvable Requires, no cycles) and returns them in dependency order.
+func topoSort(tasks []PlanTask) ([]PlanTask, error) {
+	if len(tasks) == 0 {
+		return tasks, nil
+	}
+
+	byID := make(map[string]*PlanTask, len(tasks))
+	for i := range tasks {
+		if tasks[i].ID == "" {
+			return nil, fmt.Errorf("task %d has no id", i)
+		}
+		if _, dup := byID[tasks[i].ID]; dup {
+			return nil, fmt.Errorf("duplicate task id %q", tasks[i].ID)
+		}
+		byID[tasks[i].ID] = &tasks[i]
+	}
+
+	byBuilding := make(map[string][]*PlanTask)
+	for i := range tasks {
+		byBuilding[tasks[i].Building] = append(byBuilding[tasks[i].Building], &tasks[i])
+	}
+	for building, bTasks := range byBuilding {
+		for i := 1; i < len(bTasks); i++ {
+			if bTasks[i].ResultLevel <= bTasks[i-1].ResultLevel {
+				return nil, fmt.Errorf("building %q: task %q's result_level (%d) must exceed the preceding task %q's (%d)",
+					building, bTasks[i].ID, bTasks[i].ResultLevel, bTasks[i-1].ID, bTasks[i-1].ResultLevel)
+			}
+		}
+	}
+
+	indegree := make(map[string]int, len(tasks))
+	edges := make(map[string][]string) // taskID -> tasks that depend on it
+	for i := range tasks {
+		indegree[tasks[i].ID] = 0
+	}
+	addEdge := func(from, to string) {
+		if from == to {
+			return
+		}
+		edges[from] = append(edges[from], to)
+		indegree[to]++
+	}
+
+	for _, bTasks := range byBuilding {
+		for i := 1; i < len(bTasks); i++ {
+			addEdge(bTasks[i-1].ID, bTasks[i].ID)
+		}
+	}
+
+	for i := range tasks {
+		for _, req := range tasks[i].Requires {
+			building, level, err := parseRequirement(req)
+			if err != nil {
+				return nil, fmt.Errorf("task %q: %w", tasks[i].ID, err)
+			}
+
+			providers, ok := byBuilding[building]
+			if !ok {
+				if externallyTrackedBuildings[building] {
+					continue // satisfied at runtime from live InstanceState, not a plan edge
+				}
+				return nil, fmt.Errorf("task %q requires %q, but the plan has no task for %q", tasks[i].ID, req, building)
+			}
+
+			var provider *PlanTask
+			for _, p := range providers {
+				if p.ResultLevel >= level {
+					provider = p
+					break
+				}
+			}
+			if provider == nil {
+				return nil, fmt.Errorf("task %q requires %s>=%d, but no task ever brings %q that high (unreachable)", tasks[i].ID, building, level, building)
+			}
+			addEdge(provider.ID, tasks[i].ID)
+		}
+	}
+
+	var queue []string
+	for id, d := range indegree {
+		if d == 0 {
+			queue = append(queue, id)
+		}
+	}
+	sort.Strings(queue)
+
+	ordered := make([]string, 0, len(tasks))
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		ordered = append(ordered, id)
+
+		var freed []string
+		for _, dep := range edges[id] {
+			indegree[dep]--
+			if indegree[dep] == 0 {
+				freed = append(freed, dep)
+			}
+		}
+		sort.Strings(freed)
+		queue = append(queue, freed...)
+	}
+
+	if len(ordered) != len(tasks) {
+		return nil, fmt.Errorf("build plan has a dependency cycle (%d of %d tasks are reachable)", len(ordered), len(tasks))
+	}
+
+	result := make([]PlanTask, len(ordered))
+	for i, id := range ordered {
+		result[i] = *byID[id]
+	}
+	return result, nil
+}
+
+func parseRequirement(req string) (building string, level int, err error) {
+	parts := strings.SplitN(req, ">=", 2)
+	if len(parts) != 2 {
+		return "", 0, fmt.Errorf("requirement %q must be in the form \"building>=level\"", req)
+	}
+	level, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return "", 0, fmt.Errorf("requirement %q has a non-numeric level: %w", req, err)
+	}
+	return strings.TrimSpace(parts[0]), level, nil
+}
+
+// currentLevel returns building's level as the Plan understands it: the
+// highest ResultLevel among that building's completed tasks, or - for a
+// building the plan itself never builds - the live-tracked level from st.
+func (p *Plan) currentLevel(building string, st *state.InstanceState) int {
+	tasks, ok := p.tasksByBuilding[building]
+	if !ok {
+		if building == "city_hall" {
+			return st.CityHallLevel
+		}
+		return 0
+	}
+
+	level := 0
+	for _, t := range tasks {
+		if st.BuildPlanProgress[t.ID].Completed && t.ResultLevel > level {
+			level = t.ResultLevel
+		}
+	}
+	return level
+}
+
+// TasksForBuilding returns building's tasks in ResultLevel order, the same
+// slice currentLevel itself consults - exported for buildorder.Evaluate,
+// which needs to inspect a synthesized goal's own task chain without
+// duplicating Plan's building index.
+func (p *Plan) TasksForBuilding(building string) []*PlanTask {
+	return p.tasksByBuilding[building]
+}
+
+func (p *Plan) requirementsMet(t *PlanTask, st *state.InstanceState) bool {
+	if t.MinCityHall > 0 && p.currentLevel("city_hall", st) < t.MinCityHall {
+		return false
+	}
+	for _, req := range t.Requires {
+		building, level, err := parseRequirement(req)
+		if err != nil {
+			// Already validated in Load; only reachable if a caller builds
+			// a Plan some other way.
+			return false
+		}
+		if p.currentLevel(building, st) < level {
+			return false
+		}
+	}
+	return true
+}
+
+// skipOptional reports whether t has failed enough times that Next and
+// NextWithEconomy should stop offering it rather than block the rest of the
+// plan on a task that keeps failing.
+func skipOptional(t *PlanTask, progress state.BuildPlanTaskProgress) bool {
+	return t.Optional && progress.Attempts >= optionalMaxAttempts
+}
+
+func affordable(t *PlanTask, st *state.InstanceState) bool {
+	r := st.GameState.Resources
+	return r.Food >= t.Cost.Food && r.Wood >= t.Cost.Wood && r.Stone >= t.Cost.Stone && r.Gold >= t.Cost.Gold
+}
+
+// Next returns the highest-Priority task that is not yet completed, isn't
+// for a building already mid-construction, has its Requires satisfied, and
+// is currently affordable - or nil if nothing qualifies right now. excluded,
+// if non-nil, names task IDs (e.g. ones actions.ActionFilter just rejected)
+// to skip over even though they'd otherwise be eligible.
+func (p *Plan) Next(st *state.InstanceState, excluded map[string]bool) *PlanTask {
+	var best *PlanTask
+	for i := range p.Tasks {
+		t := &p.Tasks[i]
+		if excluded[t.ID] {
+			continue
+		}
+		progress := st.BuildPlanProgress[t.ID]
+
+		if progress.Completed || progress.Skipped || skipOptional(t, progress) {
+			continue
+		}
+		if _, inProgress := st.GameState.BuildingsInProgress[t.Building]; inProgress {
+			continue
+		}
+		if !p.requirementsMet(t, st) {
+			continue
+		}
+		if !affordable(t, st) {
+			continue
+		}
+		if best == nil || t.Priority > best.Priority {
+			best = t
+		}
+	}
+	return best
+}
+
+// militaryBuildings and economicBuildings classify a PlanTask.Building for
+// NextWithEconomy's scoring. This mirrors the "economic:"/"military:"
+// category prefix actions.BuildNewBuilding already parses out of a
+// build_new task's DetectClass to pick the right in-game tab, but upgrade
+// tasks carry no such prefix - their DetectClass is just the building's own
+// detection class - so scoring needs its own static classification.
+var militaryBuildings = map[string]bool{
+	"wall": true, "barracks": true, "archery_range": true,
+	"stable": true, "siege_workshop": true,
+}
+
+var economicBuildings = map[string]bool{
+	"farm": true, "lumber_mill": true, "quarry": true, "goldmine": true,
+	"storehouse": true, "trading_post": true, "academy": true,
+	"alliance_center": true, "tavern": true, "hospital": true, "scout_camp": true,
+}
+
+// NextWithEconomy is Next with economy-aware scoring layered on top of
+// Priority, per weights (see common.EconomyWeights - its zero value makes this
+// identical to Next). Every task Next would consider gets a base score of
+// its Priority, plus weights.EcoWeight if it's for an economic building
+// whose reserves are running low relative to income/capacity, plus
+// weights.MilitaryWeight if it's for a military building and
+// st.GameState.Power is under weights.CombatPowerTarget. A task that would
+// leave any of its cost resources under weights.ReserveFloorFraction of
+// capacity is skipped outright, regardless of score, the same way Next
+// already skips unaffordable tasks. excluded is as in Next.
+func (p *Plan) NextWithEconomy(st *state.InstanceState, weights common.EconomyWeights, excluded map[string]bool) *PlanTask {
+	var best *PlanTask
+	var bestScore float64
+
+	for i := range p.Tasks {
+		t := &p.Tasks[i]
+		if excluded[t.ID] {
+			continue
+		}
+		progress := st.BuildPlanProgress[t.ID]
+
+		if progress.Completed || progress.Skipped || skipOptional(t, progress) {
+			continue
+		}
+		if _, inProgress := st.GameState.BuildingsInProgress[t.Building]; inProgress {
+			continue
+		}
+		if !p.requirementsMet(t, st) {
+			continue
+		}
+		if !affordable(t, st) {
+			continue
+		}
+		if belowReserveFloor(t, st, weights) {
+			continue
+		}
+
+		score := float64(t.Priority)
+		if weights.EcoWeight != 0 && t.Category == "economic" && reservesRunningLow(t, st, weights) {
+			score += weights.EcoWeight
+		}
+		if weights.MilitaryWeight != 0 && t.Category == "military" && st.GameState.Power < weights.CombatPowerTarget {
+			score += weights.MilitaryWeight
+		}
+
+		if best == nil || score > bestScore {
+			best, bestScore = t, score
+		}
+	}
+	return best
+}
+
+// reservesRunningLow reports whether any resource t costs is below
+// min(income*ReserveIncomeMultiple, capacity*ReserveCapacityFraction).
+func reservesRunningLow(t *PlanTask, st *state.InstanceState, w common.EconomyWeights) bool {
+	e := st.GameState.Economy
+	return resourceRunningLow(t.Cost.Food, e.Food, w) ||
+		resourceRunningLow(t.Cost.Wood, e.Wood, w) ||
+		resourceRunningLow(t.Cost.Stone, e.Stone, w) ||
+		resourceRunningLow(t.Cost.Gold, e.Gold, w)
+}
+
+func resourceRunningLow(cost int, r state.ResourceEconomy, w common.EconomyWeights) bool {
+	if cost <= 0 {
+		return false
+	}
+	limit := float64(r.Income) * w.ReserveIncomeMultiple
+	if capLimit := float64(r.Capacity) * w.ReserveCapacityFraction; capLimit < limit {
+		limit = capLimit
+	}
+	return float64(r.Reserves) < limit
+}
+
+// belowReserveFloor reports whether spending t's cost would leave any
+// resource under ReserveFloorFraction of its capacity.
+func belowReserveFloor(t *PlanTask, st *state.InstanceState, w common.EconomyWeights) bool {
+	if w.ReserveFloorFraction <= 0 {
+		return false
+	}
+	e := st.GameState.Economy
+	return resourceBelowFloor(t.Cost.Food, e.Food, w.ReserveFloorFraction) ||
+		resourceBelowFloor(t.Cost.Wood, e.Wood, w.ReserveFloorFraction) ||
+		resourceBelowFloor(t.Cost.Stone, e.Stone, w.ReserveFloorFraction) ||
+		resourceBelowFloor(t.Cost.Gold, e.Gold, w.ReserveFloorFraction)
+}
+
+func resourceBelowFloor(cost int, r state.ResourceEconomy, floorFraction float64) bool {
+	if cost <= 0 || r.Capacity <= 0 {
+		return false
+	}
+	return float64(r.Reserves-cost) < floorFraction*float64(r.Capacity)
+}
+
+// PredictNextUnblock returns the earliest time a currently-blocked task's
+// Requires might become satisfiable, based on when a required building's
+// in-progress construction finishes (GameState.BuildingsInProgress), so a
+// caller can sleep until then instead of re-detecting every few seconds.
+//
+// This deliberately only looks at BuildingsInProgress. The repo has no
+// resource-production-rate tracking anywhere (GameState.Resources is a
+// point-in-time snapshot refreshed by detection, not a rate), so a task
+// blocked purely on affordability has no predictable unblock time here;
+// ok is false in that case and the caller should fall back to its normal
+// poll interval.
+func (p *Plan) PredictNextUnblock(st *state.InstanceState) (at time.Time, ok bool) {
+	for i := range p.Tasks {
+		t := &p.Tasks[i]
+		if st.BuildPlanProgress[t.ID].Completed {
+			continue
+		}
+		for _, req := range t.Requires {
+			building, _, err := parseRequirement(req)
+			if err != nil {
+				continue
+			}
+			finishAt, inProgress := st.GameState.BuildingsInProgress[building]
+			if !inProgress {
+				continue
+			}
+			if !ok || finishAt.Before(at) {
+				at, ok = finishAt, true
+			}
+		}
+	}
+	return at, ok
+}
+
+// MigrateLegacyBuildOrder converts an instance's pre-Plan
+// state.BuildOrder.CompletedTasks into BuildPlanProgress entries, matching
+// completed legacy tasks against plan tasks for the same building in
+// declaration order on a best-effort basis. It's a no-op once
+// BuildPlanProgress has anything in it, so it's safe to call on every
+// process_build_order run.
+func MigrateLegacyBuildOrder(st *state.InstanceState, plan *Plan) {
+	if len(st.BuildPlanProgress) > 0 || len(st.BuildOrder.CompletedTasks) == 0 {
+		return
+	}
+
+	progress := make(map[string]state.BuildPlanTaskProgress, len(plan.Tasks))
+	consumed := make(map[string]int) // building -> plan tasks for it matched so far
+	for _, legacy := range st.BuildOrder.CompletedTasks {
+		candidates := plan.tasksByBuilding[legacy.Building]
+		idx := consumed[legacy.Building]
+		if idx >= len(candidates) {
+			continue // more completed legacy tasks for this building than the plan defines
+		}
+		progress[candidates[idx].ID] = state.BuildPlanTaskProgress{
+			Completed:   true,
+			Attempts:    legacy.Attempts,
+			LastAttempt: legacy.LastAttempt,
+		}
+		consumed[legacy.Building]++
+	}
+
+	st.BuildPlanProgress = progress
+	log.Printf("[%s] Migrated %d legacy build-order task(s) into the declarative build plan", st.ID, len(progress))
+}
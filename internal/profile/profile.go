@@ -0,0 +1,103 @@
+// Package profile lets one binary drive multiple accounts differently: a
+// named Profile ("main", "farm", "scout-alt") bundles which tasks an
+// instance runs, at what priority/config, into something
+// utils.InstanceConfig.Profile can reference by name instead of every
+// account needing its own hand-maintained taskspec.Spec file.
+//
+// A Profile's Tasks are exactly taskspec.TaskDef - see ToSpec - so this
+// package doesn't reinvent "which tasks, what priority, what config": a
+// farm profile that trains only infantry and skips tavern chests is just
+// a Tasks list that omits collect_tavern_chests and the archer-training
+// task, the same way a hand-written taskspec.Spec would. Load/Watch mirror
+// taskspec.Load/Watch (JSON, no YAML dependency; mtime polling, no
+// fsnotify dependency) for the same reason: this tree has no go.mod and
+// vendors nothing third-party.
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"roborok/internal/taskspec"
+)
+
+// Profile is one named way to run an instance.
+type Profile struct {
+	Name  string             `json:"name"`
+	Tasks []taskspec.TaskDef `json:"tasks"`
+}
+
+// ToSpec converts p into the taskspec.Spec form manager.tasksFromSpec
+// already knows how to turn into a []common.Task.
+func (p Profile) ToSpec() *taskspec.Spec {
+	return &taskspec.Spec{Tasks: p.Tasks}
+}
+
+// Set is every loaded Profile, keyed by Name.
+type Set map[string]Profile
+
+// Load reads and parses a Set from path.
+func Load(path string) (Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading profiles file: %w", err)
+	}
+
+	var profiles []Profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("error parsing profiles file: %w", err)
+	}
+
+	set := make(Set, len(profiles))
+	for _, p := range profiles {
+		if p.Name == "" {
+			return nil, fmt.Errorf("profiles file has a profile with no name")
+		}
+		set[p.Name] = p
+	}
+	return set, nil
+}
+
+// Watch polls path every interval and calls onChange with the freshly
+// loaded Set whenever its modification time advances, so editing a
+// profile's task list applies without restarting every instance using it.
+// A Load error on a poll is skipped (a transient partial write shouldn't
+// tear down the watch loop) and retried on the next tick. Call the
+// returned stop func to end the polling goroutine.
+func Watch(path string, interval time.Duration, onChange func(Set)) (stop func()) {
+	done := make(chan struct{})
+
+	go func() {
+		var lastModTime time.Time
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				info, err := os.Stat(path)
+				if err != nil {
+					continue
+				}
+				if !info.ModTime().After(lastModTime) {
+					continue
+				}
+
+				set, err := Load(path)
+				if err != nil {
+					continue
+				}
+
+				lastModTime = info.ModTime()
+				onChange(set)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
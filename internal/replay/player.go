@@ -0,0 +1,128 @@
+package replay
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"roborok/internal/common"
+	"strconv"
+	"strings"
+)
+
+// Player re-feeds a recorded session back through vision.Screenshotter and
+// vision.Detector, so a Manager can run against it without a real device or
+// Roboflow API key. Capture and Analyze are meant to be called in the same
+// alternating pattern Manager uses them in live: Capture advances to the
+// next frame and returns its screenshot, and Analyze returns the
+// gameView/detections recorded for whichever frame Capture most recently
+// served (the screenshot argument is ignored, since it's always the exact
+// bytes Capture just handed back).
+type Player struct {
+	frames []playerFrame
+	next   int
+	cursor int // index of the frame last served by Capture
+}
+
+type playerFrame struct {
+	screenshot []byte
+	meta       frameMeta
+}
+
+// NewPlayer loads a session archive written by Recorder.
+func NewPlayer(path string) (*Player, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening replay archive %s: %w", path, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("error opening gzip stream: %w", err)
+	}
+	defer gz.Close()
+
+	png := make(map[int][]byte)
+	meta := make(map[int]frameMeta)
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive entry: %w", err)
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive entry %s: %w", hdr.Name, err)
+		}
+
+		switch {
+		case strings.HasPrefix(hdr.Name, "frame_") && strings.HasSuffix(hdr.Name, ".png"):
+			n, err := frameNumber(hdr.Name, ".png")
+			if err != nil {
+				return nil, err
+			}
+			png[n] = data
+		case strings.HasPrefix(hdr.Name, "frame_") && strings.HasSuffix(hdr.Name, ".json"):
+			n, err := frameNumber(hdr.Name, ".json")
+			if err != nil {
+				return nil, err
+			}
+			var m frameMeta
+			if err := json.Unmarshal(data, &m); err != nil {
+				return nil, fmt.Errorf("error parsing %s: %w", hdr.Name, err)
+			}
+			meta[n] = m
+		}
+		// manifest.json and events.ndjson aren't needed for playback.
+	}
+
+	frames := make([]playerFrame, len(png))
+	for n, data := range png {
+		m, ok := meta[n]
+		if !ok {
+			return nil, fmt.Errorf("archive missing frame_%d.json", n)
+		}
+		frames[n] = playerFrame{screenshot: data, meta: m}
+	}
+
+	return &Player{frames: frames}, nil
+}
+
+func frameNumber(name, suffix string) (int, error) {
+	trimmed := strings.TrimSuffix(strings.TrimPrefix(name, "frame_"), suffix)
+	n, err := strconv.Atoi(trimmed)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected archive entry name %q", name)
+	}
+	return n, nil
+}
+
+// Capture implements vision.Screenshotter by returning the next recorded
+// frame's screenshot in order, ignoring deviceID/adbPath.
+func (p *Player) Capture(deviceID, adbPath string) ([]byte, error) {
+	if p.next >= len(p.frames) {
+		return nil, fmt.Errorf("replay: session exhausted after %d frames", len(p.frames))
+	}
+	p.cursor = p.next
+	screenshot := p.frames[p.cursor].screenshot
+	p.next++
+	return screenshot, nil
+}
+
+// Analyze implements vision.Detector by returning the gameView/detections
+// recorded for the frame most recently served by Capture.
+func (p *Player) Analyze(screenshot []byte) (string, []common.Detection, error) {
+	if len(p.frames) == 0 {
+		return "", nil, fmt.Errorf("replay: no frames loaded")
+	}
+	m := p.frames[p.cursor].meta
+	return m.GameView, m.Detections, nil
+}
@@ -0,0 +1,258 @@
+// Package replay records vision capture/detect cycles (and the taps/swipes
+// that follow them) into an append-only session archive, and plays one
+// back through vision.Screenshotter and vision.Detector so a build-order or
+// tutorial bug can be reproduced deterministically without a real device or
+// Roboflow API key.
+//
+// An archive is a single gzipped tar file containing:
+//   - manifest.json  - session metadata (frame count, creation time)
+//   - frame_N.png    - the raw screenshot captured on cycle N
+//   - frame_N.json   - the gameView/detections the detector returned for it
+//   - events.ndjson  - one JSON object per line: taps, swipes, keypresses,
+//     and the InstanceState snapshot recorded alongside each frame
+//
+// Recording is wired in at the Manager level (RunGameplayIteration calls
+// RecordFrame explicitly, the same way it calls into internal/metrics)
+// rather than purely through the Screenshotter/Detector interfaces, since
+// those interfaces are shared across every instance and don't carry an
+// instance ID or *state.InstanceState. Tap/swipe/keypress recording, which
+// happens deep inside internal/utils where no InstanceState is available,
+// goes through the package-level Default recorder instead - the same
+// pattern internal/metrics uses for its own device-keyed ADB/vision calls.
+//
+// This is the same mechanism a standalone build-order journal would need:
+// every tap, key press, and capture/detect cycle on the path into and out
+// of internal/actions's build-order functions is already timestamped and
+// recoverable from one session archive via NewPlayer, without introducing
+// a second vision.Client/utils.Input interface layer alongside the
+// Screenshotter/Detector one that already exists. Reproducing a bad
+// UpgradeBuilding run offline means recording with GlobalConfig.ReplayDir
+// set and replaying the resulting archive's frames through Player, the
+// same as any other gameplay session.
+package replay
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"roborok/internal/common"
+	"roborok/internal/state"
+	"sync"
+	"time"
+)
+
+// Manifest describes a recorded session.
+type Manifest struct {
+	SessionID  string    `json:"session_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	FrameCount int       `json:"frame_count"`
+}
+
+// frameMeta is the content of one frame_N.json entry.
+type frameMeta struct {
+	DeviceID   string             `json:"device_id"`
+	RecordedAt time.Time          `json:"recorded_at"`
+	GameView   string             `json:"game_view"`
+	Detections []common.Detection `json:"detections"`
+}
+
+// event is one line of events.ndjson.
+type event struct {
+	Type       string               `json:"type"` // "tap", "swipe", "keypress", or "state_snapshot"
+	DeviceID   string               `json:"device_id"`
+	Timestamp  time.Time            `json:"timestamp"`
+	X          int                  `json:"x,omitempty"`
+	Y          int                  `json:"y,omitempty"`
+	X2         int                  `json:"x2,omitempty"`
+	Y2         int                  `json:"y2,omitempty"`
+	DurationMS int                  `json:"duration_ms,omitempty"`
+	Keycode    string               `json:"keycode,omitempty"`
+	State      *state.InstanceState `json:"state,omitempty"`
+}
+
+// Recorder captures frames and input events to a tar.gz session archive. It
+// is safe for concurrent use. A nil *Recorder is valid and every method on
+// it is a no-op, so call sites can record unconditionally without checking
+// whether recording is enabled first.
+type Recorder struct {
+	mu        sync.Mutex
+	f         *os.File
+	gz        *gzip.Writer
+	tw        *tar.Writer
+	sessionID string
+	createdAt time.Time
+	frameNum  int
+	events    []event
+	closed    bool
+}
+
+// NewRecorder creates a new timestamped session archive under dir.
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating replay dir %s: %w", dir, err)
+	}
+
+	now := time.Now()
+	sessionID := now.Format("20060102_150405")
+	path := filepath.Join(dir, fmt.Sprintf("session_%s.tar.gz", sessionID))
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating session archive %s: %w", path, err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	return &Recorder{
+		f:         f,
+		gz:        gz,
+		tw:        tw,
+		sessionID: sessionID,
+		createdAt: now,
+	}, nil
+}
+
+// RecordFrame appends one capture/detect cycle to the archive: the raw
+// screenshot, the resulting gameView/detections, and a state_snapshot event
+// carrying st so a later tap on the same device can be correlated with the
+// state it happened in.
+func (r *Recorder) RecordFrame(deviceID string, screenshot []byte, gameView string, detections []common.Detection, st *state.InstanceState) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+
+	now := time.Now()
+	n := r.frameNum
+	r.frameNum++
+
+	if err := r.writeEntryLocked(fmt.Sprintf("frame_%d.png", n), screenshot); err != nil {
+		logRecordError("frame png", err)
+		return
+	}
+
+	meta := frameMeta{DeviceID: deviceID, RecordedAt: now, GameView: gameView, Detections: detections}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		logRecordError("frame json", err)
+		return
+	}
+	if err := r.writeEntryLocked(fmt.Sprintf("frame_%d.json", n), data); err != nil {
+		logRecordError("frame json", err)
+		return
+	}
+
+	r.events = append(r.events, event{Type: "state_snapshot", DeviceID: deviceID, Timestamp: now, State: st})
+}
+
+// RecordTap appends a tap event for deviceID to the archive.
+func (r *Recorder) RecordTap(deviceID string, x, y int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.events = append(r.events, event{Type: "tap", DeviceID: deviceID, Timestamp: time.Now(), X: x, Y: y})
+}
+
+// RecordKeyPress appends a keypress event for deviceID to the archive.
+func (r *Recorder) RecordKeyPress(deviceID, keycode string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.events = append(r.events, event{Type: "keypress", DeviceID: deviceID, Timestamp: time.Now(), Keycode: keycode})
+}
+
+// RecordSwipe appends a swipe event for deviceID to the archive.
+func (r *Recorder) RecordSwipe(deviceID string, x1, y1, x2, y2, durationMS int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.events = append(r.events, event{
+		Type: "swipe", DeviceID: deviceID, Timestamp: time.Now(),
+		X: x1, Y: y1, X2: x2, Y2: y2, DurationMS: durationMS,
+	})
+}
+
+// Close writes manifest.json and events.ndjson and finalizes the archive.
+// Safe to call on a nil *Recorder.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	manifest := Manifest{SessionID: r.sessionID, CreatedAt: r.createdAt, FrameCount: r.frameNum}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := r.writeEntryLocked("manifest.json", data); err != nil {
+		return err
+	}
+
+	var ndjson []byte
+	for _, e := range r.events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		ndjson = append(ndjson, line...)
+		ndjson = append(ndjson, '\n')
+	}
+	if err := r.writeEntryLocked("events.ndjson", ndjson); err != nil {
+		return err
+	}
+
+	if err := r.tw.Close(); err != nil {
+		return err
+	}
+	if err := r.gz.Close(); err != nil {
+		return err
+	}
+	return r.f.Close()
+}
+
+func (r *Recorder) writeEntryLocked(name string, data []byte) error {
+	if err := r.tw.WriteHeader(&tar.Header{Name: name, Size: int64(len(data)), Mode: 0644, ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err := r.tw.Write(data)
+	return err
+}
+
+func logRecordError(what string, err error) {
+	log.Printf("replay: error recording %s: %v", what, err)
+}
+
+// Default is the process-wide recorder used by internal/utils's
+// TapScreen/SwipeScreen, which don't have a Manager or InstanceState to
+// thread through. It's nil (recording disabled) unless Manager sets it up
+// from GlobalConfig.ReplayDir.
+var Default *Recorder
@@ -0,0 +1,133 @@
+package replay
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"roborok/internal/common"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Frame is one recorded capture/detect cycle, exposed for tools that want
+// to inspect a session archive directly rather than drive it through
+// Player - currently just the "replay" CLI subcommand in main.go. Mirrors
+// frameMeta plus its frame number.
+type Frame struct {
+	Number     int
+	DeviceID   string
+	RecordedAt time.Time
+	GameView   string
+	Detections []common.Detection
+}
+
+// EventRecord is one events.ndjson line, exported for the same reason as
+// Frame. Omits the state_snapshot event's State field, which the CLI has no
+// use for; Player doesn't need events at all, so this lives alongside it
+// rather than in the event type itself.
+type EventRecord struct {
+	Type       string
+	DeviceID   string
+	Timestamp  time.Time
+	X, Y       int
+	X2, Y2     int
+	DurationMS int
+	Keycode    string
+}
+
+// ReadSession parses a session archive written by Recorder into its frames
+// (ordered by frame number) and events (in recorded order).
+func ReadSession(path string) (frames []Frame, events []EventRecord, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening replay archive %s: %w", path, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening gzip stream: %w", err)
+	}
+	defer gz.Close()
+
+	meta := make(map[int]frameMeta)
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading archive entry: %w", err)
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading archive entry %s: %w", hdr.Name, err)
+		}
+
+		switch {
+		case hdr.Name == "events.ndjson":
+			for _, line := range splitLines(data) {
+				if len(line) == 0 {
+					continue
+				}
+				var e event
+				if err := json.Unmarshal(line, &e); err != nil {
+					return nil, nil, fmt.Errorf("error parsing events.ndjson: %w", err)
+				}
+				events = append(events, EventRecord{
+					Type:       e.Type,
+					DeviceID:   e.DeviceID,
+					Timestamp:  e.Timestamp,
+					X:          e.X,
+					Y:          e.Y,
+					X2:         e.X2,
+					Y2:         e.Y2,
+					DurationMS: e.DurationMS,
+					Keycode:    e.Keycode,
+				})
+			}
+		case strings.HasSuffix(hdr.Name, ".json") && strings.HasPrefix(hdr.Name, "frame_"):
+			n, err := frameNumber(hdr.Name, ".json")
+			if err != nil {
+				return nil, nil, err
+			}
+			var m frameMeta
+			if err := json.Unmarshal(data, &m); err != nil {
+				return nil, nil, fmt.Errorf("error parsing %s: %w", hdr.Name, err)
+			}
+			meta[n] = m
+		}
+		// frame_N.png and manifest.json aren't needed for this view.
+	}
+
+	for n, m := range meta {
+		frames = append(frames, Frame{
+			Number:     n,
+			DeviceID:   m.DeviceID,
+			RecordedAt: m.RecordedAt,
+			GameView:   m.GameView,
+			Detections: m.Detections,
+		})
+	}
+	sort.Slice(frames, func(i, j int) bool { return frames[i].Number < frames[j].Number })
+
+	return frames, events, nil
+}
+
+func splitLines(data []byte) [][]byte {
+	var lines [][]byte
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		lines = append(lines, []byte(line))
+	}
+	return lines
+}
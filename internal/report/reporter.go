@@ -1,15 +1,68 @@
+// Package report batches gameplay events and screenshots and ships them to
+// an operator-configured backend endpoint. Delivery is best-effort but
+// durable: every queued item is spooled to disk as it's accepted, so a
+// crash or restart doesn't lose anything that hasn't been sent yet.
 package report
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"log"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"roborok/internal/metrics"
+	"roborok/internal/utils"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Reporter handles sending stats and screenshots to the backend
+const (
+	sendInterval   = 30 * time.Second
+	initialBackoff = 1 * time.Second
+	maxBackoff     = 2 * time.Minute
+	maxBatchSize   = 50 // caps one HTTP POST so a large backlog doesn't become one giant request
+	httpTimeout    = 30 * time.Second
+
+	// flushTimeout bounds how long Stop waits for the spool to drain, so a
+	// dead backend can't hang process shutdown forever.
+	flushTimeout = 10 * time.Second
+
+	defaultSpoolDir     = "report_spool"
+	defaultMaxQueueSize = 1000
+)
+
+// Reporter batches ReportItems and POSTs them to Endpoint, retrying failed
+// sends with exponential backoff. Items are spooled to SpoolDir as they're
+// queued and removed once successfully sent, so a restart recovers anything
+// still pending.
 type Reporter struct {
-	Endpoint    string
-	stopChan    chan struct{}
-	reportQueue []ReportItem
+	Endpoint          string
+	HMACSecret        string
+	SpoolDir          string
+	MaxQueueSize      int
+	MinReportInterval time.Duration // minimum gap between accepted reports from the same instance; 0 disables rate limiting
+
+	stopChan chan struct{}
+	client   *http.Client
+
+	mu          sync.Mutex
+	reportQueue []spooledItem
+	lastSent    map[string]time.Time
+
+	seq      int64
+	inFlight int64
 }
 
 // ReportItem represents an item in the report queue
@@ -20,30 +73,102 @@ type ReportItem struct {
 	Timestamp      time.Time
 }
 
-// NewReporter creates a new reporter
-func NewReporter(endpoint string) *Reporter {
-	return &Reporter{
-		Endpoint:    endpoint,
-		stopChan:    make(chan struct{}),
-		reportQueue: make([]ReportItem, 0),
+// spooledItem pairs a queued ReportItem with the spool file it was
+// persisted to (empty if spooling could not be set up), so a successful
+// send knows which file to remove.
+type spooledItem struct {
+	item ReportItem
+	path string
+}
+
+// NewReporter builds a Reporter from config.Global's report_* settings.
+func NewReporter(config *utils.Config) *Reporter {
+	r := &Reporter{
+		Endpoint:          config.Global.ReportEndpoint,
+		HMACSecret:        config.Global.ReportHMACSecret,
+		SpoolDir:          config.Global.ReportSpoolDir,
+		MaxQueueSize:      config.Global.ReportMaxQueueSize,
+		MinReportInterval: time.Duration(config.Global.ReportRateLimitPerInstanceS) * time.Second,
+		stopChan:          make(chan struct{}),
+		client:            &http.Client{Timeout: httpTimeout},
+		lastSent:          make(map[string]time.Time),
+	}
+
+	if r.SpoolDir == "" {
+		r.SpoolDir = defaultSpoolDir
+	}
+	if r.MaxQueueSize <= 0 {
+		r.MaxQueueSize = defaultMaxQueueSize
+	}
+
+	if err := os.MkdirAll(r.SpoolDir, 0755); err != nil {
+		log.Printf("Reporter: error creating spool dir %s: %v", r.SpoolDir, err)
 	}
+	r.loadSpool()
+
+	return r
 }
 
-// Start starts the reporter background process
-func (r *Reporter) Start() {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
+// loadSpool recovers any ReportItems left on disk from a prior run, in the
+// order they were originally queued.
+func (r *Reporter) loadSpool() {
+	entries, err := os.ReadDir(r.SpoolDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Reporter: error reading spool dir %s: %v", r.SpoolDir, err)
+		}
+		return
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
 
+	for _, name := range names {
+		path := filepath.Join(r.SpoolDir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Reporter: error reading spooled item %s: %v", path, err)
+			continue
+		}
+		var item ReportItem
+		if err := json.Unmarshal(data, &item); err != nil {
+			log.Printf("Reporter: error parsing spooled item %s, discarding: %v", path, err)
+			os.Remove(path)
+			continue
+		}
+		r.reportQueue = append(r.reportQueue, spooledItem{item: item, path: path})
+	}
+
+	if len(r.reportQueue) > 0 {
+		log.Printf("Reporter: recovered %d spooled report items from %s", len(r.reportQueue), r.SpoolDir)
+		metrics.Default.SetReportQueueDepth(len(r.reportQueue))
+	}
+}
+
+// Start starts the reporter background process: it periodically sends
+// queued items to Endpoint, backing off on failure, until Stop is called.
+func (r *Reporter) Start() {
 	log.Println("Reporter started")
 
+	backoff := initialBackoff
+	ticker := time.NewTicker(sendInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case <-ticker.C:
-			// This is a placeholder - in the future this will send data to the backend
-			if len(r.reportQueue) > 0 {
-				log.Printf("Would send %d reports to backend", len(r.reportQueue))
-				// Clear the queue after reporting
-				r.reportQueue = r.reportQueue[:0]
+			if err := r.sendPending(); err != nil {
+				wait := jitter(backoff)
+				log.Printf("Reporter: send failed, backing off %v: %v", wait, err)
+				time.Sleep(wait)
+				backoff = nextBackoff(backoff)
+			} else {
+				backoff = initialBackoff
 			}
 		case <-r.stopChan:
 			log.Println("Reporter stopped")
@@ -52,29 +177,54 @@ func (r *Reporter) Start() {
 	}
 }
 
-// Stop stops the reporter
+// Stop drains the spool (bounded by flushTimeout) and shuts down Start's
+// loop.
 func (r *Reporter) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	if err := r.Flush(ctx); err != nil {
+		log.Printf("Reporter: stop flush incomplete, %d item(s) still spooled: %v", r.queueLen(), err)
+	}
 	close(r.stopChan)
 }
 
+// Flush sends queued report items until the queue is empty or ctx is done,
+// for graceful shutdown.
+func (r *Reporter) Flush(ctx context.Context) error {
+	for r.queueLen() > 0 {
+		if err := r.sendPending(); err != nil {
+			log.Printf("Reporter: flush send failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+func (r *Reporter) queueLen() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.reportQueue)
+}
+
 // ReportScreenshot adds a screenshot report to the queue
 func (r *Reporter) ReportScreenshot(instanceID, screenshotPath string, metadata map[string]interface{}) {
-	// Add to queue
-	r.reportQueue = append(r.reportQueue, ReportItem{
+	r.enqueue(ReportItem{
 		InstanceID:     instanceID,
 		ScreenshotPath: screenshotPath,
 		Metadata:       metadata,
 		Timestamp:      time.Now(),
 	})
 
-	// Log for now
 	log.Printf("Screenshot reported for instance %s: %s", instanceID, screenshotPath)
 }
 
 // ReportEvent adds an event report to the queue
 func (r *Reporter) ReportEvent(instanceID string, eventType string, metadata map[string]interface{}) {
-	// Add to queue
-	r.reportQueue = append(r.reportQueue, ReportItem{
+	r.enqueue(ReportItem{
 		InstanceID:     instanceID,
 		ScreenshotPath: "",
 		Metadata: map[string]interface{}{
@@ -84,6 +234,213 @@ func (r *Reporter) ReportEvent(instanceID string, eventType string, metadata map
 		Timestamp: time.Now(),
 	})
 
-	// Log for now
 	log.Printf("Event reported for instance %s: %s", instanceID, eventType)
 }
+
+// enqueue applies per-instance rate limiting, persists item to the spool
+// directory, appends it to the in-memory queue, and evicts the oldest item
+// if MaxQueueSize is now exceeded.
+func (r *Reporter) enqueue(item ReportItem) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.allowLocked(item.InstanceID) {
+		log.Printf("Reporter: rate limit exceeded for instance %s, dropping report", item.InstanceID)
+		return
+	}
+
+	path, err := r.spool(item)
+	if err != nil {
+		log.Printf("Reporter: error spooling report item for instance %s: %v", item.InstanceID, err)
+	}
+
+	r.reportQueue = append(r.reportQueue, spooledItem{item: item, path: path})
+
+	if len(r.reportQueue) > r.MaxQueueSize {
+		evicted := r.reportQueue[0]
+		r.reportQueue = r.reportQueue[1:]
+		if evicted.path != "" {
+			os.Remove(evicted.path)
+		}
+		log.Printf("Reporter: queue exceeded max size %d, dropped oldest report for instance %s", r.MaxQueueSize, evicted.item.InstanceID)
+	}
+
+	metrics.Default.SetReportQueueDepth(len(r.reportQueue))
+}
+
+// allowLocked reports whether an item from instanceID may be accepted right
+// now, and records the acceptance time if so. Caller must hold r.mu.
+func (r *Reporter) allowLocked(instanceID string) bool {
+	if r.MinReportInterval <= 0 {
+		return true
+	}
+	if last, ok := r.lastSent[instanceID]; ok && time.Since(last) < r.MinReportInterval {
+		return false
+	}
+	r.lastSent[instanceID] = time.Now()
+	return true
+}
+
+// spool persists item to SpoolDir and returns the file path it was written
+// to.
+func (r *Reporter) spool(item ReportItem) (string, error) {
+	seq := atomic.AddInt64(&r.seq, 1)
+	name := fmt.Sprintf("%020d_%s.json", seq, sanitizeForFilename(item.InstanceID))
+	path := filepath.Join(r.SpoolDir, name)
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func sanitizeForFilename(s string) string {
+	replacer := strings.NewReplacer("/", "_", string(filepath.Separator), "_")
+	return replacer.Replace(s)
+}
+
+// sendPending POSTs up to maxBatchSize queued items to Endpoint and, on
+// success, removes them from the queue and their spool files.
+func (r *Reporter) sendPending() error {
+	r.mu.Lock()
+	if len(r.reportQueue) == 0 {
+		r.mu.Unlock()
+		return nil
+	}
+	n := len(r.reportQueue)
+	if n > maxBatchSize {
+		n = maxBatchSize
+	}
+	batch := append([]spooledItem(nil), r.reportQueue[:n]...)
+	r.mu.Unlock()
+
+	atomic.AddInt64(&r.inFlight, 1)
+	metrics.Default.SetReportInFlight(int(atomic.LoadInt64(&r.inFlight)))
+	defer func() {
+		atomic.AddInt64(&r.inFlight, -1)
+		metrics.Default.SetReportInFlight(int(atomic.LoadInt64(&r.inFlight)))
+	}()
+
+	if err := r.postBatch(batch); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.reportQueue = r.reportQueue[n:]
+	metrics.Default.SetReportQueueDepth(len(r.reportQueue))
+	r.mu.Unlock()
+
+	for _, si := range batch {
+		if si.path != "" {
+			os.Remove(si.path)
+		}
+	}
+
+	return nil
+}
+
+// postBatch gzip-compresses batch's items as JSON, attaches any screenshots
+// as multipart parts, signs the body if HMACSecret is set, and POSTs it to
+// Endpoint. A 5xx or network error is returned so the caller retries; a 4xx
+// is logged and treated as non-retryable, since resending the same rejected
+// batch forever would just spin.
+func (r *Reporter) postBatch(batch []spooledItem) error {
+	if r.Endpoint == "" {
+		return fmt.Errorf("no report endpoint configured")
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	items := make([]ReportItem, len(batch))
+	for i, si := range batch {
+		items[i] = si.item
+	}
+
+	batchPart, err := writer.CreateFormFile("batch", "batch.json.gz")
+	if err != nil {
+		return fmt.Errorf("error creating batch part: %w", err)
+	}
+	gz := gzip.NewWriter(batchPart)
+	if err := json.NewEncoder(gz).Encode(items); err != nil {
+		return fmt.Errorf("error encoding batch: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("error closing gzip writer: %w", err)
+	}
+
+	for i, si := range batch {
+		if si.item.ScreenshotPath == "" {
+			continue
+		}
+		screenshot, err := os.ReadFile(si.item.ScreenshotPath)
+		if err != nil {
+			log.Printf("Reporter: error reading screenshot %s, sending batch without it: %v", si.item.ScreenshotPath, err)
+			continue
+		}
+		part, err := writer.CreateFormFile(fmt.Sprintf("screenshot_%d", i), filepath.Base(si.item.ScreenshotPath))
+		if err != nil {
+			return fmt.Errorf("error creating screenshot part: %w", err)
+		}
+		if _, err := part.Write(screenshot); err != nil {
+			return fmt.Errorf("error writing screenshot part: %w", err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("error closing multipart writer: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", r.Endpoint, body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if r.HMACSecret != "" {
+		req.Header.Set("X-Roborok-Signature", signBody(body.Bytes(), r.HMACSecret))
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending report batch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("report backend returned %d (retryable)", resp.StatusCode)
+	}
+	if resp.StatusCode >= 400 {
+		log.Printf("Reporter: backend rejected batch of %d item(s) with status %d, dropping", len(batch), resp.StatusCode)
+		return nil
+	}
+
+	return nil
+}
+
+func signBody(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func nextBackoff(current time.Duration) time.Duration {
+	next := current * 2
+	if next > maxBackoff {
+		next = maxBackoff
+	}
+	return next
+}
+
+// jitter randomizes d by up to +/-20% so repeated backoffs across many
+// instances don't all retry in lockstep.
+func jitter(d time.Duration) time.Duration {
+	delta := time.Duration(rand.Int63n(int64(d)/5 + 1))
+	if rand.Intn(2) == 0 {
+		return d - delta
+	}
+	return d + delta
+}
@@ -0,0 +1,202 @@
+// Package scheduler arbitrates scarce, shared resources (the Roboflow
+// inference rate limit, concurrent ADB command slots) across multiple
+// instance loops, mesos-style: instances submit Bids describing the work
+// they want to do and how important it is, and the Scheduler grants them
+// in priority order as budget frees up, instead of every instance
+// goroutine hammering ADB/Roboflow independently.
+//
+// This is an initial cut: it arbitrates admission to the screenshot+vision
+// step of one gameplay iteration (see manager.RunGameplayIteration). It
+// does not yet gate the individual ADB taps/swipes a task handler issues
+// once it's running, and it doesn't preempt a bid that's already been
+// granted - a high-priority bid simply jumps the queue ahead of
+// lower-priority bids still waiting. Both are natural follow-ups once more
+// of the ADB call surface threads a Bid through.
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// Bid describes a scheduling request: which instance and task wants to
+// spend shared budget, and how important it is relative to other bids
+// waiting on the same resource. Higher Priority is granted first.
+type Bid struct {
+	InstanceID string
+	TaskName   string
+	Priority   float64
+}
+
+// waiter is one pending Bid, parked on a min/max-heap until granted.
+type waiter struct {
+	bid   Bid
+	ready chan struct{}
+	index int
+}
+
+// waiterHeap is a container/heap.Interface ordering waiters highest
+// Priority first.
+type waiterHeap []*waiter
+
+func (h waiterHeap) Len() int           { return len(h) }
+func (h waiterHeap) Less(i, j int) bool { return h[i].bid.Priority > h[j].bid.Priority }
+func (h waiterHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i]; h[i].index = i; h[j].index = j }
+func (h *waiterHeap) Push(x interface{}) {
+	w := x.(*waiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+func (h *waiterHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return w
+}
+
+// Scheduler grants Bids against two independent budgets: a per-minute
+// vision-inference call rate and a pool of concurrent ADB command slots.
+// A budget of 0 means unlimited - AcquireVision/AcquireADB return
+// immediately - so a deployment that doesn't configure either behaves
+// exactly as if the Scheduler weren't there.
+type Scheduler struct {
+	mu          sync.Mutex
+	visionQueue waiterHeap
+	adbQueue    waiterHeap
+	adbTokens   int
+
+	visionUnlimited bool
+	adbUnlimited    bool
+
+	stop chan struct{}
+}
+
+// NewScheduler creates a Scheduler and starts its vision-budget refill
+// loop. visionCallsPerMinute <= 0 means no limit on vision calls;
+// adbConcurrency <= 0 means no limit on concurrent ADB command slots.
+func NewScheduler(visionCallsPerMinute, adbConcurrency int) *Scheduler {
+	s := &Scheduler{
+		adbTokens:       adbConcurrency,
+		visionUnlimited: visionCallsPerMinute <= 0,
+		adbUnlimited:    adbConcurrency <= 0,
+		stop:            make(chan struct{}),
+	}
+	heap.Init(&s.visionQueue)
+	heap.Init(&s.adbQueue)
+
+	if !s.visionUnlimited {
+		go s.refillVision(visionCallsPerMinute)
+	}
+
+	return s
+}
+
+// Stop ends the vision-budget refill loop. Bids already waiting are left
+// parked; callers blocked in AcquireVision should instead be cancelled via
+// their own context.
+func (s *Scheduler) Stop() {
+	close(s.stop)
+}
+
+func (s *Scheduler) refillVision(perMinute int) {
+	ticker := time.NewTicker(time.Minute / time.Duration(perMinute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.grantOne(&s.visionQueue)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// grantOne wakes the highest-priority waiter on q, if any. A tick with
+// nobody waiting is simply unused capacity for that minute - tokens aren't
+// banked for a later burst.
+func (s *Scheduler) grantOne(q *waiterHeap) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if q.Len() == 0 {
+		return
+	}
+	w := heap.Pop(q).(*waiter)
+	close(w.ready)
+}
+
+// AcquireVision blocks until bid is granted a vision-inference call slot
+// by the refill loop, or ctx is done first. A Scheduler with no vision
+// budget configured returns immediately.
+func (s *Scheduler) AcquireVision(ctx context.Context, bid Bid) error {
+	if s.visionUnlimited {
+		return nil
+	}
+	return s.wait(ctx, &s.visionQueue, bid)
+}
+
+// AcquireADB blocks until one of the shared ADB command slots is free for
+// bid, highest-priority bid first, or ctx is done first. On success it
+// returns a release func the caller must call once done with the slot. A
+// Scheduler with no ADB concurrency limit configured returns immediately
+// with a no-op release func.
+func (s *Scheduler) AcquireADB(ctx context.Context, bid Bid) (func(), error) {
+	if s.adbUnlimited {
+		return func() {}, nil
+	}
+
+	s.mu.Lock()
+	if s.adbTokens > 0 {
+		s.adbTokens--
+		s.mu.Unlock()
+		return s.releaseADB, nil
+	}
+	s.mu.Unlock()
+
+	if err := s.wait(ctx, &s.adbQueue, bid); err != nil {
+		return nil, err
+	}
+	return s.releaseADB, nil
+}
+
+// releaseADB hands a freed ADB slot straight to the highest-priority
+// waiter, if any, rather than incrementing adbTokens and letting whichever
+// goroutine happens to wake up first grab it.
+func (s *Scheduler) releaseADB() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.adbQueue.Len() > 0 {
+		w := heap.Pop(&s.adbQueue).(*waiter)
+		close(w.ready)
+		return
+	}
+	s.adbTokens++
+}
+
+// wait parks bid on q until it's granted or ctx is done, removing it from
+// q in the latter case so an abandoned bid doesn't linger.
+func (s *Scheduler) wait(ctx context.Context, q *waiterHeap, bid Bid) error {
+	w := &waiter{bid: bid, ready: make(chan struct{})}
+
+	s.mu.Lock()
+	heap.Push(q, w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		if w.index >= 0 && w.index < q.Len() && (*q)[w.index] == w {
+			heap.Remove(q, w.index)
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -3,6 +3,7 @@ package state
 import (
 	"encoding/json"
 	"os"
+	"roborok/internal/taskrunner"
 	"time"
 )
 
@@ -22,6 +23,30 @@ type BuildOrder struct {
 	LastAttemptTime time.Time   `json:"last_attempt_time"` // When we last tried to execute any build task
 }
 
+// BuildPlanTaskProgress is one internal/planner PlanTask's completion and
+// attempt state, the BuildPlanProgress analogue of BuildTask's own
+// Completed/Attempts/LastAttempt fields.
+type BuildPlanTaskProgress struct {
+	Completed   bool      `json:"completed"`
+	Attempts    int       `json:"attempts"`
+	LastAttempt time.Time `json:"last_attempt"`
+
+	// Step and StepEnteredAt mirror BuildTask's own fields below, since
+	// processBuildOrderWithPlan builds a fresh BuildTask every call instead
+	// of keeping a persistent one - the BuildFSM state has to be threaded
+	// through here between ticks instead.
+	Step          string    `json:"step,omitempty"`
+	StepEnteredAt time.Time `json:"step_entered_at,omitempty"`
+
+	// Backoff, ConsecutiveFailures, FailureReason, and Skipped mirror
+	// BuildTask's own fields below, threaded through the same way as Step
+	// above.
+	Backoff             time.Duration `json:"backoff,omitempty"`
+	ConsecutiveFailures int           `json:"consecutive_failures,omitempty"`
+	FailureReason       string        `json:"failure_reason,omitempty"`
+	Skipped             bool          `json:"skipped,omitempty"`
+}
+
 // BuildTask represents a single building or upgrade task in the ordered list
 type BuildTask struct {
 	Type        string                 `json:"type"`         // "build" or "upgrade"
@@ -31,12 +56,35 @@ type BuildTask struct {
 	Attempts    int                    `json:"attempts"`     // Number of attempts made
 	LastAttempt time.Time              `json:"last_attempt"` // When we last tried this task
 	Config      map[string]interface{} `json:"config"`       // Optional configuration for speedups etc.
+
+	// Step is the current BuildFSM state name for a "build_new" task
+	// (empty means not yet started, i.e. the initial state). StepEnteredAt
+	// is when Step last changed, so a state that never sees its expected
+	// detection can time out instead of waiting forever.
+	Step          string    `json:"step,omitempty"`
+	StepEnteredAt time.Time `json:"step_entered_at,omitempty"`
+
+	// Backoff is how long to wait before the next attempt after a failure,
+	// set by actions.applyFailurePolicy to 30s*2^ConsecutiveFailures
+	// (capped) instead of a flat cooldown, so a task that fails for a
+	// reason unlikely to clear quickly (a busy builder, low resources)
+	// backs off further each time instead of retrying at the same pace
+	// forever. FailureReason (one of the actions.FailureReason* constants)
+	// records why the last attempt failed, and Skipped marks a task
+	// actions.applyFailurePolicy gave up on after too many consecutive
+	// structural failures (its expected UI never appeared at all), so it
+	// stops blocking the rest of the build order.
+	Backoff             time.Duration `json:"backoff,omitempty"`
+	ConsecutiveFailures int           `json:"consecutive_failures,omitempty"`
+	FailureReason       string        `json:"failure_reason,omitempty"`
+	Skipped             bool          `json:"skipped,omitempty"`
 }
 
 // InstanceState represents the persistent state of a game instance
 type InstanceState struct {
 	ID                             string            `json:"id"`
 	DeviceID                       string            `json:"device_id"`
+	LifecyclePhase                 string            `json:"lifecycle_phase"` // current fsm.FSMState, persisted so resumes pick up where they left off
 	TutorialCompleted              bool              `json:"tutorial_completed"`
 	TutorialUpgradeCompleteClicked bool              `json:"tutorial_upgrade_complete_clicked"`
 	TutorialFinalArrowClicked      bool              `json:"tutorial_final_arrow_clicked"`
@@ -52,14 +100,56 @@ type InstanceState struct {
 	ScoutState                     ScoutState        `json:"scout_state"`
 	BuilderState                   BuilderState      `json:"builder_state"`
 	TavernState                    TavernState       `json:"tavern_state"`
+	TreeState                      TreeState         `json:"tree_state"`
 	BuildingPositions              BuildingPositions `json:"building_positions"`
 	BuildOrder                     BuildOrder        `json:"build_order"`
+
+	// BuildPlanProgress tracks per-task completion/attempt state for
+	// internal/planner's declarative build plan, keyed by PlanTask.ID.
+	// Only populated once a build plan is configured; see
+	// planner.MigrateLegacyBuildOrder for how it's seeded from BuildOrder.
+	BuildPlanProgress map[string]BuildPlanTaskProgress `json:"build_plan_progress,omitempty"`
+
+	// ActiveBuildChange tracks the in-progress process_build_order task run
+	// by internal/taskrunner, so a crash mid-upgrade resumes at the correct
+	// sub-step instead of re-running process_build_order from scratch.
+	ActiveBuildChange *taskrunner.Change `json:"active_build_change,omitempty"`
+
+	// GoalsStartedAt records, per building, when buildorder.Track first saw
+	// a goal targeting it - buildorder.Evaluate needs this to judge a
+	// Goal's Deadline, and there's nowhere else in InstanceState a goal's
+	// start time would otherwise be remembered across ticks. Only
+	// populated when GlobalConfig.GoalsPath (or its per-instance override)
+	// is configured.
+	GoalsStartedAt map[string]time.Time `json:"goals_started_at,omitempty"`
+
+	// UpgradeCosts records each building's most recently OCR'd upgrade cost,
+	// keyed by building name, as stored by actions.preflightUpgradeCheck.
+	// Nothing reads it back: preflightUpgradeCheck reads the cost off the
+	// upgrade dialog again on every call. Keyed by building rather than
+	// building+level since BuildTask doesn't track a per-building level
+	// anywhere else in this tree; a stale entry just gets overwritten the
+	// next time the dialog is actually read.
+	UpgradeCosts map[string]UpgradeCost `json:"upgrade_costs,omitempty"`
+}
+
+// UpgradeCost is one building's upgrade cost and duration, parsed from the
+// upgrade dialog by actions.parseUpgradeCost off OCR text read by
+// vision.ReadRegion. Mirrors ResourceState's resource fields rather than
+// reusing it directly, since a cost isn't itself a resource balance.
+type UpgradeCost struct {
+	Food     int           `json:"food"`
+	Wood     int           `json:"wood"`
+	Stone    int           `json:"stone"`
+	Gold     int           `json:"gold"`
+	Duration time.Duration `json:"duration"`
 }
 
 // GameState contains detailed game state information
 type GameState struct {
-	Power               int                  `json:"power"`
+	Power               int                  `json:"power"` // combat power, used as common.EconomyWeights' CombatPowerTarget comparison
 	Resources           ResourceState        `json:"resources"`
+	Economy             Economy              `json:"economy"`
 	BuildingsInProgress map[string]time.Time `json:"buildings_in_progress"`
 }
 
@@ -72,6 +162,26 @@ type ResourceState struct {
 	Gems  int `json:"gems"`
 }
 
+// Economy is a point-in-time snapshot of an instance's resource production,
+// reserves, and storage capacity, read off the in-city resource bar by
+// vision.ExtractEconomy. ResourceState already tracks raw reserves; Economy
+// adds the income/capacity figures planner.Plan.NextWithEconomy needs to
+// judge whether reserves are low relative to how fast they're produced and
+// how much the city can even hold, rather than just their absolute amount.
+type Economy struct {
+	Food  ResourceEconomy `json:"food"`
+	Wood  ResourceEconomy `json:"wood"`
+	Stone ResourceEconomy `json:"stone"`
+	Gold  ResourceEconomy `json:"gold"`
+}
+
+// ResourceEconomy is one resource's income/reserves/capacity reading.
+type ResourceEconomy struct {
+	Income   int `json:"income"`   // production per hour
+	Reserves int `json:"reserves"` // currently stored
+	Capacity int `json:"capacity"` // storehouse cap
+}
+
 // ActionPointInfo tracks action points
 type ActionPointInfo struct {
 	Current    int       `json:"current"`
@@ -91,6 +201,20 @@ type ScoutState struct {
 	CurrentY     int       `json:"current_y"`
 	IsMoving     bool      `json:"is_moving"`
 	LastMoveTime time.Time `json:"last_move_time"`
+
+	// Blacklist records fog destinations actions.SendScoutToFog tried and
+	// failed to reach (an "unable_to_reach"/"path_blocked" UI error after
+	// confirming March), so it can skip re-offering the same tile until
+	// the entry expires - see actions.scoutBlacklistTTL.
+	Blacklist []ScoutBlacklistEntry `json:"blacklist,omitempty"`
+}
+
+// ScoutBlacklistEntry is one destination SendScoutToFog couldn't reach.
+type ScoutBlacklistEntry struct {
+	X             int       `json:"x"`
+	Y             int       `json:"y"`
+	BlacklistedAt time.Time `json:"blacklisted_at"`
+	Reason        string    `json:"reason"` // the UI error class that caused the blacklist, e.g. "unable_to_reach"
 }
 
 // BuilderState tracks builder-related information
@@ -104,6 +228,16 @@ type TavernState struct {
 	LastGoldChestTime   time.Time `json:"last_gold_chest_time"`
 }
 
+// TreeState tracks actions.ClearTrees's progress through TreeCoordinates for
+// one instance. It used to live in package-level vars in actions/trees.go,
+// which corrupted progress whenever two devices ran ClearTrees concurrently;
+// keeping it here per-instance (like ScoutState/TavernState) fixes that.
+type TreeState struct {
+	TreeIndex        int  `json:"tree_index"`        // Current tree index being processed
+	ClearingComplete bool `json:"clearing_complete"` // Whether all trees have been cleared
+	ViewResetDone    bool `json:"view_reset_done"`   // Whether the view reset has been completed
+}
+
 // BuildingStates tracks the state of various buildings
 type BuildingStates struct {
 	// City Hall
@@ -133,6 +267,7 @@ func NewInstanceState(id, deviceID string) *InstanceState {
 	return &InstanceState{
 		ID:                             id,
 		DeviceID:                       deviceID,
+		LifecyclePhase:                 "boot",
 		TutorialCompleted:              false,
 		TutorialUpgradeCompleteClicked: false,
 		TutorialFinalArrowClicked:      false,
@@ -0,0 +1,231 @@
+// Package taskrunner is a small snapcore-style task runner: a Change groups
+// an ordered list of Tasks, each progressing through an explicit state
+// machine, and a Runner drives them through handler functions that can ask
+// to be retried with backoff instead of treated as failures. Unlike a plain
+// bool-returning task function, a Change/Task's status round-trips through
+// JSON, so it can be persisted on state.InstanceState and resumed at the
+// sub-step where it left off after a crash, instead of starting over.
+package taskrunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Status is a Task or Change's position in its state machine.
+type Status int
+
+const (
+	// DoStatus is the initial status: the task hasn't run yet.
+	DoStatus Status = iota
+	// DoingStatus means a handler is currently executing.
+	DoingStatus
+	// WaitStatus means the handler asked to be retried later via Retry.
+	WaitStatus
+	// DoneStatus means the handler completed successfully.
+	DoneStatus
+	// ErrorStatus means the handler returned a non-Retry error.
+	ErrorStatus
+	// AbortStatus means the context passed to Run was already cancelled
+	// before the task started or by the time its handler returned.
+	// Manager.Pause() doesn't cancel that context.
+	AbortStatus
+)
+
+// String renders the status the way it would appear in logs or a status dump.
+func (s Status) String() string {
+	switch s {
+	case DoStatus:
+		return "do"
+	case DoingStatus:
+		return "doing"
+	case WaitStatus:
+		return "wait"
+	case DoneStatus:
+		return "done"
+	case ErrorStatus:
+		return "error"
+	case AbortStatus:
+		return "abort"
+	default:
+		return "unknown"
+	}
+}
+
+// Ready reports whether the task has reached a terminal status and won't
+// run again on the next Runner.Run call.
+func (s Status) Ready() bool {
+	return s == DoneStatus || s == ErrorStatus || s == AbortStatus
+}
+
+// Retry is returned by a HandlerFunc to request that its task be retried
+// after the given backoff instead of being marked as failed.
+type Retry struct {
+	After time.Duration
+}
+
+func (r *Retry) Error() string {
+	return fmt.Sprintf("retry after %v", r.After)
+}
+
+// Task is a single step of a Change, e.g. "navigate", "tap", "confirm", or
+// "verify" for an "upgrade city hall" Change. Only the exported fields are
+// persisted; Status, Error, and NotBefore are enough to resume correctly, so
+// a Task carries no unexported state of its own.
+type Task struct {
+	ID     string
+	Kind   string
+	Status Status
+	Error  string `json:",omitempty"`
+
+	// NotBefore is when a WaitStatus task's handler may next be attempted,
+	// set from the Retry.After a handler returned. Run re-checks this on
+	// every call instead of re-invoking the handler immediately, since a
+	// Change is driven by repeated Run calls on the gameplay loop's own
+	// tick rather than a dedicated timer goroutine.
+	NotBefore time.Time `json:",omitempty"`
+}
+
+// Change groups an ordered list of dependent Tasks that together accomplish
+// one higher-level operation. Tasks run in order; a Change is done once
+// every Task is done.
+type Change struct {
+	ID     string
+	Kind   string
+	Status Status
+	Tasks  []*Task
+}
+
+// NewChange creates an empty Change. id should be stable across resumes
+// (e.g. the instance ID) so Runner can track its in-flight cancel func.
+func NewChange(id, kind string) *Change {
+	return &Change{ID: id, Kind: kind}
+}
+
+// AddTask appends a new, not-yet-run task of the given kind.
+func (c *Change) AddTask(id, kind string) *Task {
+	t := &Task{ID: id, Kind: kind, Status: DoStatus}
+	c.Tasks = append(c.Tasks, t)
+	return t
+}
+
+// HandlerFunc performs the work for one task. It should respect ctx.Done()
+// for long-running or blocking steps so Runner.AbortChange can actually cut
+// execution short. Returning &Retry{After: d} asks to be retried after d
+// without marking the task (or Change) as failed.
+type HandlerFunc func(ctx context.Context, task *Task) error
+
+// Runner drives Changes through registered handlers, one task at a time,
+// and keeps the in-flight task's cancel func per Change so AbortChange can
+// cancel that task's context. A task cancelled that way ends with whatever
+// status its handler's return gives it, not AbortStatus. Manager.Pause()
+// doesn't call AbortChange.
+type Runner struct {
+	mu       sync.Mutex
+	handlers map[string]HandlerFunc
+	cancels  map[string]context.CancelFunc // keyed by Change.ID
+}
+
+// NewRunner creates an empty Runner.
+func NewRunner() *Runner {
+	return &Runner{
+		handlers: make(map[string]HandlerFunc),
+		cancels:  make(map[string]context.CancelFunc),
+	}
+}
+
+// AddHandler registers the function that executes tasks of the given kind.
+func (r *Runner) AddHandler(kind string, fn HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[kind] = fn
+}
+
+// Run executes change's pending tasks in order, skipping any already in
+// DoneStatus, so a Change resumed from persisted state picks up at the
+// right sub-step instead of re-running from scratch. It returns once the
+// whole change completes, a task asks to be retried, or a task fails or is
+// aborted.
+func (r *Runner) Run(parent context.Context, change *Change) (retryAfter time.Duration, err error) {
+	for _, task := range change.Tasks {
+		if task.Status.Ready() {
+			continue
+		}
+
+		if parent.Err() != nil {
+			task.Status = AbortStatus
+			change.Status = AbortStatus
+			return 0, parent.Err()
+		}
+
+		if task.Status == WaitStatus {
+			if remaining := time.Until(task.NotBefore); remaining > 0 {
+				return remaining, nil
+			}
+		}
+
+		r.mu.Lock()
+		handler, ok := r.handlers[task.Kind]
+		r.mu.Unlock()
+		if !ok {
+			task.Status = ErrorStatus
+			task.Error = fmt.Sprintf("no handler registered for kind %q", task.Kind)
+			change.Status = ErrorStatus
+			return 0, errors.New(task.Error)
+		}
+
+		ctx, cancel := context.WithCancel(parent)
+		r.mu.Lock()
+		r.cancels[change.ID] = cancel
+		r.mu.Unlock()
+
+		task.Status = DoingStatus
+		handlerErr := handler(ctx, task)
+		cancel()
+
+		r.mu.Lock()
+		delete(r.cancels, change.ID)
+		r.mu.Unlock()
+
+		if parent.Err() != nil {
+			task.Status = AbortStatus
+			change.Status = AbortStatus
+			return 0, parent.Err()
+		}
+
+		if handlerErr != nil {
+			var retry *Retry
+			if errors.As(handlerErr, &retry) {
+				task.Status = WaitStatus
+				task.NotBefore = time.Now().Add(retry.After)
+				change.Status = WaitStatus
+				return retry.After, nil
+			}
+
+			task.Status = ErrorStatus
+			task.Error = handlerErr.Error()
+			change.Status = ErrorStatus
+			return 0, handlerErr
+		}
+
+		task.Status = DoneStatus
+	}
+
+	change.Status = DoneStatus
+	return 0, nil
+}
+
+// AbortChange cancels whichever task of the named change is currently in
+// flight, if any. It's a no-op if the change isn't currently running.
+func (r *Runner) AbortChange(changeID string) {
+	r.mu.Lock()
+	cancel, ok := r.cancels[changeID]
+	r.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
@@ -0,0 +1,127 @@
+package testharness
+
+import "roborok/internal/common"
+
+// region10 returns a small box centered on (x, y), since every tap in this
+// module lands on an exact detection coordinate rather than somewhere
+// inside its bounding box.
+func region10(x, y float64) *Region {
+	return &Region{X: x - 10, Y: y - 10, Width: 20, Height: 20}
+}
+
+// TutorialScenario exercises a short slice of the tutorial flow: an arrow
+// prompt pointing at a button, then the tutorial's "upgrade complete"
+// popup, mirroring the taps actions/tutorial.go makes off FSM-driven
+// detections. Each step's ExpectedTapRegion checks the tap made in
+// reaction to that same step's Detections, before the harness advances to
+// the next one.
+func TutorialScenario() Scenario {
+	return Scenario{
+		Name: "tutorial",
+		Steps: []Step{
+			{
+				Screenshot:        blankScreenshot(1),
+				ExpectedTapRegion: region10(360, 640),
+				Detections: []common.Detection{
+					{Class: "click_arrow", X: 360, Y: 540, Width: 80, Height: 80, Confidence: 0.95},
+					{Class: "click_target", X: 360, Y: 640, Width: 80, Height: 80, Confidence: 0.95},
+				},
+			},
+			{
+				Screenshot:        blankScreenshot(2),
+				ExpectedTapRegion: region10(360, 950), // 20px below the detection's bottom edge (Y+Height/2)
+				Detections: []common.Detection{
+					{Class: "upgrade_complete", X: 360, Y: 900, Width: 200, Height: 60, Confidence: 0.95},
+				},
+			},
+			{
+				Screenshot: blankScreenshot(3),
+				Detections: nil,
+			},
+		},
+	}
+}
+
+// QuestClaimingScenario drives actions.CollectQuests through one main
+// quest and one regular quest claim. CollectQuests taps the regular
+// quest's detection at (X, Y+78), which the second step's ExpectedTapRegion
+// accounts for.
+func QuestClaimingScenario() Scenario {
+	return Scenario{
+		Name: "quest_claiming",
+		Steps: []Step{
+			{
+				Screenshot:        blankScreenshot(11),
+				ExpectedTapRegion: region10(400, 300),
+				Detections: []common.Detection{
+					{Class: "main_quest_claimable", X: 400, Y: 300, Width: 60, Height: 60, Confidence: 0.97},
+				},
+			},
+			{
+				Screenshot:        blankScreenshot(12),
+				ExpectedTapRegion: region10(400, 578), // Y+78 from the detection below
+				Detections: []common.Detection{
+					{Class: "quests_claimable", X: 400, Y: 500, Width: 60, Height: 60, Confidence: 0.97},
+				},
+			},
+			{
+				Screenshot: blankScreenshot(13),
+				Detections: nil,
+			},
+		},
+	}
+}
+
+// HelpBubbleScenario exercises vision.CaptureAndDetect's dismiss-then-retry
+// loop: the first step's frame shows a help bubble on top of the real
+// detections, and its ExpectedTapRegion checks that CaptureAndDetect tapped
+// the bubble. The harness serves that same frame until Advance, so every
+// retry within one CaptureAndDetect call sees the bubble again and taps it;
+// the second step is the clean frame served after Advance.
+func HelpBubbleScenario() Scenario {
+	return Scenario{
+		Name: "help_bubble_dismissal",
+		Steps: []Step{
+			{
+				Screenshot:        blankScreenshot(21),
+				ExpectedTapRegion: region10(650, 120),
+				Detections: []common.Detection{
+					{Class: "help_chat_bubble", X: 650, Y: 120, Width: 50, Height: 50, Confidence: 0.9},
+					{Class: "build_available", X: 200, Y: 800, Width: 100, Height: 100, Confidence: 0.9},
+				},
+			},
+			{
+				Screenshot: blankScreenshot(22),
+				Detections: []common.Detection{
+					{Class: "build_available", X: 200, Y: 800, Width: 100, Height: 100, Confidence: 0.9},
+				},
+			},
+		},
+	}
+}
+
+// BuildOrderScenario drives a short multi-step actions.ProcessBuildOrder
+// run: an idle builder starts a new building on the build_available
+// button, then the resulting farm is picked up by the next detection pass.
+func BuildOrderScenario() Scenario {
+	return Scenario{
+		Name: "build_order",
+		Steps: []Step{
+			{
+				Screenshot:        blankScreenshot(31),
+				ExpectedTapRegion: region10(400, 700),
+				Detections: []common.Detection{
+					{Class: "builders_hut", X: 50, Y: 1200, Width: 80, Height: 80, Confidence: 0.95},
+					{Class: "build_available", X: 400, Y: 700, Width: 120, Height: 120, Confidence: 0.95},
+				},
+			},
+			{
+				Screenshot: blankScreenshot(32),
+				Detections: []common.Detection{
+					{Class: "builders_hut", X: 50, Y: 1200, Width: 80, Height: 80, Confidence: 0.95},
+					{Class: "farm", X: 400, Y: 700, Width: 120, Height: 120, Confidence: 0.95},
+				},
+			},
+		},
+	}
+}
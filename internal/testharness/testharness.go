@@ -0,0 +1,326 @@
+// Package testharness stands up an in-process fake ADB and a fake Roboflow
+// server so a scenario-driven test can exercise the module's real
+// capture/detect/tap loop - vision.CaptureScreenshot, vision.SendToRoboflow,
+// utils.TapScreen/SwipeScreen - without a real device or Roboflow API quota.
+//
+// A scenario (see Scenario, Step) is a sequence of frames: each has the
+// screenshot bytes to serve next and the detections Roboflow should report
+// for it, plus an optional region the module's next tap/swipe is expected
+// to land in before the harness advances to the following frame.
+//
+// Fake ADB: every call this module makes to adb goes through os/exec to
+// the `adb` binary named by adbPath - CaptureScreenshot, TapScreen, and
+// SwipeScreen never open the ADB host:5037 wire protocol themselves. So
+// rather than a unix-socket server actually speaking that protocol (which
+// nothing in this tree would ever connect to), Harness installs a small
+// POSIX shell script at a temp path and hands its location out via
+// AdbPath: the script answers `-s <device> exec-out screencap -p` by
+// cating the current frame file, and logs `-s <device> shell input
+// tap|swipe ...` invocations to an events file the Harness then parses
+// back. This matches the actual interface the module depends on.
+//
+// Fake Roboflow: an httptest.Server. vision.SendToRoboflow's request URL is
+// built from the package var vision.RoboflowBaseURL, which FakeRoboflow
+// points at itself for the duration of the test.
+package testharness
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"roborok/internal/common"
+	"roborok/internal/vision"
+)
+
+// Region is an axis-aligned bounding box a tap or swipe endpoint is
+// expected to land inside.
+type Region struct {
+	X, Y, Width, Height float64
+}
+
+// Contains reports whether (x, y) falls inside r.
+func (r Region) Contains(x, y float64) bool {
+	return x >= r.X && x <= r.X+r.Width && y >= r.Y && y <= r.Y+r.Height
+}
+
+// Step is one frame of a Scenario.
+type Step struct {
+	// Screenshot is served by FakeADB for this frame.
+	Screenshot []byte
+	// Detections is what FakeRoboflow reports for Screenshot.
+	Detections []common.Detection
+	// ExpectedTapRegion, if non-nil, is checked against the last tap or
+	// swipe-endpoint recorded since the previous Advance before moving on
+	// to the next step. Leave nil for a step that isn't expected to
+	// produce a tap (e.g. the first frame of a scenario).
+	ExpectedTapRegion *Region
+}
+
+// Scenario is a named, ordered sequence of Steps.
+type Scenario struct {
+	Name  string
+	Steps []Step
+}
+
+// Event is one recorded adb shell input invocation.
+type Event struct {
+	Type               string // "tap" or "swipe"
+	X, Y               int
+	X2, Y2, DurationMS int // swipe only
+}
+
+// Harness runs a Scenario against FakeADB and FakeRoboflow.
+type Harness struct {
+	scenario Scenario
+	step     int
+
+	adb      *fakeADB
+	roboflow *httptest.Server
+
+	mismatches []error
+}
+
+// New starts a Harness for scenario. Call Close when done.
+func New(scenario Scenario) (*Harness, error) {
+	if len(scenario.Steps) == 0 {
+		return nil, fmt.Errorf("testharness: scenario %q has no steps", scenario.Name)
+	}
+
+	adb, err := newFakeADB()
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Harness{scenario: scenario, adb: adb}
+
+	h.roboflow = httptest.NewServer(http.HandlerFunc(h.serveRoboflow))
+	vision.RoboflowBaseURL = h.roboflow.URL
+
+	if err := adb.setFrame(scenario.Steps[0].Screenshot); err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// AdbPath is the fake `adb` binary to pass as adbPath to the functions
+// under test.
+func (h *Harness) AdbPath() string { return h.adb.path }
+
+func (h *Harness) serveRoboflow(w http.ResponseWriter, r *http.Request) {
+	idx := h.step
+	if idx >= len(h.scenario.Steps) {
+		idx = len(h.scenario.Steps) - 1
+	}
+
+	resp := vision.RoboflowResponse{}
+	for _, d := range h.scenario.Steps[idx].Detections {
+		resp.Predictions = append(resp.Predictions, struct {
+			X          float64 `json:"x"`
+			Y          float64 `json:"y"`
+			Width      float64 `json:"width"`
+			Height     float64 `json:"height"`
+			Confidence float64 `json:"confidence"`
+			Class      string  `json:"class"`
+		}{X: d.X, Y: d.Y, Width: d.Width, Height: d.Height, Confidence: d.Confidence, Class: d.Class})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Advance checks the current step's ExpectedTapRegion (if any) against the
+// tap/swipe events recorded since the last Advance (or since New, for the
+// first call), records a mismatch (retrievable via Mismatches) rather than
+// failing immediately so a caller can run a whole scenario and report every
+// violation at once, clears the event log, and serves the next step's
+// screenshot/detections. It returns false once the scenario is exhausted.
+func (h *Harness) Advance() bool {
+	step := h.scenario.Steps[h.step]
+	events, err := h.adb.events()
+	if err != nil {
+		h.mismatches = append(h.mismatches, fmt.Errorf("%s: step %d: reading adb events: %w", h.scenario.Name, h.step, err))
+	}
+
+	if step.ExpectedTapRegion != nil {
+		if len(events) == 0 {
+			h.mismatches = append(h.mismatches, fmt.Errorf("%s: step %d: expected a tap in %+v, but none was recorded", h.scenario.Name, h.step, *step.ExpectedTapRegion))
+		} else {
+			last := events[len(events)-1]
+			x, y := float64(last.X), float64(last.Y)
+			if last.Type == "swipe" {
+				x, y = float64(last.X2), float64(last.Y2)
+			}
+			if !step.ExpectedTapRegion.Contains(x, y) {
+				h.mismatches = append(h.mismatches, fmt.Errorf("%s: step %d: tap/swipe endpoint (%.0f, %.0f) outside expected region %+v", h.scenario.Name, h.step, x, y, *step.ExpectedTapRegion))
+			}
+		}
+	}
+
+	h.adb.clearEvents()
+	h.step++
+	if h.step >= len(h.scenario.Steps) {
+		return false
+	}
+
+	if err := h.adb.setFrame(h.scenario.Steps[h.step].Screenshot); err != nil {
+		h.mismatches = append(h.mismatches, fmt.Errorf("%s: step %d: setting next frame: %w", h.scenario.Name, h.step, err))
+	}
+	return true
+}
+
+// Mismatches returns every assertion failure recorded across all Advance
+// calls so far.
+func (h *Harness) Mismatches() []error {
+	return h.mismatches
+}
+
+// Close tears down the fake Roboflow server and fake adb script.
+func (h *Harness) Close() {
+	if h.roboflow != nil {
+		h.roboflow.Close()
+	}
+	if h.adb != nil {
+		os.RemoveAll(h.adb.dir)
+	}
+}
+
+// fakeADB is the adb-CLI-shaped substitute described in the package doc
+// comment: a shell script plus the two files it reads/writes.
+type fakeADB struct {
+	dir        string
+	path       string
+	framePath  string
+	eventsPath string
+}
+
+func newFakeADB() (*fakeADB, error) {
+	dir, err := os.MkdirTemp("", "testharness-adb")
+	if err != nil {
+		return nil, fmt.Errorf("testharness: creating temp dir: %w", err)
+	}
+
+	a := &fakeADB{
+		dir:        dir,
+		path:       filepath.Join(dir, "adb"),
+		framePath:  filepath.Join(dir, "frame.png"),
+		eventsPath: filepath.Join(dir, "events.log"),
+	}
+
+	script := fmt.Sprintf(`#!/bin/sh
+if [ "$3" = "exec-out" ]; then
+  cat %s
+  exit 0
+fi
+if [ "$3" = "shell" ] && [ "$4" = "input" ]; then
+  action="$5"
+  shift 5
+  case "$action" in
+    tap)
+      echo "tap $1 $2" >> %s
+      ;;
+    swipe)
+      echo "swipe $1 $2 $3 $4 $5" >> %s
+      ;;
+  esac
+fi
+exit 0
+`, shellQuote(a.framePath), shellQuote(a.eventsPath), shellQuote(a.eventsPath))
+
+	if err := os.WriteFile(a.path, []byte(script), 0755); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("testharness: writing fake adb script: %w", err)
+	}
+	if err := os.WriteFile(a.eventsPath, nil, 0644); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("testharness: creating events log: %w", err)
+	}
+
+	return a, nil
+}
+
+func shellQuote(path string) string {
+	return "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+}
+
+func (a *fakeADB) setFrame(data []byte) error {
+	return os.WriteFile(a.framePath, data, 0644)
+}
+
+func (a *fakeADB) clearEvents() {
+	os.WriteFile(a.eventsPath, nil, 0644)
+}
+
+func (a *fakeADB) events() ([]Event, error) {
+	f, err := os.Open(a.eventsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "tap":
+			if len(fields) != 3 {
+				continue
+			}
+			x, _ := strconv.Atoi(fields[1])
+			y, _ := strconv.Atoi(fields[2])
+			events = append(events, Event{Type: "tap", X: x, Y: y})
+		case "swipe":
+			if len(fields) != 6 {
+				continue
+			}
+			x1, _ := strconv.Atoi(fields[1])
+			y1, _ := strconv.Atoi(fields[2])
+			x2, _ := strconv.Atoi(fields[3])
+			y2, _ := strconv.Atoi(fields[4])
+			ms, _ := strconv.Atoi(fields[5])
+			events = append(events, Event{Type: "swipe", X: x1, Y: y1, X2: x2, Y2: y2, DurationMS: ms})
+		}
+	}
+	return events, scanner.Err()
+}
+
+// blankScreenshot returns a small placeholder PNG whose pixel content
+// varies with seed, for scenario steps where the exact image doesn't matter
+// because detections are scripted rather than vision-derived - it still
+// has to vary per step, though, and by more than flat color:
+// vision.SendToRoboflow's perceptual-hash cache (see roboflow_cache.go) is
+// gradient-based, so a single solid color hashes the same regardless of
+// which color it is. A diagonal gradient keyed by seed gives each call a
+// genuinely distinct hash, the same way two different real screenshots
+// would.
+func blankScreenshot(seed int) []byte {
+	const n = 16
+	img := image.NewGray(image.Rect(0, 0, n, n))
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8((x*16 + y*9 + seed*37) % 256)})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		panic(fmt.Sprintf("testharness: encoding blank screenshot: %v", err))
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,72 @@
+package testharness
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"roborok/internal/actions"
+	"roborok/internal/common"
+	"roborok/internal/state"
+	"roborok/internal/utils"
+	"roborok/internal/vision"
+)
+
+// initTestConfig points the global config at a minimal on-disk config.json
+// so CaptureAndDetect (which reads the Roboflow API key/model ID off it) has
+// something to load. The API key/model ID themselves don't matter: New's
+// fake Roboflow server ignores them and just replays the current step's
+// canned detections.
+func initTestConfig(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	const body = `{
+		"global": {},
+		"instances": {"emulator-5554": {"device_id": "emulator-5554"}},
+		"gameplay": {"adb_path": "adb"}
+	}`
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatalf("writing test config: %v", err)
+	}
+	if err := utils.InitGlobalConfig(path); err != nil {
+		t.Fatalf("InitGlobalConfig: %v", err)
+	}
+}
+
+// TestQuestClaiming drives QuestClaimingScenario through the real
+// vision.CaptureAndDetect/actions.CollectQuests path, the same capture ->
+// detect -> tap loop manager.go runs live, against the harness's fake ADB
+// and fake Roboflow server instead of a real device or API quota.
+func TestQuestClaiming(t *testing.T) {
+	initTestConfig(t)
+
+	h, err := New(QuestClaimingScenario())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer h.Close()
+
+	const deviceID = "emulator-5554"
+	instanceState := &state.InstanceState{ID: deviceID, DeviceID: deviceID}
+	taskConfig := common.TaskConfig{}
+
+	for {
+		detections, err := vision.CaptureAndDetect(deviceID, h.AdbPath())
+		if err != nil {
+			t.Fatalf("CaptureAndDetect: %v", err)
+		}
+
+		actions.CollectQuests(context.Background(), deviceID, "", detections, h.AdbPath(), taskConfig, instanceState)
+
+		if !h.Advance() {
+			break
+		}
+	}
+
+	for _, mismatch := range h.Mismatches() {
+		t.Error(mismatch)
+	}
+}
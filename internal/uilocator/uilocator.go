@@ -0,0 +1,123 @@
+// Package uilocator resolves named UI elements to tap coordinates from
+// whichever of three sources is available, in order of preference: a live
+// detection class, an offset relative to another detected element, or a
+// screen-fraction fallback. This replaces action handlers' hardcoded
+// (x, y) taps (e.g. CollectVIPRewards's old literal 320,200), which
+// silently mistap the moment a handler runs against a differently-sized
+// emulator and give the detection pipeline no way to tell a tap happened
+// against a guess rather than something actually on screen.
+package uilocator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"roborok/internal/common"
+	"roborok/internal/logging"
+	"roborok/internal/utils"
+)
+
+// Locator names a UI element and how to find it. Resolve tries each
+// populated source below in order until one succeeds:
+//
+//  1. DetectionClass: the element's own detection class, if present in
+//     the handler's current []common.Detection - the accurate case,
+//     since the element is confirmed on screen right now.
+//  2. RelativeTo/OffsetX/OffsetY: OffsetX/OffsetY pixels from wherever
+//     RelativeTo's detection class currently is, for elements that don't
+//     get their own class but sit a fixed distance from one that does
+//     (e.g. a dialog's close button relative to the dialog itself).
+//  3. FracX/FracY: a position normalized to (0,0)-(1,1) of the screen,
+//     scaled to the device's actual resolution via
+//     utils.GetScreenResolution. The only source that doesn't need a
+//     detection to have fired, and the last resort for elements the
+//     vision model doesn't recognize yet.
+type Locator struct {
+	Name           string  `json:"name"`
+	DetectionClass string  `json:"detection_class,omitempty"`
+	RelativeTo     string  `json:"relative_to,omitempty"`
+	OffsetX        int     `json:"offset_x,omitempty"`
+	OffsetY        int     `json:"offset_y,omitempty"`
+	FracX          float64 `json:"frac_x"`
+	FracY          float64 `json:"frac_y"`
+}
+
+// Resolve finds loc's current tap coordinates, preferring a live
+// detection over loc's FracX/FracY fallback scaled to deviceID's
+// resolution (queried via utils.GetScreenResolution). Every time
+// resolution falls all the way back to FracX/FracY, it emits a "locator
+// miss" Warning event via logging.Emit, so an operator watching
+// logging.DefaultBus (e.g. over ctlapi's /events) can see which locators
+// are drifting away from their detection classes.
+func Resolve(deviceID, adbPath string, loc Locator, detections []common.Detection) (x, y int, err error) {
+	if loc.DetectionClass != "" {
+		if det := findDetection(detections, loc.DetectionClass); det != nil {
+			return int(det.X), int(det.Y), nil
+		}
+	}
+
+	if loc.RelativeTo != "" {
+		if det := findDetection(detections, loc.RelativeTo); det != nil {
+			return int(det.X) + loc.OffsetX, int(det.Y) + loc.OffsetY, nil
+		}
+	}
+
+	fields := logging.Fields{"device_id": deviceID, "task": "resolve_locator", "locator": loc.Name}
+
+	width, height, resErr := utils.GetScreenResolution(deviceID, adbPath)
+	if resErr != nil {
+		return 0, 0, fmt.Errorf("resolve locator %q: no detection available and %w", loc.Name, resErr)
+	}
+
+	x = int(loc.FracX * float64(width))
+	y = int(loc.FracY * float64(height))
+	logging.Emit(logging.Warning, fields, "locator miss: %q fell back to normalized coordinates (%d, %d)", loc.Name, x, y)
+	return x, y, nil
+}
+
+// findDetection returns the first above-MinConfidence detection of class
+// in detections, or nil if none matched.
+func findDetection(detections []common.Detection, class string) *common.Detection {
+	for _, det := range detections {
+		if det.Class == class && det.Confidence > common.MinConfidence {
+			return &det
+		}
+	}
+	return nil
+}
+
+// TapLocator resolves loc against detections and taps the result.
+func TapLocator(deviceID, adbPath string, loc Locator, detections []common.Detection) error {
+	x, y, err := Resolve(deviceID, adbPath, loc, detections)
+	if err != nil {
+		return err
+	}
+	return utils.TapScreen(deviceID, adbPath, x, y)
+}
+
+// Table is a set of Locators keyed by Locator.Name, the shape LoadTable
+// parses a profile file into.
+type Table map[string]Locator
+
+// LoadTable reads a Table from the JSON file at path: a flat array of
+// Locator objects, keyed here by their Name. There's no go.mod to vendor
+// a YAML library into this tree, so profile files are JSON, the same
+// choice build-order.go's loadBuildPlan/loadGoalPlan already made for
+// their own config-like input files.
+func LoadTable(path string) (Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading locator table %s: %w", path, err)
+	}
+
+	var locators []Locator
+	if err := json.Unmarshal(data, &locators); err != nil {
+		return nil, fmt.Errorf("error parsing locator table %s: %w", path, err)
+	}
+
+	table := make(Table, len(locators))
+	for _, loc := range locators {
+		table[loc.Name] = loc
+	}
+	return table, nil
+}
@@ -3,12 +3,18 @@ package utils
 import (
 	"fmt"
 	"os/exec"
+	"roborok/internal/metrics"
+	"roborok/internal/replay"
+	"strconv"
 	"strings"
 	"time"
 )
 
 // TapScreen simulates a tap at the given coordinates
 func TapScreen(deviceID, adbPath string, x, y int) error {
+	defer observeLatency(deviceID, time.Now())
+	replay.Default.RecordTap(deviceID, x, y)
+
 	cmd := exec.Command(
 		adbPath,
 		"-s",
@@ -25,6 +31,9 @@ func TapScreen(deviceID, adbPath string, x, y int) error {
 
 // SwipeScreen simulates a swipe from (x1, y1) to (x2, y2) with the given duration
 func SwipeScreen(deviceID, adbPath string, x1, y1, x2, y2, durationMS int) error {
+	defer observeLatency(deviceID, time.Now())
+	replay.Default.RecordSwipe(deviceID, x1, y1, x2, y2, durationMS)
+
 	cmd := exec.Command(
 		adbPath,
 		"-s",
@@ -42,6 +51,13 @@ func SwipeScreen(deviceID, adbPath string, x1, y1, x2, y2, durationMS int) error
 	return cmd.Run()
 }
 
+// observeLatency records how long an ADB round-trip took for deviceID in
+// the process-wide metrics collector, for the /metrics control-plane
+// endpoint.
+func observeLatency(deviceID string, start time.Time) {
+	metrics.Default.ObserveADBLatency(deviceID, time.Since(start))
+}
+
 // SendText sends text input to the device
 func SendText(deviceID, adbPath, text string) error {
 	// Replace spaces with %s
@@ -62,6 +78,9 @@ func SendText(deviceID, adbPath, text string) error {
 
 // PressKey simulates pressing a key
 func PressKey(deviceID, adbPath, keycode string) error {
+	defer observeLatency(deviceID, time.Now())
+	replay.Default.RecordKeyPress(deviceID, keycode)
+
 	cmd := exec.Command(
 		adbPath,
 		"-s",
@@ -75,6 +94,46 @@ func PressKey(deviceID, adbPath, keycode string) error {
 	return cmd.Run()
 }
 
+// GetScreenResolution queries the device's current display size via
+// `adb shell wm size`, parsing a line like "Physical size: 1080x1920". Callers
+// that hold a list of hardcoded tap coordinates (see actions.ScaleCoordinate)
+// use this to detect when a device's screen doesn't match the resolution
+// those coordinates were captured at, rather than silently mistapping on
+// differently-sized emulators.
+func GetScreenResolution(deviceID, adbPath string) (width, height int, err error) {
+	cmd := exec.Command(adbPath, "-s", deviceID, "shell", "wm", "size")
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to query screen resolution: %w", err)
+	}
+
+	// wm size reports "Physical size: WxH" (and, if an override is active,
+	// an additional "Override size: WxH" line below it) - take the last
+	// "W x H" pair on any line, which is the size currently in effect.
+	for _, line := range strings.Split(string(output), "\n") {
+		idx := strings.LastIndex(line, ":")
+		if idx == -1 {
+			continue
+		}
+		dims := strings.TrimSpace(line[idx+1:])
+		parts := strings.SplitN(dims, "x", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		w, errW := strconv.Atoi(strings.TrimSpace(parts[0]))
+		h, errH := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if errW != nil || errH != nil {
+			continue
+		}
+		width, height = w, h
+	}
+
+	if width == 0 || height == 0 {
+		return 0, 0, fmt.Errorf("could not parse screen resolution from %q", output)
+	}
+	return width, height, nil
+}
+
 // IsDeviceConnected checks if the device is connected
 func IsDeviceConnected(deviceID, adbPath string) bool {
 	cmd := exec.Command(adbPath, "devices")
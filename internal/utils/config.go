@@ -7,13 +7,20 @@ import (
 	"os"
 	"roborok/internal/common"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// Global config instance and mutex for thread-safety
+// Global config instance. globalConfig is an atomic.Pointer rather than a
+// plain *Config behind a mutex so GetConfig() never blocks on a reload in
+// progress, and a reader that grabbed a *Config keeps reading a single
+// consistent snapshot even if ReloadConfig swaps in a new one mid-use.
 var (
-	globalConfig     *Config
+	globalConfig     atomic.Pointer[Config]
 	globalConfigOnce sync.Once
-	configMutex      sync.RWMutex
+
+	subscribersMu sync.Mutex
+	subscribers   []func(old, new *Config)
 )
 
 // Config represents the application configuration
@@ -29,8 +36,122 @@ type GlobalConfig struct {
 	RoboflowTutorialModel string `json:"roboflow_tutorial_model_id"`
 	RoboflowGameplayModel string `json:"roboflow_gameplay_model_id"`
 	RefreshIntervalMS     int    `json:"refresh_interval_ms"`
+	SplayMS               int    `json:"splay_ms"` // randomizes the loop delay by +/- this many ms so parallel instances don't click in lockstep
 	ReportEndpoint        string `json:"report_endpoint"`
 	ReportingIntervalS    int    `json:"reporting_interval_s"`
+	CtlAPIAddr            string `json:"ctlapi_addr"` // address (e.g. ":8090") for the HTTP control plane; disabled if empty
+
+	// ReportHMACSecret, if set, signs every report.Reporter POST body with
+	// HMAC-SHA256 (header X-Roborok-Signature) so the backend can verify a
+	// batch came from a configured bot instead of an arbitrary sender.
+	ReportHMACSecret string `json:"report_hmac_secret"`
+
+	// ReportSpoolDir is where report.Reporter persists queued ReportItems
+	// so they survive a restart before being successfully sent. Defaults to
+	// "report_spool" if unset.
+	ReportSpoolDir string `json:"report_spool_dir"`
+
+	// ReportMaxQueueSize caps how many ReportItems report.Reporter holds at
+	// once; past this, the oldest queued item (and its spool file) is
+	// dropped to make room for the newest. Defaults to 1000 if unset.
+	ReportMaxQueueSize int `json:"report_max_queue_size"`
+
+	// ReportRateLimitPerInstanceS is the minimum number of seconds between
+	// two ReportItems accepted from the same instance. 0 means unlimited.
+	ReportRateLimitPerInstanceS int `json:"report_rate_limit_per_instance_s"`
+
+	// VisionCallsPerMinute and ADBConcurrency bound the shared budget that
+	// internal/scheduler arbitrates across every instance loop, so N
+	// emulators running in parallel can't collectively exceed the
+	// Roboflow rate limit or saturate ADB. 0 means unlimited for that
+	// budget (the default - no behavior change unless configured).
+	VisionCallsPerMinute int `json:"vision_calls_per_minute"`
+	ADBConcurrency       int `json:"adb_concurrency"`
+
+	// RoboflowCallsPerMinutePerKey bounds how often vision.ResilientDetector
+	// will call the Roboflow API with a given RoboflowAPIKey, independent of
+	// VisionCallsPerMinute above. The two operate at different layers:
+	// VisionCallsPerMinute is scheduler's process-wide admission budget for
+	// the whole screenshot+vision step, shared across every instance
+	// regardless of which API key or model they use; this one is a
+	// token-bucket keyed by the literal API key string, so two instances
+	// (or a tutorial/gameplay model split) configured with different
+	// Roboflow keys get independent budgets that track each key's own
+	// quota. 0 means unlimited for that key (the default - no behavior
+	// change unless configured).
+	RoboflowCallsPerMinutePerKey int `json:"roboflow_calls_per_minute_per_key"`
+
+	// TaskSpecPath, if set, points at a taskspec.Spec JSON file used to
+	// build every instance's task list instead of the hard-coded list in
+	// manager.initializeTasks, and is watched for edits so changes apply
+	// without a restart. Empty preserves the existing hard-coded behavior.
+	TaskSpecPath string `json:"task_spec_path"`
+
+	// ReplayDir, if set, enables internal/replay session recording: every
+	// capture/detect cycle and tap/swipe is written to a timestamped
+	// tar.gz archive under this directory. Empty disables recording
+	// entirely (the default - no behavior change unless configured).
+	ReplayDir string `json:"replay_dir"`
+
+	// EventLogPath, if set, starts a logging.StartJSONLSink appending every
+	// logging.DefaultBus event to this file as NDJSON, alongside whatever
+	// the process's regular stdout/stderr log already receives. Empty
+	// disables the sink entirely (the default).
+	EventLogPath string `json:"event_log_path"`
+
+	// ViewWeightsPath, if set, points at a vision.ViewScore list JSON file
+	// overriding vision.DetermineGameView's built-in class -> view weight
+	// table. Empty keeps the built-in table (see vision/classifier.go's
+	// defaultViewWeights).
+	ViewWeightsPath string `json:"view_weights_path"`
+
+	// LocatorsPath, if set, points at a uilocator.Table JSON file overriding
+	// an action handler's built-in locator table (e.g. vipLocators in
+	// vip.go) by Locator.Name. Empty keeps every handler on its built-in
+	// table.
+	LocatorsPath string `json:"locators_path"`
+
+	// BuildPlanPath, if set, points at a planner.Plan JSON file used to pick
+	// the next build-order task instead of walking the hard-coded, flat
+	// actions.DefineDefaultBuildOrder list in declaration order. Empty
+	// preserves the existing behavior.
+	BuildPlanPath string `json:"build_plan_path"`
+
+	// GoalsPath, if set, points at a buildorder.Goal list JSON file;
+	// RunBuildOrderTask compiles it into a planner.Plan (see
+	// buildorder.Compile) instead of reading either BuildPlanPath or the
+	// hard-coded flat list. Takes precedence over BuildPlanPath when both
+	// are set, since a goal list is a higher-level declaration of the same
+	// kind of plan. Empty preserves the existing behavior.
+	GoalsPath string `json:"goals_path"`
+
+	// TemplatesDir, if set, points vision/templates.LocateTemplate at a
+	// directory of named template PNGs used to resolve on-screen UI
+	// elements by image matching instead of a hardcoded (x,y) pair. Empty
+	// disables template matching entirely - every caller falls back to its
+	// existing hardcoded coordinate (the default - no behavior change
+	// unless configured).
+	TemplatesDir string `json:"templates_dir"`
+
+	// ProfilesPath, if set, points at a profile.Set JSON file (a list of
+	// named profile.Profile) that InstanceConfig.Profile references by
+	// name, and is watched for edits so a profile change applies without
+	// restarting. Empty means no instance can use Profile (see
+	// manager.Manager.applyProfile).
+	ProfilesPath string `json:"profiles_path"`
+
+	// ArrowTapDistancePx is how far past a detected click_arrow's center
+	// handleArrowOnlyAction taps, in the direction vision.EstimateOrientation
+	// infers. 0 uses the default of 100px.
+	ArrowTapDistancePx float64 `json:"arrow_tap_distance_px"`
+
+	// VisionCacheDir, if set, spills SendToRoboflow's perceptual-hash
+	// inference cache to disk under this directory (one JSON file per
+	// distinct frame, content-addressed by hash) so it survives a restart
+	// instead of only living for the current process. Empty keeps the
+	// cache in-memory only (still enabled - no behavior change beyond
+	// losing the cache across restarts).
+	VisionCacheDir string `json:"vision_cache_dir"`
 }
 
 // InstanceConfig contains per-instance settings
@@ -40,6 +161,29 @@ type InstanceConfig struct {
 	ClaimQuests                bool   `json:"claim_quests"`
 	ClaimOnlyMainQuest         bool   `json:"claim_only_main_quest"`
 	EnableScoutMicromanagement bool   `json:"enable_scout_micromanagement"`
+	SplayMS                    int    `json:"splay_ms"` // overrides GlobalConfig.SplayMS for this instance when non-zero
+
+	// TaskSpecPath overrides GlobalConfig.TaskSpecPath for this instance
+	// when non-empty, so one emulator can run a different task list (e.g.
+	// a farming-only account) than the rest of the fleet.
+	TaskSpecPath string `json:"task_spec_path"`
+
+	// BuildPlanPath overrides GlobalConfig.BuildPlanPath for this instance
+	// when non-empty, so one emulator can follow a different build plan
+	// (e.g. a different KvK/season build order) than the rest of the fleet.
+	BuildPlanPath string `json:"build_plan_path"`
+
+	// GoalsPath overrides GlobalConfig.GoalsPath for this instance when
+	// non-empty, mirroring BuildPlanPath's per-instance override.
+	GoalsPath string `json:"goals_path"`
+
+	// Profile names a profile.Profile (from GlobalConfig.ProfilesPath) this
+	// instance should run, e.g. "main" or "farm". Takes precedence over
+	// TaskSpecPath and the hard-coded default task list when the name
+	// resolves to a loaded profile; falls back to them otherwise (unset
+	// name, or a ProfilesPath that hasn't loaded the name yet). Empty runs
+	// the instance exactly as before profiles existed.
+	Profile string `json:"profile"`
 }
 
 // GameplayConfig contains gameplay settings
@@ -52,6 +196,13 @@ type GameplayConfig struct {
 	ResearchPath       []string       `json:"research_path"`
 	BuildingLevels     map[string]int `json:"building_levels"`
 	TroopLevels        map[string]int `json:"troop_levels"`
+	VisionBackend      string         `json:"vision_backend"`  // "roboflow" (default), "onnx", or "hybrid"
+	ONNXModelPath      string         `json:"onnx_model_path"` // path to a local ONNX/TFLite model, used by "onnx" and "hybrid" backends
+
+	// SchedulerWeights tunes the candidate-scoring task scheduler in
+	// Manager.RunGameplayIteration, e.g. to favor a build-heavy or
+	// troop-heavy playstyle. Nil uses common.DefaultSchedulerWeights.
+	SchedulerWeights *common.SchedulerWeights `json:"scheduler_weights,omitempty"`
 }
 
 // LoadConfig loads the configuration from a JSON file
@@ -109,6 +260,10 @@ func LoadConfig(filepath string) (*Config, error) {
 		config.Global.RoboflowGameplayModel = common.GameplayModelID
 	}
 
+	if config.Gameplay.VisionBackend == "" {
+		config.Gameplay.VisionBackend = "roboflow"
+	}
+
 	if config.Gameplay.ADBPath == "" {
 		return nil, fmt.Errorf("missing required field: gameplay.adb_path")
 	}
@@ -132,9 +287,7 @@ func InitGlobalConfig(configPath string) error {
 			return
 		}
 
-		configMutex.Lock()
-		globalConfig = config
-		configMutex.Unlock()
+		globalConfig.Store(config)
 
 		log.Println("Global configuration initialized successfully")
 	})
@@ -142,17 +295,102 @@ func InitGlobalConfig(configPath string) error {
 	return initErr
 }
 
+// ReloadConfig re-reads and validates the configuration from disk (the same
+// checks LoadConfig always runs) and, only on success, atomically swaps it
+// into place and notifies every SubscribeConfig callback with the old and
+// new config. On a validation or read failure the previously loaded config
+// is left untouched and the error is returned, so a bad edit on disk can't
+// take down a running fleet. Safe to call repeatedly - from a SIGHUP
+// handler or a WatchConfig poll loop - to pick up edits without restarting.
+func ReloadConfig(configPath string) (*Config, error) {
+	newConfig, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	oldConfig := globalConfig.Swap(newConfig)
+
+	log.Println("Global configuration reloaded successfully")
+	notifySubscribers(oldConfig, newConfig)
+	return newConfig, nil
+}
+
+// WatchConfig polls configPath every interval and calls ReloadConfig
+// whenever its modification time advances, so a config edit on disk takes
+// effect without either a restart or a manual SIGHUP. This tree has no
+// go.mod and vendors no fsnotify equivalent, so - as with
+// internal/taskspec's own hot-reload - polling mtime stands in for
+// filesystem-event notification at the cost of up to one poll interval of
+// latency. A failed reload (see ReloadConfig) is logged and retried on the
+// next tick rather than tearing down the watch loop. Call the returned stop
+// func to end it.
+func WatchConfig(configPath string, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+
+	go func() {
+		var lastModTime time.Time
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				info, err := os.Stat(configPath)
+				if err != nil {
+					continue
+				}
+				if !info.ModTime().After(lastModTime) {
+					continue
+				}
+
+				if _, err := ReloadConfig(configPath); err != nil {
+					log.Printf("Config file changed but failed to reload, keeping current config: %v", err)
+					continue
+				}
+				lastModTime = info.ModTime()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// SubscribeConfig registers fn to be called with the old and new config
+// after every successful ReloadConfig, so a component that isn't on the hot
+// path of reading m.Config/GetConfig() each iteration (the Reporter, the
+// vision detector, per-instance goroutines) can still react to a changed
+// tunable - RefreshIntervalMS, ClaimOnlyMainQuest, a model ID - without a
+// restart. fn runs synchronously on the goroutine that called ReloadConfig;
+// it should return quickly.
+func SubscribeConfig(fn func(old, new *Config)) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	subscribers = append(subscribers, fn)
+}
+
+func notifySubscribers(old, new *Config) {
+	subscribersMu.Lock()
+	fns := make([]func(old, new *Config), len(subscribers))
+	copy(fns, subscribers)
+	subscribersMu.Unlock()
+
+	for _, fn := range fns {
+		fn(old, new)
+	}
+}
+
 // GetConfig returns the global configuration
 // It will panic if the configuration hasn't been initialized
 func GetConfig() *Config {
-	configMutex.RLock()
-	defer configMutex.RUnlock()
-
-	if globalConfig == nil {
+	config := globalConfig.Load()
+	if config == nil {
 		log.Fatal("Attempted to access global config before initialization")
 	}
 
-	return globalConfig
+	return config
 }
 
 // GetRoboflowAPIKey returns the Roboflow API key from the global config
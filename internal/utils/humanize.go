@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// TapOptions configures HumanizedTap/HumanizedSwipe's coordinate jitter and
+// timing randomization, so a single set of defaults doesn't have to fit
+// every button size and screen resolution.
+type TapOptions struct {
+	// JitterRadius is the standard deviation, in pixels, of the Gaussian
+	// offset applied to each coordinate. Zero disables jitter.
+	JitterRadius float64
+	// MinDwellMS and MaxDwellMS bound how long a tap or swipe takes to
+	// complete, randomized uniformly within the range.
+	MinDwellMS, MaxDwellMS int
+	// CurveProbability is the chance, in [0,1), that HumanizedSwipe bows a
+	// swipe into two short segments around a midpoint instead of issuing
+	// one straight-line SwipeScreen call.
+	CurveProbability float64
+}
+
+// DefaultTapOptions returns the jitter/timing defaults used when a caller
+// doesn't need to tune them for a particular button or gesture: Gaussian
+// jitter with a 6px standard deviation, an 80-180ms dwell, and a 25% chance of a curved swipe path.
+func DefaultTapOptions() TapOptions {
+	return TapOptions{JitterRadius: 6, MinDwellMS: 80, MaxDwellMS: 180, CurveProbability: 0.25}
+}
+
+// humanizerRNG backs HumanizedTap/HumanizedSwipe's jitter and timing. It's
+// package-level, like tutorial.go's own rand.Seed(time.Now().UnixNano())
+// call, but kept as its own *rand.Rand rather than the global source so
+// SeedHumanizer can make it deterministic without affecting unrelated
+// rand.Intn calls elsewhere in the process.
+var humanizerRNG = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// SeedHumanizer reseeds the RNG HumanizedTap and HumanizedSwipe draw jitter
+// and dwell times from, so repeated calls with the same inputs produce the
+// same sequence of taps.
+func SeedHumanizer(seed int64) {
+	humanizerRNG = rand.New(rand.NewSource(seed))
+}
+
+// HumanizedTap taps near (x, y), offsetting both coordinates by an
+// independent Gaussian sample with standard deviation opts.JitterRadius and
+// holding the tap for a randomized dwell within [opts.MinDwellMS,
+// opts.MaxDwellMS], so repeated taps at the same logical target don't land
+// on the exact same pixel or take the exact same time every call.
+func HumanizedTap(deviceID, adbPath string, x, y int, opts TapOptions) error {
+	jx, jy := jitter(x, opts.JitterRadius), jitter(y, opts.JitterRadius)
+	d := dwell(opts)
+	if d <= 0 {
+		return TapScreen(deviceID, adbPath, jx, jy)
+	}
+	// A tap held for a nonzero duration is a swipe from a point to itself:
+	// "input swipe" (SwipeScreen's underlying command) is the
+	// ADB primitive that takes an explicit duration; "input tap" does not.
+	return SwipeScreen(deviceID, adbPath, jx, jy, jx, jy, int(d.Milliseconds()))
+}
+
+// HumanizedSwipe swipes from (x1, y1) to (x2, y2), jittering both endpoints
+// independently and randomizing total duration within opts' dwell range.
+// With probability opts.CurveProbability it bows the path through an
+// intermediate point offset perpendicular to the straight line instead of
+// issuing one linear SwipeScreen call, so the motion isn't a
+// constant-velocity straight drag every time.
+func HumanizedSwipe(deviceID, adbPath string, x1, y1, x2, y2 int, opts TapOptions) error {
+	jx1, jy1 := jitter(x1, opts.JitterRadius), jitter(y1, opts.JitterRadius)
+	jx2, jy2 := jitter(x2, opts.JitterRadius), jitter(y2, opts.JitterRadius)
+
+	total := dwell(opts)
+	if total <= 0 {
+		total = 150 * time.Millisecond
+	}
+
+	if opts.CurveProbability <= 0 || humanizerRNG.Float64() >= opts.CurveProbability {
+		return SwipeScreen(deviceID, adbPath, jx1, jy1, jx2, jy2, int(total.Milliseconds()))
+	}
+
+	midX, midY := curvedMidpoint(jx1, jy1, jx2, jy2)
+	segmentMS := int(total.Milliseconds()) / 2
+	if segmentMS <= 0 {
+		segmentMS = 1
+	}
+	if err := SwipeScreen(deviceID, adbPath, jx1, jy1, midX, midY, segmentMS); err != nil {
+		return err
+	}
+	return SwipeScreen(deviceID, adbPath, midX, midY, jx2, jy2, segmentMS)
+}
+
+func jitter(v int, radius float64) int {
+	if radius <= 0 {
+		return v
+	}
+	return v + int(math.Round(humanizerRNG.NormFloat64()*radius))
+}
+
+func dwell(opts TapOptions) time.Duration {
+	minMS, maxMS := opts.MinDwellMS, opts.MaxDwellMS
+	if maxMS <= minMS {
+		return time.Duration(minMS) * time.Millisecond
+	}
+	return time.Duration(minMS+humanizerRNG.Intn(maxMS-minMS+1)) * time.Millisecond
+}
+
+// curvedMidpoint returns a point offset perpendicular to the (x1,y1)-(x2,y2)
+// line by up to 15% of its length, so a curved HumanizedSwipe bows slightly
+// to one side rather than passing through a point exactly on the straight
+// line, which would be indistinguishable from not curving at all.
+func curvedMidpoint(x1, y1, x2, y2 int) (int, int) {
+	mx, my := float64(x1+x2)/2, float64(y1+y2)/2
+	dx, dy := float64(x2-x1), float64(y2-y1)
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return int(mx), int(my)
+	}
+	perpX, perpY := -dy/length, dx/length
+	bow := (humanizerRNG.Float64()*2 - 1) * length * 0.15
+	return int(mx + perpX*bow), int(my + perpY*bow)
+}
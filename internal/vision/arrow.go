@@ -0,0 +1,104 @@
+package vision
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"roborok/internal/common"
+	"roborok/internal/vision/templates"
+)
+
+// DetectionRect returns det's bounding box in screenshot pixel coordinates.
+// common.Detection's X/Y is the box's center (see tutorial.go's
+// handleUpgradeCompleteAction, which takes Y+Height/2 as the bottom edge
+// and taps 20px below it), so the box spans [X-Width/2, X+Width/2] x [Y-Height/2, Y+Height/2].
+func DetectionRect(det common.Detection) image.Rectangle {
+	return image.Rect(
+		int(det.X-det.Width/2), int(det.Y-det.Height/2),
+		int(det.X+det.Width/2), int(det.Y+det.Height/2),
+	)
+}
+
+// CropDetection decodes screenshot and re-encodes the sub-image bounded by
+// rect (clamped to the decoded image's own bounds) as a standalone PNG -
+// the same crop-and-re-encode templates.CaptureTemplate does when building
+// a template library, exposed here so a caller (e.g. EstimateOrientation,
+// or a city-automation handler matching against a detection's own region
+// rather than the full screen) can feed a cropped region straight back into
+// templates.LocateTemplate without duplicating the draw.Draw boilerplate.
+func CropDetection(screenshot []byte, rect image.Rectangle) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(screenshot))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding screenshot: %w", err)
+	}
+
+	rect = rect.Intersect(img.Bounds())
+	if rect.Empty() {
+		return nil, fmt.Errorf("crop rect is empty after clamping to image bounds %v", img.Bounds())
+	}
+
+	cropped := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, rect.Min, draw.Src)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, cropped); err != nil {
+		return nil, fmt.Errorf("error encoding cropped region: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// arrowDirections maps each cardinal unit vector to the template name
+// EstimateOrientation matches against - bundled as arrow_up.png,
+// arrow_down.png, arrow_left.png, arrow_right.png under
+// GlobalConfig.TemplatesDir, the same dir/name.png convention every other
+// named UI template already follows (see internal/vision/templates).
+var arrowDirections = []struct {
+	name   string
+	dx, dy float64
+}{
+	{"arrow_up", 0, -1},
+	{"arrow_down", 0, 1},
+	{"arrow_left", -1, 0},
+	{"arrow_right", 1, 0},
+}
+
+// EstimateOrientation crops screenshot to det's bounding box and template-
+// matches the crop against each of the 4 cardinal arrow templates in
+// templatesDir, returning the best-scoring direction as a unit vector. ok
+// is false if templatesDir is empty, the crop fails, or none of the 4
+// templates score above templates.MatchThreshold - in every case the
+// caller should fall back rather than tap in an unverified direction, the
+// same contract templates.LocateTemplate itself uses.
+func EstimateOrientation(screenshot []byte, det common.Detection, templatesDir string) (dx, dy float64, ok bool) {
+	if templatesDir == "" {
+		return 0, 0, false
+	}
+
+	region, err := CropDetection(screenshot, DetectionRect(det))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	bestScore := -1.0
+	for _, d := range arrowDirections {
+		_, _, score, matched := templates.LocateTemplate(region, templatesDir, d.name)
+		if matched && score > bestScore {
+			bestScore, dx, dy, ok = score, d.dx, d.dy, true
+		}
+	}
+	return dx, dy, ok
+}
+
+// ImageBounds decodes screenshot and returns its pixel dimensions, for a
+// caller that needs to clamp a computed tap target (e.g.
+// handleArrowOnlyAction's center + k*direction) to the screen.
+func ImageBounds(screenshot []byte) (width, height int, err error) {
+	img, _, err := image.Decode(bytes.NewReader(screenshot))
+	if err != nil {
+		return 0, 0, fmt.Errorf("error decoding screenshot: %w", err)
+	}
+	bounds := img.Bounds()
+	return bounds.Dx(), bounds.Dy(), nil
+}
@@ -0,0 +1,177 @@
+package vision
+
+import (
+	"bytes"
+	"image"
+	_ "image/png" // registers the PNG decoder used by dHash
+	"roborok/internal/common"
+	"roborok/internal/metrics"
+	"sync"
+	"time"
+)
+
+const (
+	// cacheTTL bounds how long a cached frame can be reused, so a stale
+	// result can never persist past a stuck/frozen screen for long.
+	cacheTTL = 10 * time.Second
+
+	// hammingThreshold is how many differing bits two dHashes may have and
+	// still be considered "the same frame" (screencap re-encoding and minor
+	// animation noise can flip a handful of bits even on an unchanged screen).
+	hammingThreshold = 2
+
+	// cacheCapacity bounds how many recent frames cachingDetector remembers.
+	// A single entry only catches "the exact same frame as last time"; a
+	// handler that alternates between a couple of screens (e.g. polling a
+	// dialog that hasn't finished animating in) would miss every other
+	// frame with just one slot. Small because this is a short-TTL
+	// near-duplicate cache, not a general detection store.
+	cacheCapacity = 8
+)
+
+// cacheEntry holds a previously computed detection result for a frame hash.
+type cacheEntry struct {
+	hash       uint64
+	gameView   string
+	detections []common.Detection
+	expiresAt  time.Time
+}
+
+// cachingDetector wraps another Detector and skips inference entirely when
+// the current screenshot's perceptual hash (dHash) is within hammingThreshold
+// bits of one of the last cacheCapacity analyzed frames. This is common
+// while the bot is paused or waiting on an animation, where consecutive
+// screenshots are identical or near-identical, and also catches a handler
+// that alternates between a couple of screens rather than sitting on just
+// one.
+//
+// entries is ordered most-recently-used first; a hit is moved to the front
+// so a frame that keeps recurring (e.g. two alternating dialog states)
+// stays cached instead of being evicted by whatever's merely come in most
+// recently.
+type cachingDetector struct {
+	inner Detector
+
+	mu      sync.Mutex
+	entries []*cacheEntry
+}
+
+func newCachingDetector(inner Detector) *cachingDetector {
+	return &cachingDetector{inner: inner}
+}
+
+// Analyze implements Detector.
+func (c *cachingDetector) Analyze(screenshot []byte) (string, []common.Detection, error) {
+	hash, hashErr := dHash(screenshot)
+
+	if hashErr == nil {
+		if cached, hit := c.lookup(hash); hit {
+			metrics.Default.IncVisionCacheHits()
+			return cached.gameView, cached.detections, nil
+		}
+	}
+
+	gameView, detections, err := c.inner.Analyze(screenshot)
+	if err != nil {
+		return gameView, detections, err
+	}
+
+	if hashErr == nil {
+		c.store(hash, gameView, detections)
+	}
+
+	return gameView, detections, nil
+}
+
+func (c *cachingDetector) lookup(hash uint64) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for i, e := range c.entries {
+		if now.After(e.expiresAt) {
+			continue
+		}
+		if hammingDistance(hash, e.hash) > hammingThreshold {
+			continue
+		}
+		if i > 0 {
+			c.entries = append(c.entries[:i], c.entries[i+1:]...)
+			c.entries = append([]*cacheEntry{e}, c.entries...)
+		}
+		return e, true
+	}
+	return nil, false
+}
+
+func (c *cachingDetector) store(hash uint64, gameView string, detections []common.Detection) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{
+		hash:       hash,
+		gameView:   gameView,
+		detections: detections,
+		expiresAt:  time.Now().Add(cacheTTL),
+	}
+
+	c.entries = append([]*cacheEntry{entry}, c.entries...)
+	if len(c.entries) > cacheCapacity {
+		c.entries = c.entries[:cacheCapacity]
+	}
+}
+
+// dHash computes a 64-bit difference hash of the image: it's shrunk to a
+// 9x8 grayscale grid and each pixel is compared to its right-hand neighbor,
+// producing one bit per comparison. Near-duplicate screenshots (re-encoded
+// PNG, a blinking cursor, a subtly animated icon) hash to a value only a
+// few bits away from each other, unlike a cryptographic hash.
+func dHash(screenshot []byte) (uint64, error) {
+	img, _, err := image.Decode(bytes.NewReader(screenshot))
+	if err != nil {
+		return 0, err
+	}
+
+	const (
+		cols = 9
+		rows = 8
+	)
+
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	gray := make([]float64, cols*rows)
+	for row := 0; row < rows; row++ {
+		srcY := bounds.Min.Y + row*height/rows
+		for col := 0; col < cols; col++ {
+			srcX := bounds.Min.X + col*width/cols
+			r, g, b, _ := img.At(srcX, srcY).RGBA()
+			// Standard luma weighting; inputs are 16-bit per channel.
+			gray[row*cols+col] = 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+		}
+	}
+
+	var hash uint64
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols-1; col++ {
+			bit := uint64(0)
+			if gray[row*cols+col] > gray[row*cols+col+1] {
+				bit = 1
+			}
+			hash = hash<<1 | bit
+		}
+	}
+
+	return hash, nil
+}
+
+func hammingDistance(a, b uint64) int {
+	x := a ^ b
+	count := 0
+	for x != 0 {
+		count++
+		x &= x - 1
+	}
+	return count
+}
@@ -0,0 +1,195 @@
+package vision
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"roborok/internal/common"
+	"roborok/internal/logging"
+	"roborok/internal/utils"
+	"sort"
+	"sync"
+	"time"
+)
+
+// viewMargin is how far the top-scoring view's score must lead the
+// runner-up's for classifyView to commit to it. A count-based classifier
+// silently defaults ties and near-ties to "city", which hides exactly the
+// ambiguous frames (mid-transition, a screen the weight table doesn't
+// cover well) that matter most - those should come back "unknown" instead,
+// so a caller can request a fresh screenshot rather than act on a guess.
+//
+// Kept well below common.MinConfidence (0.7): a single weight-1 indicator
+// detected above that confidence already scores >= 0.7 against a runner-up
+// of 0, and a routine frame showing only one building (e.g. zoomed in on
+// just city_hall) still needs to classify cleanly rather than tripping
+// "unknown" just for having a single detection.
+const viewMargin = 0.5
+
+// ViewScore is one class's signed contribution to a view's score: seeing
+// Class at confidence c adds Weight*c to View's running total. A class can
+// appear more than once (e.g. contributing positively to one view and
+// negatively to another) since weights are read as a flat list, not a
+// one-class-one-view map.
+type ViewScore struct {
+	Class  string  `json:"class"`
+	View   string  `json:"view"`
+	Weight float64 `json:"weight"`
+}
+
+// viewWeights is a ViewScore table indexed by class for fast lookup during
+// scoring.
+type viewWeights map[string][]ViewScore
+
+// defaultViewWeights is used when GlobalConfig.ViewWeightsPath is unset,
+// carrying forward the same signal the old indicator-counting
+// DetermineGameView used: on_field/in_city are unambiguous so they carry a
+// large weight, the rest are a weaker vote each.
+var defaultViewWeights = viewWeights{
+	"on_field":                     {{Class: "on_field", View: "field", Weight: 5}},
+	"in_city":                      {{Class: "in_city", View: "city", Weight: 5}},
+	"city_hall":                    {{Class: "city_hall", View: "city", Weight: 1}},
+	"city_hall_upgradeable":        {{Class: "city_hall_upgradeable", View: "city", Weight: 1}},
+	"barracks":                     {{Class: "barracks", View: "city", Weight: 1}},
+	"barracks_upgradeable":         {{Class: "barracks_upgradeable", View: "city", Weight: 1}},
+	"barracks_upgradeable_idle":    {{Class: "barracks_upgradeable_idle", View: "city", Weight: 1}},
+	"farm":                         {{Class: "farm", View: "city", Weight: 1}},
+	"builders_hut":                 {{Class: "builders_hut", View: "city", Weight: 1}},
+	"builders_hut_idle":            {{Class: "builders_hut_idle", View: "city", Weight: 1}},
+	"tavern":                       {{Class: "tavern", View: "city", Weight: 1}},
+	"tavern_upgradeable_clickable": {{Class: "tavern_upgradeable_clickable", View: "city", Weight: 1}},
+	"return_to_city_button":        {{Class: "return_to_city_button", View: "map", Weight: 1}},
+	"world_map":                    {{Class: "world_map", View: "map", Weight: 1}},
+	"barbarian":                    {{Class: "barbarian", View: "map", Weight: 1}},
+	"resource_node":                {{Class: "resource_node", View: "map", Weight: 1}},
+}
+
+// LoadViewWeights reads a viewWeights table from the JSON file at path: a
+// flat array of ViewScore objects. There's no go.mod to vendor a YAML
+// library into this tree, so this is JSON, the same choice build-order.go
+// and uilocator.LoadTable already made for their own config-like input
+// files.
+func LoadViewWeights(path string) (viewWeights, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading view weights %s: %w", path, err)
+	}
+
+	var scores []ViewScore
+	if err := json.Unmarshal(data, &scores); err != nil {
+		return nil, fmt.Errorf("error parsing view weights %s: %w", path, err)
+	}
+
+	table := make(viewWeights, len(scores))
+	for _, s := range scores {
+		table[s.Class] = append(table[s.Class], s)
+	}
+	return table, nil
+}
+
+// cachedViewWeights caches the table loaded from GlobalConfig.ViewWeightsPath,
+// mirroring internal/actions/locators.go's mtime-based reload caching so an
+// override file is only re-read once it actually changes.
+var (
+	viewWeightsMu     sync.Mutex
+	cachedViewWeights *cachedViewWeightsTable
+)
+
+type cachedViewWeightsTable struct {
+	table   viewWeights
+	modTime time.Time
+}
+
+// currentViewWeights returns GlobalConfig.ViewWeightsPath's table if
+// configured and loadable, otherwise defaultViewWeights. A broken or
+// unreadable override file is logged and ignored rather than propagated,
+// so a config typo degrades to the built-in table instead of breaking
+// view classification entirely.
+func currentViewWeights() viewWeights {
+	path := utils.GetConfig().Global.ViewWeightsPath
+	if path == "" {
+		return defaultViewWeights
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		logging.Emit(logging.Warning, nil, "view weights file %s unavailable, using built-in table: %v", path, err)
+		return defaultViewWeights
+	}
+
+	viewWeightsMu.Lock()
+	defer viewWeightsMu.Unlock()
+
+	if cachedViewWeights != nil && !info.ModTime().After(cachedViewWeights.modTime) {
+		return cachedViewWeights.table
+	}
+
+	table, err := LoadViewWeights(path)
+	if err != nil {
+		logging.Emit(logging.Warning, nil, "error loading view weights file %s, using built-in table: %v", path, err)
+		return defaultViewWeights
+	}
+
+	cachedViewWeights = &cachedViewWeightsTable{table: table, modTime: info.ModTime()}
+	return table
+}
+
+// classifyView scores detections against currentViewWeights and returns the
+// winning view, or "unknown" if the top view doesn't lead the runner-up by
+// at least viewMargin - emitting a Warning event with both scores so an
+// operator watching logging.DefaultBus can see which frames the classifier
+// is unsure about, instead of the old behavior of silently guessing "city".
+func classifyView(detections []common.Detection) string {
+	scores := scoreViews(detections, currentViewWeights())
+	view, top, runnerUp := topTwoViews(scores)
+
+	if view == "" || top-runnerUp < viewMargin {
+		logging.Emit(logging.Warning, logging.Fields{"task": "determine_game_view"},
+			"ambiguous game view: top candidate %q scored %.2f, runner-up %.2f (margin %.2f < required %.2f)",
+			view, top, runnerUp, top-runnerUp, viewMargin)
+		return "unknown"
+	}
+	return view
+}
+
+// scoreViews sums Weight*Confidence for every detection whose class appears
+// in weights, per view.
+func scoreViews(detections []common.Detection, weights viewWeights) map[string]float64 {
+	scores := make(map[string]float64)
+	for _, det := range detections {
+		for _, score := range weights[det.Class] {
+			scores[score.View] += score.Weight * det.Confidence
+		}
+	}
+	return scores
+}
+
+// topTwoViews returns the highest-scoring view and its score, and the
+// runner-up's score (0 if there's only one candidate view). Ties are broken
+// alphabetically by view name so the result is deterministic regardless of
+// map iteration order.
+func topTwoViews(scores map[string]float64) (view string, top, runnerUp float64) {
+	type candidate struct {
+		view  string
+		score float64
+	}
+
+	candidates := make([]candidate, 0, len(scores))
+	for v, s := range scores {
+		candidates = append(candidates, candidate{v, s})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].view < candidates[j].view
+	})
+
+	if len(candidates) == 0 {
+		return "", 0, 0
+	}
+	if len(candidates) == 1 {
+		return candidates[0].view, candidates[0].score, 0
+	}
+	return candidates[0].view, candidates[0].score, candidates[1].score
+}
@@ -0,0 +1,125 @@
+package vision
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"roborok/internal/common"
+	"sort"
+)
+
+// LabeledSample is one labeled fixture TestClassifierOnCorpus reads: a
+// recorded detection set and the view a human labeled it as, the same
+// shape replay.Frame's Detections/GameView fields carry, but standalone so
+// a corpus can be hand-curated without capturing a full session archive.
+type LabeledSample struct {
+	Detections   []common.Detection `json:"detections"`
+	ExpectedView string             `json:"expected_view"`
+}
+
+// ViewStats accumulates one view's outcomes across a corpus run: how many
+// samples labeled this view were correctly classified as it (true
+// positives), how many samples of some other view were wrongly classified
+// as this one (false positives), and how many samples labeled this view
+// were classified as something else (false negatives).
+type ViewStats struct {
+	TruePositives  int
+	FalsePositives int
+	FalseNegatives int
+}
+
+// Precision is TruePositives / (TruePositives + FalsePositives), or 0 if
+// the view was never predicted.
+func (s ViewStats) Precision() float64 {
+	denom := s.TruePositives + s.FalsePositives
+	if denom == 0 {
+		return 0
+	}
+	return float64(s.TruePositives) / float64(denom)
+}
+
+// Recall is TruePositives / (TruePositives + FalseNegatives), or 0 if the
+// view never appeared in the corpus.
+func (s ViewStats) Recall() float64 {
+	denom := s.TruePositives + s.FalseNegatives
+	if denom == 0 {
+		return 0
+	}
+	return float64(s.TruePositives) / float64(denom)
+}
+
+// CorpusReport is TestClassifierOnCorpus's result: overall accuracy plus
+// per-view precision/recall, so a weight-table change's effect on, say,
+// "unknown" recall can be seen separately from its effect on "city"
+// precision.
+type CorpusReport struct {
+	Samples    int
+	Correct    int
+	PerView    map[string]*ViewStats
+	Mismatches []CorpusMismatch
+}
+
+// CorpusMismatch records one sample where DetermineGameView disagreed with
+// its expected_view label, for a caller that wants to print or inspect the
+// specific misclassified fixtures rather than just the aggregate stats.
+type CorpusMismatch struct {
+	File          string
+	ExpectedView  string
+	PredictedView string
+}
+
+// TestClassifierOnCorpus runs DetermineGameView against every *.json file
+// in dir (each a LabeledSample) and reports precision/recall per view, so
+// a weight-table edit's effect on real-world accuracy can be checked before
+// it ships rather than discovered from a misclassified frame in
+// production.
+func TestClassifierOnCorpus(dir string) (*CorpusReport, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("error globbing corpus dir %s: %w", dir, err)
+	}
+	sort.Strings(paths)
+
+	report := &CorpusReport{PerView: make(map[string]*ViewStats)}
+
+	statsFor := func(view string) *ViewStats {
+		s, ok := report.PerView[view]
+		if !ok {
+			s = &ViewStats{}
+			report.PerView[view] = s
+		}
+		return s
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading corpus sample %s: %w", path, err)
+		}
+
+		var sample LabeledSample
+		if err := json.Unmarshal(data, &sample); err != nil {
+			return nil, fmt.Errorf("error parsing corpus sample %s: %w", path, err)
+		}
+
+		predicted := DetermineGameView(sample.Detections)
+		report.Samples++
+
+		if predicted == sample.ExpectedView {
+			report.Correct++
+			statsFor(predicted).TruePositives++
+			continue
+		}
+
+		statsFor(predicted).FalsePositives++
+		statsFor(sample.ExpectedView).FalseNegatives++
+		report.Mismatches = append(report.Mismatches, CorpusMismatch{
+			File:          path,
+			ExpectedView:  sample.ExpectedView,
+			PredictedView: predicted,
+		})
+	}
+
+	return report, nil
+}
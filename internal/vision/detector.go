@@ -0,0 +1,88 @@
+package vision
+
+import (
+	"roborok/internal/common"
+	"roborok/internal/logging"
+	"roborok/internal/utils"
+)
+
+// Detector analyzes a screenshot and returns the current game view
+// ("city", "field"/"map", etc.) along with the detected objects. It
+// abstracts over where inference actually runs, so manager.RunGameplayIteration
+// doesn't need to know whether a frame was classified by the Roboflow API,
+// a local ONNX/TFLite model, or a hybrid of the two.
+//
+// This is this tree's pluggable inference seam - NewDetector already
+// selects between three implementations by config (ResilientDetector,
+// ONNXDetector, HybridDetector), and FakeDetector is a fourth for tests and
+// fixtures. NonMaxSuppression (see nms.go) is the shared per-class dedup
+// pass available to any of them. Two things stay out of scope rather than
+// forced: a ctx.Context parameter (nothing on the call path into Analyze -
+// CaptureAndDetect, the task handlers - carries one yet, so adding it here
+// alone wouldn't plumb through anywhere) and a real ONNX Runtime backend
+// (see ONNXDetector's doc comment: no go.mod in this tree means no CGO
+// binding like yalue/onnxruntime_go can be vendored). Per-class label maps
+// also aren't modeled separately from common.Detection.Class, which already
+// is the label.
+type Detector interface {
+	Analyze(screenshot []byte) (gameView string, detections []common.Detection, err error)
+}
+
+// RoboflowDetector sends every frame to the hosted Roboflow API.
+type RoboflowDetector struct {
+	APIKey  string
+	ModelID string
+}
+
+// Analyze implements Detector.
+func (d *RoboflowDetector) Analyze(screenshot []byte) (string, []common.Detection, error) {
+	return AnalyzeGameState(screenshot, d.APIKey, d.ModelID)
+}
+
+// newRoboflowBackend builds the Roboflow-calling Detector shared by the
+// "roboflow" and "hybrid" backends: a ResilientDetector calling
+// AnalyzeGameState with per-key rate limiting, retry, and a circuit
+// breaker that fails over to an ONNXDetector (the local backend) once
+// Roboflow's error rate crosses its threshold.
+//
+// In "hybrid" mode this means a frame that HybridDetector already ran
+// through its own Local ONNXDetector (and rejected as low-confidence)
+// pays a second, separate ONNX inference as this backend's Fallback if
+// Roboflow then also fails - redundant CPU work, but only during a
+// Roboflow outage, and still strictly better than HybridDetector's
+// alternative of returning a bare error with no result at all.
+func newRoboflowBackend(cfg *utils.Config) Detector {
+	return NewResilientDetector(
+		cfg.Global.RoboflowAPIKey,
+		cfg.Global.RoboflowGameplayModel,
+		&ONNXDetector{ModelPath: cfg.Gameplay.ONNXModelPath},
+		cfg.Global.RoboflowCallsPerMinutePerKey,
+	)
+}
+
+// NewDetector builds the Detector selected by cfg.Gameplay.VisionBackend
+// ("roboflow", "onnx", or "hybrid"; empty defaults to "roboflow"), wrapped
+// in a caching layer keyed by a perceptual hash of the screenshot so
+// repeated/near-identical frames (paused, waiting on an animation) skip
+// inference entirely.
+func NewDetector(cfg *utils.Config) Detector {
+	var base Detector
+
+	switch cfg.Gameplay.VisionBackend {
+	case "onnx":
+		base = &ONNXDetector{ModelPath: cfg.Gameplay.ONNXModelPath}
+	case "hybrid":
+		base = &HybridDetector{
+			Local:               &ONNXDetector{ModelPath: cfg.Gameplay.ONNXModelPath},
+			Remote:              newRoboflowBackend(cfg),
+			ConfidenceThreshold: common.MinConfidence,
+		}
+	case "roboflow", "":
+		base = newRoboflowBackend(cfg)
+	default:
+		logging.Emit(logging.Warning, nil, "Unknown vision_backend %q, falling back to roboflow", cfg.Gameplay.VisionBackend)
+		base = newRoboflowBackend(cfg)
+	}
+
+	return newCachingDetector(base)
+}
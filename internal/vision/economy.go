@@ -0,0 +1,23 @@
+package vision
+
+import (
+	"roborok/internal/common"
+	"roborok/internal/state"
+)
+
+// ExtractEconomy reads an instance's resource income, reserves, and
+// capacity off the top resource bar for a single tick of
+// state.Economy. detections are bounding-box/class results like any other
+// Detector output (see Detector) - they carry no digits, so turning them
+// into the actual numbers printed in the resource bar needs an OCR pass
+// this tree doesn't have: no OCR library is vendored and there's no go.mod
+// to add one to, the same constraint noted in internal/planner's doc
+// comment about plan files being JSON instead of YAML. ExtractEconomy is the
+// seam a real OCR pass would fill in - it always returns an empty
+// state.Economy and false for now, so planner.Plan.NextWithEconomy's
+// scoring is ready to use live numbers the moment this returns true, and
+// callers that want economy-aware scoring before then can populate
+// state.GameState.Economy some other way.
+func ExtractEconomy(detections []common.Detection) (state.Economy, bool) {
+	return state.Economy{}, false
+}
@@ -0,0 +1,33 @@
+package vision
+
+import (
+	"fmt"
+	"roborok/internal/common"
+)
+
+// FakeDetector is a canned Detector for tests and fixtures: it ignores the
+// screenshot bytes entirely and returns whatever Responses says to return
+// next, in order. It's the in-memory counterpart to internal/replay.Player,
+// which does the same job but reads its canned responses from a recorded
+// session archive instead of being built by hand in code.
+type FakeDetector struct {
+	Responses []FakeDetectorResponse
+	next      int
+}
+
+// FakeDetectorResponse is one canned Analyze result.
+type FakeDetectorResponse struct {
+	GameView   string
+	Detections []common.Detection
+	Err        error
+}
+
+// Analyze implements Detector.
+func (d *FakeDetector) Analyze(screenshot []byte) (string, []common.Detection, error) {
+	if d.next >= len(d.Responses) {
+		return "", nil, fmt.Errorf("fake detector: no more canned responses (%d configured)", len(d.Responses))
+	}
+	resp := d.Responses[d.next]
+	d.next++
+	return resp.GameView, resp.Detections, resp.Err
+}
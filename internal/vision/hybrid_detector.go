@@ -0,0 +1,47 @@
+package vision
+
+import (
+	"roborok/internal/common"
+	"roborok/internal/logging"
+)
+
+// HybridDetector runs Local first and only falls back to Remote when Local
+// errors or returns a frame where the average detection confidence is
+// below ConfidenceThreshold. This is the common case once a local model is
+// available: most frames are confidently classified on-device, and only
+// ambiguous ones pay the Roboflow round-trip.
+type HybridDetector struct {
+	Local               Detector
+	Remote              Detector
+	ConfidenceThreshold float64
+}
+
+// Analyze implements Detector.
+func (d *HybridDetector) Analyze(screenshot []byte) (string, []common.Detection, error) {
+	gameView, detections, err := d.Local.Analyze(screenshot)
+	if err == nil && averageConfidence(detections) >= d.ConfidenceThreshold {
+		return gameView, detections, nil
+	}
+
+	if err != nil {
+		logging.Emit(logging.Warning, nil, "Local detector failed, falling back to remote: %v", err)
+	} else {
+		logging.Emit(logging.Warning, nil, "Local detector returned low-confidence frame, falling back to remote")
+	}
+
+	return d.Remote.Analyze(screenshot)
+}
+
+// averageConfidence returns the mean confidence across detections, or 0 for
+// an empty slice (treated as low-confidence so it always falls back).
+func averageConfidence(detections []common.Detection) float64 {
+	if len(detections) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, det := range detections {
+		sum += det.Confidence
+	}
+	return sum / float64(len(detections))
+}
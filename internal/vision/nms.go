@@ -0,0 +1,60 @@
+package vision
+
+import (
+	"roborok/internal/common"
+	"sort"
+)
+
+// IntersectionOverUnion returns the IoU of two detections' bounding boxes
+// (X, Y are box centers, matching common.Detection and the Roboflow
+// response it's parsed from), 0 if they don't overlap at all.
+func IntersectionOverUnion(a, b common.Detection) float64 {
+	aLeft, aRight := a.X-a.Width/2, a.X+a.Width/2
+	aTop, aBottom := a.Y-a.Height/2, a.Y+a.Height/2
+	bLeft, bRight := b.X-b.Width/2, b.X+b.Width/2
+	bTop, bBottom := b.Y-b.Height/2, b.Y+b.Height/2
+
+	interLeft, interTop := max(aLeft, bLeft), max(aTop, bTop)
+	interRight, interBottom := min(aRight, bRight), min(aBottom, bBottom)
+	if interRight <= interLeft || interBottom <= interTop {
+		return 0
+	}
+
+	intersection := (interRight - interLeft) * (interBottom - interTop)
+	union := a.Width*a.Height + b.Width*b.Height - intersection
+	if union <= 0 {
+		return 0
+	}
+	return intersection / union
+}
+
+// NonMaxSuppression drops lower-confidence detections that overlap a
+// higher-confidence detection of the same class by more than iouThreshold,
+// the standard per-class NMS pass every detector backend (Roboflow, ONNX,
+// Hybrid) needs to collapse duplicate boxes around the same object into one.
+// detections is left unmodified; the result is ordered by descending
+// confidence.
+func NonMaxSuppression(detections []common.Detection, iouThreshold float64) []common.Detection {
+	if len(detections) == 0 {
+		return nil
+	}
+
+	sorted := make([]common.Detection, len(detections))
+	copy(sorted, detections)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Confidence > sorted[j].Confidence })
+
+	kept := make([]common.Detection, 0, len(sorted))
+	for _, candidate := range sorted {
+		suppressed := false
+		for _, k := range kept {
+			if k.Class == candidate.Class && IntersectionOverUnion(k, candidate) > iouThreshold {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			kept = append(kept, candidate)
+		}
+	}
+	return kept
+}
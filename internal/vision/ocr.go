@@ -0,0 +1,69 @@
+package vision
+
+import "strings"
+
+// ReadRegion reads the text printed inside a named UI region of screenshot
+// (e.g. "upgrade_cost", "resource_bar") - the screen-text analogue of
+// CaptureAndDetect's bounding-box/class detections, which carry no digits
+// or labels of their own. A real implementation needs an OCR engine
+// (Tesseract/PaddleOCR via CGo, or a local HTTP sidecar); this tree vendors
+// neither and has no go.mod to add one to, the same constraint noted in
+// ExtractEconomy's doc comment. ReadRegion is the seam a real OCR pass
+// would fill in - it always returns "" and false for now, so callers like
+// actions.preflightUpgradeCheck degrade to a no-op until it does, rather
+// than blocking on infrastructure this tree can't build.
+func ReadRegion(screenshot []byte, region string) (string, bool) {
+	return "", false
+}
+
+// FuzzyEqual reports whether a and b match after folding case, tolerating
+// up to maxDistance character edits (insertions, deletions, substitutions)
+// between them - enough slack to treat OCR noise like "Fo0d" or "G0ld" as
+// the label it was meant to be without that slack being wide enough to
+// confuse genuinely different labels. Unlike ReadRegion, this needs no
+// external OCR backend to implement for real - it's used by
+// actions.parseUpgradeCost the moment ReadRegion starts returning text.
+func FuzzyEqual(a, b string, maxDistance int) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if a == b {
+		return true
+	}
+	return levenshteinDistance(a, b) <= maxDistance
+}
+
+// levenshteinDistance returns the minimum number of single-character
+// insertions, deletions, and substitutions needed to turn a into b.
+func levenshteinDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	m := a
+	if b < m {
+		m = b
+	}
+	if c < m {
+		m = c
+	}
+	return m
+}
@@ -0,0 +1,29 @@
+package vision
+
+import (
+	"fmt"
+	"roborok/internal/common"
+)
+
+// ONNXDetector runs inference against a local ONNX/TFLite model instead of
+// calling out to the Roboflow API, cutting per-iteration latency and API
+// cost for the per-second build-order polling loop.
+//
+// This tree has no vendored ONNX/TFLite runtime (that requires a CGO
+// binding such as onnxruntime_go, which isn't available in this sandbox),
+// so Analyze returns a clear error rather than silently no-op'ing. Once a
+// runtime is vendored, swap the body of Analyze to load ModelPath once and
+// run inference, keeping the Detector signature unchanged so HybridDetector
+// and the config-driven factory in NewDetector need no changes.
+type ONNXDetector struct {
+	ModelPath string
+}
+
+// Analyze implements Detector.
+func (d *ONNXDetector) Analyze(screenshot []byte) (string, []common.Detection, error) {
+	if d.ModelPath == "" {
+		return "", nil, fmt.Errorf("onnx detector: no model_path configured (gameplay.onnx_model_path)")
+	}
+
+	return "", nil, fmt.Errorf("onnx detector: local inference not available in this build (no ONNX/TFLite runtime vendored); configure vision_backend \"hybrid\" to fall back to Roboflow")
+}
@@ -0,0 +1,338 @@
+package vision
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"roborok/internal/common"
+	"roborok/internal/logging"
+	"roborok/internal/metrics"
+	"sync"
+	"time"
+)
+
+const (
+	// resilientMaxRetries is how many additional attempts ResilientDetector
+	// makes against Roboflow after an initial retryable failure, before
+	// giving up and falling over to Fallback.
+	resilientMaxRetries = 3
+
+	// backoffBase and backoffMax bound the exponential backoff delay
+	// between retries when the Roboflow response didn't include a
+	// Retry-After header to honor directly.
+	backoffBase = 500 * time.Millisecond
+	backoffMax  = 8 * time.Second
+
+	// breakerWindow is how many of the most recent Roboflow attempts the
+	// circuit breaker's failure rate is computed over.
+	breakerWindow = 20
+
+	// breakerMinSamples keeps the breaker from tripping on a handful of
+	// unlucky requests right after startup, before breakerWindow has
+	// actually filled up.
+	breakerMinSamples = 5
+
+	// breakerFailureThreshold is the fraction of the last breakerWindow
+	// attempts that must have failed for the breaker to open.
+	breakerFailureThreshold = 0.5
+
+	// breakerCooldown is how long the breaker stays open (serving Fallback
+	// directly, without attempting Roboflow at all) before letting a
+	// single probe request through to test recovery.
+	breakerCooldown = 30 * time.Second
+)
+
+// tokenBucket is a simple token-bucket rate limiter: it holds up to
+// capacity tokens, refilled continuously at refillPerSecond, and blocks a
+// caller in wait until one token is available. Unlike
+// internal/scheduler.Scheduler's refillVision (a fixed-interval grant loop
+// running in its own goroutine), it refills lazily on each call instead of
+// running a ticker, since one exists per Roboflow API key and most
+// deployments only use one or two keys.
+type tokenBucket struct {
+	mu              sync.Mutex
+	tokens          float64
+	capacity        float64
+	refillPerSecond float64
+	last            time.Time
+
+	// perMinute is the rate this bucket was configured with, so
+	// rateLimiterFor can tell a config reload changed it and replace the
+	// bucket instead of silently keeping the old rate for the process's
+	// remaining lifetime.
+	perMinute int
+}
+
+func newTokenBucket(perMinute int) *tokenBucket {
+	rate := float64(perMinute) / 60
+	return &tokenBucket{
+		tokens:          float64(perMinute),
+		capacity:        float64(perMinute),
+		refillPerSecond: rate,
+		last:            time.Now(),
+		perMinute:       perMinute,
+	}
+}
+
+// wait blocks until a token is available, then consumes it. There's no
+// ctx.Context to cancel on - see Detector's doc comment on why nothing on
+// this call path carries one yet - so a caller that wants a bound on how
+// long it waits has none; in practice the bucket's capacity tracks the
+// configured per-minute rate, so a wait is bounded by that rate.
+func (b *tokenBucket) wait() {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.refillPerSecond)
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return
+		}
+
+		deficit := 1 - b.tokens
+		sleep := time.Duration(deficit / b.refillPerSecond * float64(time.Second))
+		b.mu.Unlock()
+		time.Sleep(sleep)
+	}
+}
+
+// rateLimiters holds one tokenBucket per Roboflow API key, so two
+// instances (or a tutorial/gameplay model split) configured with different
+// keys get independent budgets rather than contending over a single shared
+// one.
+var (
+	rateLimitersMu sync.Mutex
+	rateLimiters   = make(map[string]*tokenBucket)
+)
+
+// rateLimiterFor returns the shared tokenBucket for apiKey, creating it on
+// first use and replacing it if a config reload changed perMinute for this
+// key (manager.go rebuilds the Detector, and so calls NewResilientDetector
+// again, whenever the config is reloaded). perMinute <= 0 means no limit -
+// returns nil, and callers treat a nil limiter as "don't wait".
+func rateLimiterFor(apiKey string, perMinute int) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	rl, ok := rateLimiters[apiKey]
+	if !ok || rl.perMinute != perMinute {
+		rl = newTokenBucket(perMinute)
+		rateLimiters[apiKey] = rl
+	}
+	return rl
+}
+
+// circuitBreaker tracks the success/failure of the last breakerWindow
+// Roboflow attempts and opens once the failure rate crosses
+// breakerFailureThreshold, so a Roboflow outage doesn't cost every
+// instance resilientMaxRetries failed round-trips per frame for
+// breakerCooldown's duration - it opens once and every instance falls
+// straight to Fallback until the cooldown elapses.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	results  []bool
+	pos      int
+	filled   int
+	open     bool
+	openedAt time.Time
+
+	// probing is set while one caller's recovery probe is in flight after
+	// the cooldown elapses, so concurrent callers (every instance shares
+	// one ResilientDetector per backend) don't all pile onto Roboflow at
+	// once the moment the cooldown ends - only the probing call's record()
+	// decides whether the breaker actually closes.
+	probing bool
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{results: make([]bool, breakerWindow)}
+}
+
+// allow reports whether a Roboflow attempt should be made: true if the
+// breaker is closed, or if it's open, the cooldown has elapsed, and no
+// other caller is already probing - exactly one caller gets to test
+// recovery at a time; every other concurrent caller keeps getting Fallback
+// until that probe's outcome is recorded.
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if !cb.open {
+		return true
+	}
+	if time.Since(cb.openedAt) < breakerCooldown || cb.probing {
+		return false
+	}
+	cb.probing = true
+	return true
+}
+
+// record logs one Roboflow attempt's outcome. While the breaker is open,
+// the only attempt that can reach here is the single probe allow() just
+// let through: success closes the breaker and clears its window so it
+// starts clean; failure restarts the cooldown. While closed, it appends to
+// the rolling window and opens the breaker once the failure rate crosses
+// breakerFailureThreshold.
+func (cb *circuitBreaker) record(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.open {
+		cb.probing = false
+		if success {
+			cb.open = false
+			cb.pos, cb.filled = 0, 0
+		} else {
+			cb.openedAt = time.Now()
+		}
+		return
+	}
+
+	cb.results[cb.pos] = success
+	cb.pos = (cb.pos + 1) % len(cb.results)
+	if cb.filled < len(cb.results) {
+		cb.filled++
+	}
+
+	if cb.filled < breakerMinSamples {
+		return
+	}
+
+	failures := 0
+	for i := 0; i < cb.filled; i++ {
+		if !cb.results[i] {
+			failures++
+		}
+	}
+	if float64(failures)/float64(cb.filled) >= breakerFailureThreshold {
+		cb.open = true
+		cb.openedAt = time.Now()
+	}
+}
+
+// ResilientDetector wraps the hosted Roboflow API with a per-key rate
+// limiter, retry with backoff, and a circuit breaker that fails over to
+// Fallback (normally an ONNXDetector - the local backend) once Roboflow's
+// error rate crosses breakerFailureThreshold. NewDetector builds one of
+// these for the "roboflow" and "hybrid" backends; it's the direct client
+// wrapper around SendToRoboflow, distinct from internal/scheduler's
+// process-wide vision-call admission budget (see
+// GlobalConfig.RoboflowCallsPerMinutePerKey's doc comment for how the two
+// relate).
+type ResilientDetector struct {
+	APIKey  string
+	ModelID string
+
+	// Fallback serves frames while the circuit breaker is open, or once a
+	// Roboflow request has exhausted its retries.
+	Fallback Detector
+
+	limiter *tokenBucket
+	breaker *circuitBreaker
+}
+
+// NewResilientDetector builds a ResilientDetector for apiKey/modelID,
+// falling back to fallback. ratePerMinute <= 0 means no per-key rate limit.
+func NewResilientDetector(apiKey, modelID string, fallback Detector, ratePerMinute int) *ResilientDetector {
+	return &ResilientDetector{
+		APIKey:   apiKey,
+		ModelID:  modelID,
+		Fallback: fallback,
+		limiter:  rateLimiterFor(apiKey, ratePerMinute),
+		breaker:  newCircuitBreaker(),
+	}
+}
+
+// Analyze implements Detector.
+func (d *ResilientDetector) Analyze(screenshot []byte) (string, []common.Detection, error) {
+	if !d.breaker.allow() {
+		metrics.Default.IncVisionRequests(d.ModelID, "fallback")
+		return d.Fallback.Analyze(screenshot)
+	}
+
+	// Check the perceptual-hash cache (roboflow_cache.go) before the rate
+	// limiter, not after: a cache hit never reaches Roboflow, so it
+	// shouldn't also pay the per-key rate limiter's wait - otherwise a
+	// cache-heavy run (e.g. replaying a recorded session) would be
+	// throttled as if every frame were a real API call.
+	if hash, hashErr := dHash(screenshot); hashErr == nil {
+		ensureRoboflowCacheLoaded(d.ModelID)
+		if cached, hit := lookupRoboflowCache(hash, d.ModelID); hit {
+			recordRoboflowCacheResult(true)
+			detections := respToDetections(cached)
+			// Not an IncVisionRequests call: that counter is "inference
+			// attempts" served by roboflow/error/fallback, and a cache hit
+			// never reaches Roboflow. vision.Stats() is the hit/miss source
+			// of truth for this cache.
+			return DetermineGameView(detections), detections, nil
+		}
+	}
+
+	if d.limiter != nil {
+		d.limiter.wait()
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= resilientMaxRetries; attempt++ {
+		if attempt > 0 {
+			metrics.Default.IncVisionRetries(d.ModelID)
+			time.Sleep(retryDelay(attempt, lastErr))
+		}
+
+		gameView, detections, err := AnalyzeGameState(screenshot, d.APIKey, d.ModelID)
+		if err == nil {
+			d.breaker.record(true)
+			metrics.Default.IncVisionRequests(d.ModelID, "roboflow")
+			return gameView, detections, nil
+		}
+
+		lastErr = err
+		if !isRetryable(err) {
+			break
+		}
+	}
+
+	d.breaker.record(false)
+	metrics.Default.IncVisionRequests(d.ModelID, "error")
+	logging.Emit(logging.Warning, logging.Fields{"model_id": d.ModelID},
+		"Roboflow request failed after retries, falling back to local detector: %v", lastErr)
+	return d.Fallback.Analyze(screenshot)
+}
+
+// isRetryable reports whether err is worth retrying: any non-2xx response
+// is only retryable if it was a rate limit or a server-side failure (429,
+// 5xx) - a 4xx like a bad model ID or API key will never succeed on
+// retry. A network-level error (err not a *RoboflowHTTPError at all, e.g.
+// a dropped connection) is always retryable.
+func isRetryable(err error) bool {
+	var httpErr *RoboflowHTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == 429 || httpErr.StatusCode >= 500
+	}
+	return true
+}
+
+// retryDelay picks how long to wait before retry attempt n (1-indexed): a
+// Retry-After header on lastErr takes precedence when present, otherwise
+// exponential backoff from backoffBase capped at backoffMax, with full
+// jitter so many instances retrying the same outage don't all hammer
+// Roboflow again in lockstep.
+func retryDelay(attempt int, lastErr error) time.Duration {
+	var httpErr *RoboflowHTTPError
+	if errors.As(lastErr, &httpErr) && httpErr.RetryAfter > 0 {
+		return httpErr.RetryAfter
+	}
+
+	backoff := backoffBase * time.Duration(1<<uint(attempt-1))
+	if backoff > backoffMax {
+		backoff = backoffMax
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
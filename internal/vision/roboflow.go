@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"mime/multipart"
 	"net/http"
 	"roborok/internal/common"
+	"roborok/internal/logging"
+	"roborok/internal/metrics"
+	"strconv"
 	"time"
 )
 
@@ -29,8 +31,52 @@ type RoboflowResponse struct {
 	} `json:"image"`
 }
 
+// RoboflowBaseURL is the scheme+host SendToRoboflow sends inference
+// requests to. It's a var rather than a literal so internal/testharness can
+// point it at an in-process fake server instead of the real Roboflow API.
+var RoboflowBaseURL = "https://detect.roboflow.com"
+
+// RoboflowHTTPError reports a non-200 response from the Roboflow API,
+// exposing the status code and any Retry-After header so a caller (see
+// ResilientDetector in resilient_detector.go) can tell a rate-limited or
+// transiently-failing request (429, 5xx) apart from a permanent one (e.g.
+// a bad model ID) and decide whether/how long to back off before retrying.
+type RoboflowHTTPError struct {
+	StatusCode int
+	RetryAfter time.Duration // 0 if the response carried no Retry-After header
+	Message    string
+}
+
+func (e *RoboflowHTTPError) Error() string { return e.Message }
+
+// parseRetryAfter reads a Retry-After header's delay-seconds form (the form
+// Roboflow actually sends); an HTTP-date value or a missing/unparsable
+// header both result in 0, which callers treat as "no hint given".
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
 // SendToRoboflow sends an image to Roboflow for inference
-func SendToRoboflow(imageBytes []byte, apiKey, modelID string) (*RoboflowResponse, error) {
+func SendToRoboflow(imageBytes []byte, apiKey, modelID string) (out *RoboflowResponse, err error) {
+	var servedFromCache bool
+	defer func(start time.Time) {
+		if servedFromCache {
+			return // not a real Roboflow request - would skew request-rate/latency metrics
+		}
+		status := "ok"
+		if err != nil {
+			status = "error"
+		}
+		metrics.Default.ObserveRoboflowRequest(modelID, status, time.Since(start))
+	}(time.Now())
+
 	// Add detailed logging before the API call
 	// log.Printf("Sending request to Roboflow API - Model ID: %s", modelID)
 
@@ -38,10 +84,26 @@ func SendToRoboflow(imageBytes []byte, apiKey, modelID string) (*RoboflowRespons
 	if len(apiKey) > 4 {
 		// log.Printf("API Key (first 4 chars): %s...", apiKey[:4]) // Only log first 4 chars for security
 	} else {
-		log.Printf("API Key: [TOO SHORT - POSSIBLE ERROR]")
+		logging.Emit(logging.Warning, nil, "API Key: [TOO SHORT - POSSIBLE ERROR]")
 	}
 
-	url := fmt.Sprintf("https://detect.roboflow.com/%s?api_key=%s", modelID, apiKey)
+	// hash is the screenshot's perceptual hash, used to skip the network
+	// call entirely when a near-identical frame for the same modelID was
+	// already analyzed - see roboflow_cache.go. hashErr != nil (an
+	// undecodable image) just means this call isn't cacheable; it still
+	// goes to Roboflow as before.
+	hash, hashErr := dHash(imageBytes)
+	if hashErr == nil {
+		ensureRoboflowCacheLoaded(modelID)
+		if cached, hit := lookupRoboflowCache(hash, modelID); hit {
+			recordRoboflowCacheResult(true)
+			servedFromCache = true
+			return cached, nil
+		}
+		recordRoboflowCacheResult(false)
+	}
+
+	url := fmt.Sprintf("%s/%s?api_key=%s", RoboflowBaseURL, modelID, apiKey)
 
 	// Create multipart form
 	body := &bytes.Buffer{}
@@ -78,7 +140,7 @@ func SendToRoboflow(imageBytes []byte, apiKey, modelID string) (*RoboflowRespons
 	// Check for success with more detailed error reporting
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		log.Printf("Roboflow API error - Status: %d, Response: %s", resp.StatusCode, string(bodyBytes))
+		logging.Emit(logging.Error, logging.Fields{"model_id": modelID}, "Roboflow API error - Status: %d, Response: %s", resp.StatusCode, string(bodyBytes))
 
 		// Try to parse the error message for more details
 		var errorResponse struct {
@@ -86,12 +148,16 @@ func SendToRoboflow(imageBytes []byte, apiKey, modelID string) (*RoboflowRespons
 			Detail  string `json:"detail,omitempty"`
 		}
 
+		message := fmt.Sprintf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
 		if err := json.Unmarshal(bodyBytes, &errorResponse); err == nil && errorResponse.Detail != "" {
-			return nil, fmt.Errorf("API error (status %d): %s - %s",
-				resp.StatusCode, errorResponse.Message, errorResponse.Detail)
+			message = fmt.Sprintf("API error (status %d): %s - %s", resp.StatusCode, errorResponse.Message, errorResponse.Detail)
 		}
 
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return nil, &RoboflowHTTPError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+			Message:    message,
+		}
 	}
 
 	// Parse the response
@@ -102,13 +168,17 @@ func SendToRoboflow(imageBytes []byte, apiKey, modelID string) (*RoboflowRespons
 
 	// Log detailed information about detected objects
 	if len(result.Predictions) > 0 {
-		log.Printf("Roboflow API request successful - Detected %d objects:", len(result.Predictions))
+		logging.Emit(logging.Debug, logging.Fields{"model_id": modelID}, "Roboflow API request successful - Detected %d objects:", len(result.Predictions))
 		for i, pred := range result.Predictions {
-			log.Printf("  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
+			logging.Emit(logging.Debug, logging.Fields{"model_id": modelID}, "  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
 				i+1, pred.Class, pred.Confidence, pred.X, pred.Y, pred.Width, pred.Height)
 		}
 	} else {
-		log.Printf("Roboflow API request successful - No objects detected")
+		logging.Emit(logging.Debug, logging.Fields{"model_id": modelID}, "Roboflow API request successful - No objects detected")
+	}
+
+	if hashErr == nil {
+		storeRoboflowCache(hash, modelID, &result)
 	}
 
 	return &result, nil
@@ -126,7 +196,16 @@ func AnalyzeGameState(
 		return "", nil, fmt.Errorf("failed to analyze screenshot: %w", err)
 	}
 
-	// Convert response to detections
+	detections := respToDetections(resp)
+	gameView := DetermineGameView(detections)
+	return gameView, detections, nil
+}
+
+// respToDetections converts a RoboflowResponse's predictions to
+// common.Detection, the shape the rest of the codebase works with. Shared by
+// AnalyzeGameState and ResilientDetector's cache-hit fast path so both stay
+// in sync with RoboflowResponse's fields.
+func respToDetections(resp *RoboflowResponse) []common.Detection {
 	var detections []common.Detection
 	for _, pred := range resp.Predictions {
 		detections = append(detections, common.Detection{
@@ -138,61 +217,12 @@ func AnalyzeGameState(
 			Confidence: pred.Confidence,
 		})
 	}
-
-	// Determine the view (city or map)
-	gameView := DetermineGameView(detections)
-
-	return gameView, detections, nil
+	return detections
 }
 
-// DetermineGameView determines if we're in city view, map view, or unknown view
+// DetermineGameView determines whether detections represent city, map, or
+// field view. The scoring itself lives in classifier.go - see its doc
+// comment for why this isn't a simple indicator count anymore.
 func DetermineGameView(detections []common.Detection) string {
-	// First, check explicit view indicators
-	for _, detection := range detections {
-		if detection.Class == "on_field" && detection.Confidence > common.MinConfidence {
-			return "field"
-		}
-
-		if detection.Class == "in_city" && detection.Confidence > common.MinConfidence {
-			return "city"
-		}
-	}
-
-	// If no explicit indicator, check for view-specific elements
-	cityIndicators := 0
-	mapIndicators := 0
-
-	for _, detection := range detections {
-		// City view indicators
-		if detection.Class == "city_hall" ||
-			detection.Class == "city_hall_upgradeable" ||
-			detection.Class == "barracks" ||
-			detection.Class == "barracks_upgradeable" ||
-			detection.Class == "barracks_upgradeable_idle" ||
-			detection.Class == "farm" ||
-			detection.Class == "builders_hut" ||
-			detection.Class == "builders_hut_idle" ||
-			detection.Class == "tavern" ||
-			detection.Class == "tavern_upgradeable_clickable" {
-			cityIndicators++
-		}
-
-		// Map view indicators
-		if detection.Class == "return_to_city_button" ||
-			detection.Class == "world_map" ||
-			detection.Class == "barbarian" ||
-			detection.Class == "resource_node" {
-			mapIndicators++
-		}
-	}
-
-	// Determine view based on the count of indicators
-	if cityIndicators > 0 && cityIndicators > mapIndicators {
-		return "city"
-	} else if mapIndicators > 0 {
-		return "map"
-	}
-
-	// Default to unknown if we can't determine
-	return "city"
+	return classifyView(detections)
 }
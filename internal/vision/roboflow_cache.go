@@ -0,0 +1,179 @@
+package vision
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"roborok/internal/logging"
+	"roborok/internal/utils"
+	"sync"
+	"sync/atomic"
+)
+
+// roboflowCacheCapacity bounds how many distinct frames the in-memory
+// cache remembers per model ID. Larger than cachingDetector's
+// cacheCapacity (8, see cache.go): that cache only needs to catch the last
+// few near-duplicate polls, while this one is meant to serve a whole
+// tutorial run (or replay session) from cache, so it needs to remember
+// every distinct screen the run visits.
+const roboflowCacheCapacity = 256
+
+// roboflowCacheHammingThreshold is how many differing dHash bits two
+// screenshots may have and still be served from cache. Wider than
+// cachingDetector's hammingThreshold (2) by design: this cache trades a
+// little more tolerance for visual drift (re-encoding, a blinking cursor,
+// a slightly different animation frame) for a much higher hit rate, since
+// a miss here costs a real Roboflow API call, while a miss in
+// cachingDetector only falls through to the backend it wraps (for the
+// "roboflow" and "hybrid" backends, this cache is checked next).
+const roboflowCacheHammingThreshold = 4
+
+// roboflowCacheEntry is both the in-memory cache record and the on-disk
+// spill format (see spillEntry) - one entry per distinct (modelID, hash).
+type roboflowCacheEntry struct {
+	Hash     uint64            `json:"hash"`
+	ModelID  string            `json:"model_id"`
+	Response *RoboflowResponse `json:"response"`
+}
+
+var (
+	roboflowCacheMu      sync.Mutex
+	roboflowCacheEntries []*roboflowCacheEntry // most-recently-used first
+	roboflowCacheLoaded  = map[string]bool{}   // modelIDs already spilled-in from disk
+
+	roboflowCacheHits   int64
+	roboflowCacheMisses int64
+)
+
+// Stats reports SendToRoboflow's persistent inference cache's hit/miss
+// counts since process start, so an operator (or a replay-based regression
+// test, which should see close to 100% hits) can confirm the cache is
+// actually saving API calls.
+func Stats() (hits, misses int64) {
+	return atomic.LoadInt64(&roboflowCacheHits), atomic.LoadInt64(&roboflowCacheMisses)
+}
+
+func recordRoboflowCacheResult(hit bool) {
+	if hit {
+		atomic.AddInt64(&roboflowCacheHits, 1)
+	} else {
+		atomic.AddInt64(&roboflowCacheMisses, 1)
+	}
+}
+
+// lookupRoboflowCache returns the cached response for the first entry
+// within roboflowCacheHammingThreshold bits of hash for the same modelID -
+// a different modelID never matches, so swapping models (e.g. tutorial ->
+// gameplay) invalidates the old model's entries implicitly rather than
+// requiring a separate flush. A hit is moved to the front, same as
+// cachingDetector.lookup.
+func lookupRoboflowCache(hash uint64, modelID string) (*RoboflowResponse, bool) {
+	roboflowCacheMu.Lock()
+	defer roboflowCacheMu.Unlock()
+
+	for i, e := range roboflowCacheEntries {
+		if e.ModelID != modelID || hammingDistance(hash, e.Hash) > roboflowCacheHammingThreshold {
+			continue
+		}
+		if i > 0 {
+			roboflowCacheEntries = append(roboflowCacheEntries[:i], roboflowCacheEntries[i+1:]...)
+			roboflowCacheEntries = append([]*roboflowCacheEntry{e}, roboflowCacheEntries...)
+		}
+		return e.Response, true
+	}
+	return nil, false
+}
+
+// storeRoboflowCache records resp in the in-memory cache and, if
+// GlobalConfig.VisionCacheDir is set, spills it to disk so a later process
+// (or the same process after a restart) can reuse it without ever calling
+// Roboflow for this exact frame.
+func storeRoboflowCache(hash uint64, modelID string, resp *RoboflowResponse) {
+	entry := &roboflowCacheEntry{Hash: hash, ModelID: modelID, Response: resp}
+
+	roboflowCacheMu.Lock()
+	roboflowCacheEntries = append([]*roboflowCacheEntry{entry}, roboflowCacheEntries...)
+	if len(roboflowCacheEntries) > roboflowCacheCapacity {
+		roboflowCacheEntries = roboflowCacheEntries[:roboflowCacheCapacity]
+	}
+	roboflowCacheMu.Unlock()
+
+	spillEntry(entry)
+}
+
+// ensureRoboflowCacheLoaded spills GlobalConfig.VisionCacheDir's entries for
+// modelID into the in-memory cache the first time modelID is seen by this
+// process, mirroring internal/vision/templates's loadedDir pattern of
+// lazily loading from disk once per key instead of on every call.
+func ensureRoboflowCacheLoaded(modelID string) {
+	dir := utils.GetConfig().Global.VisionCacheDir
+	if dir == "" {
+		return
+	}
+
+	roboflowCacheMu.Lock()
+	if roboflowCacheLoaded[modelID] {
+		roboflowCacheMu.Unlock()
+		return
+	}
+	roboflowCacheLoaded[modelID] = true
+	roboflowCacheMu.Unlock()
+
+	modelDir := filepath.Join(dir, modelID)
+	files, err := os.ReadDir(modelDir)
+	if err != nil {
+		return // no spilled cache for this model yet, nothing to load
+	}
+
+	var loaded []*roboflowCacheEntry
+	for _, f := range files {
+		data, err := os.ReadFile(filepath.Join(modelDir, f.Name()))
+		if err != nil {
+			continue
+		}
+		var entry roboflowCacheEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			logging.Emit(logging.Warning, nil, "vision cache: error parsing %s: %v", f.Name(), err)
+			continue
+		}
+		loaded = append(loaded, &entry)
+	}
+	if len(loaded) == 0 {
+		return
+	}
+
+	roboflowCacheMu.Lock()
+	roboflowCacheEntries = append(loaded, roboflowCacheEntries...)
+	if len(roboflowCacheEntries) > roboflowCacheCapacity {
+		roboflowCacheEntries = roboflowCacheEntries[:roboflowCacheCapacity]
+	}
+	roboflowCacheMu.Unlock()
+}
+
+// spillEntry writes entry to GlobalConfig.VisionCacheDir as its own
+// content-addressed file (dir/modelID/hash.json), so the cache survives a
+// restart. A no-op if VisionCacheDir is unset.
+func spillEntry(entry *roboflowCacheEntry) {
+	dir := utils.GetConfig().Global.VisionCacheDir
+	if dir == "" {
+		return
+	}
+
+	modelDir := filepath.Join(dir, entry.ModelID)
+	if err := os.MkdirAll(modelDir, 0755); err != nil {
+		logging.Emit(logging.Warning, nil, "vision cache: error creating %s: %v", modelDir, err)
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logging.Emit(logging.Warning, nil, "vision cache: error marshaling cache entry: %v", err)
+		return
+	}
+
+	path := filepath.Join(modelDir, fmt.Sprintf("%016x.json", entry.Hash))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		logging.Emit(logging.Warning, nil, "vision cache: error writing %s: %v", path, err)
+	}
+}
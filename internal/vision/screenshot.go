@@ -2,21 +2,46 @@ package vision
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"roborok/internal/common"
+	"roborok/internal/logging"
+	"roborok/internal/metrics"
 	"roborok/internal/utils"
 	"time"
 )
 
 // CaptureScreenshot captures a screenshot from the device
 func CaptureScreenshot(deviceID, adbPath string) ([]byte, error) {
+	defer func(start time.Time) {
+		metrics.Default.ObserveScreenshotCapture(deviceID, time.Since(start))
+	}(time.Now())
+
 	cmd := exec.Command(adbPath, "-s", deviceID, "exec-out", "screencap", "-p")
 	return cmd.Output()
 }
 
+// Screenshotter captures a raw screenshot from a device. It abstracts over
+// where the bytes actually come from, so manager.RunGameplayIteration
+// doesn't need to know whether a frame was pulled live over ADB or (via
+// internal/replay's Player) re-served from a previously recorded session.
+type Screenshotter interface {
+	Capture(deviceID, adbPath string) ([]byte, error)
+}
+
+// adbScreenshotter captures screenshots over a live ADB connection.
+type adbScreenshotter struct{}
+
+// Capture implements Screenshotter.
+func (adbScreenshotter) Capture(deviceID, adbPath string) ([]byte, error) {
+	return CaptureScreenshot(deviceID, adbPath)
+}
+
+// DefaultScreenshotter captures screenshots over ADB. It's the Screenshotter
+// every Manager uses unless a replay.Player has been swapped in instead.
+var DefaultScreenshotter Screenshotter = adbScreenshotter{}
+
 // SaveScreenshot saves a screenshot to disk
 func SaveScreenshot(screenshot []byte, path string) error {
 	// Ensure directory exists
@@ -45,6 +70,7 @@ func CaptureAndDetect(
 	// Get API key and model ID from global config
 	apiKey := utils.GetRoboflowAPIKey()
 	modelID := utils.GetRoboflowGameplayModel()
+	fields := logging.Fields{"device_id": deviceID, "task": "capture_and_detect"}
 
 	// Maximum attempts to dismiss help bubbles
 	const maxAttempts = 5
@@ -78,15 +104,15 @@ func CaptureAndDetect(
 
 		// Log the results for debugging
 		if len(detections) > 0 {
-			log.Printf("Detected %d objects:", len(detections))
+			logging.Emit(logging.Debug, fields, "Detected %d objects:", len(detections))
 			for i, det := range detections {
 				if det.Confidence > common.MinConfidence {
-					log.Printf("  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
+					logging.Emit(logging.Debug, fields, "  %d. %s (%.2f): (%.1f, %.1f) %.0fx%.0f",
 						i+1, det.Class, det.Confidence, det.X, det.Y, det.Width, det.Height)
 				}
 			}
 		} else {
-			log.Printf("No objects detected")
+			logging.Emit(logging.Debug, fields, "No objects detected")
 		}
 
 		// Check for help bubbles
@@ -95,14 +121,15 @@ func CaptureAndDetect(
 			if (det.Class == "help_chat_bubble" || det.Class == "help_bubble") &&
 				det.Confidence > common.MinConfidence {
 				// Found a help bubble, click it to dismiss
-				log.Printf("Found %s, dismissing popup at (%.1f, %.1f)...",
+				logging.Emit(logging.Info, fields, "Found %s, dismissing popup at (%.1f, %.1f)...",
 					det.Class, det.X, det.Y)
 
 				if err := utils.TapScreen(deviceID, adbPath, int(det.X), int(det.Y)); err != nil {
-					log.Printf("Error dismissing help bubble: %v", err)
+					logging.Emit(logging.Error, fields, "Error dismissing help bubble: %v", err)
 				} else {
 					helpBubbleFound = true
-					log.Printf("Help bubble dismissed (attempt %d/%d)", attempts+1, maxAttempts)
+					metrics.Default.IncHelpBubblesDismissed(deviceID)
+					logging.Emit(logging.Info, fields, "Help bubble dismissed (attempt %d/%d)", attempts+1, maxAttempts)
 					// Wait for bubble animation and any subsequent bubbles to appear
 					time.Sleep(1 * time.Second)
 				}
@@ -120,7 +147,7 @@ func CaptureAndDetect(
 	}
 
 	// If we got here, we've reached the maximum attempts
-	log.Printf("Maximum help bubble dismissal attempts (%d) reached, continuing anyway", maxAttempts)
+	logging.Emit(logging.Warning, fields, "Maximum help bubble dismissal attempts (%d) reached, continuing anyway", maxAttempts)
 
 	// Try one more time to get clean detections
 	screenshot, err := CaptureScreenshot(deviceID, adbPath)
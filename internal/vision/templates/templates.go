@@ -0,0 +1,208 @@
+// Package templates resolves named UI elements on a screenshot by
+// zero-normalized cross-correlation against a library of small reference
+// PNGs, an alternative to internal/actions's hardcoded (x,y) taps that
+// tolerates minor UI shifts (a slightly different device resolution, a
+// button that moved a few pixels) the way an exact pixel coordinate
+// doesn't. There's no gocv dependency available in this tree (no go.mod to
+// vendor one into), so matching is a pure-Go correlation over the
+// standard library's decoded image.Image - slower than an OpenCV call but
+// with no external dependency.
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// MatchThreshold is the minimum correlation score LocateTemplate accepts as
+// a match; below this, LocateTemplate reports ok = false so the caller can
+// fall back to its own hardcoded coordinate.
+const MatchThreshold = 0.8
+
+type template struct {
+	gray   [][]float64
+	width  int
+	height int
+}
+
+// cache holds every template loaded so far for loadedDir, so repeated
+// LocateTemplate calls in the same gameplay loop don't re-read and
+// re-decode the same PNG from disk every tick. It's invalidated wholesale
+// whenever dir changes, which in practice only happens if GlobalConfig's
+// TemplatesDir is edited and reloaded.
+var (
+	mu        sync.Mutex
+	loadedDir string
+	cache     map[string]*template
+)
+
+// LocateTemplate runs name's template (loaded from dir, e.g.
+// GlobalConfig.TemplatesDir) against screenshot and returns the center
+// pixel of the best match plus its correlation score. ok is false if dir
+// is empty, name has no corresponding dir/name.png, or the best match
+// scores below MatchThreshold - in every case the caller should fall back
+// to its own hardcoded coordinate rather than tap (0, 0).
+func LocateTemplate(screenshot []byte, dir, name string) (x, y int, confidence float64, ok bool) {
+	if dir == "" {
+		return 0, 0, 0, false
+	}
+
+	tpl, err := loadTemplate(dir, name)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(screenshot))
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	scene := toGray(img)
+	if len(scene) == 0 || len(scene[0]) == 0 {
+		return 0, 0, 0, false
+	}
+	sceneH, sceneW := len(scene), len(scene[0])
+
+	bestX, bestY, bestScore := 0, 0, -1.0
+	for sy := 0; sy+tpl.height <= sceneH; sy++ {
+		for sx := 0; sx+tpl.width <= sceneW; sx++ {
+			if score := ncc(scene, tpl.gray, sx, sy); score > bestScore {
+				bestScore, bestX, bestY = score, sx, sy
+			}
+		}
+	}
+
+	if bestScore < MatchThreshold {
+		return 0, 0, bestScore, false
+	}
+	return bestX + tpl.width/2, bestY + tpl.height/2, bestScore, true
+}
+
+// CaptureTemplate crops the rectangle (x, y, width, height) out of
+// screenshot and saves it as dir/name.png, overwriting any existing
+// template of that name. It's the dev-mode counterpart to LocateTemplate:
+// building the template library by cropping a region out of a live
+// screenshot instead of hand-authoring reference PNGs offline.
+func CaptureTemplate(screenshot []byte, dir, name string, x, y, width, height int) error {
+	img, _, err := image.Decode(bytes.NewReader(screenshot))
+	if err != nil {
+		return fmt.Errorf("error decoding screenshot: %w", err)
+	}
+
+	bounds := img.Bounds()
+	rect := image.Rect(bounds.Min.X+x, bounds.Min.Y+y, bounds.Min.X+x+width, bounds.Min.Y+y+height)
+	if !rect.In(bounds) {
+		return fmt.Errorf("crop region %v is outside screenshot bounds %v", rect, bounds)
+	}
+
+	cropped := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(cropped, cropped.Bounds(), img, rect.Min, draw.Src)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating templates dir %s: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, name+".png")
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating template file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, cropped); err != nil {
+		return fmt.Errorf("error encoding template %s: %w", path, err)
+	}
+
+	mu.Lock()
+	if loadedDir == dir {
+		delete(cache, name) // force the next LocateTemplate to pick up the new crop
+	}
+	mu.Unlock()
+
+	return nil
+}
+
+func loadTemplate(dir, name string) (*template, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if loadedDir != dir {
+		cache = make(map[string]*template)
+		loadedDir = dir
+	}
+	if tpl, ok := cache[name]; ok {
+		return tpl, nil
+	}
+
+	path := filepath.Join(dir, name+".png")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading template %s: %w", path, err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding template %s: %w", path, err)
+	}
+
+	gray := toGray(img)
+	if len(gray) == 0 || len(gray[0]) == 0 {
+		return nil, fmt.Errorf("template %s decoded to an empty image", path)
+	}
+	tpl := &template{gray: gray, width: len(gray[0]), height: len(gray)}
+	cache[name] = tpl
+	return tpl, nil
+}
+
+func toGray(img image.Image) [][]float64 {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	gray := make([][]float64, h)
+	for y := 0; y < h; y++ {
+		gray[y] = make([]float64, w)
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			gray[y][x] = 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+		}
+	}
+	return gray
+}
+
+// ncc computes the zero-normalized cross-correlation between tpl and the
+// scene patch of the same size with top-left corner (ox, oy), in [-1, 1] -
+// 1 meaning a pixel-for-pixel linear match regardless of overall
+// brightness offset between the two images.
+func ncc(scene, tpl [][]float64, ox, oy int) float64 {
+	th, tw := len(tpl), len(tpl[0])
+
+	var sceneSum, sceneSumSq, tplSum, tplSumSq, cross float64
+	for y := 0; y < th; y++ {
+		for x := 0; x < tw; x++ {
+			sv := scene[oy+y][ox+x]
+			tv := tpl[y][x]
+			sceneSum += sv
+			sceneSumSq += sv * sv
+			tplSum += tv
+			tplSumSq += tv * tv
+			cross += sv * tv
+		}
+	}
+
+	n := float64(th * tw)
+	sceneMean := sceneSum / n
+	tplMean := tplSum / n
+	numerator := cross - n*sceneMean*tplMean
+	sceneVar := sceneSumSq - n*sceneMean*sceneMean
+	tplVar := tplSumSq - n*tplMean*tplMean
+
+	denom := math.Sqrt(sceneVar * tplVar)
+	if denom == 0 {
+		return 0
+	}
+	return numerator / denom
+}
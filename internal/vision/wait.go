@@ -0,0 +1,170 @@
+package vision
+
+import (
+	"fmt"
+	"roborok/internal/common"
+	"roborok/internal/utils"
+	"time"
+)
+
+// Frame is one poll's screenshot and detections, passed to every Predicate
+// WaitForState evaluates along with every Frame seen so far this wait.
+type Frame struct {
+	Screenshot []byte
+	Detections []common.Detection
+}
+
+// Predicate reports whether WaitForState should stop waiting, given the
+// latest Frame and every Frame polled before it (oldest first).
+type Predicate func(current Frame, history []Frame) bool
+
+// HasClass reports the first poll where class is present above
+// common.MinConfidence.
+func HasClass(class string) Predicate {
+	return func(current Frame, history []Frame) bool {
+		return FindDetectionByClass(current.Detections, class, common.MinConfidence) != nil
+	}
+}
+
+// HasAnyOf reports the first poll where any of classes is present above
+// common.MinConfidence.
+func HasAnyOf(classes ...string) Predicate {
+	return func(current Frame, history []Frame) bool {
+		return FindDetectionByClasses(current.Detections, classes, common.MinConfidence) != nil
+	}
+}
+
+// LostClass reports the first poll where class, having been present in an
+// earlier poll this wait, is no longer present - e.g. waiting for a build
+// menu's "in_build" marker to disappear after pressing back. It never
+// fires if class was never present in the first place, since there would
+// be nothing to call "lost".
+func LostClass(class string) Predicate {
+	hadIt := false
+	return func(current Frame, history []Frame) bool {
+		present := FindDetectionByClass(current.Detections, class, common.MinConfidence) != nil
+		if present {
+			hadIt = true
+			return false
+		}
+		return hadIt
+	}
+}
+
+// stableHashThreshold is the dHash hamming distance at or under which two
+// screenshots are considered the same screen, per the request that added
+// Stable: "9x8 grayscale, compare adjacent pixels, hamming distance <= 5".
+// This is looser than cachingDetector's hammingThreshold since Stable is
+// judging "has this transition visibly finished" rather than "is this
+// frame near-identical enough to skip re-detecting it".
+const stableHashThreshold = 5
+
+// Stable reports the first poll whose screenshot's dHash is within
+// stableHashThreshold of the preceding n-1 polls' - i.e. the screen hasn't
+// visibly changed for n consecutive polls - for waiting out a transition
+// with no detection class of its own to watch for (e.g. a dialog closing).
+// Frames dHash can't decode compare as stable against each other (dHash
+// returns 0 for them), which only matters if
+// CaptureScreenshot starts returning something other than a PNG.
+func Stable(n int) Predicate {
+	return func(current Frame, history []Frame) bool {
+		if n < 1 || len(history) < n-1 {
+			return false
+		}
+		window := append(append([]Frame{}, history[len(history)-(n-1):]...), current)
+		base, _ := dHash(window[0].Screenshot)
+		for _, f := range window[1:] {
+			hash, _ := dHash(f.Screenshot)
+			if hammingDistance(base, hash) > stableHashThreshold {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or reports true the first poll any of preds does, short-circuiting left
+// to right - e.g. Or(HasAnyOf("upgrade_button", "upgrade_not_available"),
+// Stable(3)) to wait for either a known button or the screen simply
+// settling on something unrecognized.
+func Or(preds ...Predicate) Predicate {
+	return func(current Frame, history []Frame) bool {
+		for _, p := range preds {
+			if p(current, history) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// maxUnchangedPollsBeforeRedetect caps how many consecutive dHash-stable
+// polls WaitForState will skip re-running detection for before forcing one
+// anyway, so a Predicate that needs fresh Detections (HasClass and the
+// like) can't stall forever reading a frame that was reused past the point
+// Stable itself would have already fired.
+const maxUnchangedPollsBeforeRedetect = 3
+
+// WaitForState polls deviceID's screen every pollInterval until pred
+// reports true or timeout elapses, returning the Detections from whichever
+// poll satisfied it (or the last poll's, on timeout). Each poll captures a
+// screenshot and dHashes it against the previous poll; when the hash is
+// within stableHashThreshold (the screen hasn't visibly changed),
+// detection is skipped and the previous poll's Detections are reused
+// instead of spending another Roboflow call on a frame that looks the
+// same - up to maxUnchangedPollsBeforeRedetect times in a row, after which
+// detection runs anyway so a Predicate watching for a class change isn't
+// permanently starved by a visually-static-but-actually-different screen
+// (e.g. a progress bar too fine-grained for dHash to notice).
+func WaitForState(deviceID, adbPath string, pred Predicate, timeout, pollInterval time.Duration) ([]common.Detection, error) {
+	apiKey := utils.GetRoboflowAPIKey()
+	modelID := utils.GetRoboflowGameplayModel()
+
+	var history []Frame
+	var lastHash uint64
+	unchangedPolls := 0
+	deadline := time.Now().Add(timeout)
+
+	for {
+		screenshot, err := CaptureScreenshot(deviceID, adbPath)
+		if err != nil {
+			return lastDetections(history), fmt.Errorf("capturing screenshot: %w", err)
+		}
+
+		hash, _ := dHash(screenshot)
+		reuseDetections := len(history) > 0 &&
+			hammingDistance(hash, lastHash) <= stableHashThreshold &&
+			unchangedPolls < maxUnchangedPollsBeforeRedetect
+		lastHash = hash
+
+		var detections []common.Detection
+		if reuseDetections {
+			unchangedPolls++
+			detections = history[len(history)-1].Detections
+		} else {
+			unchangedPolls = 0
+			_, detections, err = AnalyzeGameState(screenshot, apiKey, modelID)
+			if err != nil {
+				return lastDetections(history), fmt.Errorf("analyzing game state: %w", err)
+			}
+		}
+
+		current := Frame{Screenshot: screenshot, Detections: detections}
+		if pred(current, history) {
+			return detections, nil
+		}
+		history = append(history, current)
+
+		if time.Now().After(deadline) {
+			return detections, fmt.Errorf("timed out after %s waiting for screen state", timeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+func lastDetections(history []Frame) []common.Detection {
+	if len(history) == 0 {
+		return nil
+	}
+	return history[len(history)-1].Detections
+}
@@ -0,0 +1,149 @@
+package vision
+
+import (
+	"fmt"
+	"roborok/internal/common"
+	"roborok/internal/utils"
+	"time"
+)
+
+// Require selects how WaitSpec.Classes combine into a single match
+// condition.
+type Require int
+
+const (
+	// AnyOf is satisfied by the first of Classes found above
+	// MinConfidence. The zero value, so an unset WaitSpec.Require behaves
+	// like the simple "is any of these on screen" check most callers want.
+	AnyOf Require = iota
+	// AllOf requires every one of Classes to be present above
+	// MinConfidence in the same frame.
+	AllOf
+	// Clickable is like AnyOf, but additionally requires the matched
+	// detection to have a non-zero bounding box - i.e. an actual region a
+	// tap can land inside, not a degenerate zero-size detection.
+	Clickable
+)
+
+// WaitSpec describes what WaitFor/WaitForGone are waiting for.
+type WaitSpec struct {
+	// Classes are the detection classes WaitFor/WaitForGone checks for,
+	// combined per Require.
+	Classes []string
+	// MinConfidence overrides common.MinConfidence for this wait. Zero
+	// uses common.MinConfidence.
+	MinConfidence float64
+	// Timeout is how long WaitFor/WaitForGone polls before giving up.
+	// Ignored when Freeze is set.
+	Timeout time.Duration
+	// PollInterval is how long WaitFor/WaitForGone sleeps between polls.
+	// Ignored when Freeze is set.
+	PollInterval time.Duration
+	// Require selects how Classes combine. Zero value is AnyOf.
+	Require Require
+	// Freeze, when true, checks a single captured frame once instead of
+	// polling - mirroring Airtest/Poco's "with frozen_poco:" scope, where
+	// several isVisible-style checks against one screen share a single
+	// capture instead of each re-capturing. Timeout and PollInterval are
+	// ignored when Freeze is set.
+	Freeze bool
+}
+
+// MatchSpec returns the first of detections satisfying spec (per
+// spec.Require; AnyOf scans detections in order, Clickable scans Classes in
+// order, and AllOf returns the match for the last of Classes), or nil if
+// none do. It's the pure matching logic behind
+// WaitFor/WaitForGone, exported so a caller that already has a Detections
+// batch in hand - e.g. an actions/fsm State's Guard/Action, which already
+// shares one capture per Tick - can reuse the same Classes/Require/
+// MinConfidence semantics without triggering another device capture.
+func MatchSpec(detections []common.Detection, spec WaitSpec) *common.Detection {
+	minConf := spec.MinConfidence
+	if minConf == 0 {
+		minConf = common.MinConfidence
+	}
+
+	switch spec.Require {
+	case AllOf:
+		var last *common.Detection
+		for _, class := range spec.Classes {
+			det := FindDetectionByClass(detections, class, minConf)
+			if det == nil {
+				return nil
+			}
+			last = det
+		}
+		return last
+	case Clickable:
+		for _, class := range spec.Classes {
+			det := FindDetectionByClass(detections, class, minConf)
+			if det != nil && det.Width > 0 && det.Height > 0 {
+				return det
+			}
+		}
+		return nil
+	default: // AnyOf
+		return FindDetectionByClasses(detections, spec.Classes, minConf)
+	}
+}
+
+// WaitFor polls deviceID's screen until spec's Classes are satisfied (per
+// spec.Require) or spec.Timeout elapses, returning the matched Detection.
+// It's built on WaitForState, so it gets the same dHash-based "skip
+// re-detecting an unchanged screen" behavior as every other wait in this
+// package. If spec.Freeze is set, it instead captures and analyzes a single
+// frame and checks spec against it once, with no retry loop.
+func WaitFor(deviceID, adbPath string, spec WaitSpec) (*common.Detection, error) {
+	if spec.Freeze {
+		detections, err := frozenDetections(deviceID, adbPath)
+		if err != nil {
+			return nil, err
+		}
+		if det := MatchSpec(detections, spec); det != nil {
+			return det, nil
+		}
+		return nil, fmt.Errorf("none of %v found in frozen frame", spec.Classes)
+	}
+
+	pred := func(current Frame, history []Frame) bool {
+		return MatchSpec(current.Detections, spec) != nil
+	}
+
+	detections, err := WaitForState(deviceID, adbPath, pred, spec.Timeout, spec.PollInterval)
+	det := MatchSpec(detections, spec)
+	if err != nil {
+		return det, err
+	}
+	return det, nil
+}
+
+// WaitForGone polls deviceID's screen until none of spec.Classes are
+// present above spec.MinConfidence, or spec.Timeout elapses. spec.Require
+// and spec.Freeze are ignored: "gone" always means none of Classes are on
+// screen right now, and always needs polling to notice the transition.
+func WaitForGone(deviceID, adbPath string, spec WaitSpec) error {
+	goneSpec := WaitSpec{Classes: spec.Classes, MinConfidence: spec.MinConfidence, Require: AnyOf}
+	pred := func(current Frame, history []Frame) bool {
+		return MatchSpec(current.Detections, goneSpec) == nil
+	}
+
+	_, err := WaitForState(deviceID, adbPath, pred, spec.Timeout, spec.PollInterval)
+	return err
+}
+
+// frozenDetections captures and analyzes a single frame, bypassing
+// WaitForState's polling and dHash reuse logic entirely.
+func frozenDetections(deviceID, adbPath string) ([]common.Detection, error) {
+	screenshot, err := CaptureScreenshot(deviceID, adbPath)
+	if err != nil {
+		return nil, fmt.Errorf("capturing screenshot: %w", err)
+	}
+
+	apiKey := utils.GetRoboflowAPIKey()
+	modelID := utils.GetRoboflowGameplayModel()
+	_, detections, err := AnalyzeGameState(screenshot, apiKey, modelID)
+	if err != nil {
+		return nil, fmt.Errorf("analyzing game state: %w", err)
+	}
+	return detections, nil
+}
@@ -2,20 +2,53 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"roborok/internal/ctlapi"
+	"roborok/internal/logging"
 	"roborok/internal/manager"
+	"roborok/internal/replay"
 	"roborok/internal/report"
 	"roborok/internal/utils"
+	"roborok/internal/vision"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
 )
 
+// configWatchPollInterval is how often utils.WatchConfig re-checks config.json.
+const configWatchPollInterval = 5 * time.Second
+
 func main() {
+	// "roborok replay <session.tar.gz>" is a standalone inspection mode,
+	// handled before flag.Parse so it doesn't collide with the flags below
+	// (it takes a positional archive path, not flags).
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		runReplayCLI(os.Args[2:])
+		return
+	}
+
+	// "roborok classify-corpus <dir>" is likewise a standalone mode: it
+	// scores vision.DetermineGameView against a directory of hand-labeled
+	// fixtures instead of running any automation.
+	if len(os.Args) > 1 && os.Args[1] == "classify-corpus" {
+		runClassifierCorpusCLI(os.Args[2:])
+		return
+	}
+
+	profilePath := flag.String("profile", "", "path to a command profile script to run on startup")
+	// Named "--device-profiles", not "--profile", since that flag already
+	// means something else above (a scripted command profile to replay,
+	// predating profile.Profile by a long way).
+	deviceProfiles := flag.String("device-profiles", "", "profile=deviceID pairs assigning a profile.Profile to specific devices, comma-separated, e.g. main=emulator-5554,farm=emulator-5556")
+	flag.Parse()
+
 	log.Println("Starting Rise of Kingdoms Automation...")
 
 	// Ensure screenshots directory exists
@@ -30,8 +63,17 @@ func main() {
 	// Get the initialized config
 	config := utils.GetConfig()
 
-	// Initialize reporter (placeholder for now)
-	reporter := report.NewReporter(config.Global.ReportEndpoint)
+	// Always show events on the terminal; additionally persist them as
+	// NDJSON when GlobalConfig.EventLogPath is set.
+	logging.StartStderrSink(logging.DefaultBus)
+	if config.Global.EventLogPath != "" {
+		if _, err := logging.StartJSONLSink(logging.DefaultBus, config.Global.EventLogPath); err != nil {
+			log.Printf("Warning: could not start event log sink: %v", err)
+		}
+	}
+
+	// Initialize reporter
+	reporter := report.NewReporter(config)
 	go reporter.Start()
 
 	// Initialize instance manager
@@ -43,19 +85,45 @@ func main() {
 		log.Println("Initializing with default states...")
 	}
 
-	// Setup signal handler for graceful shutdown
-	setupSignalHandler(mgr)
+	mgr.ApplyDeviceProfiles(parseDeviceProfiles(*deviceProfiles))
+
+	// Setup signal handler for graceful shutdown, config reload, and pause/resume
+	setupSignalHandler(mgr, reporter, configPath)
+
+	// Also pick up config edits without waiting for an operator to send
+	// SIGHUP, so a long-running overnight fleet can have its gameplay
+	// knobs tuned without a restart.
+	utils.WatchConfig(configPath, configWatchPollInterval)
+
+	// Start the HTTP control plane so multiple bots on one workstation can
+	// be controlled from a single dashboard or scraped by monitoring tools
+	if config.Global.CtlAPIAddr != "" {
+		ctlSrv := ctlapi.NewServer(mgr, config.Global.CtlAPIAddr)
+		go func() {
+			if err := ctlSrv.Start(); err != nil {
+				log.Printf("Control API server stopped: %v", err)
+			}
+		}()
+	}
+
+	// kill aborts a running command profile; closed on 'q' or SIGINT
+	kill := make(chan struct{})
+	setupProfileKillSwitch(kill)
+
+	if *profilePath != "" {
+		go runProfile(mgr, *profilePath, kill)
+	}
 
 	// Start console command monitor in a separate goroutine
-	go monitorCommands(mgr)
+	go monitorCommands(mgr, kill)
 
 	// Start all instances in parallel
-	for id, instance := range mgr.Instances {
+	for id, instance := range mgr.InstancesSnapshot() {
 		go mgr.RunInstanceLoop(id, instance)
 	}
 
 	// Log success
-	log.Printf("Started automation for %d instances", len(mgr.Instances))
+	log.Printf("Started automation for %d instances", mgr.InstanceCount())
 
 	// Keep the main process alive
 	for {
@@ -63,85 +131,412 @@ func main() {
 	}
 }
 
-// setupSignalHandler creates a handler for graceful shutdown
-func setupSignalHandler(mgr *manager.Manager) {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+// parseDeviceProfiles parses --device-profiles' "profile=deviceID,..."
+// syntax into deviceID -> profile name, the form Manager.ApplyDeviceProfiles
+// expects. A malformed pair (missing "=") is logged and skipped rather than
+// treated as fatal, so a typo in one pair doesn't stop the rest of the
+// fleet from starting.
+func parseDeviceProfiles(raw string) map[string]string {
+	result := make(map[string]string)
+	if raw == "" {
+		return result
+	}
+
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		profileName, deviceID, ok := strings.Cut(pair, "=")
+		if !ok || profileName == "" || deviceID == "" {
+			log.Printf("--device-profiles: ignoring malformed pair %q, expected profile=deviceID", pair)
+			continue
+		}
+
+		result[deviceID] = profileName
+	}
+	return result
+}
+
+// runReplayCLI implements "roborok replay <session.tar.gz>": it steps
+// through a session archive's frames and events and prints them in order.
+// For each frame it recomputes vision.DetermineGameView from the recorded
+// detections and flags a divergence from the recorded gameView - that
+// function is pure, so any difference means DetermineGameView's logic has
+// changed since the session was captured. Full task-handler replay (taps,
+// navigation decisions) isn't reproduced here: internal/replay.Player
+// already drives that through the regular Manager/dispatcher path, and
+// that's where a handler like CollectVIPRewards should be exercised against
+// a saved session rather than in a one-off CLI.
+func runReplayCLI(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: roborok replay <session.tar.gz>")
+		os.Exit(1)
+	}
+
+	frames, events, err := replay.ReadSession(args[0])
+	if err != nil {
+		log.Fatalf("replay: %v", err)
+	}
+
+	fmt.Printf("Session %s: %d frames, %d events\n", args[0], len(frames), len(events))
+	for _, fr := range frames {
+		recomputed := vision.DetermineGameView(fr.Detections)
+		diff := ""
+		if recomputed != fr.GameView {
+			diff = fmt.Sprintf("  <-- DIVERGED (recorded=%q recomputed=%q)", fr.GameView, recomputed)
+		}
+		fmt.Printf("frame %d [%s] device=%s detections=%d gameView=%s%s\n",
+			fr.Number, fr.RecordedAt.Format(time.RFC3339), fr.DeviceID, len(fr.Detections), fr.GameView, diff)
+	}
+
+	for _, ev := range events {
+		switch ev.Type {
+		case "tap":
+			fmt.Printf("  [%s] %s tap (%d, %d)\n", ev.Timestamp.Format(time.RFC3339), ev.DeviceID, ev.X, ev.Y)
+		case "swipe":
+			fmt.Printf("  [%s] %s swipe (%d, %d) -> (%d, %d) %dms\n",
+				ev.Timestamp.Format(time.RFC3339), ev.DeviceID, ev.X, ev.Y, ev.X2, ev.Y2, ev.DurationMS)
+		case "keypress":
+			fmt.Printf("  [%s] %s keypress %s\n", ev.Timestamp.Format(time.RFC3339), ev.DeviceID, ev.Keycode)
+		}
+	}
+}
+
+// runClassifierCorpusCLI implements "roborok classify-corpus <dir>": it runs
+// vision.TestClassifierOnCorpus against dir and prints overall accuracy plus
+// per-view precision/recall, so a vision.ViewScore weight-table edit's
+// effect on real fixtures can be checked before it's shipped as
+// GlobalConfig.ViewWeightsPath.
+func runClassifierCorpusCLI(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: roborok classify-corpus <dir>")
+		os.Exit(1)
+	}
 
+	report, err := vision.TestClassifierOnCorpus(args[0])
+	if err != nil {
+		log.Fatalf("classify-corpus: %v", err)
+	}
+
+	fmt.Printf("Corpus %s: %d samples, %d correct (%.1f%% accuracy)\n",
+		args[0], report.Samples, report.Correct, 100*float64(report.Correct)/float64(max(report.Samples, 1)))
+
+	views := make([]string, 0, len(report.PerView))
+	for view := range report.PerView {
+		views = append(views, view)
+	}
+	sort.Strings(views)
+
+	for _, view := range views {
+		stats := report.PerView[view]
+		fmt.Printf("  %-10s precision=%.2f recall=%.2f (tp=%d fp=%d fn=%d)\n",
+			view, stats.Precision(), stats.Recall(), stats.TruePositives, stats.FalsePositives, stats.FalseNegatives)
+	}
+
+	for _, m := range report.Mismatches {
+		fmt.Printf("  MISMATCH %s: expected=%q predicted=%q\n", m.File, m.ExpectedView, m.PredictedView)
+	}
+}
+
+// setupProfileKillSwitch closes kill whenever the process receives an
+// interrupt, so any in-flight 'cmd load' profile run aborts cleanly instead
+// of continuing to dispatch commands after shutdown has started.
+func setupProfileKillSwitch(kill chan struct{}) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
 	go func() {
 		<-c
+		close(kill)
+	}()
+}
+
+// setupSignalHandler creates a handler for graceful shutdown, SIGHUP config
+// reload, SIGTSTP/SIGCONT suspend-resume, and SIGUSR1 log rotation.
+func setupSignalHandler(mgr *manager.Manager, reporter *report.Reporter, configPath string) {
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-shutdown
 		log.Println("Shutdown signal received, saving state...")
 		if err := mgr.SaveInstanceStates(); err != nil {
 			log.Printf("Error saving state on shutdown: %v", err)
 		}
+		reporter.Stop()
+		if err := mgr.Replay.Close(); err != nil {
+			log.Printf("Error closing session recording: %v", err)
+		}
 		os.Exit(0)
 	}()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			log.Println("SIGHUP received, reloading config...")
+			if _, err := utils.ReloadConfig(configPath); err != nil {
+				log.Printf("Config reload failed, keeping current config: %v", err)
+			}
+		}
+	}()
+
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+
+	go func() {
+		for range usr1 {
+			log.Println("SIGUSR1 received, rotating log and dumping status")
+			rotateLog()
+			printStatus(mgr)
+		}
+	}()
+
+	go handleSuspendResume(mgr)
+}
+
+// handleSuspendResume pauses automation on SIGTSTP and re-raises it so the
+// process actually suspends (^Z from the shell), then resumes automation
+// when the shell brings the process back to the foreground with SIGCONT.
+func handleSuspendResume(mgr *manager.Manager) {
+	for {
+		tstp := make(chan os.Signal, 1)
+		signal.Notify(tstp, syscall.SIGTSTP)
+		<-tstp
+		signal.Stop(tstp)
+
+		log.Println("SIGTSTP received, pausing automation before suspending...")
+		mgr.Pause()
+
+		signal.Reset(syscall.SIGTSTP)
+		syscall.Kill(os.Getpid(), syscall.SIGTSTP)
+
+		// Execution resumes here once the shell sends SIGCONT ('fg')
+		cont := make(chan os.Signal, 1)
+		signal.Notify(cont, syscall.SIGCONT)
+		<-cont
+		signal.Stop(cont)
+
+		log.Println("SIGCONT received, resuming automation")
+		mgr.Resume()
+	}
+}
+
+// rotateLog truncates and reopens the process log file so operators can
+// rotate logs externally (e.g. via logrotate's copytruncate) without
+// restarting the bot.
+func rotateLog() {
+	f, err := os.OpenFile("roborok.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("Error rotating log file: %v", err)
+		return
+	}
+	log.SetOutput(f)
+	log.Println("Log file rotated")
 }
 
 // monitorCommands processes user input commands for controlling the automation
-func monitorCommands(mgr *manager.Manager) {
+func monitorCommands(mgr *manager.Manager, kill chan struct{}) {
 	scanner := bufio.NewScanner(os.Stdin)
 
 	fmt.Println("\n=== Command Interface ===")
 	fmt.Println("Available commands:")
-	fmt.Println("  p - Pause automation")
-	fmt.Println("  r - Resume automation")
+	fmt.Println("  p [id] - Pause automation (optionally, just one instance)")
+	fmt.Println("  r [id] - Resume automation (optionally, just one instance)")
 	fmt.Println("  s - Show status")
-	fmt.Println("  t60 - Pause for 60 seconds (change number as needed)")
+	fmt.Println("  t60 [id] - Pause for 60 seconds (optionally, just one instance)")
+	fmt.Println("  force <id> <task> - Boost a task's score so it runs next for that instance")
+	fmt.Println("  cmd load <path> - Run a scripted command profile")
 	fmt.Println("  q - Quit")
 	fmt.Println("  h - Show this help message")
 
 	for scanner.Scan() {
 		cmd := strings.TrimSpace(scanner.Text())
 
-		switch {
-		case cmd == "p":
+		if cmd == "q" {
+			fmt.Println("Saving state and shutting down...")
+			if err := mgr.SaveInstanceStates(); err != nil {
+				log.Printf("Error saving state on quit: %v", err)
+			}
+			os.Exit(0)
+		}
+
+		if rest, ok := strings.CutPrefix(cmd, "cmd load "); ok {
+			path := strings.TrimSpace(rest)
+			go runProfile(mgr, path, kill)
+			continue
+		}
+
+		dispatchCommand(mgr, cmd)
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Printf("Error reading command input: %v", err)
+	}
+}
+
+// forceBoostAmount is added to a task's Priority for one scheduling pass by
+// the "force" command, well above any staleness bonus a constantly-cooled-
+// down task could otherwise accumulate.
+const forceBoostAmount = 1000
+
+// dispatchCommand handles a single command line, shared between the
+// interactive scanner loop and the scripted profile runner. "p", "r", and
+// "tXX" all accept an optional trailing instance ID (e.g. "p instance1") to
+// target a single instance instead of every instance, for when one
+// emulator needs manual intervention (captcha, event popup) while the
+// others keep farming. "force" always targets a single instance and task.
+func dispatchCommand(mgr *manager.Manager, cmd string) {
+	fields := strings.Fields(cmd)
+	verb := ""
+	if len(fields) > 0 {
+		verb = fields[0]
+	}
+	targetID := ""
+	if len(fields) > 1 {
+		targetID = fields[1]
+	}
+
+	switch {
+	case cmd == "":
+		// Ignore blank lines
+
+	case verb == "p":
+		if targetID != "" {
+			if err := mgr.PauseInstance(targetID); err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("Instance %s paused. Type 'r %s' to resume.\n", targetID, targetID)
+		} else {
 			mgr.Pause()
 			fmt.Println("Automation paused. Type 'r' to resume.")
+		}
 
-		case cmd == "r":
+	case verb == "r":
+		if targetID != "" {
+			if err := mgr.ResumeInstance(targetID); err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("Instance %s resumed.\n", targetID)
+		} else {
 			mgr.Resume()
 			fmt.Println("Automation resumed.")
+		}
 
-		case cmd == "s":
-			printStatus(mgr)
+	case cmd == "s" || cmd == "status":
+		printStatus(mgr)
 
-		case cmd == "h":
-			printHelp()
+	case cmd == "snapshot":
+		if err := mgr.SaveInstanceStates(); err != nil {
+			log.Printf("Error saving snapshot: %v", err)
+		} else {
+			fmt.Println("Snapshot saved.")
+		}
 
-		case cmd == "q":
-			fmt.Println("Saving state and shutting down...")
-			if err := mgr.SaveInstanceStates(); err != nil {
-				log.Printf("Error saving state on quit: %v", err)
-			}
-			os.Exit(0)
+	case verb == "force":
+		if len(fields) < 3 {
+			fmt.Println("Usage: force <id> <task>")
+			return
+		}
+		taskName := fields[2]
+		if err := mgr.BoostTask(targetID, taskName, forceBoostAmount); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("Instance %s: boosted %s to run next.\n", targetID, taskName)
+
+	case cmd == "h":
+		printHelp()
+
+	case strings.HasPrefix(verb, "t") && len(verb) > 1 && verb[1] >= '0' && verb[1] <= '9':
+		// Parse time in seconds
+		var seconds int
+		_, err := fmt.Sscanf(verb[1:], "%d", &seconds)
+		if err != nil || seconds <= 0 {
+			fmt.Println("Invalid time format. Use tXX where XX is seconds, e.g., t60")
+			return
+		}
 
-		case strings.HasPrefix(cmd, "t") && len(cmd) > 1:
-			// Parse time in seconds
-			var seconds int
-			_, err := fmt.Sscanf(cmd[1:], "%d", &seconds)
-			if err != nil || seconds <= 0 {
-				fmt.Println("Invalid time format. Use tXX where XX is seconds, e.g., t60")
-				continue
+		if targetID != "" {
+			if err := mgr.PauseInstanceFor(targetID, time.Duration(seconds)*time.Second); err != nil {
+				fmt.Println(err)
+				return
 			}
+			fmt.Printf("Instance %s paused for %d seconds...\n", targetID, seconds)
+			return
+		}
 
-			fmt.Printf("Pausing automation for %d seconds...\n", seconds)
-			mgr.Pause()
+		fmt.Printf("Pausing automation for %d seconds...\n", seconds)
+		mgr.Pause()
+
+		// Start a goroutine to resume after the specified time
+		go func() {
+			time.Sleep(time.Duration(seconds) * time.Second)
+			mgr.Resume()
+			fmt.Printf("Time's up! Automation resumed after %d seconds.\n", seconds)
+		}()
 
-			// Start a goroutine to resume after the specified time
-			go func() {
-				time.Sleep(time.Duration(seconds) * time.Second)
-				mgr.Resume()
-				fmt.Printf("Time's up! Automation resumed after %d seconds.\n", seconds)
-			}()
+	default:
+		fmt.Printf("Unknown command: %q. Type 'h' for help.\n", cmd)
+	}
+}
+
+// runProfile streams timed commands from a script file through
+// dispatchCommand, supporting "sleep <seconds>" pacing and "#" comments.
+// It aborts as soon as kill is closed, so 'q' or SIGINT stops an overnight
+// script cleanly instead of leaving it to keep firing commands.
+func runProfile(mgr *manager.Manager, path string, kill chan struct{}) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("Could not open command profile %s: %v", path, err)
+		return
+	}
+	defer f.Close()
+
+	log.Printf("Running command profile: %s", path)
+	reader := bufio.NewReader(f)
 
+	for {
+		select {
+		case <-kill:
+			log.Printf("Command profile %s aborted", path)
+			return
 		default:
-			fmt.Println("Unknown command. Type 'h' for help.")
 		}
-	}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("Error reading command input: %v", err)
+		line, err := reader.ReadString('\n')
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			if rest, ok := strings.CutPrefix(trimmed, "sleep "); ok {
+				var seconds int
+				if _, serr := fmt.Sscanf(strings.TrimSpace(rest), "%d", &seconds); serr == nil && seconds > 0 {
+					select {
+					case <-time.After(time.Duration(seconds) * time.Second):
+					case <-kill:
+						log.Printf("Command profile %s aborted during sleep", path)
+						return
+					}
+				} else {
+					log.Printf("Invalid sleep duration in profile: %q", trimmed)
+				}
+			} else {
+				log.Printf("Profile command: %s", trimmed)
+				dispatchCommand(mgr, trimmed)
+			}
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Error reading command profile %s: %v", path, err)
+			}
+			log.Printf("Command profile %s finished", path)
+			return
+		}
 	}
 }
 
@@ -150,9 +545,20 @@ func printStatus(mgr *manager.Manager) {
 	fmt.Println("\n=== Automation Status ===")
 	fmt.Printf("Running: %v\n", !mgr.IsPaused())
 
-	for id, instance := range mgr.Instances {
+	for id, instance := range mgr.InstancesSnapshot() {
 		fmt.Printf("\nInstance: %s\n", id)
 		fmt.Printf("  Device ID: %s\n", instance.DeviceID)
+		fmt.Printf("  Lifecycle Phase: %s\n", instance.FSM.State())
+		if until := time.Until(instance.NextActionAt); until > 0 {
+			fmt.Printf("  Next action in: %.0fs\n", until.Seconds())
+		}
+		if pauseState := instance.PauseState(); pauseState.Paused {
+			if pauseState.Until.IsZero() {
+				fmt.Println("  Paused: yes (indefinitely)")
+			} else {
+				fmt.Printf("  Paused: yes (until %s)\n", pauseState.Until.Format(time.Kitchen))
+			}
+		}
 		fmt.Printf("  City Hall Level: %d\n", instance.State.CityHallLevel)
 		fmt.Printf("  Tutorial Completed: %v\n", instance.State.TutorialCompleted)
 		fmt.Printf("  Startup Tasks Completed: %v\n", instance.State.StartupTasksCompleted)
@@ -170,10 +576,11 @@ func printStatus(mgr *manager.Manager) {
 func printHelp() {
 	fmt.Println("\n=== Command Interface Help ===")
 	fmt.Println("Available commands:")
-	fmt.Println("  p - Pause automation")
-	fmt.Println("  r - Resume automation")
+	fmt.Println("  p [id] - Pause automation (optionally, just one instance)")
+	fmt.Println("  r [id] - Resume automation (optionally, just one instance)")
 	fmt.Println("  s - Show status")
-	fmt.Println("  t60 - Pause for 60 seconds (change number as needed)")
+	fmt.Println("  t60 [id] - Pause for 60 seconds (optionally, just one instance)")
+	fmt.Println("  force <id> <task> - Boost a task's score so it runs next for that instance")
 	fmt.Println("  q - Quit")
 	fmt.Println("  h - Show this help message")
 	fmt.Println("\nWhile automation is running, you can use these commands")